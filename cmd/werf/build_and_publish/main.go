@@ -75,6 +75,7 @@ If one or more IMAGE_NAME parameters specified, werf will build images stages an
 	}
 
 	common.SetupDir(&CommonCmdData, cmd)
+	common.SetupConfigValues(&CommonCmdData, cmd)
 	common.SetupTmpDir(&CommonCmdData, cmd)
 	common.SetupHomeDir(&CommonCmdData, cmd)
 	common.SetupSSHKey(&CommonCmdData, cmd)
@@ -86,6 +87,10 @@ If one or more IMAGE_NAME parameters specified, werf will build images stages an
 	common.SetupDockerConfig(&CommonCmdData, cmd, "Command needs granted permissions to read, pull and push images into the specified stages storage, to push images into the specified images repo, to pull base images")
 	common.SetupInsecureRegistry(&CommonCmdData, cmd)
 	common.SetupSkipTlsVerifyRegistry(&CommonCmdData, cmd)
+	common.SetupForcePublish(&CommonCmdData, cmd)
+	common.SetupPublishParallelLayers(&CommonCmdData, cmd)
+	common.SetupPublishBestEffort(&CommonCmdData, cmd)
+	common.SetupProtect(&CommonCmdData, cmd)
 
 	common.SetupLogOptions(&CommonCmdData, cmd)
 	common.SetupLogProjectDir(&CommonCmdData, cmd)
@@ -126,7 +131,7 @@ func runBuildAndPublish(imagesToProcess []string) error {
 
 	common.ProcessLogProjectDir(&CommonCmdData, projectDir)
 
-	werfConfig, err := common.GetWerfConfig(projectDir)
+	werfConfig, err := common.GetWerfConfig(projectDir, &CommonCmdData)
 	if err != nil {
 		return fmt.Errorf("bad config: %s", err)
 	}
@@ -145,27 +150,27 @@ func runBuildAndPublish(imagesToProcess []string) error {
 	}
 	defer tmp_manager.ReleaseProjectDir(projectTmpDir)
 
-	imagesRepo, err := common.GetImagesRepo(projectName, &CommonCmdData)
+	imagesRepoManagers, err := common.GetImagesRepoManagers(projectName, &CommonCmdData)
 	if err != nil {
 		return err
 	}
 
-	imagesRepoMode, err := common.GetImagesRepoMode(&CommonCmdData)
-	if err != nil {
-		return err
+	var buildImagesRepoManagers []build.ImagesRepoManager
+	for _, imagesRepoManager := range imagesRepoManagers {
+		buildImagesRepoManagers = append(buildImagesRepoManagers, imagesRepoManager)
 	}
 
-	imagesRepoManager, err := common.GetImagesRepoManager(imagesRepo, imagesRepoMode)
+	stagesRepo, err := common.GetStagesRepo(&CommonCmdData)
 	if err != nil {
 		return err
 	}
 
-	stagesRepo, err := common.GetStagesRepo(&CommonCmdData)
+	tagOpts, err := common.GetTagOptions(&CommonCmdData, common.TagOptionsGetterOptions{})
 	if err != nil {
 		return err
 	}
 
-	tagOpts, err := common.GetTagOptions(&CommonCmdData, common.TagOptionsGetterOptions{})
+	parallelLayers, err := common.GetPublishParallelLayers(&CommonCmdData)
 	if err != nil {
 		return err
 	}
@@ -194,14 +199,18 @@ func runBuildAndPublish(imagesToProcess []string) error {
 			IntrospectOptions: introspectOptions,
 		},
 		PublishImagesOptions: build.PublishImagesOptions{
-			TagOptions: tagOpts,
+			TagOptions:     tagOpts,
+			ForcePublish:   *CommonCmdData.ForcePublish,
+			ParallelLayers: int(parallelLayers),
+			BestEffort:     *CommonCmdData.PublishBestEffort,
+			Protect:        *CommonCmdData.Protect,
 		},
 	}
 
 	c := build.NewConveyor(werfConfig, imagesToProcess, projectDir, projectTmpDir, ssh_agent.SSHAuthSock)
 	defer c.Terminate()
 
-	if err = c.BuildAndPublish(stagesRepo, imagesRepoManager, opts); err != nil {
+	if err = c.BuildAndPublish(stagesRepo, buildImagesRepoManagers, opts); err != nil {
 		return err
 	}
 
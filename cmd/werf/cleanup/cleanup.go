@@ -3,6 +3,7 @@ package cleanup
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/flant/shluz"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/flant/werf/pkg/werf"
 
 	"github.com/spf13/cobra"
+	"k8s.io/client-go/dynamic"
 )
 
 var CommonCmdData common.CmdData
@@ -47,6 +49,7 @@ It is safe to run this command periodically (daily is enough) by automated clean
 	}
 
 	common.SetupDir(&CommonCmdData, cmd)
+	common.SetupConfigValues(&CommonCmdData, cmd)
 	common.SetupTmpDir(&CommonCmdData, cmd)
 	common.SetupHomeDir(&CommonCmdData, cmd)
 
@@ -56,12 +59,17 @@ It is safe to run this command periodically (daily is enough) by automated clean
 	common.SetupDockerConfig(&CommonCmdData, cmd, "Command needs granted permissions to read, pull and delete images from the specified stages storage and images repo")
 	common.SetupInsecureRegistry(&CommonCmdData, cmd)
 	common.SetupSkipTlsVerifyRegistry(&CommonCmdData, cmd)
+	common.SetupRepoImplementation(&CommonCmdData, cmd)
+	common.SetupRegistryDelete(&CommonCmdData, cmd)
 	common.SetupImagesCleanupPolicies(&CommonCmdData, cmd)
 
 	common.SetupKubeConfig(&CommonCmdData, cmd)
 	common.SetupKubeContext(&CommonCmdData, cmd)
+	common.SetupHelmReleaseStorageNamespace(&CommonCmdData, cmd)
+	common.SetupHelmReleaseStorageType(&CommonCmdData, cmd)
 
 	common.SetupDryRun(&CommonCmdData, cmd)
+	common.SetupCleanupPlan(&CommonCmdData, cmd)
 
 	common.SetupLogOptions(&CommonCmdData, cmd)
 	common.SetupLogProjectDir(&CommonCmdData, cmd)
@@ -80,7 +88,7 @@ func runCleanup() error {
 		return err
 	}
 
-	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *CommonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *CommonCmdData.SkipTlsVerifyRegistry}); err != nil {
+	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *CommonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *CommonCmdData.SkipTlsVerifyRegistry, RepoImplementation: *CommonCmdData.RepoImplementation, QuayToken: common.GetQuayToken()}); err != nil {
 		return err
 	}
 
@@ -109,27 +117,19 @@ func runCleanup() error {
 	}
 	defer tmp_manager.ReleaseProjectDir(projectTmpDir)
 
-	werfConfig, err := common.GetWerfConfig(projectDir)
+	werfConfig, err := common.GetWerfConfig(projectDir, &CommonCmdData)
 	if err != nil {
 		return fmt.Errorf("bad config: %s", err)
 	}
 
 	projectName := werfConfig.Meta.Project
 
-	imagesRepo, err := common.GetImagesRepo(projectName, &CommonCmdData)
+	imagesRepoManagers, err := common.GetImagesRepoManagers(projectName, &CommonCmdData)
 	if err != nil {
 		return err
 	}
 
-	imagesRepoMode, err := common.GetImagesRepoMode(&CommonCmdData)
-	if err != nil {
-		return err
-	}
-
-	imagesRepoManager, err := common.GetImagesRepoManager(imagesRepo, imagesRepoMode)
-	if err != nil {
-		return err
-	}
+	imagesRepoManager := imagesRepoManagers[0]
 
 	stagesRepo, err := common.GetStagesRepo(&CommonCmdData)
 	if err != nil {
@@ -156,7 +156,22 @@ func runCleanup() error {
 		}
 	}
 
-	policies, err := common.GetImagesCleanupPolicies(&CommonCmdData)
+	rules, err := common.GetImagesCleanupRules(werfConfig, &CommonCmdData)
+	if err != nil {
+		return err
+	}
+
+	protectedTags, err := common.GetImagesCleanupProtectedTags(werfConfig)
+	if err != nil {
+		return err
+	}
+
+	plan, applyPlan, err := common.GetCleanupPlans(&CommonCmdData, imagesRepoManagers)
+	if err != nil {
+		return err
+	}
+
+	helmReleaseStorageType, err := common.GetHelmReleaseStorageType(*CommonCmdData.HelmReleaseStorageType)
 	if err != nil {
 		return err
 	}
@@ -166,16 +181,40 @@ func runCleanup() error {
 		return fmt.Errorf("unable to get Kubernetes clusters connections: %s", err)
 	}
 
+	kubernetesResources, err := common.GetImagesCleanupKubernetesResources(werfConfig)
+	if err != nil {
+		return err
+	}
+
+	var kubernetesContextsDynamicClients map[string]dynamic.Interface
+	if len(kubernetesResources) != 0 {
+		kubernetesContextsDynamicClients, err = common.GetAllContextsDynamicClients(common.GetAllContextsDynamicClientsOptions{KubeConfig: *CommonCmdData.KubeConfig})
+		if err != nil {
+			return fmt.Errorf("unable to get Kubernetes clusters connections: %s", err)
+		}
+	}
+
 	imagesCleanupOptions := cleaning.ImagesCleanupOptions{
 		CommonRepoOptions: cleaning.CommonRepoOptions{
 			ImagesRepoManager: imagesRepoManager,
 			ImagesNames:       imagesNames,
 			DryRun:            *CommonCmdData.DryRun,
+			DeleteOptions:     common.GetRepoImagesDeleteOptions(&CommonCmdData),
 		},
-		LocalGit:                  localGitRepo,
-		KubernetesContextsClients: kubernetesContextsClients,
-		WithoutKube:               *CommonCmdData.WithoutKube,
-		Policies:                  policies,
+		LocalGit:                         localGitRepo,
+		KubernetesContextsClients:        kubernetesContextsClients,
+		KubernetesContextsDynamicClients: kubernetesContextsDynamicClients,
+		KubernetesResources:              kubernetesResources,
+		WithoutKube:                      *CommonCmdData.WithoutKube,
+		Rules:                            rules,
+		ProtectedTags:                    protectedTags,
+
+		HelmReleaseStorageNamespace: *CommonCmdData.HelmReleaseStorageNamespace,
+		HelmReleaseStorageType:      helmReleaseStorageType,
+		HelmReleaseRevisions:        werfConfig.Meta.Cleanup.KubernetesWhitelist.HelmReleaseRevisions,
+
+		Plan:      plan,
+		ApplyPlan: applyPlan,
 	}
 
 	stagesCleanupOptions := cleaning.StagesCleanupOptions{
@@ -184,6 +223,7 @@ func runCleanup() error {
 		StagesStorage:     stagesRepo,
 		ImagesNames:       imagesNames,
 		DryRun:            *CommonCmdData.DryRun,
+		DeleteOptions:     common.GetRepoImagesDeleteOptions(&CommonCmdData),
 	}
 
 	cleanupOptions := cleaning.CleanupOptions{
@@ -191,9 +231,39 @@ func runCleanup() error {
 		ImagesCleanupOptions: imagesCleanupOptions,
 	}
 
+	var deleteErrors []string
+
 	logboek.LogOptionalLn()
 	if err := cleaning.Cleanup(cleanupOptions); err != nil {
-		return err
+		if !cleaning.IsRepoImagesDeleteError(err) {
+			return err
+		}
+
+		deleteErrors = append(deleteErrors, err.Error())
+	}
+
+	// the rest images repos are cleaned up independently, stages cleanup is based on the primary images repo
+	for _, mirrorImagesRepoManager := range imagesRepoManagers[1:] {
+		imagesCleanupOptions.CommonRepoOptions.ImagesRepoManager = mirrorImagesRepoManager
+
+		logboek.LogOptionalLn()
+		if err := cleaning.ImagesCleanup(imagesCleanupOptions); err != nil {
+			if !cleaning.IsRepoImagesDeleteError(err) {
+				return fmt.Errorf("images repo %s cleanup failed: %s", mirrorImagesRepoManager.ImagesRepo(), err)
+			}
+
+			deleteErrors = append(deleteErrors, fmt.Sprintf("images repo %s cleanup failed: %s", mirrorImagesRepoManager.ImagesRepo(), err))
+		}
+	}
+
+	if plan != nil {
+		if err := plan.Save(*CommonCmdData.PlanOutput); err != nil {
+			return fmt.Errorf("cannot write cleanup plan %s: %s", *CommonCmdData.PlanOutput, err)
+		}
+	}
+
+	if len(deleteErrors) != 0 {
+		return fmt.Errorf("%s", strings.Join(deleteErrors, "\n"))
 	}
 
 	return nil
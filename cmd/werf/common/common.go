@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"github.com/flant/kubedog/pkg/kube"
 	"github.com/flant/logboek"
@@ -20,21 +22,29 @@ import (
 	cleanup "github.com/flant/werf/pkg/cleaning"
 	"github.com/flant/werf/pkg/config"
 	"github.com/flant/werf/pkg/deploy/helm"
+	"github.com/flant/werf/pkg/deploy/status_stream"
+	"github.com/flant/werf/pkg/docker_registry"
 	"github.com/flant/werf/pkg/logging"
+	"github.com/flant/werf/pkg/tag_strategy"
 	"github.com/flant/werf/pkg/util"
 	"github.com/flant/werf/pkg/werf"
 )
 
 type CmdData struct {
-	Dir     *string
-	TmpDir  *string
-	HomeDir *string
-	SSHKeys *[]string
+	Dir          *string
+	TmpDir       *string
+	HomeDir      *string
+	SSHKeys      *[]string
+	ConfigValues *[]string
+	ConfigSet    *[]string
 
 	TagCustom    *[]string
 	TagGitBranch *string
 	TagGitTag    *string
 	TagGitCommit *string
+	TagBySemver  *string
+
+	TagByStagesSignature *bool
 
 	Environment                      *string
 	Release                          *string
@@ -55,14 +65,26 @@ type CmdData struct {
 	SecretValues    *[]string
 	IgnoreSecretKey *bool
 
-	StagesStorage  *string
-	ImagesRepo     *string
-	ImagesRepoMode *string
+	StagesStorage         *string
+	ImagesRepo            *[]string
+	ImagesRepoMode        *[]string
+	ImagesRepoTemplate    *string
+	ImagesRepoTagTemplate *string
 
 	DockerConfig          *string
 	InsecureRegistry      *bool
 	SkipTlsVerifyRegistry *bool
+	RepoImplementation    *string
 	DryRun                *bool
+	ForcePublish          *bool
+
+	RegistryDeleteConcurrency *int64
+	RegistryDeleteRateLimit   *int64
+	FailFast                  *bool
+
+	PublishParallelLayers *int64
+	PublishBestEffort     *bool
+	Protect               *bool
 
 	GitTagStrategyLimit         *int64
 	GitTagStrategyExpiryDays    *int64
@@ -71,6 +93,9 @@ type CmdData struct {
 
 	WithoutKube *bool
 
+	PlanOutput *string
+	ApplyPlan  *string
+
 	StagesToIntrospect *[]string
 
 	LogPretty        *bool
@@ -79,6 +104,10 @@ type CmdData struct {
 	LogTerminalWidth *int64
 
 	ThreeWayMergeMode *string
+
+	StatusOutput *string
+
+	PostRenderer *string
 }
 
 const (
@@ -94,6 +123,14 @@ func SetupDir(cmdData *CmdData, cmd *cobra.Command) {
 	cmd.Flags().StringVarP(cmdData.Dir, "dir", "", "", "Change to the specified directory to find werf.yaml config")
 }
 
+func SetupConfigValues(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.ConfigValues = new([]string)
+	cmd.Flags().StringArrayVarP(cmdData.ConfigValues, "config-values", "", []string{}, fmt.Sprintf("Specify werf.yaml values in a YAML file, available as .Values in werf.yaml templates (can specify multiple, %s is used by default)", config.DefaultWerfConfigValuesPath))
+
+	cmdData.ConfigSet = new([]string)
+	cmd.Flags().StringArrayVarP(cmdData.ConfigSet, "config-set", "", []string{}, "Set werf.yaml values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+}
+
 func SetupTmpDir(cmdData *CmdData, cmd *cobra.Command) {
 	cmdData.TmpDir = new(string)
 	cmd.Flags().StringVarP(cmdData.TmpDir, "tmp-dir", "", "", "Use specified dir to store tmp files and dirs (default $WERF_TMP_DIR or system tmp dir)")
@@ -115,10 +152,10 @@ func SetupImagesCleanupPolicies(cmdData *CmdData, cmd *cobra.Command) {
 	cmdData.GitCommitStrategyLimit = new(int64)
 	cmdData.GitCommitStrategyExpiryDays = new(int64)
 
-	cmd.Flags().Int64VarP(cmdData.GitTagStrategyLimit, "git-tag-strategy-limit", "", -1, "Keep max number of images published with the git-tag tagging strategy in the images repo. No limit by default, -1 disables the limit. Value can be specified by the $WERF_GIT_TAG_STRATEGY_LIMIT")
-	cmd.Flags().Int64VarP(cmdData.GitTagStrategyExpiryDays, "git-tag-strategy-expiry-days", "", -1, "Keep images published with the git-tag tagging strategy in the images repo for the specified maximum days since image published. Republished image will be kept specified maximum days since new publication date. No days limit by default, -1 disables the limit. Value can be specified by the $WERF_GIT_TAG_STRATEGY_EXPIRY_DAYS")
-	cmd.Flags().Int64VarP(cmdData.GitCommitStrategyLimit, "git-commit-strategy-limit", "", -1, "Keep max number of images published with the git-commit tagging strategy in the images repo. No limit by default, -1 disables the limit. Value can be specified by the $WERF_GIT_COMMIT_STRATEGY_LIMIT")
-	cmd.Flags().Int64VarP(cmdData.GitCommitStrategyExpiryDays, "git-commit-strategy-expiry-days", "", -1, "Keep images published with the git-commit tagging strategy in the images repo for the specified maximum days since image published. Republished image will be kept specified maximum days since new publication date. No days limit by default, -1 disables the limit. Value can be specified by the $WERF_GIT_COMMIT_STRATEGY_EXPIRY_DAYS")
+	cmd.Flags().Int64VarP(cmdData.GitTagStrategyLimit, "git-tag-strategy-limit", "", -1, "Keep max number of images published with the git-tag tagging strategy in the images repo. No limit by default, -1 disables the limit. Value can be specified by the $WERF_GIT_TAG_STRATEGY_LIMIT. The option is ignored if cleanup rules are defined in werf.yaml")
+	cmd.Flags().Int64VarP(cmdData.GitTagStrategyExpiryDays, "git-tag-strategy-expiry-days", "", -1, "Keep images published with the git-tag tagging strategy in the images repo for the specified maximum days since image published. Republished image will be kept specified maximum days since new publication date. No days limit by default, -1 disables the limit. Value can be specified by the $WERF_GIT_TAG_STRATEGY_EXPIRY_DAYS. The option is ignored if cleanup rules are defined in werf.yaml")
+	cmd.Flags().Int64VarP(cmdData.GitCommitStrategyLimit, "git-commit-strategy-limit", "", -1, "Keep max number of images published with the git-commit tagging strategy in the images repo. No limit by default, -1 disables the limit. Value can be specified by the $WERF_GIT_COMMIT_STRATEGY_LIMIT. The option is ignored if cleanup rules are defined in werf.yaml")
+	cmd.Flags().Int64VarP(cmdData.GitCommitStrategyExpiryDays, "git-commit-strategy-expiry-days", "", -1, "Keep images published with the git-commit tagging strategy in the images repo for the specified maximum days since image published. Republished image will be kept specified maximum days since new publication date. No days limit by default, -1 disables the limit. Value can be specified by the $WERF_GIT_COMMIT_STRATEGY_EXPIRY_DAYS. The option is ignored if cleanup rules are defined in werf.yaml")
 }
 
 func SetupWithoutKube(cmdData *CmdData, cmd *cobra.Command) {
@@ -126,6 +163,14 @@ func SetupWithoutKube(cmdData *CmdData, cmd *cobra.Command) {
 	cmd.Flags().BoolVarP(cmdData.WithoutKube, "without-kube", "", GetBoolEnvironment("WERF_WITHOUT_KUBE"), "Do not skip deployed Kubernetes images (default $WERF_KUBE_CONTEXT)")
 }
 
+func SetupCleanupPlan(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.PlanOutput = new(string)
+	cmdData.ApplyPlan = new(string)
+
+	cmd.Flags().StringVarP(cmdData.PlanOutput, "plan-output", "", os.Getenv("WERF_PLAN_OUTPUT"), "Write the decision with the reason for each considered images repo image into the specified file (JSON, or YAML for .yaml and .yml extensions; default $WERF_PLAN_OUTPUT). Use with --dry-run to review the plan before deleting")
+	cmd.Flags().StringVarP(cmdData.ApplyPlan, "apply-plan", "", os.Getenv("WERF_APPLY_PLAN"), "Delete exactly the images to delete from the specified plan file instead of using cleanup policies (default $WERF_APPLY_PLAN). Nothing is deleted if any image has changed since the plan was made")
+}
+
 func SetupTag(cmdData *CmdData, cmd *cobra.Command) {
 	var tagCustom []string
 	for _, keyValue := range os.Environ() {
@@ -139,11 +184,15 @@ func SetupTag(cmdData *CmdData, cmd *cobra.Command) {
 	cmdData.TagGitBranch = new(string)
 	cmdData.TagGitTag = new(string)
 	cmdData.TagGitCommit = new(string)
+	cmdData.TagBySemver = new(string)
+	cmdData.TagByStagesSignature = new(bool)
 
 	cmd.Flags().StringArrayVarP(cmdData.TagCustom, "tag-custom", "", tagCustom, "Use custom tagging strategy and tag by the specified arbitrary tags.\nOption can be used multiple times to produce multiple images with the specified tags.\nAlso can be specified in $WERF_TAG_CUSTOM* (e.g. $WERF_TAG_CUSTOM_TAG1=tag1, $WERF_TAG_CUSTOM_TAG2=tag2)")
 	cmd.Flags().StringVarP(cmdData.TagGitBranch, "tag-git-branch", "", os.Getenv("WERF_TAG_GIT_BRANCH"), "Use git-branch tagging strategy and tag by the specified git branch (option can be enabled by specifying git branch in the $WERF_TAG_GIT_BRANCH)")
 	cmd.Flags().StringVarP(cmdData.TagGitTag, "tag-git-tag", "", os.Getenv("WERF_TAG_GIT_TAG"), "Use git-tag tagging strategy and tag by the specified git tag (option can be enabled by specifying git tag in the $WERF_TAG_GIT_TAG)")
 	cmd.Flags().StringVarP(cmdData.TagGitCommit, "tag-git-commit", "", os.Getenv("WERF_TAG_GIT_COMMIT"), "Use git-commit tagging strategy and tag by the specified git commit hash (option can be enabled by specifying git commit hash in the $WERF_TAG_GIT_COMMIT)")
+	cmd.Flags().StringVarP(cmdData.TagBySemver, "tag-by-semver", "", os.Getenv("WERF_TAG_BY_SEMVER"), "Use git-semver tagging strategy and tag by the semantic version from the specified git tag (e.g. v1.4.2 produces tags 1.4.2, 1.4, 1 and latest, floating tags are moved only for the highest version in the line).\nOption can be enabled by specifying git tag in the $WERF_TAG_BY_SEMVER")
+	cmd.Flags().BoolVarP(cmdData.TagByStagesSignature, "tag-by-stages-signature", "", GetBoolEnvironment("WERF_TAG_BY_STAGES_SIGNATURE"), "Use stages-signature tagging strategy and tag each image by the signature of its last stage, publishing is skipped when the tag already exists (default $WERF_TAG_BY_STAGES_SIGNATURE)")
 }
 
 func SetupEnvironment(cmdData *CmdData, cmd *cobra.Command) {
@@ -296,19 +345,36 @@ func hooksStatusProgressPeriodDefaultValue() *int64 {
 }
 
 func SetupImagesRepo(cmdData *CmdData, cmd *cobra.Command) {
-	cmdData.ImagesRepo = new(string)
-	cmd.Flags().StringVarP(cmdData.ImagesRepo, "images-repo", "i", os.Getenv("WERF_IMAGES_REPO"), "Docker Repo to store images (default $WERF_IMAGES_REPO)")
+	cmdData.ImagesRepo = new([]string)
+
+	var defaultValue []string
+	if v := os.Getenv("WERF_IMAGES_REPO"); v != "" {
+		defaultValue = []string{v}
+	}
+
+	cmd.Flags().StringArrayVarP(cmdData.ImagesRepo, "images-repo", "i", defaultValue, `Docker Repo to store images (default $WERF_IMAGES_REPO).
+The option can be specified multiple times: images are published into each repo and each repo is cleaned up independently.
+The first repo is the primary one, it is used by the commands that work with a single repo (e.g. deploy)`)
 }
 
 func SetupImagesRepoMode(cmdData *CmdData, cmd *cobra.Command) {
-	cmdData.ImagesRepoMode = new(string)
+	cmdData.ImagesRepoMode = new([]string)
 
 	defaultValue := os.Getenv("WERF_IMAGES_REPO_MODE")
 	if defaultValue == "" {
 		defaultValue = MultirepoImagesRepoMode
 	}
 
-	cmd.Flags().StringVarP(cmdData.ImagesRepoMode, "images-repo-mode", "", defaultValue, fmt.Sprintf(`Define how to store images in Repo: %[1]s or %[2]s (defaults to $WERF_IMAGES_REPO_MODE or %[1]s)`, MultirepoImagesRepoMode, MonorepoImagesRepoMode))
+	cmd.Flags().StringArrayVarP(cmdData.ImagesRepoMode, "images-repo-mode", "", []string{defaultValue}, fmt.Sprintf(`Define how to store images in Repo: %[1]s, %[2]s or %[3]s (defaults to $WERF_IMAGES_REPO_MODE or %[1]s).
+The option can be specified for each --images-repo in the same order, a single value is used for all repos`, MultirepoImagesRepoMode, MonorepoImagesRepoMode, TemplateImagesRepoMode))
+
+	cmdData.ImagesRepoTemplate = new(string)
+	cmd.Flags().StringVarP(cmdData.ImagesRepoTemplate, "images-repo-template", "", os.Getenv("WERF_IMAGES_REPO_TEMPLATE"), fmt.Sprintf(`Go template of the image repository for %s images repo mode.
+.Repo, .Project, .Image and .Env ($WERF_ENV or --env) values can be used (defaults to $WERF_IMAGES_REPO_TEMPLATE or IMAGES_REPO/IMAGE_NAME)`, TemplateImagesRepoMode))
+
+	cmdData.ImagesRepoTagTemplate = new(string)
+	cmd.Flags().StringVarP(cmdData.ImagesRepoTagTemplate, "images-repo-tag-template", "", os.Getenv("WERF_IMAGES_REPO_TAG_TEMPLATE"), fmt.Sprintf(`Go template of the image tag for %s images repo mode.
+.Repo, .Project, .Image, .Tag and .Env ($WERF_ENV or --env) values can be used (defaults to $WERF_IMAGES_REPO_TAG_TEMPLATE or TAG)`, TemplateImagesRepoMode))
 }
 
 func SetupInsecureRegistry(cmdData *CmdData, cmd *cobra.Command) {
@@ -327,6 +393,56 @@ func SetupSkipTlsVerifyRegistry(cmdData *CmdData, cmd *cobra.Command) {
 	}
 }
 
+func SetupRepoImplementation(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.RepoImplementation = new(string)
+	cmd.Flags().StringVarP(cmdData.RepoImplementation, "repo-implementation", "", os.Getenv("WERF_REPO_IMPLEMENTATION"), fmt.Sprintf("Registry implementation to delete tags with: %s (default $WERF_REPO_IMPLEMENTATION or detected by the registry host). The quay implementation requires the Quay API OAuth token in $WERF_QUAY_TOKEN", strings.Join(docker_registry.ImplementationNames, ", ")))
+}
+
+func SetupRegistryDelete(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.RegistryDeleteConcurrency = new(int64)
+	cmdData.RegistryDeleteRateLimit = new(int64)
+	cmdData.FailFast = new(bool)
+
+	concurrency, err := getInt64EnvVar("WERF_REGISTRY_DELETE_CONCURRENCY")
+	if err != nil {
+		TerminateWithError(err.Error(), 1)
+	}
+
+	defaultConcurrency := int64(1)
+	if concurrency != nil {
+		defaultConcurrency = *concurrency
+	}
+
+	rateLimit, err := getInt64EnvVar("WERF_REGISTRY_DELETE_RATE_LIMIT")
+	if err != nil {
+		TerminateWithError(err.Error(), 1)
+	}
+
+	var defaultRateLimit int64
+	if rateLimit != nil {
+		defaultRateLimit = *rateLimit
+	}
+
+	cmd.Flags().Int64VarP(cmdData.RegistryDeleteConcurrency, "registry-delete-concurrency", "", defaultConcurrency, "Number of images deleted from the registry in parallel (default $WERF_REGISTRY_DELETE_CONCURRENCY or 1)")
+	cmd.Flags().Int64VarP(cmdData.RegistryDeleteRateLimit, "registry-delete-rate-limit", "", defaultRateLimit, "Max number of registry deletion requests per second, 0 disables the limit (default $WERF_REGISTRY_DELETE_RATE_LIMIT or 0)")
+	cmd.Flags().BoolVarP(cmdData.FailFast, "fail-fast", "", GetBoolEnvironment("WERF_FAIL_FAST"), `Abort on the first image that cannot be deleted from the registry (default $WERF_FAIL_FAST).
+By default deletions are retried on 429 and 5xx registry responses, failed deletions are reported after the cleanup and do not abort it`)
+}
+
+// GetRepoImagesDeleteOptions returns the options of registry deletion
+func GetRepoImagesDeleteOptions(cmdData *CmdData) cleanup.RepoImagesDeleteOptions {
+	return cleanup.RepoImagesDeleteOptions{
+		Concurrency: int(*cmdData.RegistryDeleteConcurrency),
+		RateLimit:   float64(*cmdData.RegistryDeleteRateLimit),
+		FailFast:    *cmdData.FailFast,
+	}
+}
+
+// GetQuayToken returns the Quay API OAuth token, which is used to delete tags in Quay
+func GetQuayToken() string {
+	return os.Getenv("WERF_QUAY_TOKEN")
+}
+
 func SetupDryRun(cmdData *CmdData, cmd *cobra.Command) {
 	cmdData.DryRun = new(bool)
 	cmd.Flags().BoolVarP(cmdData.DryRun, "dry-run", "", false, "Indicate what the command would do without actually doing that")
@@ -417,11 +533,39 @@ func SetupIgnoreSecretKey(cmdData *CmdData, cmd *cobra.Command) {
 	cmd.Flags().BoolVarP(cmdData.IgnoreSecretKey, "ignore-secret-key", "", GetBoolEnvironment("WERF_IGNORE_SECRET_KEY"), "Disable secrets decryption (default $WERF_IGNORE_SECRET_KEY)")
 }
 
+func SetupPostRenderer(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.PostRenderer = new(string)
+	cmd.Flags().StringVarP(cmdData.PostRenderer, "post-renderer", "", os.Getenv("WERF_POST_RENDERER"), `Pipe the rendered manifests through the executable before they are stored in the release and applied (default $WERF_POST_RENDERER or deploy.postRenderer from werf.yaml).
+The executable receives all manifests on stdin and should print the modified manifests to stdout`)
+}
+
 func SetupLogProjectDir(cmdData *CmdData, cmd *cobra.Command) {
 	cmdData.LogProjectDir = new(bool)
 	cmd.Flags().BoolVarP(cmdData.LogProjectDir, "log-project-dir", "", GetBoolEnvironment("WERF_LOG_PROJECT_DIR"), `Print current project directory path (default $WERF_LOG_PROJECT_DIR)`)
 }
 
+func SetupForcePublish(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.ForcePublish = new(bool)
+	cmd.Flags().BoolVarP(cmdData.ForcePublish, "force-publish", "", GetBoolEnvironment("WERF_FORCE_PUBLISH"), "Publish image even if the tag in the images repo already holds the same image (default $WERF_FORCE_PUBLISH)")
+}
+
+func SetupPublishParallelLayers(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.PublishParallelLayers = new(int64)
+	cmd.Flags().Int64VarP(cmdData.PublishParallelLayers, "publish-parallel-layers", "", docker_registry.DefaultPushParallelLayers, "Max number of layers uploaded in parallel when publishing an image, 0 disables the limit. Value can be specified by the $WERF_PUBLISH_PARALLEL_LAYERS")
+}
+
+func SetupPublishBestEffort(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.PublishBestEffort = new(bool)
+	cmd.Flags().BoolVarP(cmdData.PublishBestEffort, "publish-best-effort", "", GetBoolEnvironment("WERF_PUBLISH_BEST_EFFORT"), `Continue publishing into the other images repos when publishing into one of them failed, failures are reported in the publish summary (default $WERF_PUBLISH_BEST_EFFORT).
+By default access to all images repos is checked before publishing and publishing stops on the first error`)
+}
+
+func SetupProtect(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.Protect = new(bool)
+	cmd.Flags().BoolVarP(cmdData.Protect, "protect", "", GetBoolEnvironment("WERF_PROTECT"), `Protect published images from cleanup, already published up-to-date tags are protected too (default $WERF_PROTECT).
+Protection can be removed with the werf images unprotect command`)
+}
+
 func SetupIntrospectStage(cmdData *CmdData, cmd *cobra.Command) {
 	cmdData.StagesToIntrospect = new([]string)
 	cmd.Flags().StringArrayVarP(cmdData.StagesToIntrospect, "introspect-stage", "", []string{}, `Introspect a specific stage. The option can be used multiple times to introspect several stages.
@@ -457,6 +601,72 @@ func SetupThreeWayMergeMode(cmdData *CmdData, cmd *cobra.Command) {
 Supported 'enabled', 'disabled' and 'onlyNewReleases', see docs for more info https://werf.io/documentation/reference/deploy_process/experimental_three_way_merge.html`)
 }
 
+func SetupStatusOutput(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.StatusOutput = new(string)
+	cmd.Flags().StringVarP(cmdData.StatusOutput, "status-output", "", os.Getenv("WERF_STATUS_OUTPUT"), `Emit release phases and resources states as newline-delimited json events (default $WERF_STATUS_OUTPUT).
+json-stream writes events to stdout instead of the human-readable log, json-stream=FILE writes events into the FILE`)
+}
+
+// ProcessStatusOutput enables the status stream, it should be called before kubedog initialization to mute the human-readable output properly.
+// The status output file is returned for json-stream=FILE, the command owns the file and must pass it to CloseStatusOutput
+func ProcessStatusOutput(cmdData *CmdData) (*os.File, error) {
+	statusOutput := *cmdData.StatusOutput
+
+	switch {
+	case statusOutput == "":
+	case statusOutput == "json-stream":
+		logboek.MuteOut()
+		status_stream.Init(os.Stdout)
+	case strings.HasPrefix(statusOutput, "json-stream="):
+		path := strings.TrimPrefix(statusOutput, "json-stream=")
+		if path == "" {
+			return nil, fmt.Errorf("bad status output '%s': file path expected after json-stream=", statusOutput)
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create status output file %s: %s", path, err)
+		}
+
+		status_stream.Init(f)
+
+		return f, nil
+	default:
+		return nil, fmt.Errorf("bad status output '%s': json-stream and json-stream=FILE are supported", statusOutput)
+	}
+
+	return nil, nil
+}
+
+// CloseStatusOutput disables the status stream, syncs and closes the status output file if any.
+// The error of writing the events is returned as well
+func CloseStatusOutput(f *os.File) error {
+	writeErr := status_stream.WriteError()
+	status_stream.Init(nil)
+
+	if f == nil {
+		if writeErr != nil {
+			return fmt.Errorf("unable to write status output: %s", writeErr)
+		}
+
+		return nil
+	}
+
+	syncErr := f.Sync()
+	closeErr := f.Close()
+
+	switch {
+	case writeErr != nil:
+		return fmt.Errorf("unable to write status output file %s: %s", f.Name(), writeErr)
+	case syncErr != nil:
+		return fmt.Errorf("unable to sync status output file %s: %s", f.Name(), syncErr)
+	case closeErr != nil:
+		return fmt.Errorf("unable to close status output file %s: %s", f.Name(), closeErr)
+	}
+
+	return nil
+}
+
 func GetThreeWayMergeMode(threeWayMergeModeParam string) (helm.ThreeWayMergeModeType, error) {
 	switch threeWayMergeModeParam {
 	case "enabled", "disabled", "onlyNewReleases", "":
@@ -571,47 +781,181 @@ func GetGitCommitStrategyExpiryDays(cmdData *CmdData) (int64, error) {
 	return *cmdData.GitCommitStrategyExpiryDays, nil
 }
 
-func GetImagesCleanupPolicies(cmdData *CmdData) (cleanup.ImagesCleanupPolicies, error) {
+func GetPublishParallelLayers(cmdData *CmdData) (int64, error) {
+	v, err := getInt64EnvVar("WERF_PUBLISH_PARALLEL_LAYERS")
+	if err != nil {
+		return 0, err
+	}
+	if v != nil {
+		return *v, nil
+	}
+	return *cmdData.PublishParallelLayers, nil
+}
+
+// GetCleanupPlans returns the plan to fill, if --plan-output is specified, and the plan to apply, if --apply-plan is specified
+func GetCleanupPlans(cmdData *CmdData, imagesRepoManagers []*ImagesRepoManager) (*cleanup.CleanupPlan, *cleanup.CleanupPlan, error) {
+	if *cmdData.PlanOutput != "" && *cmdData.ApplyPlan != "" {
+		return nil, nil, fmt.Errorf("--plan-output and --apply-plan cannot be used together")
+	}
+
+	if *cmdData.PlanOutput != "" {
+		return cleanup.NewCleanupPlan(), nil, nil
+	}
+
+	if *cmdData.ApplyPlan == "" {
+		return nil, nil, nil
+	}
+
+	applyPlan, err := cleanup.LoadCleanupPlan(*cmdData.ApplyPlan)
+	if err != nil {
+		return nil, nil, err
+	}
+
+Loop:
+	for _, planImagesRepo := range applyPlan.ImagesRepos {
+		for _, imagesRepoManager := range imagesRepoManagers {
+			if imagesRepoManager.ImagesRepo() == planImagesRepo.ImagesRepo {
+				continue Loop
+			}
+		}
+
+		return nil, nil, fmt.Errorf("cleanup plan images repo %s is not specified by --images-repo", planImagesRepo.ImagesRepo)
+	}
+
+	return nil, applyPlan, nil
+}
+
+// GetImagesCleanupKubernetesResources returns kinds of objects from werf.yaml, which images are kept during cleanup
+func GetImagesCleanupKubernetesResources(werfConfig *config.WerfConfig) ([]cleanup.KubernetesResource, error) {
+	var resources []cleanup.KubernetesResource
+	for _, configResource := range werfConfig.Meta.Cleanup.KubernetesWhitelist.Resources {
+		groupVersion, err := schema.ParseGroupVersion(configResource.ApiVersion)
+		if err != nil {
+			return nil, fmt.Errorf("bad cleanup kubernetes whitelist resource apiVersion '%s': %s", configResource.ApiVersion, err)
+		}
+
+		resources = append(resources, cleanup.KubernetesResource{
+			GroupVersionKind: groupVersion.WithKind(configResource.Kind),
+			ImagePaths:       configResource.ImagePaths,
+		})
+	}
+
+	return resources, nil
+}
+
+// GetImagesCleanupProtectedTags returns patterns of the tags protected from cleanup in werf.yaml
+func GetImagesCleanupProtectedTags(werfConfig *config.WerfConfig) ([]*regexp.Regexp, error) {
+	var protectedTags []*regexp.Regexp
+	for _, pattern := range werfConfig.Meta.Cleanup.ProtectedTags {
+		protectedTag, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		protectedTags = append(protectedTags, protectedTag)
+	}
+
+	return protectedTags, nil
+}
+
+// GetImagesCleanupRules returns cleanup rules defined in werf.yaml.
+// Without rules in werf.yaml the rules are formed by the git-tag and git-commit strategies policies options
+func GetImagesCleanupRules(werfConfig *config.WerfConfig, cmdData *CmdData) ([]cleanup.ImagesCleanupRule, error) {
 	tagLimit, err := GetGitTagStrategyLimit(cmdData)
 	if err != nil {
-		return cleanup.ImagesCleanupPolicies{}, err
+		return nil, err
 	}
 
 	tagDays, err := GetGitTagStrategyExpiryDays(cmdData)
 	if err != nil {
-		return cleanup.ImagesCleanupPolicies{}, err
+		return nil, err
 	}
 
 	commitLimit, err := GetGitCommitStrategyLimit(cmdData)
 	if err != nil {
-		return cleanup.ImagesCleanupPolicies{}, err
+		return nil, err
 	}
 
 	commitDays, err := GetGitCommitStrategyExpiryDays(cmdData)
 	if err != nil {
-		return cleanup.ImagesCleanupPolicies{}, err
+		return nil, err
 	}
 
-	res := cleanup.ImagesCleanupPolicies{}
+	if len(werfConfig.Meta.Cleanup.Rules) != 0 {
+		if tagLimit >= 0 || tagDays >= 0 || commitLimit >= 0 || commitDays >= 0 {
+			logboek.LogErrorLn("WARNING: Cleanup rules are defined in werf.yaml, git-tag and git-commit strategies policies options are ignored")
+		}
 
-	if tagLimit >= 0 {
-		res.GitTagStrategyHasLimit = true
-		res.GitTagStrategyLimit = tagLimit
-	}
-	if tagDays >= 0 {
-		res.GitTagStrategyHasExpiryPeriod = true
-		res.GitTagStrategyExpiryPeriod = time.Hour * 24 * time.Duration(tagDays)
+		var rules []cleanup.ImagesCleanupRule
+		for ind, configRule := range werfConfig.Meta.Cleanup.Rules {
+			rule := cleanup.ImagesCleanupRule{
+				Description:   fmt.Sprintf("cleanup.rules[%d]", ind),
+				TagStrategies: configRule.TagStrategies,
+				ImageNames:    configRule.ImageNames,
+			}
+
+			if configRule.References != "" {
+				rule.References, err = regexp.Compile(configRule.References)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			if configRule.KeepLast != nil {
+				rule.HasKeepLast = true
+				rule.KeepLast = int64(*configRule.KeepLast)
+			}
+
+			if configRule.KeepNewerThan != nil {
+				rule.HasKeepNewerThan = true
+				rule.KeepNewerThan = *configRule.KeepNewerThan
+			}
+
+			rules = append(rules, rule)
+		}
+
+		return rules, nil
 	}
-	if commitLimit >= 0 {
-		res.GitCommitStrategyHasLimit = true
-		res.GitCommitStrategyLimit = commitLimit
+
+	var rules []cleanup.ImagesCleanupRule
+
+	if tagLimit >= 0 || tagDays >= 0 {
+		rule := cleanup.ImagesCleanupRule{
+			Description:   "git-tag strategy policies",
+			TagStrategies: []string{string(tag_strategy.GitTag), string(tag_strategy.GitSemver)},
+		}
+
+		if tagLimit >= 0 {
+			rule.HasKeepLast = true
+			rule.KeepLast = tagLimit
+		}
+		if tagDays >= 0 {
+			rule.HasKeepNewerThan = true
+			rule.KeepNewerThan = time.Hour * 24 * time.Duration(tagDays)
+		}
+
+		rules = append(rules, rule)
 	}
-	if commitDays >= 0 {
-		res.GitCommitStrategyHasExpiryPeriod = true
-		res.GitCommitStrategyExpiryPeriod = time.Hour * 24 * time.Duration(commitDays)
+
+	if commitLimit >= 0 || commitDays >= 0 {
+		rule := cleanup.ImagesCleanupRule{
+			Description:   "git-commit strategy policies",
+			TagStrategies: []string{string(tag_strategy.GitCommit)},
+		}
+
+		if commitLimit >= 0 {
+			rule.HasKeepLast = true
+			rule.KeepLast = commitLimit
+		}
+		if commitDays >= 0 {
+			rule.HasKeepNewerThan = true
+			rule.KeepNewerThan = time.Hour * 24 * time.Duration(commitDays)
+		}
+
+		rules = append(rules, rule)
 	}
 
-	return res, nil
+	return rules, nil
 }
 
 func GetStagesRepo(cmdData *CmdData) (string, error) {
@@ -624,24 +968,106 @@ func GetStagesRepo(cmdData *CmdData) (string, error) {
 }
 
 func GetImagesRepo(projectName string, cmdData *CmdData) (string, error) {
-	if *cmdData.ImagesRepo == "" {
+	if len(*cmdData.ImagesRepo) == 0 {
 		return "", fmt.Errorf("--images-repo REPO param required")
 	}
 	return GetOptionalImagesRepo(projectName, cmdData)
 }
 
+// GetImagesRepoMode returns the mode of the primary images repo
 func GetImagesRepoMode(cmdData *CmdData) (string, error) {
-	switch *cmdData.ImagesRepoMode {
-	case MultirepoImagesRepoMode, MonorepoImagesRepoMode:
-		return *cmdData.ImagesRepoMode, nil
-	default:
-		return "", fmt.Errorf("bad --images-repo-mode '%s': only %s or %s supported", *cmdData.ImagesRepoMode, MultirepoImagesRepoMode, MonorepoImagesRepoMode)
+	imagesReposModes, err := getImagesReposModes(cmdData)
+	if err != nil {
+		return "", err
 	}
+
+	return imagesReposModes[0], nil
 }
 
+// GetOptionalImagesRepo returns the primary images repo (the first --images-repo) or empty string
 func GetOptionalImagesRepo(projectName string, cmdData *CmdData) (string, error) {
-	repoOption := *cmdData.ImagesRepo
+	if len(*cmdData.ImagesRepo) == 0 {
+		return "", nil
+	}
+
+	return getImagesRepo(projectName, (*cmdData.ImagesRepo)[0])
+}
+
+// GetImagesRepoManagers returns managers for all specified images repos, the primary images repo manager is the first
+func GetImagesRepoManagers(projectName string, cmdData *CmdData) ([]*ImagesRepoManager, error) {
+	if len(*cmdData.ImagesRepo) == 0 {
+		return nil, fmt.Errorf("--images-repo REPO param required")
+	}
+
+	imagesReposModes, err := getImagesReposModes(cmdData)
+	if err != nil {
+		return nil, err
+	}
+
+	var imagesRepoManagers []*ImagesRepoManager
+	for ind, repoOption := range *cmdData.ImagesRepo {
+		imagesRepo, err := getImagesRepo(projectName, repoOption)
+		if err != nil {
+			return nil, err
+		}
+
+		imagesRepoMode := imagesReposModes[0]
+		if len(imagesReposModes) > 1 {
+			imagesRepoMode = imagesReposModes[ind]
+		}
+
+		imagesRepoManager, err := GetImagesRepoManagerByMode(projectName, imagesRepo, imagesRepoMode, cmdData)
+		if err != nil {
+			return nil, err
+		}
+
+		imagesRepoManagers = append(imagesRepoManagers, imagesRepoManager)
+	}
+
+	return imagesRepoManagers, nil
+}
+
+// GetImagesRepoManagerByMode returns images repo manager for any images repo mode, templates for the template mode are taken from the options
+func GetImagesRepoManagerByMode(projectName, imagesRepo, imagesRepoMode string, cmdData *CmdData) (*ImagesRepoManager, error) {
+	if imagesRepoMode != TemplateImagesRepoMode {
+		return GetImagesRepoManager(imagesRepo, imagesRepoMode)
+	}
+
+	env := os.Getenv("WERF_ENV")
+	if cmdData.Environment != nil {
+		env = *cmdData.Environment
+	}
 
+	return GetTemplateImagesRepoManager(imagesRepo, ImagesRepoTemplateOptions{
+		RepoTemplate: *cmdData.ImagesRepoTemplate,
+		TagTemplate:  *cmdData.ImagesRepoTagTemplate,
+		Project:      projectName,
+		Env:          env,
+	})
+}
+
+func getImagesReposModes(cmdData *CmdData) ([]string, error) {
+	imagesReposModes := *cmdData.ImagesRepoMode
+	if len(imagesReposModes) == 0 {
+		imagesReposModes = []string{MultirepoImagesRepoMode}
+	}
+
+	if len(imagesReposModes) > 1 && len(imagesReposModes) != len(*cmdData.ImagesRepo) {
+		return nil, fmt.Errorf("--images-repo-mode should be specified once or for each --images-repo: got %d modes for %d repos", len(imagesReposModes), len(*cmdData.ImagesRepo))
+	}
+
+	for _, imagesRepoMode := range imagesReposModes {
+		switch imagesRepoMode {
+		case MultirepoImagesRepoMode, MonorepoImagesRepoMode, TemplateImagesRepoMode:
+		default:
+			return nil, fmt.Errorf("bad --images-repo-mode '%s': only %s, %s or %s supported", imagesRepoMode, MultirepoImagesRepoMode, MonorepoImagesRepoMode, TemplateImagesRepoMode)
+		}
+	}
+
+	return imagesReposModes, nil
+}
+
+func getImagesRepo(projectName, repoOption string) (string, error) {
 	if repoOption == ":minikube" {
 		return fmt.Sprintf("werf-registry.kube-system.svc.cluster.local:5000/%s", projectName), nil
 	} else if repoOption != "" {
@@ -656,13 +1082,21 @@ func GetOptionalImagesRepo(projectName string, cmdData *CmdData) (string, error)
 	return "", nil
 }
 
-func GetWerfConfig(projectDir string) (*config.WerfConfig, error) {
+func GetWerfConfig(projectDir string, cmdData *CmdData) (*config.WerfConfig, error) {
 	werfConfigPath, err := GetWerfConfigPath(projectDir)
 	if err != nil {
 		return nil, err
 	}
 
-	return config.GetWerfConfig(werfConfigPath, true)
+	return config.GetWerfConfig(werfConfigPath, GetWerfConfigOptions(cmdData, true))
+}
+
+func GetWerfConfigOptions(cmdData *CmdData, logRenderedFilePath bool) config.WerfConfigOptions {
+	return config.WerfConfigOptions{
+		LogRenderedFilePath: logRenderedFilePath,
+		ValuesPaths:         *cmdData.ConfigValues,
+		SetValues:           *cmdData.ConfigSet,
+	}
 }
 
 func GetWerfConfigPath(projectDir string) (string, error) {
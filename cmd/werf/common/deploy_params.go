@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"text/template"
 	"time"
@@ -16,6 +18,20 @@ import (
 )
 
 func GetHelmRelease(releaseOption string, environmentOption string, werfConfig *config.WerfConfig) (string, error) {
+	return getHelmRelease(releaseOption, werfConfig.Meta.DeployTemplates.HelmRelease, environmentOption, werfConfig)
+}
+
+// GetClusterHelmRelease uses helmRelease template of the cluster if it is set instead of the common deploy template
+func GetClusterHelmRelease(releaseOption string, environmentOption string, cluster *config.DeployCluster, werfConfig *config.WerfConfig) (string, error) {
+	releaseTemplate := werfConfig.Meta.DeployTemplates.HelmRelease
+	if cluster.HelmRelease != "" {
+		releaseTemplate = cluster.HelmRelease
+	}
+
+	return getHelmRelease(releaseOption, releaseTemplate, environmentOption, werfConfig)
+}
+
+func getHelmRelease(releaseOption, releaseTemplate string, environmentOption string, werfConfig *config.WerfConfig) (string, error) {
 	if releaseOption != "" {
 		err := slug.ValidateHelmRelease(releaseOption)
 		if err != nil {
@@ -24,7 +40,6 @@ func GetHelmRelease(releaseOption string, environmentOption string, werfConfig *
 		return releaseOption, nil
 	}
 
-	releaseTemplate := werfConfig.Meta.DeployTemplates.HelmRelease
 	if releaseTemplate == "" {
 		releaseTemplate = "[[ project ]]-[[ env ]]"
 	}
@@ -51,6 +66,20 @@ func GetHelmRelease(releaseOption string, environmentOption string, werfConfig *
 }
 
 func GetKubernetesNamespace(namespaceOption string, environmentOption string, werfConfig *config.WerfConfig) (string, error) {
+	return getKubernetesNamespace(namespaceOption, werfConfig.Meta.DeployTemplates.Namespace, environmentOption, werfConfig)
+}
+
+// GetClusterKubernetesNamespace uses namespace template of the cluster if it is set instead of the common deploy template
+func GetClusterKubernetesNamespace(namespaceOption string, environmentOption string, cluster *config.DeployCluster, werfConfig *config.WerfConfig) (string, error) {
+	namespaceTemplate := werfConfig.Meta.DeployTemplates.Namespace
+	if cluster.Namespace != "" {
+		namespaceTemplate = cluster.Namespace
+	}
+
+	return getKubernetesNamespace(namespaceOption, namespaceTemplate, environmentOption, werfConfig)
+}
+
+func getKubernetesNamespace(namespaceOption, namespaceTemplate string, environmentOption string, werfConfig *config.WerfConfig) (string, error) {
 	if namespaceOption != "" {
 		err := slug.ValidateKubernetesNamespace(namespaceOption)
 		if err != nil {
@@ -59,7 +88,6 @@ func GetKubernetesNamespace(namespaceOption string, environmentOption string, we
 		return namespaceOption, nil
 	}
 
-	namespaceTemplate := werfConfig.Meta.DeployTemplates.Namespace
 	if namespaceTemplate == "" {
 		namespaceTemplate = "[[ project ]]-[[ env ]]"
 	}
@@ -85,6 +113,28 @@ func GetKubernetesNamespace(namespaceOption string, environmentOption string, we
 	return renderedNamespace, nil
 }
 
+// GetPostRenderer returns --post-renderer option or deploy.postRenderer from werf.yaml, which path is relative to the project directory
+func GetPostRenderer(cmdData *CmdData, projectDir string, werfConfig *config.WerfConfig) (string, error) {
+	postRenderer := *cmdData.PostRenderer
+	if postRenderer == "" {
+		postRenderer = werfConfig.Meta.DeployTemplates.PostRenderer
+		if postRenderer == "" {
+			return "", nil
+		}
+
+		if strings.ContainsRune(postRenderer, filepath.Separator) && !filepath.IsAbs(postRenderer) {
+			postRenderer = filepath.Join(projectDir, postRenderer)
+		}
+	}
+
+	path, err := exec.LookPath(postRenderer)
+	if err != nil {
+		return "", fmt.Errorf("bad post-renderer '%s': %s", postRenderer, err)
+	}
+
+	return path, nil
+}
+
 func GetHelmReleaseStorageType(helmReleaseStorageType string) (string, error) {
 	switch helmReleaseStorageType {
 	case helm.ConfigMapStorage, helm.SecretStorage:
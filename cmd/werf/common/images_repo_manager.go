@@ -1,14 +1,24 @@
 package common
 
 import (
+	"bytes"
 	"fmt"
+	"regexp"
 	"strings"
+	"text/template"
 )
 
 const (
 	MultirepoImagesRepoMode   = "multirepo"
 	MonorepoImagesRepoMode    = "monorepo"
+	TemplateImagesRepoMode    = "template"
 	MonorepoTagPartsSeparator = "-"
+
+	DefaultImagesRepoTemplate    = "{{ .Repo }}{{ if .Image }}/{{ .Image }}{{ end }}"
+	DefaultImagesRepoTagTemplate = "{{ .Tag }}"
+
+	// imagesRepoTemplateTagPlaceholder is used instead of the tag to invert the templates
+	imagesRepoTemplateTagPlaceholder = "WERFTAGPLACEHOLDER"
 )
 
 type ImagesRepoManager struct {
@@ -16,6 +26,24 @@ type ImagesRepoManager struct {
 	namelessImageRepoFunc func(imagesRepo string) string
 	imageRepoFunc         func(imagesRepo, imageName string) string
 	imageRepoTagFunc      func(imageName, tag string) string
+
+	isTemplate bool
+}
+
+// ImagesRepoTemplateOptions are the values available in the images repo templates besides .Image and .Tag
+type ImagesRepoTemplateOptions struct {
+	RepoTemplate string
+	TagTemplate  string
+	Project      string
+	Env          string
+}
+
+type imagesRepoTemplateData struct {
+	Repo    string
+	Project string
+	Image   string
+	Tag     string
+	Env     string
 }
 
 func newImagesRepoManager(
@@ -61,6 +89,37 @@ func (m *ImagesRepoManager) IsMonorepo() bool {
 	return m.ImagesRepo() == m.ImageRepo("image")
 }
 
+func (m *ImagesRepoManager) IsTemplate() bool {
+	return m.isTemplate
+}
+
+// ParseImageRepoTag inverts the images repo naming: reports whether the image repo and tag belong to the image and returns the tag
+func (m *ImagesRepoManager) ParseImageRepoTag(imageName, imageRepo, imageRepoTag string) (string, bool) {
+	if m.ImageRepo(imageName) != imageRepo {
+		return "", false
+	}
+
+	// the tag template is executed with the placeholder, so that all parts of the tag except the tag itself are known
+	parts := strings.Split(m.ImageRepoTag(imageName, imagesRepoTemplateTagPlaceholder), imagesRepoTemplateTagPlaceholder)
+	for ind := range parts {
+		parts[ind] = regexp.QuoteMeta(parts[ind])
+	}
+
+	submatch := regexp.MustCompile(fmt.Sprintf("^%s$", strings.Join(parts, "(.+)"))).FindStringSubmatch(imageRepoTag)
+	if submatch == nil {
+		return "", false
+	}
+
+	tag := submatch[1]
+	for _, t := range submatch[2:] {
+		if t != tag {
+			return "", false
+		}
+	}
+
+	return tag, true
+}
+
 func GetImagesRepoManager(imagesRepo, imagesRepoMode string) (*ImagesRepoManager, error) {
 	var namelessImageRepoFunc func(imagesRepo string) string
 	var imageRepoFunc func(imagesRepo, imageName string) string
@@ -96,7 +155,7 @@ func GetImagesRepoManager(imagesRepo, imagesRepoMode string) (*ImagesRepoManager
 			return tag
 		}
 	default:
-		return nil, fmt.Errorf("bad images repo mode '%s': only %s and %s supported", imagesRepoMode, MultirepoImagesRepoMode, MonorepoImagesRepoMode)
+		return nil, fmt.Errorf("bad images repo mode '%s': only %s and %s supported, use GetTemplateImagesRepoManager for %s mode", imagesRepoMode, MultirepoImagesRepoMode, MonorepoImagesRepoMode, TemplateImagesRepoMode)
 	}
 
 	return newImagesRepoManager(
@@ -106,3 +165,87 @@ func GetImagesRepoManager(imagesRepo, imagesRepoMode string) (*ImagesRepoManager
 		imageRepoTagFunc,
 	), nil
 }
+
+// GetTemplateImagesRepoManager returns images repo manager that forms the image repository and tag by the go templates.
+// The templates can use .Repo, .Project, .Image, .Tag and .Env values, empty templates form the multirepo layout
+func GetTemplateImagesRepoManager(imagesRepo string, opts ImagesRepoTemplateOptions) (*ImagesRepoManager, error) {
+	if opts.RepoTemplate == "" {
+		opts.RepoTemplate = DefaultImagesRepoTemplate
+	}
+
+	if opts.TagTemplate == "" {
+		opts.TagTemplate = DefaultImagesRepoTagTemplate
+	}
+
+	repoTmpl, err := template.New("images-repo").Option("missingkey=error").Parse(opts.RepoTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("bad images repo template '%s': %s", opts.RepoTemplate, err)
+	}
+
+	tagTmpl, err := template.New("images-repo-tag").Option("missingkey=error").Parse(opts.TagTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("bad images repo tag template '%s': %s", opts.TagTemplate, err)
+	}
+
+	formattedImagesRepo := strings.TrimRight(imagesRepo, "/")
+	executeFunc := func(tmpl *template.Template, imageName, tag string) (string, error) {
+		data := imagesRepoTemplateData{
+			Repo:    formattedImagesRepo,
+			Project: opts.Project,
+			Image:   imageName,
+			Tag:     tag,
+			Env:     opts.Env,
+		}
+
+		buf := bytes.NewBuffer(nil)
+		if err := tmpl.Execute(buf, data); err != nil {
+			return "", err
+		}
+
+		return buf.String(), nil
+	}
+
+	// templates are validated once, so that execution errors are not expected further
+	for _, imageName := range []string{"", "image"} {
+		repo, err := executeFunc(repoTmpl, imageName, imagesRepoTemplateTagPlaceholder)
+		if err != nil {
+			return nil, fmt.Errorf("bad images repo template '%s': %s", opts.RepoTemplate, err)
+		} else if strings.Contains(repo, imagesRepoTemplateTagPlaceholder) {
+			return nil, fmt.Errorf("bad images repo template '%s': .Tag can be used only in the tag template", opts.RepoTemplate)
+		}
+
+		tag, err := executeFunc(tagTmpl, imageName, imagesRepoTemplateTagPlaceholder)
+		if err != nil {
+			return nil, fmt.Errorf("bad images repo tag template '%s': %s", opts.TagTemplate, err)
+		} else if !strings.Contains(tag, imagesRepoTemplateTagPlaceholder) {
+			return nil, fmt.Errorf("bad images repo tag template '%s': .Tag should be used", opts.TagTemplate)
+		}
+	}
+
+	imageRepo, _ := executeFunc(repoTmpl, "image", "")
+	otherImageRepo, _ := executeFunc(repoTmpl, "other", "")
+	imageRepoTag, _ := executeFunc(tagTmpl, "image", "tag")
+	otherImageRepoTag, _ := executeFunc(tagTmpl, "other", "tag")
+	if imageRepo == otherImageRepo && imageRepoTag == otherImageRepoTag {
+		return nil, fmt.Errorf("bad images repo templates: .Image should be used either in the images repo template or in the tag template")
+	}
+
+	m := newImagesRepoManager(
+		imagesRepo,
+		func(_ string) string {
+			repo, _ := executeFunc(repoTmpl, "", "")
+			return repo
+		},
+		func(_, imageName string) string {
+			repo, _ := executeFunc(repoTmpl, imageName, "")
+			return repo
+		},
+		func(imageName, tag string) string {
+			repoTag, _ := executeFunc(tagTmpl, imageName, tag)
+			return repoTag
+		},
+	)
+	m.isTemplate = true
+
+	return m, nil
+}
@@ -2,6 +2,7 @@ package common
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -63,3 +64,126 @@ func TestGetImagesRepoManager(t *testing.T) {
 		})
 	}
 }
+
+func TestGetImagesRepoManagers(t *testing.T) {
+	tests := []struct {
+		name              string
+		imagesRepos       []string
+		imagesReposModes  []string
+		expectedImageRepo []string
+		expectedError     bool
+	}{
+		{
+			name:              "singleMode",
+			imagesRepos:       []string{"registry-a/repo", "registry-b/repo"},
+			imagesReposModes:  []string{MultirepoImagesRepoMode},
+			expectedImageRepo: []string{"registry-a/repo/image:tag", "registry-b/repo/image:tag"},
+		},
+		{
+			name:              "modePerRepo",
+			imagesRepos:       []string{"registry-a/repo", "registry-b/repo"},
+			imagesReposModes:  []string{MultirepoImagesRepoMode, MonorepoImagesRepoMode},
+			expectedImageRepo: []string{"registry-a/repo/image:tag", fmt.Sprintf("registry-b/repo:image%stag", MonorepoTagPartsSeparator)},
+		},
+		{
+			name:             "modesNumberMismatch",
+			imagesRepos:      []string{"registry-a/repo", "registry-b/repo", "registry-c/repo"},
+			imagesReposModes: []string{MultirepoImagesRepoMode, MonorepoImagesRepoMode},
+			expectedError:    true,
+		},
+		{
+			name:          "noRepo",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmdData := &CmdData{ImagesRepo: &test.imagesRepos, ImagesRepoMode: &test.imagesReposModes}
+
+			managers, err := GetImagesRepoManagers("project", cmdData)
+			if test.expectedError {
+				if err == nil {
+					t.Errorf("expected error")
+				}
+
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var imageRepos []string
+			for _, m := range managers {
+				imageRepos = append(imageRepos, m.ImageRepoWithTag("image", "tag"))
+			}
+
+			if !reflect.DeepEqual(test.expectedImageRepo, imageRepos) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", test.expectedImageRepo, imageRepos)
+			}
+		})
+	}
+}
+
+func TestGetTemplateImagesRepoManager(t *testing.T) {
+	m, err := GetTemplateImagesRepoManager("registry/team", ImagesRepoTemplateOptions{
+		RepoTemplate: "{{ .Repo }}/{{ .Project }}-{{ .Image }}",
+		TagTemplate:  "{{ .Env }}-{{ .Tag }}",
+		Project:      "project",
+		Env:          "production",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if imageRepoWithTag := m.ImageRepoWithTag("image", "v1.0.0"); imageRepoWithTag != "registry/team/project-image:production-v1.0.0" {
+		t.Errorf("\n[EXPECTED]: %q\n[GOT]: %q", "registry/team/project-image:production-v1.0.0", imageRepoWithTag)
+	}
+
+	tests := []struct {
+		imageName     string
+		imageRepo     string
+		imageRepoTag  string
+		expectedTag   string
+		expectedMatch bool
+	}{
+		{"image", "registry/team/project-image", "production-v1.0.0", "v1.0.0", true},
+		{"image", "registry/team/project-image", "production-feature-x", "feature-x", true},
+		{"image", "registry/team/project-image", "staging-v1.0.0", "", false},
+		{"image", "registry/team/project-other", "production-v1.0.0", "", false},
+	}
+
+	for _, test := range tests {
+		tag, ok := m.ParseImageRepoTag(test.imageName, test.imageRepo, test.imageRepoTag)
+		if ok != test.expectedMatch || tag != test.expectedTag {
+			t.Errorf("%s:%s\n[EXPECTED]: %q %v\n[GOT]: %q %v", test.imageRepo, test.imageRepoTag, test.expectedTag, test.expectedMatch, tag, ok)
+		}
+	}
+}
+
+func TestGetTemplateImagesRepoManagerBadTemplates(t *testing.T) {
+	for _, opts := range []ImagesRepoTemplateOptions{
+		{RepoTemplate: "{{ .Repo }}/{{ .Image }}", TagTemplate: "{{ .Env }}"},
+		{RepoTemplate: "{{ .Repo }}/{{ .Tag }}", TagTemplate: "{{ .Image }}-{{ .Tag }}"},
+		{RepoTemplate: "{{ .Repo }}", TagTemplate: "{{ .Tag }}"},
+		{RepoTemplate: "{{ .Repo }}/{{ .Unknown }}", TagTemplate: "{{ .Tag }}"},
+	} {
+		if _, err := GetTemplateImagesRepoManager("repo", opts); err == nil {
+			t.Errorf("expected error for templates %q and %q", opts.RepoTemplate, opts.TagTemplate)
+		}
+	}
+}
+
+func TestParseImageRepoTagMonorepo(t *testing.T) {
+	m, err := GetImagesRepoManager("repo", MonorepoImagesRepoMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag, ok := m.ParseImageRepoTag("image", "repo", fmt.Sprintf("image%sv1", MonorepoTagPartsSeparator)); !ok || tag != "v1" {
+		t.Errorf("\n[EXPECTED]: %q true\n[GOT]: %q %v", "v1", tag, ok)
+	}
+
+	if _, ok := m.ParseImageRepoTag("image", "repo", "other-v1"); ok {
+		t.Errorf("unexpected match of other image tag")
+	}
+}
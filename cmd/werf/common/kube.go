@@ -0,0 +1,57 @@
+package common
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// inClusterContextName is the context name of the in-cluster client returned by kube.GetAllContextsClients
+const inClusterContextName = "inClusterContext"
+
+type GetAllContextsDynamicClientsOptions struct {
+	KubeConfig string
+}
+
+// GetAllContextsDynamicClients returns dynamic clients by contexts like kube.GetAllContextsClients does for typed clients
+func GetAllContextsDynamicClients(opts GetAllContextsDynamicClientsOptions) (map[string]dynamic.Interface, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.DefaultClientConfig = &clientcmd.DefaultClientConfig
+	if opts.KubeConfig != "" {
+		rules.ExplicitPath = opts.KubeConfig
+	}
+
+	rc, outOfClusterErr := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).RawConfig()
+	if outOfClusterErr == nil && len(rc.Contexts) != 0 {
+		clients := map[string]dynamic.Interface{}
+		for contextName := range rc.Contexts {
+			overrides := &clientcmd.ConfigOverrides{ClusterDefaults: clientcmd.ClusterDefaults, CurrentContext: contextName}
+			config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+			if err != nil {
+				return nil, fmt.Errorf("out-of-cluster configuration problem, context %q: %s", contextName, err)
+			}
+
+			client, err := dynamic.NewForConfig(config)
+			if err != nil {
+				return nil, err
+			}
+
+			clients[contextName] = client
+		}
+
+		return clients, nil
+	}
+
+	if config, err := rest.InClusterConfig(); err == nil {
+		client, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]dynamic.Interface{inClusterContextName: client}, nil
+	}
+
+	return nil, outOfClusterErr
+}
@@ -27,6 +27,12 @@ func GetDeployTag(cmdData *CmdData, opts TagOptionsGetterOptions) (string, tag_s
 	if *cmdData.TagGitCommit != "" {
 		optionsCount++
 	}
+	if *cmdData.TagBySemver != "" {
+		optionsCount++
+	}
+	if *cmdData.TagByStagesSignature {
+		optionsCount++
+	}
 
 	if optionsCount > 1 {
 		return "", "", fmt.Errorf("exactly one tag should be specified for deploy")
@@ -45,6 +51,16 @@ func GetDeployTag(cmdData *CmdData, opts TagOptionsGetterOptions) (string, tag_s
 		return tagOpts.TagsByGitTag[0], tag_strategy.GitTag, nil
 	} else if len(tagOpts.TagsByGitCommit) > 0 {
 		return tagOpts.TagsByGitCommit[0], tag_strategy.GitCommit, nil
+	} else if len(tagOpts.TagsByGitSemver) > 0 {
+		version, err := tag_strategy.ParseSemverGitTag(tagOpts.TagsByGitSemver[0])
+		if err != nil {
+			return "", "", err
+		}
+
+		return tag_strategy.SemverVersionTag(version), tag_strategy.GitSemver, nil
+	} else if tagOpts.TagByStagesSignature {
+		// tag is the signature of the last stage, which is different for each image
+		return "", tag_strategy.StagesSignature, nil
 	}
 
 	if !opts.Optional {
@@ -99,8 +115,22 @@ func GetTagOptions(cmdData *CmdData, opts TagOptionsGetterOptions) (build.TagOpt
 		emptyTags = false
 	}
 
+	if tag := *cmdData.TagBySemver; tag != "" {
+		if _, err := tag_strategy.ParseSemverGitTag(tag); err != nil {
+			return build.TagOptions{}, fmt.Errorf("bad --tag-by-semver parameter '%s' specified: %s", tag, err)
+		}
+
+		res.TagsByGitSemver = append(res.TagsByGitSemver, tag)
+		emptyTags = false
+	}
+
+	if *cmdData.TagByStagesSignature {
+		res.TagByStagesSignature = true
+		emptyTags = false
+	}
+
 	if emptyTags && !opts.Optional {
-		return build.TagOptions{}, fmt.Errorf("at least one tag should be specified with --tag-custom|--tag-git-tag|--tag-git-branch|--tag-git-commit options")
+		return build.TagOptions{}, fmt.Errorf("at least one tag should be specified with --tag-custom|--tag-git-tag|--tag-git-branch|--tag-git-commit|--tag-by-semver|--tag-by-stages-signature options")
 	}
 
 	return res, nil
@@ -0,0 +1,178 @@
+package graph
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flant/logboek"
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/cmd/werf/common"
+	"github.com/flant/werf/pkg/build"
+	"github.com/flant/werf/pkg/config"
+	"github.com/flant/werf/pkg/docker"
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/logging"
+	"github.com/flant/werf/pkg/ssh_agent"
+	"github.com/flant/werf/pkg/tmp_manager"
+	"github.com/flant/werf/pkg/true_git"
+	"github.com/flant/werf/pkg/werf"
+)
+
+var commonCmdData common.CmdData
+var cmdData struct {
+	Format     string
+	WithStages bool
+}
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                   "graph",
+		DisableFlagsInUseLine: true,
+		Short:                 "Print images dependency graph",
+		Long: common.GetLongCommandDescription(`Print images dependency graph.
+
+Nodes are images, artifacts and dockerfile images defined in werf.yaml.
+Edges point from the dependency to the dependent image and are labeled by relation type: fromImage, fromImageArtifact or import (with import stage, e.g. before install).
+
+With --with-stages option nodes are annotated with the current signature of the last stage and cache status of stages in the stages storage (only :local is supported). Nothing is built`),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			logging.Mute()
+
+			return run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&cmdData.Format, "format", "", "dot", "Output the graph in the specified format (dot, mermaid or json)")
+	cmd.Flags().BoolVarP(&cmdData.WithStages, "with-stages", "", false, "Annotate nodes with stages signatures and cache status from the stages storage")
+
+	common.SetupDir(&commonCmdData, cmd)
+	common.SetupConfigValues(&commonCmdData, cmd)
+	common.SetupTmpDir(&commonCmdData, cmd)
+	common.SetupHomeDir(&commonCmdData, cmd)
+	common.SetupSSHKey(&commonCmdData, cmd)
+
+	common.SetupStagesStorage(&commonCmdData, cmd)
+	common.SetupDockerConfig(&commonCmdData, cmd, "Command needs granted permissions to read and pull images from the specified stages storage")
+	common.SetupInsecureRegistry(&commonCmdData, cmd)
+	common.SetupSkipTlsVerifyRegistry(&commonCmdData, cmd)
+
+	return cmd
+}
+
+func run() error {
+	if cmdData.Format != "dot" && cmdData.Format != "mermaid" && cmdData.Format != "json" {
+		return fmt.Errorf("bad --format value '%s': dot, mermaid or json expected", cmdData.Format)
+	}
+
+	if err := werf.Init(*commonCmdData.TmpDir, *commonCmdData.HomeDir); err != nil {
+		return fmt.Errorf("initialization error: %s", err)
+	}
+
+	tmp_manager.AutoGCEnabled = false
+
+	projectDir, err := common.GetProjectDir(&commonCmdData)
+	if err != nil {
+		return fmt.Errorf("getting project dir failed: %s", err)
+	}
+
+	werfConfig, err := common.GetWerfConfig(projectDir, &commonCmdData)
+	if err != nil {
+		return fmt.Errorf("bad config: %s", err)
+	}
+
+	graph := werfConfig.ImagesGraph()
+
+	if cmdData.WithStages {
+		if err := annotateGraphWithStages(graph, werfConfig, projectDir); err != nil {
+			return err
+		}
+	}
+
+	var data []byte
+	switch cmdData.Format {
+	case "dot":
+		data = graph.Dot()
+	case "mermaid":
+		data = graph.Mermaid()
+	case "json":
+		if data, err = graph.Json(); err != nil {
+			return err
+		}
+
+		data = append(data, '\n')
+	}
+
+	_, err = os.Stdout.Write(data)
+
+	return err
+}
+
+func annotateGraphWithStages(graph *config.ImagesGraph, werfConfig *config.WerfConfig, projectDir string) error {
+	if err := shluz.Init(filepath.Join(werf.GetServiceDir(), "locks")); err != nil {
+		return err
+	}
+
+	if err := true_git.Init(true_git.Options{Out: logboek.GetOutStream(), Err: logboek.GetErrStream()}); err != nil {
+		return err
+	}
+
+	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *commonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *commonCmdData.SkipTlsVerifyRegistry}); err != nil {
+		return err
+	}
+
+	if err := docker.Init(*commonCmdData.DockerConfig); err != nil {
+		return err
+	}
+
+	if _, err := common.GetStagesRepo(&commonCmdData); err != nil {
+		return err
+	}
+
+	projectTmpDir, err := tmp_manager.CreateProjectDir()
+	if err != nil {
+		return fmt.Errorf("getting project tmp dir failed: %s", err)
+	}
+	defer tmp_manager.ReleaseProjectDir(projectTmpDir)
+
+	if err := ssh_agent.Init(*commonCmdData.SSHKeys); err != nil {
+		return fmt.Errorf("cannot initialize ssh agent: %s", err)
+	}
+	defer func() {
+		err := ssh_agent.Terminate()
+		if err != nil {
+			logboek.LogErrorF("WARNING: ssh agent termination failed: %s\n", err)
+		}
+	}()
+
+	c := build.NewConveyor(werfConfig, []string{}, projectDir, projectTmpDir, ssh_agent.SSHAuthSock)
+	defer c.Terminate()
+
+	imagesStagesStatus, err := c.GetImagesStagesStatus()
+	if err != nil {
+		return err
+	}
+
+	for _, node := range graph.Nodes {
+		status, ok := imagesStagesStatus[node.Name]
+		if !ok {
+			continue
+		}
+
+		node.Signature = status.Signature
+
+		switch status.CachedStagesNumber {
+		case status.StagesNumber:
+			node.CacheStatus = "cached"
+		case 0:
+			node.CacheStatus = "not cached"
+		default:
+			node.CacheStatus = fmt.Sprintf("%d/%d stages cached", status.CachedStagesNumber, status.StagesNumber)
+		}
+	}
+
+	return nil
+}
@@ -29,6 +29,7 @@ func NewCmd() *cobra.Command {
 	cmd.Flags().BoolVarP(&cmdData.imagesOnly, "images-only", "", false, "Show image names without artifacts")
 
 	common.SetupDir(&commonCmdData, cmd)
+	common.SetupConfigValues(&commonCmdData, cmd)
 	common.SetupTmpDir(&commonCmdData, cmd)
 	common.SetupHomeDir(&commonCmdData, cmd)
 
@@ -52,7 +53,7 @@ func run() error {
 		return err
 	}
 
-	werfConfig, err := config.GetWerfConfig(werfConfigPath, false)
+	werfConfig, err := config.GetWerfConfig(werfConfigPath, common.GetWerfConfigOptions(&commonCmdData, false))
 	if err != nil {
 		return err
 	}
@@ -12,6 +12,9 @@ import (
 )
 
 var CommonCmdData common.CmdData
+var CmdData struct {
+	Resolved bool
+}
 
 func NewCmd() *cobra.Command {
 	cmd := &cobra.Command{
@@ -35,11 +38,14 @@ func NewCmd() *cobra.Command {
 				return err
 			}
 
-			return config.RenderWerfConfig(werfConfigPath, args)
+			return config.RenderWerfConfig(werfConfigPath, args, CmdData.Resolved, common.GetWerfConfigOptions(&CommonCmdData, false))
 		},
 	}
 
+	cmd.Flags().BoolVarP(&CmdData.Resolved, "resolved", "", false, "Show image and artifact config sections merged with the extended templates (extends directive)")
+
 	common.SetupDir(&CommonCmdData, cmd)
+	common.SetupConfigValues(&CommonCmdData, cmd)
 	common.SetupTmpDir(&CommonCmdData, cmd)
 	common.SetupHomeDir(&CommonCmdData, cmd)
 
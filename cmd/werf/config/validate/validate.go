@@ -0,0 +1,94 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flant/werf/cmd/werf/common"
+	"github.com/flant/werf/pkg/config"
+	"github.com/flant/werf/pkg/tmp_manager"
+	"github.com/flant/werf/pkg/werf"
+)
+
+var commonCmdData common.CmdData
+var cmdData struct {
+	OutputFormat string
+}
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                   "validate",
+		DisableFlagsInUseLine: true,
+		Short:                 "Validate werf.yaml",
+		Long: common.GetLongCommandDescription(`Validate werf.yaml.
+
+Render werf.yaml templates and check each config section against werf.yaml JSON Schema (https://werf.io/schemas/werf.schema.json).
+All violations are reported with config section (document) number, line and column of the rendered werf.yaml.
+Command exits with non-zero code when at least one violation found`),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&cmdData.OutputFormat, "output", "", "text", "Output the specified format (text or json)")
+
+	common.SetupDir(&commonCmdData, cmd)
+	common.SetupConfigValues(&commonCmdData, cmd)
+	common.SetupTmpDir(&commonCmdData, cmd)
+	common.SetupHomeDir(&commonCmdData, cmd)
+
+	return cmd
+}
+
+func run() error {
+	if cmdData.OutputFormat != "text" && cmdData.OutputFormat != "json" {
+		return fmt.Errorf("bad --output value '%s': text or json expected", cmdData.OutputFormat)
+	}
+
+	if err := werf.Init(*commonCmdData.TmpDir, *commonCmdData.HomeDir); err != nil {
+		return fmt.Errorf("initialization error: %s", err)
+	}
+
+	tmp_manager.AutoGCEnabled = false
+
+	projectDir, err := common.GetProjectDir(&commonCmdData)
+	if err != nil {
+		return fmt.Errorf("getting project dir failed: %s", err)
+	}
+
+	werfConfigPath, err := common.GetWerfConfigPath(projectDir)
+	if err != nil {
+		return err
+	}
+
+	validationErrors, err := config.ValidateWerfConfig(werfConfigPath, common.GetWerfConfigOptions(&commonCmdData, false))
+	if err != nil {
+		return err
+	}
+
+	switch cmdData.OutputFormat {
+	case "json":
+		if validationErrors == nil {
+			validationErrors = []*config.ValidationError{}
+		}
+
+		data, err := json.MarshalIndent(validationErrors, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(data))
+	default:
+		for _, validationError := range validationErrors {
+			fmt.Println(validationError.String())
+		}
+	}
+
+	if len(validationErrors) != 0 {
+		return fmt.Errorf("werf.yaml is not valid: %d violation(s) found", len(validationErrors))
+	}
+
+	return nil
+}
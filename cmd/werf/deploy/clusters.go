@@ -0,0 +1,310 @@
+package deploy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/cmd/werf/common"
+	"github.com/flant/werf/pkg/config"
+	"github.com/flant/werf/pkg/deploy"
+)
+
+const (
+	SequentialClustersDeployMode = "sequential"
+	ParallelClustersDeployMode   = "parallel"
+
+	AllMustSucceedClustersFailurePolicy     = "all-must-succeed"
+	StopOnFirstFailureClustersFailurePolicy = "stop-on-first-failure"
+
+	clustersWerfChartFlag = "clusters-werf-chart"
+)
+
+// getDeployClusters returns nil if the release should be deployed into the single cluster specified by --kube-context
+func getDeployClusters(projectDir string, werfConfig *config.WerfConfig, initCluster func(kubeContext string) error) ([]*deploy.DeployCluster, error) {
+	configClusters := werfConfig.Meta.DeployTemplates.Clusters
+
+	var clusters []*config.DeployCluster
+	if len(CmdData.Clusters) != 0 {
+		if *CommonCmdData.KubeContext != "" {
+			return nil, fmt.Errorf("--kube-context cannot be used with --cluster")
+		}
+
+	selectedClustersLoop:
+		for _, name := range CmdData.Clusters {
+			for _, cluster := range configClusters {
+				if cluster.Name == name {
+					clusters = append(clusters, cluster)
+					continue selectedClustersLoop
+				}
+			}
+
+			clusters = append(clusters, &config.DeployCluster{Name: name, KubeContext: name})
+		}
+	} else if *CommonCmdData.KubeContext == "" {
+		clusters = configClusters
+	}
+
+	if len(clusters) == 0 {
+		return nil, nil
+	}
+
+	var res []*deploy.DeployCluster
+	for _, cluster := range clusters {
+		release, err := common.GetClusterHelmRelease(*CommonCmdData.Release, *CommonCmdData.Environment, cluster, werfConfig)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %s", cluster.Name, err)
+		}
+
+		namespace, err := common.GetClusterKubernetesNamespace(*CommonCmdData.Namespace, *CommonCmdData.Environment, cluster, werfConfig)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %s", cluster.Name, err)
+		}
+
+		var values []string
+		for _, path := range cluster.Values {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(projectDir, path)
+			}
+			values = append(values, path)
+		}
+
+		kubeContext := cluster.KubeContext
+		res = append(res, &deploy.DeployCluster{
+			Name:      cluster.Name,
+			Release:   release,
+			Namespace: namespace,
+			Values:    values,
+			Init: func() error {
+				return initCluster(kubeContext)
+			},
+		})
+	}
+
+	return res, nil
+}
+
+func processClustersOptions() (bool, bool, error) {
+	var parallel, stopOnFirstFailure bool
+
+	switch CmdData.ClustersDeployMode {
+	case SequentialClustersDeployMode:
+	case ParallelClustersDeployMode:
+		parallel = true
+	default:
+		return false, false, fmt.Errorf("bad --clusters-deploy-mode value '%s'. Use one of '%s' or '%s'", CmdData.ClustersDeployMode, SequentialClustersDeployMode, ParallelClustersDeployMode)
+	}
+
+	switch CmdData.ClustersFailurePolicy {
+	case AllMustSucceedClustersFailurePolicy:
+	case StopOnFirstFailureClustersFailurePolicy:
+		stopOnFirstFailure = true
+	default:
+		return false, false, fmt.Errorf("bad --clusters-failure-policy value '%s'. Use one of '%s' or '%s'", CmdData.ClustersFailurePolicy, AllMustSucceedClustersFailurePolicy, StopOnFirstFailureClustersFailurePolicy)
+	}
+
+	if parallel && *CommonCmdData.StatusOutput != "" {
+		return false, false, fmt.Errorf("--status-output cannot be used with '%s' clusters deploy mode", ParallelClustersDeployMode)
+	}
+
+	return parallel, stopOnFirstFailure, nil
+}
+
+type clusterDeployProcess struct {
+	cluster     *deploy.DeployCluster
+	cmd         *exec.Cmd
+	err         error
+	done        bool
+	interrupted bool
+	skipped     bool
+}
+
+// deployClustersInParallel runs werf deploy for each cluster in a separate process, the output of each process is prefixed with the cluster name.
+// Helm and kubedog keep the cluster connection globally, so the clusters cannot be deployed in parallel within a single process.
+// The chart is prepared once: processes deploy the chart saved into the tmp dir instead of building the service values and decoding the secrets again
+func deployClustersInParallel(clusters []*deploy.DeployCluster, clustersWerfChart *deploy.ClustersWerfChart, tmpDir string, opts deploy.ClustersDeployOptions) error {
+	var clustersRevisions []deploy.ClusterRevision
+	if opts.StopOnFirstFailure {
+		if err := logboek.LogProcess("Getting the latest successfully deployed release revisions", logboek.LogProcessOptions{}, func() error {
+			var err error
+			clustersRevisions, err = deploy.GetClustersRevisions(clusters)
+			return err
+		}); err != nil {
+			return err
+		}
+		logboek.LogOptionalLn()
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to get werf executable path: %s", err)
+	}
+
+	clustersWerfChartPath := filepath.Join(tmpDir, "clusters-werf-chart.json")
+	if err := deploy.WriteClustersWerfChart(clustersWerfChartPath, clustersWerfChart); err != nil {
+		return fmt.Errorf("unable to save the chart for the clusters deploy processes: %s", err)
+	}
+	defer os.Remove(clustersWerfChartPath)
+
+	var outputMux sync.Mutex
+	var processesMux sync.Mutex
+	var wg sync.WaitGroup
+	var processes []*clusterDeployProcess
+	var stopped bool
+	for _, cluster := range clusters {
+		args := append(
+			clusterDeployProcessArgs(os.Args[1:]),
+			"--cluster", cluster.Name,
+			"--clusters-deploy-mode", SequentialClustersDeployMode,
+			"--clusters-failure-policy", AllMustSucceedClustersFailurePolicy,
+			"--"+clustersWerfChartFlag, clustersWerfChartPath,
+		)
+		process := &clusterDeployProcess{cluster: cluster, cmd: exec.Command(executable, args...)}
+		process.cmd.Env = os.Environ()
+
+		stdout, err := process.cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+
+		stderr, err := process.cmd.StderrPipe()
+		if err != nil {
+			return err
+		}
+
+		processesMux.Lock()
+		if stopped {
+			process.done = true
+			process.skipped = true
+			processes = append(processes, process)
+			processesMux.Unlock()
+			continue
+		}
+
+		if err := process.cmd.Start(); err != nil {
+			processesMux.Unlock()
+			return fmt.Errorf("unable to start deploy to cluster %s: %s", cluster.Name, err)
+		}
+		processes = append(processes, process)
+		processesMux.Unlock()
+
+		prefix := fmt.Sprintf("[%s] ", cluster.Name)
+		var outputWg sync.WaitGroup
+		outputWg.Add(2)
+		go copyPrefixedLines(logboek.GetOutStream(), stdout, prefix, &outputMux, &outputWg)
+		go copyPrefixedLines(logboek.GetErrStream(), stderr, prefix, &outputMux, &outputWg)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			outputWg.Wait()
+			err := process.cmd.Wait()
+
+			processesMux.Lock()
+			defer processesMux.Unlock()
+
+			process.err = err
+			process.done = true
+			if err == nil || process.interrupted || !opts.StopOnFirstFailure {
+				return
+			}
+
+			stopped = true
+			for _, p := range processes {
+				if !p.done && !p.interrupted {
+					p.interrupted = true
+					if err := p.cmd.Process.Signal(os.Interrupt); err != nil {
+						_ = p.cmd.Process.Kill()
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	var failedClusters []string
+	var clustersToRollback []deploy.ClusterRevision
+	for ind, process := range processes {
+		switch {
+		case process.skipped:
+			failedClusters = append(failedClusters, fmt.Sprintf("cluster %s: not deployed", process.cluster.Name))
+			continue
+		case process.interrupted:
+			failedClusters = append(failedClusters, fmt.Sprintf("cluster %s: interrupted", process.cluster.Name))
+		case process.err != nil:
+			failedClusters = append(failedClusters, fmt.Sprintf("cluster %s: %s", process.cluster.Name, process.err))
+		}
+
+		// the failed release is rolled back by deploy itself in the atomic mode
+		if opts.StopOnFirstFailure && !(process.err != nil && !process.interrupted && opts.Atomic) {
+			clustersToRollback = append(clustersToRollback, clustersRevisions[ind])
+		}
+	}
+
+	if len(failedClusters) == 0 {
+		return nil
+	}
+
+	err = fmt.Errorf("deploy failed to %d of %d clusters:\n%s", len(failedClusters), len(clusters), strings.Join(failedClusters, "\n"))
+	if opts.StopOnFirstFailure {
+		if rollbackErr := deploy.RollbackClusters(clustersToRollback, opts.Timeout); rollbackErr != nil {
+			return fmt.Errorf("%s\n%s", err, rollbackErr)
+		}
+	}
+
+	return err
+}
+
+// clusterDeployProcessArgs removes the options which select the clusters, the clusters deploy mode and the prepared chart from the werf deploy arguments
+func clusterDeployProcessArgs(args []string) []string {
+	var res []string
+
+	flags := []string{"--cluster", "--clusters-deploy-mode", "--clusters-failure-policy", "--" + clustersWerfChartFlag}
+
+argsLoop:
+	for ind := 0; ind < len(args); ind++ {
+		for _, flag := range flags {
+			if args[ind] == flag {
+				ind++
+				continue argsLoop
+			} else if strings.HasPrefix(args[ind], flag+"=") {
+				continue argsLoop
+			}
+		}
+
+		res = append(res, args[ind])
+	}
+
+	return res
+}
+
+func copyPrefixedLines(w io.Writer, r io.Reader, prefix string, mux *sync.Mutex, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+
+			mux.Lock()
+			_, _ = fmt.Fprint(w, prefix+line)
+			mux.Unlock()
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
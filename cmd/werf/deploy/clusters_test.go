@@ -0,0 +1,145 @@
+package deploy
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flant/werf/pkg/config"
+)
+
+func TestGetDeployClusters(t *testing.T) {
+	werfConfig := &config.WerfConfig{
+		Meta: &config.Meta{
+			Project: "myproject",
+			DeployTemplates: config.DeployTemplates{
+				Clusters: []*config.DeployCluster{
+					{Name: "eu", KubeContext: "eu-context", Values: []string{".helm/values-eu.yaml", "/etc/werf/values.yaml"}},
+					{Name: "us", KubeContext: "us-context", HelmRelease: "[[ project ]]-us", Namespace: "[[ project ]]-[[ env ]]-us"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		clusters    []string
+		kubeContext string
+		release     string
+		namespace   string
+		expected    []string
+		expectedErr string
+	}{
+		{
+			name:     "configClusters",
+			expected: []string{"eu eu-context myproject-production myproject-production [/project/.helm/values-eu.yaml /etc/werf/values.yaml]", "us us-context myproject-us myproject-production-us []"},
+		},
+		{
+			name:        "singleClusterByKubeContext",
+			kubeContext: "other-context",
+		},
+		{
+			name:     "selectedClustersWithUnknownClusterAsKubeContext",
+			clusters: []string{"us", "dev-context"},
+			expected: []string{"us us-context myproject-us myproject-production-us []", "dev-context dev-context myproject-production myproject-production []"},
+		},
+		{
+			name:      "releaseAndNamespaceOptionsOverrideTemplates",
+			clusters:  []string{"us"},
+			release:   "myrelease",
+			namespace: "myns",
+			expected:  []string{"us us-context myrelease myns []"},
+		},
+		{
+			name:        "kubeContextWithCluster",
+			clusters:    []string{"eu"},
+			kubeContext: "eu-context",
+			expectedErr: "--kube-context cannot be used with --cluster",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			CmdData.Clusters = test.clusters
+			CommonCmdData.KubeContext = &test.kubeContext
+			CommonCmdData.Release = &test.release
+			CommonCmdData.Namespace = &test.namespace
+			environment := "production"
+			CommonCmdData.Environment = &environment
+
+			var initializedKubeContexts []string
+			clusters, err := getDeployClusters("/project", werfConfig, func(kubeContext string) error {
+				initializedKubeContexts = append(initializedKubeContexts, kubeContext)
+				return nil
+			})
+
+			if test.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+					t.Fatalf("\n[EXPECTED ERROR]: %s\n[GOT]: %v", test.expectedErr, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			var result []string
+			for _, cluster := range clusters {
+				if err := cluster.Init(); err != nil {
+					t.Fatal(err)
+				}
+
+				kubeContext := initializedKubeContexts[len(initializedKubeContexts)-1]
+				values := fmt.Sprintf("%v", cluster.Values)
+				result = append(result, strings.Join([]string{cluster.Name, kubeContext, cluster.Release, cluster.Namespace, filepath.ToSlash(values)}, " "))
+			}
+
+			if !reflect.DeepEqual(test.expected, result) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestClusterDeployProcessArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{
+			name:     "withoutClustersOptions",
+			args:     []string{"deploy", "--env", "production", "--images-repo", "registry/project"},
+			expected: []string{"deploy", "--env", "production", "--images-repo", "registry/project"},
+		},
+		{
+			name:     "separateValues",
+			args:     []string{"deploy", "--cluster", "eu", "--env", "production", "--cluster", "us", "--clusters-deploy-mode", "parallel", "--clusters-failure-policy", "stop-on-first-failure", "--atomic"},
+			expected: []string{"deploy", "--env", "production", "--atomic"},
+		},
+		{
+			name:     "valuesAfterEqualSign",
+			args:     []string{"deploy", "--cluster=eu", "--clusters-deploy-mode=parallel", "--env=production", "--clusters-failure-policy=all-must-succeed"},
+			expected: []string{"deploy", "--env=production"},
+		},
+		{
+			name:     "preparedChartOfParentProcess",
+			args:     []string{"deploy", "--clusters-werf-chart", "/tmp/clusters-werf-chart.json", "--env", "production", "--clusters-werf-chart=/tmp/other.json"},
+			expected: []string{"deploy", "--env", "production"},
+		},
+		{
+			name:     "optionsWithTheSamePrefixAreKept",
+			args:     []string{"deploy", "--clusters-deploy-mode-extra", "value"},
+			expected: []string{"deploy", "--clusters-deploy-mode-extra", "value"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if res := clusterDeployProcessArgs(test.args); !reflect.DeepEqual(test.expected, res) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", test.expected, res)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package deploy
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"time"
 
@@ -26,6 +27,14 @@ import (
 
 var CmdData struct {
 	Timeout int
+	Diff    bool
+	Atomic  bool
+
+	Clusters              []string
+	ClustersDeployMode    string
+	ClustersFailurePolicy string
+	// ClustersWerfChart is the chart prepared by the parent werf process of the parallel clusters deploy
+	ClustersWerfChart string
 }
 
 var CommonCmdData common.CmdData
@@ -54,11 +63,22 @@ Read more info about Helm chart structure, Helm Release name, Kubernetes Namespa
 		Annotations: map[string]string{
 			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey),
 		},
-		RunE: func(cmd *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			if err := common.ProcessLogOptions(&CommonCmdData); err != nil {
 				common.PrintHelp(cmd)
 				return err
 			}
+
+			statusOutputFile, err := common.ProcessStatusOutput(&CommonCmdData)
+			if err != nil {
+				common.PrintHelp(cmd)
+				return err
+			}
+			defer func() {
+				if closeErr := common.CloseStatusOutput(statusOutputFile); closeErr != nil && err == nil {
+					err = closeErr
+				}
+			}()
 			common.LogVersion()
 
 			return common.LogRunningTime(func() error {
@@ -68,6 +88,7 @@ Read more info about Helm chart structure, Helm Release name, Kubernetes Namespa
 	}
 
 	common.SetupDir(&CommonCmdData, cmd)
+	common.SetupConfigValues(&CommonCmdData, cmd)
 	common.SetupTmpDir(&CommonCmdData, cmd)
 	common.SetupHomeDir(&CommonCmdData, cmd)
 	common.SetupSSHKey(&CommonCmdData, cmd)
@@ -102,15 +123,44 @@ Read more info about Helm chart structure, Helm Release name, Kubernetes Namespa
 	common.SetupValues(&CommonCmdData, cmd)
 	common.SetupSecretValues(&CommonCmdData, cmd)
 	common.SetupIgnoreSecretKey(&CommonCmdData, cmd)
+	common.SetupPostRenderer(&CommonCmdData, cmd)
 
 	common.SetupThreeWayMergeMode(&CommonCmdData, cmd)
+	common.SetupStatusOutput(&CommonCmdData, cmd)
 
 	cmd.Flags().IntVarP(&CmdData.Timeout, "timeout", "t", 0, "Resources tracking timeout in seconds")
+	cmd.Flags().BoolVarP(&CmdData.Diff, "diff", "", common.GetBoolEnvironment("WERF_DIFF"), "Print the changes of the release resources against the live cluster before deploy (default $WERF_DIFF)")
+	cmd.Flags().BoolVarP(&CmdData.Atomic, "atomic", "", common.GetBoolEnvironment("WERF_ATOMIC"), "Roll the release back to the latest successfully deployed revision or purge the newly installed release if resources tracking fails or timeout is reached, the rollback is tracked too (default $WERF_ATOMIC)")
+
+	cmd.Flags().StringArrayVarP(&CmdData.Clusters, "cluster", "", []string{}, `Deploy the release into the cluster from the deploy.clusters list of werf.yaml or into the cluster with the specified kube context (can specify multiple).
+All clusters from the deploy.clusters list are used by default if --kube-context is not specified`)
+
+	defaultClustersDeployMode := os.Getenv("WERF_CLUSTERS_DEPLOY_MODE")
+	if defaultClustersDeployMode == "" {
+		defaultClustersDeployMode = SequentialClustersDeployMode
+	}
+	cmd.Flags().StringVarP(&CmdData.ClustersDeployMode, "clusters-deploy-mode", "", defaultClustersDeployMode, fmt.Sprintf("Deploy the release into several clusters one by one ('%[1]s') or simultaneously by separate werf processes ('%[2]s'), the chart is prepared only once in both modes (default $WERF_CLUSTERS_DEPLOY_MODE or '%[1]s')", SequentialClustersDeployMode, ParallelClustersDeployMode))
+
+	cmd.Flags().StringVarP(&CmdData.ClustersWerfChart, clustersWerfChartFlag, "", "", "Deploy the chart prepared by the parent werf process in the parallel clusters deploy mode")
+	if err := cmd.Flags().MarkHidden(clustersWerfChartFlag); err != nil {
+		panic(err)
+	}
+
+	defaultClustersFailurePolicy := os.Getenv("WERF_CLUSTERS_FAILURE_POLICY")
+	if defaultClustersFailurePolicy == "" {
+		defaultClustersFailurePolicy = AllMustSucceedClustersFailurePolicy
+	}
+	cmd.Flags().StringVarP(&CmdData.ClustersFailurePolicy, "clusters-failure-policy", "", defaultClustersFailurePolicy, fmt.Sprintf("Deploy the release into all clusters and fail if any of them failed ('%[1]s') or stop on the first failed cluster and roll the updated clusters back ('%[2]s') (default $WERF_CLUSTERS_FAILURE_POLICY or '%[1]s')", AllMustSucceedClustersFailurePolicy, StopOnFirstFailureClustersFailurePolicy))
 
 	return cmd
 }
 
 func runDeploy() error {
+	parallelClustersDeploy, stopOnFirstClusterFailure, err := processClustersOptions()
+	if err != nil {
+		return err
+	}
+
 	if err := werf.Init(*CommonCmdData.TmpDir, *CommonCmdData.HomeDir); err != nil {
 		return fmt.Errorf("initialization error: %s", err)
 	}
@@ -133,20 +183,28 @@ func runDeploy() error {
 		return err
 	}
 
-	deployInitOptions := deploy.InitOptions{
-		HelmInitOptions: helm.InitOptions{
-			KubeConfig:                  *CommonCmdData.KubeConfig,
-			KubeContext:                 *CommonCmdData.KubeContext,
-			HelmReleaseStorageNamespace: *CommonCmdData.HelmReleaseStorageNamespace,
-			HelmReleaseStorageType:      helmReleaseStorageType,
-			StatusProgressPeriod:        common.GetStatusProgressPeriod(&CommonCmdData),
-			HooksStatusProgressPeriod:   common.GetHooksStatusProgressPeriod(&CommonCmdData),
-			ReleasesMaxHistory:          *CommonCmdData.ReleasesHistoryMax,
-			InitNamespace:               true,
-		},
-	}
-	if err := deploy.Init(deployInitOptions); err != nil {
-		return err
+	initKube := func(kubeContext string) error {
+		deployInitOptions := deploy.InitOptions{
+			HelmInitOptions: helm.InitOptions{
+				KubeConfig:                  *CommonCmdData.KubeConfig,
+				KubeContext:                 kubeContext,
+				HelmReleaseStorageNamespace: *CommonCmdData.HelmReleaseStorageNamespace,
+				HelmReleaseStorageType:      helmReleaseStorageType,
+				StatusProgressPeriod:        common.GetStatusProgressPeriod(&CommonCmdData),
+				HooksStatusProgressPeriod:   common.GetHooksStatusProgressPeriod(&CommonCmdData),
+				ReleasesMaxHistory:          *CommonCmdData.ReleasesHistoryMax,
+				InitNamespace:               true,
+			},
+		}
+		if err := deploy.Init(deployInitOptions); err != nil {
+			return err
+		}
+
+		if err := kube.Init(kube.InitOptions{KubeContext: kubeContext, KubeConfig: *CommonCmdData.KubeConfig}); err != nil {
+			return fmt.Errorf("cannot initialize kube: %s", err)
+		}
+
+		return nil
 	}
 
 	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *CommonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *CommonCmdData.SkipTlsVerifyRegistry}); err != nil {
@@ -157,10 +215,6 @@ func runDeploy() error {
 		return err
 	}
 
-	if err := kube.Init(kube.InitOptions{KubeContext: *CommonCmdData.KubeContext, KubeConfig: *CommonCmdData.KubeConfig}); err != nil {
-		return fmt.Errorf("cannot initialize kube: %s", err)
-	}
-
 	if err := common.InitKubedog(); err != nil {
 		return fmt.Errorf("cannot init kubedog: %s", err)
 	}
@@ -178,15 +232,37 @@ func runDeploy() error {
 	}
 	defer tmp_manager.ReleaseProjectDir(projectTmpDir)
 
-	werfConfig, err := common.GetWerfConfig(projectDir)
+	werfConfig, err := common.GetWerfConfig(projectDir, &CommonCmdData)
 	if err != nil {
 		return fmt.Errorf("bad config: %s", err)
 	}
 
+	postRenderer, err := common.GetPostRenderer(&CommonCmdData, projectDir, werfConfig)
+	if err != nil {
+		return err
+	}
+
+	clusters, err := getDeployClusters(projectDir, werfConfig, initKube)
+	if err != nil {
+		return err
+	}
+
+	if clusters == nil {
+		if CmdData.ClustersWerfChart != "" {
+			return fmt.Errorf("--%s cannot be used without --cluster", clustersWerfChartFlag)
+		}
+
+		if err := initKube(*CommonCmdData.KubeContext); err != nil {
+			return err
+		}
+	}
+
 	var imagesRepoManager *common.ImagesRepoManager
 	var tag string
 	var tagStrategy tag_strategy.TagStrategy
-	if len(werfConfig.StapelImages) != 0 || len(werfConfig.ImagesFromDockerfile) != 0 {
+	var imagesTags map[string]string
+	// images are not needed if the chart with the service values has been prepared by the parent werf process
+	if CmdData.ClustersWerfChart == "" && (len(werfConfig.StapelImages) != 0 || len(werfConfig.ImagesFromDockerfile) != 0) {
 		if len(werfConfig.StapelImages) != 0 {
 			_, err = common.GetStagesRepo(&CommonCmdData)
 			if err != nil {
@@ -204,7 +280,7 @@ func runDeploy() error {
 			return err
 		}
 
-		imagesRepoManager, err = common.GetImagesRepoManager(imagesRepo, imagesRepoMode)
+		imagesRepoManager, err = common.GetImagesRepoManagerByMode(werfConfig.Meta.Project, imagesRepo, imagesRepoMode, &CommonCmdData)
 		if err != nil {
 			return err
 		}
@@ -230,22 +306,19 @@ func runDeploy() error {
 		if err = c.ShouldBeBuilt(); err != nil {
 			return err
 		}
+
+		if tagStrategy == tag_strategy.StagesSignature {
+			imagesTags = map[string]string{}
+			for _, image := range werfConfig.GetAllImages() {
+				imagesTags[image.GetName()] = c.GetImageLatestStageSignature(image.GetName())
+			}
+		}
 	}
 
 	if imagesRepoManager == nil {
 		imagesRepoManager = &common.ImagesRepoManager{}
 	}
 
-	release, err := common.GetHelmRelease(*CommonCmdData.Release, *CommonCmdData.Environment, werfConfig)
-	if err != nil {
-		return err
-	}
-
-	namespace, err := common.GetKubernetesNamespace(*CommonCmdData.Namespace, *CommonCmdData.Environment, werfConfig)
-	if err != nil {
-		return err
-	}
-
 	userExtraAnnotations, err := common.GetUserExtraAnnotations(&CommonCmdData)
 	if err != nil {
 		return err
@@ -256,7 +329,7 @@ func runDeploy() error {
 		return err
 	}
 
-	return deploy.Deploy(projectDir, imagesRepoManager, release, namespace, tag, tagStrategy, werfConfig, *CommonCmdData.HelmReleaseStorageNamespace, helmReleaseStorageType, deploy.DeployOptions{
+	deployOptions := deploy.DeployOptions{
 		Set:                  *CommonCmdData.Set,
 		SetString:            *CommonCmdData.SetString,
 		Values:               *CommonCmdData.Values,
@@ -266,6 +339,49 @@ func runDeploy() error {
 		UserExtraAnnotations: userExtraAnnotations,
 		UserExtraLabels:      userExtraLabels,
 		IgnoreSecretKey:      *CommonCmdData.IgnoreSecretKey,
+		PostRenderer:         postRenderer,
 		ThreeWayMergeMode:    threeWayMergeMode,
-	})
+		ImagesTags:           imagesTags,
+		Diff:                 CmdData.Diff,
+		Atomic:               CmdData.Atomic,
+	}
+
+	if clusters != nil {
+		clustersDeployOptions := deploy.ClustersDeployOptions{
+			DeployOptions:      deployOptions,
+			StopOnFirstFailure: stopOnFirstClusterFailure,
+		}
+
+		if CmdData.ClustersWerfChart != "" {
+			clustersWerfChart, err := deploy.ReadClustersWerfChart(CmdData.ClustersWerfChart)
+			if err != nil {
+				return err
+			}
+
+			return deploy.DeployClustersWithWerfChart(clustersWerfChart, clusters, clustersDeployOptions)
+		}
+
+		if parallelClustersDeploy && len(clusters) > 1 {
+			clustersWerfChart, err := deploy.PrepareClustersWerfChart(projectDir, imagesRepoManager, tag, tagStrategy, werfConfig, *CommonCmdData.HelmReleaseStorageNamespace, helmReleaseStorageType, clusters, clustersDeployOptions)
+			if err != nil {
+				return err
+			}
+
+			return deployClustersInParallel(clusters, clustersWerfChart, projectTmpDir, clustersDeployOptions)
+		}
+
+		return deploy.DeployClusters(projectDir, imagesRepoManager, tag, tagStrategy, werfConfig, *CommonCmdData.HelmReleaseStorageNamespace, helmReleaseStorageType, clusters, clustersDeployOptions)
+	}
+
+	release, err := common.GetHelmRelease(*CommonCmdData.Release, *CommonCmdData.Environment, werfConfig)
+	if err != nil {
+		return err
+	}
+
+	namespace, err := common.GetKubernetesNamespace(*CommonCmdData.Namespace, *CommonCmdData.Environment, werfConfig)
+	if err != nil {
+		return err
+	}
+
+	return deploy.Deploy(projectDir, imagesRepoManager, release, namespace, tag, tagStrategy, werfConfig, *CommonCmdData.HelmReleaseStorageNamespace, helmReleaseStorageType, deployOptions)
 }
@@ -44,11 +44,22 @@ Read more info about Helm Release name, Kubernetes Namespace and how to change i
   # Dismiss project using specified helm release name and namespace
   $ werf dismiss --release myrelease --namespace myns`,
 		DisableFlagsInUseLine: true,
-		RunE: func(cmd *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			if err := common.ProcessLogOptions(&CommonCmdData); err != nil {
 				common.PrintHelp(cmd)
 				return err
 			}
+
+			statusOutputFile, err := common.ProcessStatusOutput(&CommonCmdData)
+			if err != nil {
+				common.PrintHelp(cmd)
+				return err
+			}
+			defer func() {
+				if closeErr := common.CloseStatusOutput(statusOutputFile); closeErr != nil && err == nil {
+					err = closeErr
+				}
+			}()
 			common.LogVersion()
 
 			return common.LogRunningTime(func() error {
@@ -60,6 +71,7 @@ Read more info about Helm Release name, Kubernetes Namespace and how to change i
 	common.SetupTmpDir(&CommonCmdData, cmd)
 	common.SetupHomeDir(&CommonCmdData, cmd)
 	common.SetupDir(&CommonCmdData, cmd)
+	common.SetupConfigValues(&CommonCmdData, cmd)
 
 	common.SetupEnvironment(&CommonCmdData, cmd)
 	common.SetupRelease(&CommonCmdData, cmd)
@@ -76,6 +88,8 @@ Read more info about Helm Release name, Kubernetes Namespace and how to change i
 	common.SetupLogOptions(&CommonCmdData, cmd)
 	common.SetupLogProjectDir(&CommonCmdData, cmd)
 
+	common.SetupStatusOutput(&CommonCmdData, cmd)
+
 	cmd.Flags().BoolVarP(&CmdData.WithNamespace, "with-namespace", "", false, "Delete Kubernetes Namespace after purging Helm Release")
 	cmd.Flags().BoolVarP(&CmdData.WithHooks, "with-hooks", "", true, "Delete Helm Release hooks getting from existing revisions")
 
@@ -122,7 +136,7 @@ func runDismiss() error {
 
 	common.ProcessLogProjectDir(&CommonCmdData, projectDir)
 
-	werfConfig, err := common.GetWerfConfig(projectDir)
+	werfConfig, err := common.GetWerfConfig(projectDir, &CommonCmdData)
 	if err != nil {
 		return fmt.Errorf("bad config: %s", err)
 	}
@@ -3,6 +3,7 @@ package docs
 import (
 	"bufio"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -10,12 +11,14 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/flant/werf/cmd/werf/common"
+	"github.com/flant/werf/pkg/config"
 )
 
 var CmdData struct {
 	dest        string
 	readmePath  string
 	splitReadme bool
+	jsonSchema  bool
 }
 var CommonCmdData common.CmdData
 
@@ -35,6 +38,10 @@ func NewCmd() *cobra.Command {
 				if err := SplitReadme(); err != nil {
 					return err
 				}
+			} else if CmdData.jsonSchema {
+				if err := GenJsonSchema(CmdData.dest); err != nil {
+					return err
+				}
 			} else {
 				if err := GenMarkdownTree(cmd.Root(), CmdData.dest); err != nil {
 					return err
@@ -51,6 +58,7 @@ func NewCmd() *cobra.Command {
 	f.StringVar(&CmdData.dest, "dir", "./", "directory to which documentation is written")
 	f.StringVar(&CmdData.readmePath, "readme", "README.md", "path to README.md")
 	f.BoolVar(&CmdData.splitReadme, "split-readme", false, "split README.md by top headers")
+	f.BoolVar(&CmdData.jsonSchema, "json-schema", false, "generate werf.yaml JSON Schema (werf.schema.json)")
 
 	return cmd
 }
@@ -147,3 +155,16 @@ func SplitReadme() error {
 
 	return nil
 }
+
+func GenJsonSchema(dir string) error {
+	data, err := config.JsonSchema()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, "werf.schema.json"), append(data, '\n'), 0644)
+}
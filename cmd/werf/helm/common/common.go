@@ -41,7 +41,9 @@ func GetTagOrStub(commonCmdData *common.CmdData) (string, tag_strategy.TagStrate
 		return "", "", err
 	}
 
-	if tag == "" {
+	if tagStrategy == tag_strategy.StagesSignature {
+		tag = "STAGES_SIGNATURE"
+	} else if tag == "" {
 		tag, tagStrategy = "TAG", tag_strategy.Custom
 	}
 
@@ -0,0 +1,276 @@
+package diff
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flant/kubedog/pkg/kube"
+	"github.com/flant/logboek"
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/cmd/werf/common"
+	"github.com/flant/werf/pkg/build"
+	"github.com/flant/werf/pkg/deploy"
+	"github.com/flant/werf/pkg/deploy/helm"
+	"github.com/flant/werf/pkg/docker"
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/ssh_agent"
+	"github.com/flant/werf/pkg/tag_strategy"
+	"github.com/flant/werf/pkg/tmp_manager"
+	"github.com/flant/werf/pkg/true_git"
+	"github.com/flant/werf/pkg/werf"
+)
+
+// ChangesExitCode is returned with --detailed-exitcode when the release has changes
+const ChangesExitCode = 2
+
+var CmdData struct {
+	DetailedExitCode bool
+}
+
+var CommonCmdData common.CmdData
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Show changes, which deploy would make in Kubernetes",
+		Long: common.GetLongCommandDescription(`Show changes, which deploy would make in Kubernetes.
+
+The chart is rendered with the same values as by the deploy command: service values, secret values, extra annotations and labels. The unified diff is printed for each resource of the release, which will be created, deleted or modified. The current state of the resource is the live object restricted to the fields of the last release and rendered manifests, thus the fields set by Kubernetes are not reported, while manual changes of the fields managed by the chart are.
+
+Values of Secret data and secret values are masked.`),
+		Example: `  # Show changes of the release deployed into 'production' environment using images from registry.mydomain.com/myproject tagged as mytag with git-tag tagging strategy
+  $ werf helm diff --stages-storage :local --env production --images-repo registry.mydomain.com/myproject --tag-git-tag mytag
+
+  # Fail the CI job when the release has changes
+  $ werf helm diff --stages-storage :local --env production --images-repo registry.mydomain.com/myproject --tag-git-tag mytag --detailed-exitcode`,
+		DisableFlagsInUseLine: true,
+		Annotations: map[string]string{
+			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey),
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := common.ProcessLogOptions(&CommonCmdData); err != nil {
+				common.PrintHelp(cmd)
+				return err
+			}
+			common.LogVersion()
+
+			var changed bool
+			if err := common.LogRunningTime(func() error {
+				var err error
+				changed, err = runDiff()
+				return err
+			}); err != nil {
+				return err
+			}
+
+			if changed && CmdData.DetailedExitCode {
+				os.Exit(ChangesExitCode)
+			}
+
+			return nil
+		},
+	}
+
+	common.SetupDir(&CommonCmdData, cmd)
+	common.SetupConfigValues(&CommonCmdData, cmd)
+	common.SetupTmpDir(&CommonCmdData, cmd)
+	common.SetupHomeDir(&CommonCmdData, cmd)
+	common.SetupSSHKey(&CommonCmdData, cmd)
+
+	common.SetupTag(&CommonCmdData, cmd)
+	common.SetupEnvironment(&CommonCmdData, cmd)
+	common.SetupRelease(&CommonCmdData, cmd)
+	common.SetupNamespace(&CommonCmdData, cmd)
+	common.SetupAddAnnotations(&CommonCmdData, cmd)
+	common.SetupAddLabels(&CommonCmdData, cmd)
+
+	common.SetupKubeConfig(&CommonCmdData, cmd)
+	common.SetupKubeContext(&CommonCmdData, cmd)
+	common.SetupHelmReleaseStorageNamespace(&CommonCmdData, cmd)
+	common.SetupHelmReleaseStorageType(&CommonCmdData, cmd)
+
+	common.SetupStagesStorage(&CommonCmdData, cmd)
+	common.SetupImagesRepo(&CommonCmdData, cmd)
+	common.SetupImagesRepoMode(&CommonCmdData, cmd)
+	common.SetupDockerConfig(&CommonCmdData, cmd, "Command needs granted permissions to read and pull images from the specified stages storage and images repo")
+	common.SetupInsecureRegistry(&CommonCmdData, cmd)
+	common.SetupSkipTlsVerifyRegistry(&CommonCmdData, cmd)
+
+	common.SetupLogOptions(&CommonCmdData, cmd)
+	common.SetupLogProjectDir(&CommonCmdData, cmd)
+
+	common.SetupSet(&CommonCmdData, cmd)
+	common.SetupSetString(&CommonCmdData, cmd)
+	common.SetupValues(&CommonCmdData, cmd)
+	common.SetupSecretValues(&CommonCmdData, cmd)
+	common.SetupIgnoreSecretKey(&CommonCmdData, cmd)
+	common.SetupPostRenderer(&CommonCmdData, cmd)
+
+	cmd.Flags().BoolVarP(&CmdData.DetailedExitCode, "detailed-exitcode", "", common.GetBoolEnvironment("WERF_DETAILED_EXITCODE"), fmt.Sprintf("Exit with code %d when the release has changes, 0 when there are no changes and 1 on errors (default $WERF_DETAILED_EXITCODE)", ChangesExitCode))
+
+	return cmd
+}
+
+func runDiff() (bool, error) {
+	if err := werf.Init(*CommonCmdData.TmpDir, *CommonCmdData.HomeDir); err != nil {
+		return false, fmt.Errorf("initialization error: %s", err)
+	}
+
+	if err := shluz.Init(filepath.Join(werf.GetServiceDir(), "locks")); err != nil {
+		return false, err
+	}
+
+	if err := true_git.Init(true_git.Options{Out: logboek.GetOutStream(), Err: logboek.GetErrStream()}); err != nil {
+		return false, err
+	}
+
+	helmReleaseStorageType, err := common.GetHelmReleaseStorageType(*CommonCmdData.HelmReleaseStorageType)
+	if err != nil {
+		return false, err
+	}
+
+	deployInitOptions := deploy.InitOptions{
+		HelmInitOptions: helm.InitOptions{
+			KubeConfig:                  *CommonCmdData.KubeConfig,
+			KubeContext:                 *CommonCmdData.KubeContext,
+			HelmReleaseStorageNamespace: *CommonCmdData.HelmReleaseStorageNamespace,
+			HelmReleaseStorageType:      helmReleaseStorageType,
+		},
+	}
+	if err := deploy.Init(deployInitOptions); err != nil {
+		return false, err
+	}
+
+	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *CommonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *CommonCmdData.SkipTlsVerifyRegistry}); err != nil {
+		return false, err
+	}
+
+	if err := docker.Init(*CommonCmdData.DockerConfig); err != nil {
+		return false, err
+	}
+
+	if err := kube.Init(kube.InitOptions{KubeContext: *CommonCmdData.KubeContext, KubeConfig: *CommonCmdData.KubeConfig}); err != nil {
+		return false, fmt.Errorf("cannot initialize kube: %s", err)
+	}
+
+	projectDir, err := common.GetProjectDir(&CommonCmdData)
+	if err != nil {
+		return false, fmt.Errorf("getting project dir failed: %s", err)
+	}
+
+	common.ProcessLogProjectDir(&CommonCmdData, projectDir)
+
+	projectTmpDir, err := tmp_manager.CreateProjectDir()
+	if err != nil {
+		return false, fmt.Errorf("getting project tmp dir failed: %s", err)
+	}
+	defer tmp_manager.ReleaseProjectDir(projectTmpDir)
+
+	werfConfig, err := common.GetWerfConfig(projectDir, &CommonCmdData)
+	if err != nil {
+		return false, fmt.Errorf("bad config: %s", err)
+	}
+
+	postRenderer, err := common.GetPostRenderer(&CommonCmdData, projectDir, werfConfig)
+	if err != nil {
+		return false, err
+	}
+
+	var imagesRepoManager *common.ImagesRepoManager
+	var tag string
+	var tagStrategy tag_strategy.TagStrategy
+	var imagesTags map[string]string
+	if len(werfConfig.StapelImages) != 0 || len(werfConfig.ImagesFromDockerfile) != 0 {
+		if len(werfConfig.StapelImages) != 0 {
+			_, err = common.GetStagesRepo(&CommonCmdData)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		imagesRepo, err := common.GetImagesRepo(werfConfig.Meta.Project, &CommonCmdData)
+		if err != nil {
+			return false, err
+		}
+
+		imagesRepoMode, err := common.GetImagesRepoMode(&CommonCmdData)
+		if err != nil {
+			return false, err
+		}
+
+		imagesRepoManager, err = common.GetImagesRepoManagerByMode(werfConfig.Meta.Project, imagesRepo, imagesRepoMode, &CommonCmdData)
+		if err != nil {
+			return false, err
+		}
+
+		tag, tagStrategy, err = common.GetDeployTag(&CommonCmdData, common.TagOptionsGetterOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		if err := ssh_agent.Init(*CommonCmdData.SSHKeys); err != nil {
+			return false, fmt.Errorf("cannot initialize ssh agent: %s", err)
+		}
+		defer func() {
+			err := ssh_agent.Terminate()
+			if err != nil {
+				logboek.LogErrorF("WARNING: ssh agent termination failed: %s\n", err)
+			}
+		}()
+
+		c := build.NewConveyor(werfConfig, []string{}, projectDir, projectTmpDir, ssh_agent.SSHAuthSock)
+		defer c.Terminate()
+
+		if err = c.ShouldBeBuilt(); err != nil {
+			return false, err
+		}
+
+		if tagStrategy == tag_strategy.StagesSignature {
+			imagesTags = map[string]string{}
+			for _, image := range werfConfig.GetAllImages() {
+				imagesTags[image.GetName()] = c.GetImageLatestStageSignature(image.GetName())
+			}
+		}
+	}
+
+	if imagesRepoManager == nil {
+		imagesRepoManager = &common.ImagesRepoManager{}
+	}
+
+	release, err := common.GetHelmRelease(*CommonCmdData.Release, *CommonCmdData.Environment, werfConfig)
+	if err != nil {
+		return false, err
+	}
+
+	namespace, err := common.GetKubernetesNamespace(*CommonCmdData.Namespace, *CommonCmdData.Environment, werfConfig)
+	if err != nil {
+		return false, err
+	}
+
+	userExtraAnnotations, err := common.GetUserExtraAnnotations(&CommonCmdData)
+	if err != nil {
+		return false, err
+	}
+
+	userExtraLabels, err := common.GetUserExtraLabels(&CommonCmdData)
+	if err != nil {
+		return false, err
+	}
+
+	return deploy.Diff(logboek.GetOutStream(), projectDir, imagesRepoManager, release, namespace, tag, tagStrategy, werfConfig, deploy.DiffOptions{
+		Set:                  *CommonCmdData.Set,
+		SetString:            *CommonCmdData.SetString,
+		Values:               *CommonCmdData.Values,
+		SecretValues:         *CommonCmdData.SecretValues,
+		Env:                  *CommonCmdData.Environment,
+		UserExtraAnnotations: userExtraAnnotations,
+		UserExtraLabels:      userExtraLabels,
+		IgnoreSecretKey:      *CommonCmdData.IgnoreSecretKey,
+		PostRenderer:         postRenderer,
+		ImagesTags:           imagesTags,
+	})
+}
@@ -41,6 +41,7 @@ These values includes project name, docker images ids and other`),
 	}
 
 	common.SetupDir(&CommonCmdData, cmd)
+	common.SetupConfigValues(&CommonCmdData, cmd)
 	common.SetupTmpDir(&CommonCmdData, cmd)
 	common.SetupHomeDir(&CommonCmdData, cmd)
 	common.SetupSSHKey(&CommonCmdData, cmd)
@@ -91,7 +92,7 @@ func runGetServiceValues() error {
 		return fmt.Errorf("getting project dir failed: %s", err)
 	}
 
-	werfConfig, err := common.GetWerfConfig(projectDir)
+	werfConfig, err := common.GetWerfConfig(projectDir, &CommonCmdData)
 	if err != nil {
 		return fmt.Errorf("bad config: %s", err)
 	}
@@ -113,7 +114,7 @@ func runGetServiceValues() error {
 		return err
 	}
 
-	imagesRepoManager, err := common.GetImagesRepoManager(imagesRepo, imagesRepoMode)
+	imagesRepoManager, err := common.GetImagesRepoManagerByMode(werfConfig.Meta.Project, imagesRepo, imagesRepoMode, &CommonCmdData)
 	if err != nil {
 		return err
 	}
@@ -140,7 +141,7 @@ func runGetServiceValues() error {
 		}
 	}()
 
-	images := deploy.GetImagesInfoGetters(werfConfig.StapelImages, werfConfig.ImagesFromDockerfile, imagesRepoManager, tag, withoutRepo)
+	images := deploy.GetImagesInfoGetters(werfConfig.StapelImages, werfConfig.ImagesFromDockerfile, imagesRepoManager, tag, nil, withoutRepo)
 
 	serviceValues, err := deploy.GetServiceValues(werfConfig.Meta.Project, imagesRepoManager, namespace, tag, tagStrategy, images, deploy.ServiceValuesOptions{Env: environment})
 	if err != nil {
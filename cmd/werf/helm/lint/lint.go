@@ -34,6 +34,7 @@ func NewCmd() *cobra.Command {
 	}
 
 	common.SetupDir(&CommonCmdData, cmd)
+	common.SetupConfigValues(&CommonCmdData, cmd)
 	common.SetupTmpDir(&CommonCmdData, cmd)
 	common.SetupHomeDir(&CommonCmdData, cmd)
 
@@ -45,6 +46,7 @@ func NewCmd() *cobra.Command {
 	common.SetupValues(&CommonCmdData, cmd)
 	common.SetupSecretValues(&CommonCmdData, cmd)
 	common.SetupIgnoreSecretKey(&CommonCmdData, cmd)
+	common.SetupPostRenderer(&CommonCmdData, cmd)
 
 	return cmd
 }
@@ -75,11 +77,16 @@ func runLint() error {
 		return fmt.Errorf("getting project dir failed: %s", err)
 	}
 
-	werfConfig, err := common.GetWerfConfig(projectDir)
+	werfConfig, err := common.GetWerfConfig(projectDir, &CommonCmdData)
 	if err != nil {
 		return fmt.Errorf("bad config: %s", err)
 	}
 
+	postRenderer, err := common.GetPostRenderer(&CommonCmdData, projectDir, werfConfig)
+	if err != nil {
+		return err
+	}
+
 	return deploy.RunLint(projectDir, werfConfig, deploy.LintOptions{
 		Values:          *CommonCmdData.Values,
 		SecretValues:    *CommonCmdData.SecretValues,
@@ -87,5 +94,6 @@ func runLint() error {
 		SetString:       *CommonCmdData.SetString,
 		Env:             *CommonCmdData.Environment,
 		IgnoreSecretKey: *CommonCmdData.IgnoreSecretKey,
+		PostRenderer:    postRenderer,
 	})
 }
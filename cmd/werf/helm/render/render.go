@@ -41,6 +41,7 @@ func NewCmd() *cobra.Command {
 	}
 
 	common.SetupDir(&commonCmdData, cmd)
+	common.SetupConfigValues(&commonCmdData, cmd)
 	common.SetupTmpDir(&commonCmdData, cmd)
 	common.SetupHomeDir(&commonCmdData, cmd)
 
@@ -56,6 +57,7 @@ func NewCmd() *cobra.Command {
 	common.SetupValues(&commonCmdData, cmd)
 	common.SetupSecretValues(&commonCmdData, cmd)
 	common.SetupIgnoreSecretKey(&commonCmdData, cmd)
+	common.SetupPostRenderer(&commonCmdData, cmd)
 
 	common.SetupImagesRepo(&commonCmdData, cmd)
 	common.SetupImagesRepoMode(&commonCmdData, cmd)
@@ -94,11 +96,16 @@ func runRender(outputFilePath string) error {
 		return fmt.Errorf("getting project dir failed: %s", err)
 	}
 
-	werfConfig, err := common.GetWerfConfig(projectDir)
+	werfConfig, err := common.GetWerfConfig(projectDir, &commonCmdData)
 	if err != nil {
 		return fmt.Errorf("bad config: %s", err)
 	}
 
+	postRenderer, err := common.GetPostRenderer(&commonCmdData, projectDir, werfConfig)
+	if err != nil {
+		return err
+	}
+
 	optionalImagesRepo, err := common.GetOptionalImagesRepo(werfConfig.Meta.Project, &commonCmdData)
 	if err != nil {
 		return err
@@ -116,7 +123,7 @@ func runRender(outputFilePath string) error {
 		return err
 	}
 
-	imagesRepoManager, err := common.GetImagesRepoManager(imagesRepo, imagesRepoMode)
+	imagesRepoManager, err := common.GetImagesRepoManagerByMode(werfConfig.Meta.Project, imagesRepo, imagesRepoMode, &commonCmdData)
 	if err != nil {
 		return err
 	}
@@ -164,6 +171,7 @@ func runRender(outputFilePath string) error {
 		UserExtraAnnotations: userExtraAnnotations,
 		UserExtraLabels:      userExtraLabels,
 		IgnoreSecretKey:      *commonCmdData.IgnoreSecretKey,
+		PostRenderer:         postRenderer,
 	}); err != nil {
 		return err
 	}
@@ -2,6 +2,7 @@ package cleanup
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/flant/shluz"
@@ -14,10 +15,14 @@ import (
 	"github.com/flant/werf/pkg/docker"
 	"github.com/flant/werf/pkg/docker_registry"
 	"github.com/flant/werf/pkg/true_git"
+	"github.com/flant/werf/pkg/util"
 	"github.com/flant/werf/pkg/werf"
 )
 
-var CmdData struct{}
+var CmdData struct {
+	DockerStorageUsageThreshold string
+	Target                      string
+}
 
 var CommonCmdData common.CmdData
 
@@ -33,6 +38,7 @@ The data include:
 * Local cache:
   * Remote git clones cache.
   * Git worktree cache.
+* Stages of all projects, when the docker storage usage exceeds the threshold specified by --docker-storage-usage-threshold option. The least recently used stages are removed until the usage reaches the --target.
 
 It is safe to run this command periodically by automated cleanup job in parallel with other werf commands such as build, deploy, stages and images cleanup.`),
 		DisableFlagsInUseLine: true,
@@ -59,6 +65,9 @@ It is safe to run this command periodically by automated cleanup job in parallel
 
 	common.SetupDryRun(&CommonCmdData, cmd)
 
+	cmd.Flags().StringVarP(&CmdData.DockerStorageUsageThreshold, "docker-storage-usage-threshold", "", os.Getenv("WERF_DOCKER_STORAGE_USAGE_THRESHOLD"), "Remove stages of all projects when the usage of the docker root dir filesystem exceeds the specified percentage, e.g. 70% (default $WERF_DOCKER_STORAGE_USAGE_THRESHOLD)")
+	cmd.Flags().StringVarP(&CmdData.Target, "target", "", os.Getenv("WERF_DOCKER_STORAGE_USAGE_TARGET"), "Remove stages until the usage of the docker root dir filesystem reaches the specified percentage, e.g. 60% (default $WERF_DOCKER_STORAGE_USAGE_TARGET or --docker-storage-usage-threshold value)")
+
 	return cmd
 }
 
@@ -85,6 +94,32 @@ func runGC() error {
 
 	logboek.LogOptionalLn()
 	hostCleanupOptions := cleaning.HostCleanupOptions{DryRun: *CommonCmdData.DryRun}
+
+	if CmdData.DockerStorageUsageThreshold != "" {
+		threshold, err := util.ParsePercentage(CmdData.DockerStorageUsageThreshold)
+		if err != nil {
+			return fmt.Errorf("bad --docker-storage-usage-threshold value %q: %s", CmdData.DockerStorageUsageThreshold, err)
+		}
+
+		target := threshold
+		if CmdData.Target != "" {
+			target, err = util.ParsePercentage(CmdData.Target)
+			if err != nil {
+				return fmt.Errorf("bad --target value %q: %s", CmdData.Target, err)
+			}
+
+			if target > threshold {
+				return fmt.Errorf("--target value %q should not exceed --docker-storage-usage-threshold value %q", CmdData.Target, CmdData.DockerStorageUsageThreshold)
+			}
+		}
+
+		hostCleanupOptions.HasDockerStorageUsageThreshold = true
+		hostCleanupOptions.DockerStorageUsageThreshold = threshold
+		hostCleanupOptions.DockerStorageUsageTarget = target
+	} else if CmdData.Target != "" {
+		return fmt.Errorf("--target option requires --docker-storage-usage-threshold option")
+	}
+
 	if err := cleaning.HostCleanup(hostCleanupOptions); err != nil {
 		return err
 	}
@@ -3,10 +3,12 @@ package cleanup
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/flant/shluz"
 
 	"github.com/spf13/cobra"
+	"k8s.io/client-go/dynamic"
 
 	"github.com/flant/kubedog/pkg/kube"
 	"github.com/flant/logboek"
@@ -41,6 +43,7 @@ func NewCmd() *cobra.Command {
 	}
 
 	common.SetupDir(&CommonCmdData, cmd)
+	common.SetupConfigValues(&CommonCmdData, cmd)
 	common.SetupTmpDir(&CommonCmdData, cmd)
 	common.SetupHomeDir(&CommonCmdData, cmd)
 
@@ -49,15 +52,20 @@ func NewCmd() *cobra.Command {
 	common.SetupDockerConfig(&CommonCmdData, cmd, "Command needs granted permissions to delete images from the specified images repo")
 	common.SetupInsecureRegistry(&CommonCmdData, cmd)
 	common.SetupSkipTlsVerifyRegistry(&CommonCmdData, cmd)
+	common.SetupRepoImplementation(&CommonCmdData, cmd)
+	common.SetupRegistryDelete(&CommonCmdData, cmd)
 	common.SetupImagesCleanupPolicies(&CommonCmdData, cmd)
 
 	common.SetupKubeConfig(&CommonCmdData, cmd)
 	common.SetupKubeContext(&CommonCmdData, cmd)
+	common.SetupHelmReleaseStorageNamespace(&CommonCmdData, cmd)
+	common.SetupHelmReleaseStorageType(&CommonCmdData, cmd)
 
 	common.SetupLogOptions(&CommonCmdData, cmd)
 	common.SetupLogProjectDir(&CommonCmdData, cmd)
 
 	common.SetupDryRun(&CommonCmdData, cmd)
+	common.SetupCleanupPlan(&CommonCmdData, cmd)
 
 	common.SetupWithoutKube(&CommonCmdData, cmd)
 
@@ -73,7 +81,7 @@ func runCleanup() error {
 		return err
 	}
 
-	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *CommonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *CommonCmdData.SkipTlsVerifyRegistry}); err != nil {
+	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *CommonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *CommonCmdData.SkipTlsVerifyRegistry, RepoImplementation: *CommonCmdData.RepoImplementation, QuayToken: common.GetQuayToken()}); err != nil {
 		return err
 	}
 
@@ -102,24 +110,14 @@ func runCleanup() error {
 	}
 	defer tmp_manager.ReleaseProjectDir(projectTmpDir)
 
-	werfConfig, err := common.GetWerfConfig(projectDir)
+	werfConfig, err := common.GetWerfConfig(projectDir, &CommonCmdData)
 	if err != nil {
 		return fmt.Errorf("bad config: %s", err)
 	}
 
 	projectName := werfConfig.Meta.Project
 
-	imagesRepo, err := common.GetImagesRepo(projectName, &CommonCmdData)
-	if err != nil {
-		return err
-	}
-
-	imagesRepoMode, err := common.GetImagesRepoMode(&CommonCmdData)
-	if err != nil {
-		return err
-	}
-
-	imagesRepoManager, err := common.GetImagesRepoManager(imagesRepo, imagesRepoMode)
+	imagesRepoManagers, err := common.GetImagesRepoManagers(projectName, &CommonCmdData)
 	if err != nil {
 		return err
 	}
@@ -144,7 +142,22 @@ func runCleanup() error {
 		}
 	}
 
-	policies, err := common.GetImagesCleanupPolicies(&CommonCmdData)
+	rules, err := common.GetImagesCleanupRules(werfConfig, &CommonCmdData)
+	if err != nil {
+		return err
+	}
+
+	protectedTags, err := common.GetImagesCleanupProtectedTags(werfConfig)
+	if err != nil {
+		return err
+	}
+
+	plan, applyPlan, err := common.GetCleanupPlans(&CommonCmdData, imagesRepoManagers)
+	if err != nil {
+		return err
+	}
+
+	helmReleaseStorageType, err := common.GetHelmReleaseStorageType(*CommonCmdData.HelmReleaseStorageType)
 	if err != nil {
 		return err
 	}
@@ -154,21 +167,64 @@ func runCleanup() error {
 		return fmt.Errorf("unable to get Kubernetes clusters connections: %s", err)
 	}
 
+	kubernetesResources, err := common.GetImagesCleanupKubernetesResources(werfConfig)
+	if err != nil {
+		return err
+	}
+
+	var kubernetesContextsDynamicClients map[string]dynamic.Interface
+	if len(kubernetesResources) != 0 {
+		kubernetesContextsDynamicClients, err = common.GetAllContextsDynamicClients(common.GetAllContextsDynamicClientsOptions{KubeConfig: *CommonCmdData.KubeConfig})
+		if err != nil {
+			return fmt.Errorf("unable to get Kubernetes clusters connections: %s", err)
+		}
+	}
+
 	imagesCleanupOptions := cleaning.ImagesCleanupOptions{
 		CommonRepoOptions: cleaning.CommonRepoOptions{
-			ImagesRepoManager: imagesRepoManager,
-			ImagesNames:       imagesNames,
-			DryRun:            *CommonCmdData.DryRun,
+			ImagesNames:   imagesNames,
+			DryRun:        *CommonCmdData.DryRun,
+			DeleteOptions: common.GetRepoImagesDeleteOptions(&CommonCmdData),
 		},
-		LocalGit:                  localRepo,
-		KubernetesContextsClients: kubernetesContextsClients,
-		WithoutKube:               *CommonCmdData.WithoutKube,
-		Policies:                  policies,
+		LocalGit:                         localRepo,
+		KubernetesContextsClients:        kubernetesContextsClients,
+		KubernetesContextsDynamicClients: kubernetesContextsDynamicClients,
+		KubernetesResources:              kubernetesResources,
+		WithoutKube:                      *CommonCmdData.WithoutKube,
+		Rules:                            rules,
+		ProtectedTags:                    protectedTags,
+
+		HelmReleaseStorageNamespace: *CommonCmdData.HelmReleaseStorageNamespace,
+		HelmReleaseStorageType:      helmReleaseStorageType,
+		HelmReleaseRevisions:        werfConfig.Meta.Cleanup.KubernetesWhitelist.HelmReleaseRevisions,
+
+		Plan:      plan,
+		ApplyPlan: applyPlan,
+	}
+
+	// each images repo is cleaned up independently
+	var deleteErrors []string
+	for _, imagesRepoManager := range imagesRepoManagers {
+		imagesCleanupOptions.CommonRepoOptions.ImagesRepoManager = imagesRepoManager
+
+		logboek.LogOptionalLn()
+		if err := cleaning.ImagesCleanup(imagesCleanupOptions); err != nil {
+			if !cleaning.IsRepoImagesDeleteError(err) {
+				return fmt.Errorf("images repo %s cleanup failed: %s", imagesRepoManager.ImagesRepo(), err)
+			}
+
+			deleteErrors = append(deleteErrors, fmt.Sprintf("images repo %s cleanup failed: %s", imagesRepoManager.ImagesRepo(), err))
+		}
 	}
 
-	logboek.LogOptionalLn()
-	if err := cleaning.ImagesCleanup(imagesCleanupOptions); err != nil {
-		return err
+	if plan != nil {
+		if err := plan.Save(*CommonCmdData.PlanOutput); err != nil {
+			return fmt.Errorf("cannot write cleanup plan %s: %s", *CommonCmdData.PlanOutput, err)
+		}
+	}
+
+	if len(deleteErrors) != 0 {
+		return fmt.Errorf("%s", strings.Join(deleteErrors, "\n"))
 	}
 
 	return nil
@@ -0,0 +1,147 @@
+package cmd_factory
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/flant/shluz"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flant/logboek"
+	"github.com/flant/werf/cmd/werf/common"
+	"github.com/flant/werf/pkg/cleaning"
+	"github.com/flant/werf/pkg/docker"
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/werf"
+)
+
+// NewCmdWithData returns images protect command or images unprotect command when protected is false
+func NewCmdWithData(commonCmdData *common.CmdData, protected bool) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "protect IMAGE_NAME:TAG",
+		Short: "Protect published image from cleanup",
+		Long: common.GetLongCommandDescription(`Protect published image from cleanup.
+
+The image is marked protected with the werf-protection.TAG marker tag in the images repo, images cleanup never deletes protected images (images purge ignores protection).
+
+IMAGE_NAME is the name of an image described in werf.yaml, the nameless image specified with ~ or empty name (e.g. :TAG).`),
+		Example: `  # Protect release image of the backend image
+  $ werf images protect --images-repo myregistry.mydomain.com/myproject backend:v1.2.0`,
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := common.ProcessLogOptions(commonCmdData); err != nil {
+				common.PrintHelp(cmd)
+				return err
+			}
+			common.LogVersion()
+
+			if len(args) != 1 {
+				common.PrintHelp(cmd)
+				return fmt.Errorf("IMAGE_NAME:TAG required")
+			}
+
+			return common.LogRunningTime(func() error {
+				return runProtect(commonCmdData, args[0], protected)
+			})
+		},
+	}
+
+	if !protected {
+		cmd.Use = "unprotect IMAGE_NAME:TAG"
+		cmd.Short = "Remove protection of published image from cleanup"
+		cmd.Long = common.GetLongCommandDescription(`Remove protection of published image from cleanup.
+
+The werf-protection.TAG marker tag in the images repo overrides the protected label, thus images published with --protect option can be unprotected too. Tags matching cleanup.protectedTags patterns from werf.yaml remain protected.
+
+IMAGE_NAME is the name of an image described in werf.yaml, the nameless image specified with ~ or empty name (e.g. :TAG).`)
+		cmd.Example = `  # Remove protection of release image of the backend image
+  $ werf images unprotect --images-repo myregistry.mydomain.com/myproject backend:v1.2.0`
+	}
+
+	common.SetupDir(commonCmdData, cmd)
+	common.SetupConfigValues(commonCmdData, cmd)
+	common.SetupTmpDir(commonCmdData, cmd)
+	common.SetupHomeDir(commonCmdData, cmd)
+
+	common.SetupImagesRepo(commonCmdData, cmd)
+	common.SetupImagesRepoMode(commonCmdData, cmd)
+	common.SetupDockerConfig(commonCmdData, cmd, "Command needs granted permissions to read images and push protection markers into the specified images repo")
+	common.SetupInsecureRegistry(commonCmdData, cmd)
+	common.SetupSkipTlsVerifyRegistry(commonCmdData, cmd)
+
+	common.SetupLogOptions(commonCmdData, cmd)
+	common.SetupLogProjectDir(commonCmdData, cmd)
+
+	return cmd
+}
+
+func runProtect(commonCmdData *common.CmdData, imageNameAndTag string, protected bool) error {
+	parts := strings.SplitN(imageNameAndTag, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return fmt.Errorf("bad image %s: IMAGE_NAME:TAG expected", imageNameAndTag)
+	}
+
+	imageName, tag := parts[0], parts[1]
+	if imageName == "~" {
+		imageName = ""
+	}
+
+	if err := werf.Init(*commonCmdData.TmpDir, *commonCmdData.HomeDir); err != nil {
+		return fmt.Errorf("initialization error: %s", err)
+	}
+
+	if err := shluz.Init(filepath.Join(werf.GetServiceDir(), "locks")); err != nil {
+		return err
+	}
+
+	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *commonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *commonCmdData.SkipTlsVerifyRegistry}); err != nil {
+		return err
+	}
+
+	if err := docker.Init(*commonCmdData.DockerConfig); err != nil {
+		return err
+	}
+
+	projectDir, err := common.GetProjectDir(commonCmdData)
+	if err != nil {
+		return fmt.Errorf("getting project dir failed: %s", err)
+	}
+
+	common.ProcessLogProjectDir(commonCmdData, projectDir)
+
+	werfConfig, err := common.GetWerfConfig(projectDir, commonCmdData)
+	if err != nil {
+		return fmt.Errorf("bad config: %s", err)
+	}
+
+	if !werfConfig.HasImage(imageName) {
+		return fmt.Errorf("image %q is not defined in werf.yaml", imageName)
+	}
+
+	projectName := werfConfig.Meta.Project
+
+	imagesRepo, err := common.GetImagesRepo(projectName, commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	imagesRepoMode, err := common.GetImagesRepoMode(commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	imagesRepoManager, err := common.GetImagesRepoManagerByMode(projectName, imagesRepo, imagesRepoMode, commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	logboek.LogOptionalLn()
+	return cleaning.ImagesProtect(cleaning.ImagesProtectOptions{
+		ImagesRepoManager: imagesRepoManager,
+		ImageName:         imageName,
+		Tag:               tag,
+		Protected:         protected,
+	})
+}
@@ -0,0 +1,14 @@
+package protect
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/flant/werf/cmd/werf/common"
+	"github.com/flant/werf/cmd/werf/images/protect/cmd_factory"
+)
+
+var CommonCmdData common.CmdData
+
+func NewCmd() *cobra.Command {
+	return cmd_factory.NewCmdWithData(&CommonCmdData, true)
+}
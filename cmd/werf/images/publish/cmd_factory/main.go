@@ -47,6 +47,7 @@ If one or more IMAGE_NAME parameters specified, werf will publish only these ima
 	}
 
 	common.SetupDir(commonCmdData, cmd)
+	common.SetupConfigValues(commonCmdData, cmd)
 	common.SetupTmpDir(commonCmdData, cmd)
 	common.SetupHomeDir(commonCmdData, cmd)
 	common.SetupSSHKey(commonCmdData, cmd)
@@ -59,6 +60,10 @@ If one or more IMAGE_NAME parameters specified, werf will publish only these ima
 	common.SetupDockerConfig(commonCmdData, cmd, "Command needs granted permissions to read and pull images from the specified stages storage and push images into images repo")
 	common.SetupInsecureRegistry(commonCmdData, cmd)
 	common.SetupSkipTlsVerifyRegistry(commonCmdData, cmd)
+	common.SetupForcePublish(commonCmdData, cmd)
+	common.SetupPublishParallelLayers(commonCmdData, cmd)
+	common.SetupPublishBestEffort(commonCmdData, cmd)
+	common.SetupProtect(commonCmdData, cmd)
 
 	common.SetupLogOptions(commonCmdData, cmd)
 	common.SetupLogProjectDir(commonCmdData, cmd)
@@ -94,7 +99,7 @@ func runImagesPublish(commonCmdData *common.CmdData, imagesToProcess []string) e
 
 	common.ProcessLogProjectDir(commonCmdData, projectDir)
 
-	werfConfig, err := common.GetWerfConfig(projectDir)
+	werfConfig, err := common.GetWerfConfig(projectDir, commonCmdData)
 	if err != nil {
 		return fmt.Errorf("bad config: %s", err)
 	}
@@ -118,22 +123,22 @@ func runImagesPublish(commonCmdData *common.CmdData, imagesToProcess []string) e
 		return err
 	}
 
-	imagesRepo, err := common.GetImagesRepo(projectName, commonCmdData)
+	imagesRepoManagers, err := common.GetImagesRepoManagers(projectName, commonCmdData)
 	if err != nil {
 		return err
 	}
 
-	imagesRepoMode, err := common.GetImagesRepoMode(commonCmdData)
-	if err != nil {
-		return err
+	var buildImagesRepoManagers []build.ImagesRepoManager
+	for _, imagesRepoManager := range imagesRepoManagers {
+		buildImagesRepoManagers = append(buildImagesRepoManagers, imagesRepoManager)
 	}
 
-	imagesRepoManager, err := common.GetImagesRepoManager(imagesRepo, imagesRepoMode)
+	tagOpts, err := common.GetTagOptions(commonCmdData, common.TagOptionsGetterOptions{})
 	if err != nil {
 		return err
 	}
 
-	tagOpts, err := common.GetTagOptions(commonCmdData, common.TagOptionsGetterOptions{})
+	parallelLayers, err := common.GetPublishParallelLayers(commonCmdData)
 	if err != nil {
 		return err
 	}
@@ -148,12 +153,18 @@ func runImagesPublish(commonCmdData *common.CmdData, imagesToProcess []string) e
 		}
 	}()
 
-	opts := build.PublishImagesOptions{TagOptions: tagOpts}
+	opts := build.PublishImagesOptions{
+		TagOptions:     tagOpts,
+		ForcePublish:   *commonCmdData.ForcePublish,
+		ParallelLayers: int(parallelLayers),
+		BestEffort:     *commonCmdData.PublishBestEffort,
+		Protect:        *commonCmdData.Protect,
+	}
 
 	c := build.NewConveyor(werfConfig, imagesToProcess, projectDir, projectTmpDir, ssh_agent.SSHAuthSock)
 	defer c.Terminate()
 
-	if err = c.PublishImages(imagesRepoManager, opts); err != nil {
+	if err = c.PublishImages(buildImagesRepoManagers, opts); err != nil {
 		return err
 	}
 
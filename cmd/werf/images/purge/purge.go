@@ -39,6 +39,7 @@ func NewCmd() *cobra.Command {
 	}
 
 	common.SetupDir(&CommonCmdData, cmd)
+	common.SetupConfigValues(&CommonCmdData, cmd)
 	common.SetupTmpDir(&CommonCmdData, cmd)
 	common.SetupHomeDir(&CommonCmdData, cmd)
 
@@ -47,6 +48,8 @@ func NewCmd() *cobra.Command {
 	common.SetupDockerConfig(&CommonCmdData, cmd, "Command needs granted permissions to delete images from the specified images repo")
 	common.SetupInsecureRegistry(&CommonCmdData, cmd)
 	common.SetupSkipTlsVerifyRegistry(&CommonCmdData, cmd)
+	common.SetupRepoImplementation(&CommonCmdData, cmd)
+	common.SetupRegistryDelete(&CommonCmdData, cmd)
 
 	common.SetupLogOptions(&CommonCmdData, cmd)
 	common.SetupLogProjectDir(&CommonCmdData, cmd)
@@ -65,7 +68,7 @@ func runPurge() error {
 		return err
 	}
 
-	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *CommonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *CommonCmdData.SkipTlsVerifyRegistry}); err != nil {
+	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *CommonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *CommonCmdData.SkipTlsVerifyRegistry, RepoImplementation: *CommonCmdData.RepoImplementation, QuayToken: common.GetQuayToken()}); err != nil {
 		return err
 	}
 
@@ -80,7 +83,7 @@ func runPurge() error {
 
 	common.ProcessLogProjectDir(&CommonCmdData, projectDir)
 
-	werfConfig, err := common.GetWerfConfig(projectDir)
+	werfConfig, err := common.GetWerfConfig(projectDir, &CommonCmdData)
 	if err != nil {
 		return fmt.Errorf("bad config: %s", err)
 	}
@@ -97,7 +100,7 @@ func runPurge() error {
 		return err
 	}
 
-	imagesRepoManager, err := common.GetImagesRepoManager(imagesRepo, imagesRepoMode)
+	imagesRepoManager, err := common.GetImagesRepoManagerByMode(projectName, imagesRepo, imagesRepoMode, &CommonCmdData)
 	if err != nil {
 		return err
 	}
@@ -115,6 +118,7 @@ func runPurge() error {
 		ImagesRepoManager: imagesRepoManager,
 		ImagesNames:       imageNames,
 		DryRun:            *CommonCmdData.DryRun,
+		DeleteOptions:     common.GetRepoImagesDeleteOptions(&CommonCmdData),
 	}
 
 	logboek.LogOptionalLn()
@@ -29,8 +29,10 @@ import (
 	"github.com/flant/werf/cmd/werf/slugify"
 
 	images_cleanup "github.com/flant/werf/cmd/werf/images/cleanup"
+	images_protect "github.com/flant/werf/cmd/werf/images/protect"
 	images_publish "github.com/flant/werf/cmd/werf/images/publish"
 	images_purge "github.com/flant/werf/cmd/werf/images/purge"
+	images_unprotect "github.com/flant/werf/cmd/werf/images/unprotect"
 
 	stages_build "github.com/flant/werf/cmd/werf/stages/build"
 	stages_cleanup "github.com/flant/werf/cmd/werf/stages/cleanup"
@@ -46,6 +48,7 @@ import (
 	helm_delete "github.com/flant/werf/cmd/werf/helm/delete"
 	helm_dependency "github.com/flant/werf/cmd/werf/helm/dependency"
 	helm_deploy_chart "github.com/flant/werf/cmd/werf/helm/deploy_chart"
+	helm_diff "github.com/flant/werf/cmd/werf/helm/diff"
 	helm_get "github.com/flant/werf/cmd/werf/helm/get"
 	helm_get_autogenerated_values "github.com/flant/werf/cmd/werf/helm/get_autogenerated_values"
 	helm_get_namespace "github.com/flant/werf/cmd/werf/helm/get_namespace"
@@ -57,8 +60,10 @@ import (
 	helm_repo "github.com/flant/werf/cmd/werf/helm/repo"
 	helm_rollback "github.com/flant/werf/cmd/werf/helm/rollback"
 
+	config_graph "github.com/flant/werf/cmd/werf/config/graph"
 	config_list "github.com/flant/werf/cmd/werf/config/list"
 	config_render "github.com/flant/werf/cmd/werf/config/render"
+	config_validate "github.com/flant/werf/cmd/werf/config/validate"
 
 	"github.com/flant/werf/cmd/werf/completion"
 	"github.com/flant/werf/cmd/werf/docs"
@@ -147,6 +152,8 @@ func configCmd() *cobra.Command {
 	cmd.AddCommand(
 		config_render.NewCmd(),
 		config_list.NewCmd(),
+		config_validate.NewCmd(),
+		config_graph.NewCmd(),
 	)
 
 	return cmd
@@ -161,6 +168,8 @@ func imagesCmd() *cobra.Command {
 		images_publish.NewCmd(),
 		images_cleanup.NewCmd(),
 		images_purge.NewCmd(),
+		images_protect.NewCmd(),
+		images_unprotect.NewCmd(),
 	)
 
 	return cmd
@@ -204,6 +213,7 @@ func helmCmd() *cobra.Command {
 		helm_deploy_chart.NewCmd(),
 		helm_lint.NewCmd(),
 		helm_render.NewCmd(),
+		helm_diff.NewCmd(),
 		helm_list.NewCmd(),
 		helm_delete.NewCmd(),
 		helm_rollback.NewCmd(),
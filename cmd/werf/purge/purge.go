@@ -46,6 +46,7 @@ WARNING: Do not run this command during any other werf command is working on the
 	}
 
 	common.SetupDir(&CommonCmdData, cmd)
+	common.SetupConfigValues(&CommonCmdData, cmd)
 	common.SetupTmpDir(&CommonCmdData, cmd)
 	common.SetupHomeDir(&CommonCmdData, cmd)
 
@@ -55,6 +56,8 @@ WARNING: Do not run this command during any other werf command is working on the
 	common.SetupDockerConfig(&CommonCmdData, cmd, "Command needs granted permissions to delete images from the specified stages storage and images repo")
 	common.SetupInsecureRegistry(&CommonCmdData, cmd)
 	common.SetupSkipTlsVerifyRegistry(&CommonCmdData, cmd)
+	common.SetupRepoImplementation(&CommonCmdData, cmd)
+	common.SetupRegistryDelete(&CommonCmdData, cmd)
 
 	common.SetupLogOptions(&CommonCmdData, cmd)
 	common.SetupLogProjectDir(&CommonCmdData, cmd)
@@ -86,7 +89,7 @@ func runPurge() error {
 		return err
 	}
 
-	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *CommonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *CommonCmdData.SkipTlsVerifyRegistry}); err != nil {
+	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *CommonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *CommonCmdData.SkipTlsVerifyRegistry, RepoImplementation: *CommonCmdData.RepoImplementation, QuayToken: common.GetQuayToken()}); err != nil {
 		return err
 	}
 
@@ -94,7 +97,7 @@ func runPurge() error {
 		return err
 	}
 
-	werfConfig, err := common.GetWerfConfig(projectDir)
+	werfConfig, err := common.GetWerfConfig(projectDir, &CommonCmdData)
 	if err != nil {
 		return fmt.Errorf("bad config: %s", err)
 	}
@@ -111,7 +114,7 @@ func runPurge() error {
 		return err
 	}
 
-	imagesRepoManager, err := common.GetImagesRepoManager(imagesRepo, imagesRepoMode)
+	imagesRepoManager, err := common.GetImagesRepoManagerByMode(projectName, imagesRepo, imagesRepoMode, &CommonCmdData)
 	if err != nil {
 		return err
 	}
@@ -129,6 +132,7 @@ func runPurge() error {
 		ImagesRepoManager: imagesRepoManager,
 		ImagesNames:       imageNames,
 		DryRun:            *CommonCmdData.DryRun,
+		DeleteOptions:     common.GetRepoImagesDeleteOptions(&CommonCmdData),
 	}
 
 	stagesPurgeOptions := cleaning.StagesPurgeOptions{
@@ -69,6 +69,7 @@ If one or more IMAGE_NAME parameters specified, werf will build only these image
 	}
 
 	common.SetupDir(commonCmdData, cmd)
+	common.SetupConfigValues(commonCmdData, cmd)
 	common.SetupTmpDir(commonCmdData, cmd)
 	common.SetupHomeDir(commonCmdData, cmd)
 	common.SetupSSHKey(commonCmdData, cmd)
@@ -117,7 +118,7 @@ func runStagesBuild(cmdData *CmdData, commonCmdData *common.CmdData, imagesToPro
 
 	common.ProcessLogProjectDir(commonCmdData, projectDir)
 
-	werfConfig, err := common.GetWerfConfig(projectDir)
+	werfConfig, err := common.GetWerfConfig(projectDir, commonCmdData)
 	if err != nil {
 		return fmt.Errorf("bad config: %s", err)
 	}
@@ -2,8 +2,10 @@ package cleanup
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 
+	"github.com/docker/go-units"
 	"github.com/flant/shluz"
 
 	"github.com/spf13/cobra"
@@ -14,10 +16,14 @@ import (
 	"github.com/flant/werf/pkg/docker"
 	"github.com/flant/werf/pkg/docker_registry"
 	"github.com/flant/werf/pkg/tmp_manager"
+	"github.com/flant/werf/pkg/util"
 	"github.com/flant/werf/pkg/werf"
 )
 
-var CmdData struct{}
+var CmdData struct {
+	KeepUsedWithin string
+	KeepSize       string
+}
 
 var CommonCmdData common.CmdData
 
@@ -42,6 +48,7 @@ func NewCmd() *cobra.Command {
 	}
 
 	common.SetupDir(&CommonCmdData, cmd)
+	common.SetupConfigValues(&CommonCmdData, cmd)
 	common.SetupTmpDir(&CommonCmdData, cmd)
 	common.SetupHomeDir(&CommonCmdData, cmd)
 
@@ -51,12 +58,17 @@ func NewCmd() *cobra.Command {
 	common.SetupDockerConfig(&CommonCmdData, cmd, "Command needs granted permissions to read, pull and delete images from the specified stages storage, read images from the specified images repo")
 	common.SetupInsecureRegistry(&CommonCmdData, cmd)
 	common.SetupSkipTlsVerifyRegistry(&CommonCmdData, cmd)
+	common.SetupRepoImplementation(&CommonCmdData, cmd)
+	common.SetupRegistryDelete(&CommonCmdData, cmd)
 
 	common.SetupLogOptions(&CommonCmdData, cmd)
 	common.SetupLogProjectDir(&CommonCmdData, cmd)
 
 	common.SetupDryRun(&CommonCmdData, cmd)
 
+	cmd.Flags().StringVarP(&CmdData.KeepUsedWithin, "keep-used-within", "", os.Getenv("WERF_KEEP_USED_WITHIN"), "Remove :local stages that have not been used by builds within the specified period, e.g. 14d or 72h (default $WERF_KEEP_USED_WITHIN)")
+	cmd.Flags().StringVarP(&CmdData.KeepSize, "keep-size", "", os.Getenv("WERF_KEEP_SIZE"), "Remove the least recently used :local stages until the project stages fit in the specified size, e.g. 50G (default $WERF_KEEP_SIZE)")
+
 	return cmd
 }
 
@@ -69,7 +81,7 @@ func runSync() error {
 		return err
 	}
 
-	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *CommonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *CommonCmdData.SkipTlsVerifyRegistry}); err != nil {
+	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *CommonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *CommonCmdData.SkipTlsVerifyRegistry, RepoImplementation: *CommonCmdData.RepoImplementation, QuayToken: common.GetQuayToken()}); err != nil {
 		return err
 	}
 
@@ -90,7 +102,7 @@ func runSync() error {
 	}
 	defer tmp_manager.ReleaseProjectDir(projectTmpDir)
 
-	werfConfig, err := common.GetWerfConfig(projectDir)
+	werfConfig, err := common.GetWerfConfig(projectDir, &CommonCmdData)
 	if err != nil {
 		return fmt.Errorf("bad config: %s", err)
 	}
@@ -107,7 +119,7 @@ func runSync() error {
 		return err
 	}
 
-	imagesRepoManager, err := common.GetImagesRepoManager(imagesRepo, imagesRepoMode)
+	imagesRepoManager, err := common.GetImagesRepoManagerByMode(projectName, imagesRepo, imagesRepoMode, &CommonCmdData)
 	if err != nil {
 		return err
 	}
@@ -128,6 +140,27 @@ func runSync() error {
 		StagesStorage:     stagesRepo,
 		ImagesNames:       imagesNames,
 		DryRun:            *CommonCmdData.DryRun,
+		DeleteOptions:     common.GetRepoImagesDeleteOptions(&CommonCmdData),
+	}
+
+	if CmdData.KeepUsedWithin != "" {
+		keepUsedWithin, err := util.ParseDuration(CmdData.KeepUsedWithin)
+		if err != nil {
+			return fmt.Errorf("bad --keep-used-within value %q: %s", CmdData.KeepUsedWithin, err)
+		}
+
+		stagesCleanupOptions.HasKeepUsedWithin = true
+		stagesCleanupOptions.KeepUsedWithin = keepUsedWithin
+	}
+
+	if CmdData.KeepSize != "" {
+		keepSize, err := units.RAMInBytes(CmdData.KeepSize)
+		if err != nil {
+			return fmt.Errorf("bad --keep-size value %q: %s", CmdData.KeepSize, err)
+		}
+
+		stagesCleanupOptions.HasKeepSize = true
+		stagesCleanupOptions.KeepSize = keepSize
 	}
 
 	logboek.LogOptionalLn()
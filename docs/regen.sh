@@ -20,3 +20,5 @@ README=$SOURCE/../README_ru.md
 README_PARTIALS_DIR=$SOURCE/_includes/readme_ru
 
 werf docs --split-readme --readme $README --dir $README_PARTIALS_DIR
+
+werf docs --json-schema --dir $SOURCE/schemas
@@ -11,6 +11,7 @@ import (
 	"github.com/flant/werf/pkg/build/stage"
 	"github.com/flant/werf/pkg/docker"
 	imagePkg "github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/stages_usage"
 	"github.com/flant/werf/pkg/werf"
 )
 
@@ -180,9 +181,23 @@ func (p *BuildStagesPhase) runImage(image *Image, c *Conveyor) error {
 		}
 	}
 
+	touchStagesUsage(c, stages)
+
 	return nil
 }
 
+// touchStagesUsage records the usage of the stages for the stages cleanup, the failure does not break the build
+func touchStagesUsage(c *Conveyor, stages []stage.Interface) {
+	var signatures []string
+	for _, s := range stages {
+		signatures = append(signatures, s.GetSignature())
+	}
+
+	if err := stages_usage.Touch(c.projectName(), signatures...); err != nil {
+		logboek.LogErrorF("WARNING: Stages usage cannot be recorded: %s\n", err)
+	}
+}
+
 func introspectStage(s stage.Interface) error {
 	logProcessMessage := fmt.Sprintf("Introspecting stage %s", s.Name())
 	logProcessOptions := logboek.LogProcessOptions{ColorizeMsgFunc: logboek.ColorizeHighlight}
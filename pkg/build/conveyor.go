@@ -196,6 +196,10 @@ type TagOptions struct {
 	TagsByGitTag    []string
 	TagsByGitBranch []string
 	TagsByGitCommit []string
+	// TagsByGitSemver are git tags with semantic version, final tags are calculated for each image on publish
+	TagsByGitSemver []string
+	// TagByStagesSignature enables tagging by the signature of the last image stage
+	TagByStagesSignature bool
 }
 
 type ImagesRepoManager interface {
@@ -203,10 +207,20 @@ type ImagesRepoManager interface {
 	ImageRepo(imageName string) string
 	ImageRepoTag(imageName, tag string) string
 	ImageRepoWithTag(imageName, tag string) string
+	ParseImageRepoTag(imageName, imageRepo, imageRepoTag string) (string, bool)
 }
 
 type PublishImagesOptions struct {
 	TagOptions
+
+	// ForcePublish disables skipping of tags that already hold the same image in the images repo
+	ForcePublish bool
+	// ParallelLayers limits the number of concurrently uploaded layers of the image, 0 means no limit
+	ParallelLayers int
+	// BestEffort continues publishing into the other images repos when publishing into one of them failed
+	BestEffort bool
+	// Protect marks published images protected from cleanup
+	Protect bool
 }
 
 func (c *Conveyor) ShouldBeBuilt() error {
@@ -218,14 +232,51 @@ func (c *Conveyor) ShouldBeBuilt() error {
 	return c.runPhases(phases)
 }
 
-func (c *Conveyor) PublishImages(imagesRepoManager ImagesRepoManager, opts PublishImagesOptions) error {
+type ImageStagesStatus struct {
+	Signature          string
+	StagesNumber       int
+	CachedStagesNumber int
+}
+
+// GetImagesStagesStatus calculates stages signatures and checks which stages exist in the stages storage without building anything
+func (c *Conveyor) GetImagesStagesStatus() (map[string]*ImageStagesStatus, error) {
+	var phases []Phase
+	phases = append(phases, NewInitializationPhase())
+	phases = append(phases, NewSignaturesPhase(false))
+
+	if err := c.runPhases(phases); err != nil {
+		return nil, err
+	}
+
+	res := map[string]*ImageStagesStatus{}
+	for _, image := range c.imagesInOrder {
+		status := &ImageStagesStatus{}
+
+		for _, s := range image.GetStages() {
+			status.StagesNumber++
+			if s.GetImage().IsExists() {
+				status.CachedStagesNumber++
+			}
+		}
+
+		if len(image.GetStages()) != 0 {
+			status.Signature = image.LatestStage().GetSignature()
+		}
+
+		res[image.GetName()] = status
+	}
+
+	return res, nil
+}
+
+func (c *Conveyor) PublishImages(imagesRepoManagers []ImagesRepoManager, opts PublishImagesOptions) error {
 	var err error
 
 	var phases []Phase
 	phases = append(phases, NewInitializationPhase())
 	phases = append(phases, NewSignaturesPhase(false))
 	phases = append(phases, NewShouldBeBuiltPhase())
-	phases = append(phases, NewPublishImagesPhase(imagesRepoManager, opts))
+	phases = append(phases, NewPublishImagesPhase(imagesRepoManagers, opts))
 
 	lockName, err := c.lockAllImagesReadOnly()
 	if err != nil {
@@ -241,9 +292,9 @@ type BuildAndPublishOptions struct {
 	PublishImagesOptions
 }
 
-func (c *Conveyor) BuildAndPublish(stagesRepo string, imagesRepoManager ImagesRepoManager, opts BuildAndPublishOptions) error {
+func (c *Conveyor) BuildAndPublish(stagesRepo string, imagesRepoManagers []ImagesRepoManager, opts BuildAndPublishOptions) error {
 restart:
-	if err := c.buildAndPublish(stagesRepo, imagesRepoManager, opts); err != nil {
+	if err := c.buildAndPublish(stagesRepo, imagesRepoManagers, opts); err != nil {
 		if isConveyorShouldBeResetError(err) {
 			c.ReInitRuntimeFields()
 			goto restart
@@ -255,7 +306,7 @@ restart:
 	return nil
 }
 
-func (c *Conveyor) buildAndPublish(stagesRepo string, imagesRepoManager ImagesRepoManager, opts BuildAndPublishOptions) error {
+func (c *Conveyor) buildAndPublish(stagesRepo string, imagesRepoManagers []ImagesRepoManager, opts BuildAndPublishOptions) error {
 	var err error
 
 	var phases []Phase
@@ -264,7 +315,7 @@ func (c *Conveyor) buildAndPublish(stagesRepo string, imagesRepoManager ImagesRe
 	phases = append(phases, NewRenewPhase())
 	phases = append(phases, NewPrepareStagesPhase())
 	phases = append(phases, NewBuildStagesPhase(stagesRepo, opts.BuildStagesOptions))
-	phases = append(phases, NewPublishImagesPhase(imagesRepoManager, opts.PublishImagesOptions))
+	phases = append(phases, NewPublishImagesPhase(imagesRepoManagers, opts.PublishImagesOptions))
 
 	lockName, err := c.lockAllImagesReadOnly()
 	if err != nil {
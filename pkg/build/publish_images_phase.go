@@ -2,36 +2,98 @@ package build
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/flant/logboek"
 	"github.com/flant/shluz"
 
+	"github.com/flant/werf/pkg/docker"
 	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/git_repo"
 	imagePkg "github.com/flant/werf/pkg/image"
 	"github.com/flant/werf/pkg/tag_strategy"
 	"github.com/flant/werf/pkg/util"
+	"github.com/flant/werf/pkg/werf"
 )
 
-func NewPublishImagesPhase(imagesRepoManager ImagesRepoManager, opts PublishImagesOptions) *PublishImagesPhase {
+func NewPublishImagesPhase(imagesRepoManagers []ImagesRepoManager, opts PublishImagesOptions) *PublishImagesPhase {
 	tagsByScheme := map[tag_strategy.TagStrategy][]string{
 		tag_strategy.Custom:    opts.CustomTags,
 		tag_strategy.GitBranch: opts.TagsByGitBranch,
 		tag_strategy.GitTag:    opts.TagsByGitTag,
 		tag_strategy.GitCommit: opts.TagsByGitCommit,
+		tag_strategy.GitSemver: opts.TagsByGitSemver,
+	}
+	return &PublishImagesPhase{
+		TagsByScheme:         tagsByScheme,
+		TagByStagesSignature: opts.TagByStagesSignature,
+		ForcePublish:         opts.ForcePublish,
+		ParallelLayers:       opts.ParallelLayers,
+		BestEffort:           opts.BestEffort,
+		Protect:              opts.Protect,
+		ImagesRepoManagers:   imagesRepoManagers,
 	}
-	return &PublishImagesPhase{TagsByScheme: tagsByScheme, ImageRepoManager: imagesRepoManager}
 }
 
 type PublishImagesPhase struct {
-	WithStages       bool
-	TagsByScheme     map[tag_strategy.TagStrategy][]string
-	ImageRepoManager ImagesRepoManager
+	WithStages           bool
+	TagsByScheme         map[tag_strategy.TagStrategy][]string
+	TagByStagesSignature bool
+	ForcePublish         bool
+	ParallelLayers       int
+	BestEffort           bool
+	Protect              bool
+	ImagesRepoManagers   []ImagesRepoManager
+
+	existingTagsByRepository   map[string][]string
+	imagesMetadataByRepository map[string]map[string]docker_registry.ImageMetadata
+	skippedTagsByRepository    map[string][]string
+	gitCommit                  string
+	gitCommitTime              *time.Time
+	publishedImages            []string
+	skippedImages              []string
+	failures                   []string
+	lastPublishedRepository    string
+
+	// referencingGitCommitsByRepository are commits by stages-signature tags skipped as up-to-date
+	referencingGitCommitsByRepository map[string]map[string][]string
 }
 
 func (p *PublishImagesPhase) Run(c *Conveyor) error {
 	logProcessOptions := logboek.LogProcessOptions{ColorizeMsgFunc: logboek.ColorizeHighlight}
 	return logboek.LogProcess("Publishing images", logProcessOptions, func() error {
-		return p.run(c)
+		err := p.run(c)
+		if err == nil || p.BestEffort {
+			p.logSummary()
+		}
+
+		return err
+	})
+}
+
+func (p *PublishImagesPhase) logSummary() {
+	logboek.LogBlock("Publish summary", logboek.LogBlockOptions{}, func() {
+		logboek.LogF("Published: %d\n", len(p.publishedImages))
+		for _, imageName := range p.publishedImages {
+			logboek.LogF("  %s\n", imageName)
+		}
+
+		logboek.LogF("Skipped (up-to-date): %d\n", len(p.skippedImages))
+		for _, imageName := range p.skippedImages {
+			logboek.LogF("  %s\n", imageName)
+		}
+
+		if len(p.failures) != 0 {
+			logboek.LogF("Failed: %d\n", len(p.failures))
+			for _, failure := range p.failures {
+				logboek.LogF("  %s\n", failure)
+			}
+		}
 	})
 }
 
@@ -47,6 +109,39 @@ func (p *PublishImagesPhase) run(c *Conveyor) error {
 		}
 	}
 
+	var err error
+	p.gitCommit, p.gitCommitTime, err = projectHeadCommit(c)
+	if err != nil {
+		return err
+	}
+
+	p.imagesMetadataByRepository = map[string]map[string]docker_registry.ImageMetadata{}
+	p.skippedTagsByRepository = map[string][]string{}
+	p.referencingGitCommitsByRepository = map[string]map[string][]string{}
+
+	// existing tags of all images repos are fetched before publishing:
+	// nothing is published if one of the images repos is not accessible, unless best-effort mode is enabled
+	p.existingTagsByRepository = map[string][]string{}
+	failedImagesRepos := map[string]bool{}
+	for _, imagesRepoManager := range p.ImagesRepoManagers {
+		for _, image := range imagesToPublish {
+			if image.isArtifact {
+				continue
+			}
+
+			if err := p.fetchExistingTags(imagesRepoManager.ImageRepo(image.GetName())); err != nil {
+				if !p.BestEffort {
+					return err
+				}
+
+				p.failures = append(p.failures, fmt.Sprintf("%s: %s", imagesRepoManager.ImagesRepo(), err))
+				failedImagesRepos[imagesRepoManager.ImagesRepo()] = true
+
+				break
+			}
+		}
+	}
+
 	for _, image := range imagesToPublish {
 		if image.isArtifact { // FIXME: distributed stages
 			continue
@@ -67,9 +162,32 @@ func (p *PublishImagesPhase) run(c *Conveyor) error {
 			//	}
 			//}
 
-			if !image.isArtifact {
-				if err := p.pushImage(c, image); err != nil {
-					return fmt.Errorf("unable to push image %s: %s", image.LogName(), err)
+			for _, imagesRepoManager := range p.ImagesRepoManagers {
+				if failedImagesRepos[imagesRepoManager.ImagesRepo()] {
+					continue
+				}
+
+				pushImageFunc := func() error {
+					if err := p.pushImage(c, image, imagesRepoManager); err != nil {
+						return fmt.Errorf("unable to push image %s: %s", image.LogName(), err)
+					}
+
+					return nil
+				}
+
+				var err error
+				if len(p.ImagesRepoManagers) > 1 {
+					err = logboek.LogProcess(fmt.Sprintf("Images repo %s", imagesRepoManager.ImagesRepo()), logboek.LogProcessOptions{}, pushImageFunc)
+				} else {
+					err = pushImageFunc()
+				}
+
+				if err != nil {
+					if !p.BestEffort {
+						return err
+					}
+
+					p.failures = append(p.failures, fmt.Sprintf("%s: %s", imagesRepoManager.ImageRepo(image.GetName()), err))
 				}
 			}
 
@@ -79,6 +197,48 @@ func (p *PublishImagesPhase) run(c *Conveyor) error {
 		}
 	}
 
+	if err := p.writeImagesMetadata(); err != nil {
+		return err
+	}
+
+	if p.Protect {
+		if err := p.writeProtectionMarkers(); err != nil {
+			return err
+		}
+	}
+
+	if len(p.failures) != 0 {
+		return fmt.Errorf("publishing into images repos failed:\n%s", strings.Join(p.failures, "\n"))
+	}
+
+	return nil
+}
+
+func (p *PublishImagesPhase) fetchExistingTags(imageRepository string) error {
+	if _, ok := p.existingTagsByRepository[imageRepository]; ok {
+		return nil
+	}
+
+	var existingTags []string
+	var err error
+	fetchExistingTagsFunc := func() error {
+		existingTags, err = docker_registry.Tags(imageRepository)
+		return err
+	}
+
+	if debug() {
+		err = logboek.LogProcessInline(fmt.Sprintf("Fetching existing tags of %s", imageRepository), logboek.LogProcessInlineOptions{}, fetchExistingTagsFunc)
+		logboek.LogOptionalLn()
+	} else {
+		err = fetchExistingTagsFunc()
+	}
+
+	if err != nil {
+		return fmt.Errorf("error fetch existing tags of image %s: %s", imageRepository, err)
+	}
+
+	p.existingTagsByRepository[imageRepository] = existingTags
+
 	return nil
 }
 
@@ -142,26 +302,9 @@ func (p *PublishImagesPhase) run(c *Conveyor) error {
 //	return nil
 //}
 
-func (p *PublishImagesPhase) pushImage(c *Conveyor, image *Image) error {
-	imageRepository := p.ImageRepoManager.ImageRepo(image.GetName())
-
-	var existingTags []string
-	var err error
-	fetchExistingTagsFunc := func() error {
-		existingTags, err = docker_registry.Tags(imageRepository)
-		return err
-	}
-
-	if debug() {
-		err = logboek.LogProcessInline("Fetching existing image tags", logboek.LogProcessInlineOptions{}, fetchExistingTagsFunc)
-		logboek.LogOptionalLn()
-	} else {
-		err = fetchExistingTagsFunc()
-	}
-
-	if err != nil {
-		return fmt.Errorf("error fetch existing tags of image %s: %s", imageRepository, err)
-	}
+func (p *PublishImagesPhase) pushImage(c *Conveyor, image *Image, imagesRepoManager ImagesRepoManager) error {
+	imageRepository := imagesRepoManager.ImageRepo(image.GetName())
+	existingTags := p.existingTagsByRepository[imageRepository]
 
 	stages := image.GetStages()
 	lastStageImage := stages[len(stages)-1].GetImage()
@@ -175,43 +318,67 @@ func (p *PublishImagesPhase) pushImage(c *Conveyor, image *Image) error {
 		nonEmptySchemeInOrder = append(nonEmptySchemeInOrder, strategy)
 	}
 
+	if p.TagByStagesSignature {
+		nonEmptySchemeInOrder = append(nonEmptySchemeInOrder, tag_strategy.StagesSignature)
+	}
+
+	var err error
 	for _, strategy := range nonEmptySchemeInOrder {
 		imageMetaTags := p.TagsByScheme[strategy]
 
-		if len(imageMetaTags) == 0 {
-			continue
+		var gitTag, gitCommit string
+		switch strategy {
+		case tag_strategy.GitSemver:
+			gitTag = imageMetaTags[0]
+
+			imageMetaTags, err = tag_strategy.SemverTags(gitTag, existingImageMetaTags(imagesRepoManager, image, existingTags))
+			if err != nil {
+				return err
+			}
+		case tag_strategy.StagesSignature:
+			imageMetaTags = []string{stages[len(stages)-1].GetSignature()}
+			gitCommit = p.gitCommit
 		}
 
 		logProcessOptions := logboek.LogProcessOptions{ColorizeMsgFunc: logboek.ColorizeHighlight}
 		err := logboek.LogProcess(fmt.Sprintf("%s tagging strategy", string(strategy)), logProcessOptions, func() error {
 		ProcessingTags:
 			for _, imageMetaTag := range imageMetaTags {
-				imageName := p.ImageRepoManager.ImageRepoWithTag(image.GetName(), imageMetaTag)
-				imageTag := p.ImageRepoManager.ImageRepoTag(image.GetName(), imageMetaTag)
+				imageName := imagesRepoManager.ImageRepoWithTag(image.GetName(), imageMetaTag)
+				imageTag := imagesRepoManager.ImageRepoTag(image.GetName(), imageMetaTag)
 				tagLogName := fmt.Sprintf("tag %s", imageTag)
 
-				if util.IsStringsContainValue(existingTags, imageTag) {
-					var parentID string
-					var err error
-					getImageParentIDFunc := func() error {
-						parentID, err = docker_registry.ImageParentId(imageName)
-						return err
-					}
-
-					if debug() {
-						logProcessMsg := fmt.Sprintf("Getting existing tag %s parent id", imageTag)
-						err = logboek.LogProcessInline(logProcessMsg, logboek.LogProcessInlineOptions{}, getImageParentIDFunc)
-						logboek.LogOptionalLn()
+				if util.IsStringsContainValue(existingTags, imageTag) && !p.ForcePublish {
+					var isUpToDate bool
+					var upToDateMsg string
+					if strategy == tag_strategy.StagesSignature {
+						// the tag is content addressed: the same signature means the same image
+						isUpToDate = true
+						upToDateMsg = fmt.Sprintf("Tag %s already exists", imageTag)
 					} else {
-						err = getImageParentIDFunc()
-					}
+						var err error
+						checkTagFunc := func() error {
+							isUpToDate, err = isTagUpToDate(imageName, lastStageImage.ID())
+							return err
+						}
+
+						if debug() {
+							logProcessMsg := fmt.Sprintf("Comparing existing tag %s with local image", imageTag)
+							err = logboek.LogProcessInline(logProcessMsg, logboek.LogProcessInlineOptions{}, checkTagFunc)
+							logboek.LogOptionalLn()
+						} else {
+							err = checkTagFunc()
+						}
 
-					if err != nil {
-						return fmt.Errorf("unable to get image %s parent id: %s", imageName, err)
+						if err != nil {
+							return fmt.Errorf("unable to check existing tag %s: %s", imageName, err)
+						}
+
+						upToDateMsg = fmt.Sprintf("Tag %s is up-to-date", imageTag)
 					}
 
-					if lastStageImage.ID() == parentID {
-						logboek.LogHighlightF("Tag %s is up-to-date\n", imageTag)
+					if isUpToDate {
+						logboek.LogHighlightLn(upToDateMsg)
 						_ = logboek.WithIndent(func() error {
 							logboek.LogInfoF("images-repo: %s\n", imageRepository)
 							logboek.LogInfoF("      image: %s\n", imageName)
@@ -221,6 +388,13 @@ func (p *PublishImagesPhase) pushImage(c *Conveyor, image *Image) error {
 
 						logboek.LogOptionalLn()
 
+						p.skippedImages = append(p.skippedImages, imageName)
+						p.skippedTagsByRepository[imageRepository] = append(p.skippedTagsByRepository[imageRepository], imageTag)
+
+						if strategy == tag_strategy.StagesSignature && gitCommit != "" {
+							p.addReferencingGitCommit(imageRepository, imageTag, gitCommit)
+						}
+
 						continue ProcessingTags
 					}
 				}
@@ -234,18 +408,34 @@ func (p *PublishImagesPhase) pushImage(c *Conveyor, image *Image) error {
 
 					pushImage := imagePkg.NewImage(c.GetStageImage(lastStageImage.Name()), imageName)
 
-					pushImage.Container().ServiceCommitChangeOptions().AddLabel(map[string]string{
+					labels := map[string]string{
 						imagePkg.WerfDockerImageName:  imageName,
 						imagePkg.WerfTagStrategyLabel: string(strategy),
 						imagePkg.WerfImageLabel:       "true",
 						imagePkg.WerfImageNameLabel:   image.GetName(),
 						imagePkg.WerfImageTagLabel:    imageMetaTag,
-					})
+					}
+
+					if p.Protect {
+						labels[imagePkg.WerfProtectedLabel] = "true"
+					}
+
+					if gitTag != "" {
+						labels[imagePkg.WerfGitTagLabel] = gitTag
+					}
+
+					if gitCommit != "" {
+						labels[imagePkg.WerfGitCommitLabel] = gitCommit
+					}
+
+					pushImage.Container().ServiceCommitChangeOptions().AddLabel(labels)
 
+					var digest string
 					successInfoSectionFunc := func() {
 						_ = logboek.WithIndent(func() error {
 							logboek.LogInfoF("images-repo: %s\n", imageRepository)
 							logboek.LogInfoF("      image: %s\n", imageName)
+							logboek.LogInfoF("     digest: %s\n", digest)
 
 							return nil
 						})
@@ -262,10 +452,35 @@ func (p *PublishImagesPhase) pushImage(c *Conveyor, image *Image) error {
 							return err
 						}
 
-						if err := pushImage.Export(); err != nil {
+						digest, err = p.publishImage(c, pushImage, imageName, imageRepository)
+						if err != nil {
 							return fmt.Errorf("error pushing %s: %s", imageName, err)
 						}
 
+						p.publishedImages = append(p.publishedImages, fmt.Sprintf("%s@%s", imageName, digest))
+
+						inspect, err := pushImage.MustGetInspect()
+						if err != nil {
+							return err
+						}
+
+						created, err := time.Parse(time.RFC3339Nano, inspect.Created)
+						if err != nil {
+							return fmt.Errorf("unable to parse image %s creation time: %s", imageName, err)
+						}
+
+						p.addImageMetadata(imageRepository, imageTag, docker_registry.ImageMetadata{
+							ImageName:     image.GetName(),
+							TagStrategy:   string(strategy),
+							ImageTag:      imageMetaTag,
+							GitTag:        gitTag,
+							GitCommit:     p.gitCommit,
+							GitCommitTime: p.gitCommitTime,
+							Created:       created,
+							WerfVersion:   werf.Version,
+							Protected:     p.Protect,
+						})
+
 						return nil
 					})
 				}()
@@ -285,3 +500,237 @@ func (p *PublishImagesPhase) pushImage(c *Conveyor, image *Image) error {
 
 	return nil
 }
+
+func (p *PublishImagesPhase) addImageMetadata(imageRepository, imageTag string, record docker_registry.ImageMetadata) {
+	if _, ok := p.imagesMetadataByRepository[imageRepository]; !ok {
+		p.imagesMetadataByRepository[imageRepository] = map[string]docker_registry.ImageMetadata{}
+	}
+
+	p.imagesMetadataByRepository[imageRepository][imageTag] = record
+}
+
+func (p *PublishImagesPhase) addReferencingGitCommit(imageRepository, imageTag, gitCommit string) {
+	if _, ok := p.referencingGitCommitsByRepository[imageRepository]; !ok {
+		p.referencingGitCommitsByRepository[imageRepository] = map[string][]string{}
+	}
+
+	p.referencingGitCommitsByRepository[imageRepository][imageTag] = append(p.referencingGitCommitsByRepository[imageRepository][imageTag], gitCommit)
+}
+
+// writeImagesMetadata adds records of published tags and commits of skipped stages-signature tags to the metadata of image repositories and drops records of removed tags.
+// The metadata only speeds up cleanup, thus errors are reported as warnings
+func (p *PublishImagesPhase) writeImagesMetadata() error {
+	imageRepositories := map[string]bool{}
+	for imageRepository := range p.imagesMetadataByRepository {
+		imageRepositories[imageRepository] = true
+	}
+
+	for imageRepository := range p.referencingGitCommitsByRepository {
+		imageRepositories[imageRepository] = true
+	}
+
+	for imageRepository := range imageRepositories {
+		records := p.imagesMetadataByRepository[imageRepository]
+		referencingGitCommits := p.referencingGitCommitsByRepository[imageRepository]
+
+		writeFunc := func() error {
+			return shluz.WithLock(docker_registry.ImagesMetadataLockName(imageRepository), shluz.LockOptions{}, func() error {
+				tags, err := docker_registry.Tags(imageRepository)
+				if err != nil {
+					return err
+				}
+
+				existingRecords, err := docker_registry.ImagesMetadata(imageRepository)
+				if err != nil {
+					return err
+				}
+
+				newRecords := map[string]docker_registry.ImageMetadata{}
+				for tag, record := range existingRecords {
+					if util.IsStringsContainValue(tags, tag) {
+						newRecords[tag] = record
+					}
+				}
+
+				for tag, record := range records {
+					newRecords[tag] = record
+				}
+
+				for tag, gitCommits := range referencingGitCommits {
+					record, ok := newRecords[tag]
+					if !ok {
+						configFile, err := docker_registry.ImageConfigFile(strings.Join([]string{imageRepository, tag}, ":"))
+						if err != nil {
+							return err
+						}
+
+						record = docker_registry.NewImageMetadata(configFile)
+					}
+
+					for _, gitCommit := range gitCommits {
+						record.AddReferencingGitCommit(gitCommit)
+					}
+
+					newRecords[tag] = record
+				}
+
+				return docker_registry.WriteImagesMetadata(imageRepository, newRecords)
+			})
+		}
+
+		logProcessMsg := fmt.Sprintf("Writing images metadata of %s", imageRepository)
+		if err := logboek.LogProcessInline(logProcessMsg, logboek.LogProcessInlineOptions{}, writeFunc); err != nil {
+			logboek.LogErrorF("WARNING: Unable to write images metadata of %s: %s\n", imageRepository, err)
+		}
+	}
+
+	return nil
+}
+
+// writeProtectionMarkers protects published and skipped up-to-date tags with the protection marker tags,
+// the marker overrides the protection the tag has been unprotected with before
+func (p *PublishImagesPhase) writeProtectionMarkers() error {
+	tagsByRepository := map[string][]string{}
+	for imageRepository, tags := range p.skippedTagsByRepository {
+		tagsByRepository[imageRepository] = append(tagsByRepository[imageRepository], tags...)
+	}
+
+	for imageRepository, records := range p.imagesMetadataByRepository {
+		for tag := range records {
+			tagsByRepository[imageRepository] = append(tagsByRepository[imageRepository], tag)
+		}
+	}
+
+	for imageRepository, tags := range tagsByRepository {
+		for _, tag := range tags {
+			logProcessMsg := fmt.Sprintf("Protecting %s:%s", imageRepository, tag)
+			if err := logboek.LogProcessInline(logProcessMsg, logboek.LogProcessInlineOptions{}, func() error {
+				return docker_registry.WriteProtectionMarker(imageRepository, tag, true)
+			}); err != nil {
+				return fmt.Errorf("unable to protect %s:%s: %s", imageRepository, tag, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// publishImage saves the image from the local docker daemon and pushes it into the images repo with the registry API.
+// Layers of the image published previously into another repository of the same registry are mounted instead of uploading
+func (p *PublishImagesPhase) publishImage(c *Conveyor, img *imagePkg.Image, imageName, imageRepository string) (string, error) {
+	imageID, err := img.MustGetId()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(c.tmpDir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	archive, err := ioutil.TempFile(c.tmpDir, "publish-*.tar")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive.Name())
+
+	if err := logboek.LogProcess("Saving image from docker daemon", logboek.LogProcessOptions{}, func() error {
+		defer archive.Close()
+
+		rc, err := docker.ImageSave(imageID)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		_, err = io.Copy(archive, rc)
+		return err
+	}); err != nil {
+		return "", err
+	}
+
+	pushOptions := docker_registry.PushOptions{
+		ParallelLayers: p.ParallelLayers,
+		MountFrom:      p.lastPublishedRepository,
+		MaxAttempts:    docker_registry.DefaultPushMaxAttempts,
+		RetryDelay:     docker_registry.DefaultPushRetryDelay,
+	}
+
+	var digest string
+	if err := logboek.LogProcess(fmt.Sprintf("Pushing %s", imageName), logboek.LogProcessOptions{}, func() error {
+		digest, err = docker_registry.PushImageArchive(archive.Name(), imageName, pushOptions)
+		return err
+	}); err != nil {
+		return "", err
+	}
+
+	p.lastPublishedRepository = imageRepository
+
+	return digest, nil
+}
+
+// isTagUpToDate reports whether the existing tag in the images repo holds the image built from the last stage image.
+// The tag is up-to-date if the registry manifest config digest is the ID of the local image with the same name that was built from the last stage image,
+// otherwise the parent of the registry image is compared with the last stage image
+func isTagUpToDate(imageName, lastStageImageID string) (bool, error) {
+	repoImageID, err := docker_registry.ImageId(imageName)
+	if err != nil {
+		return false, err
+	}
+
+	if exist, err := docker.ImageExist(imageName); err != nil {
+		return false, err
+	} else if exist {
+		localImageInspect, err := docker.ImageInspect(imageName)
+		if err != nil {
+			return false, err
+		}
+
+		if localImageInspect.Parent == lastStageImageID && localImageInspect.ID == repoImageID {
+			return true, nil
+		}
+	}
+
+	repoImageParentID, err := docker_registry.ImageParentId(imageName)
+	if err != nil {
+		return false, err
+	}
+
+	return repoImageParentID == lastStageImageID, nil
+}
+
+// existingImageMetaTags returns tags of the image without images repo mode specific parts (e.g. image name prefix in monorepo mode)
+func existingImageMetaTags(imagesRepoManager ImagesRepoManager, image *Image, existingTags []string) []string {
+	imageRepo := imagesRepoManager.ImageRepo(image.GetName())
+
+	var res []string
+	for _, imageRepoTag := range existingTags {
+		if tag, ok := imagesRepoManager.ParseImageRepoTag(image.GetName(), imageRepo, imageRepoTag); ok {
+			res = append(res, tag)
+		}
+	}
+
+	return res
+}
+
+// projectHeadCommit returns the current commit of the project git repository and its time or empty values when project is not a git repository
+func projectHeadCommit(c *Conveyor) (string, *time.Time, error) {
+	gitDir := filepath.Join(c.projectDir, ".git")
+	if exist, err := util.DirExists(gitDir); err != nil {
+		return "", nil, err
+	} else if !exist {
+		return "", nil, nil
+	}
+
+	localGitRepo := &git_repo.Local{Path: c.projectDir, GitDir: gitDir}
+	commit, err := localGitRepo.HeadCommit()
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to get project git repository head commit: %s", err)
+	}
+
+	commitTime, err := localGitRepo.CommitTime(commit)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to get project git repository head commit time: %s", err)
+	}
+
+	return commit, &commitTime, nil
+}
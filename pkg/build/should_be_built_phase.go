@@ -41,6 +41,10 @@ func (p *ShouldBeBuiltPhase) run(c *Conveyor) error {
 			badStages = append(badStages, s)
 		}
 
+		if len(badStages) == 0 {
+			touchStagesUsage(c, image.GetStages())
+		}
+
 		for _, s := range badStages {
 			logboek.LogErrorF("%s %s is not exist in stages storage\n", image.LogDetailedName(), s.LogDetailedName())
 		}
@@ -6,13 +6,15 @@ type CleanupOptions struct {
 }
 
 func Cleanup(options CleanupOptions) error {
-	if err := ImagesCleanup(options.ImagesCleanupOptions); err != nil {
-		return err
+	// failed deletions of images do not abort the stages cleanup: stages of the remaining images are kept
+	imagesCleanupErr := ImagesCleanup(options.ImagesCleanupOptions)
+	if imagesCleanupErr != nil && !IsRepoImagesDeleteError(imagesCleanupErr) {
+		return imagesCleanupErr
 	}
 
 	if err := StagesCleanup(options.StagesCleanupOptions); err != nil {
 		return err
 	}
 
-	return nil
+	return imagesCleanupErr
 }
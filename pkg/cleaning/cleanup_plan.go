@@ -0,0 +1,264 @@
+package cleaning
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/docker_registry"
+)
+
+const (
+	CleanupPlanKeep   = "keep"
+	CleanupPlanDelete = "delete"
+
+	CleanupPlanReasonNotManaged              = "not-managed"
+	CleanupPlanReasonProtected               = "protected"
+	CleanupPlanReasonNoGitRepository         = "no-git-repository"
+	CleanupPlanReasonUsedInKubernetes        = "used-in-kubernetes"
+	CleanupPlanReasonReferencedByHelmRelease = "referenced-by-helm-release"
+	CleanupPlanReasonGitReferenceExists      = "git-reference-exists"
+	CleanupPlanReasonGitReferenceNonexistent = "git-reference-nonexistent"
+	CleanupPlanReasonRuleKeep                = "rule-keep"
+	CleanupPlanReasonRuleLimit               = "rule-limit"
+	CleanupPlanReasonRuleExpired             = "rule-expired"
+
+	cleanupPlanVersion = 1
+)
+
+// CleanupPlan contains the decision with the reason for each repo image considered by images cleanup.
+// The reviewed plan can be applied later: only the images to delete are removed if their digests have not changed
+type CleanupPlan struct {
+	Version     int                      `json:"version"`
+	ImagesRepos []*CleanupPlanImagesRepo `json:"imagesRepos"`
+}
+
+type CleanupPlanImagesRepo struct {
+	ImagesRepo string              `json:"imagesRepo"`
+	Images     []*CleanupPlanImage `json:"images"`
+}
+
+type CleanupPlanImage struct {
+	ImageName  string `json:"imageName"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	Digest     string `json:"digest,omitempty"`
+	Decision   string `json:"decision"`
+	Reason     string `json:"reason"`
+	Details    string `json:"details,omitempty"`
+}
+
+func NewCleanupPlan() *CleanupPlan {
+	return &CleanupPlan{Version: cleanupPlanVersion}
+}
+
+// LoadCleanupPlan reads the plan in JSON or YAML format (by the file extension)
+func LoadCleanupPlan(path string) (*CleanupPlan, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &CleanupPlan{}
+	if isYamlCleanupPlanPath(path) {
+		err = yaml.Unmarshal(data, plan)
+	} else {
+		err = json.Unmarshal(data, plan)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("bad cleanup plan %s: %s", path, err)
+	}
+
+	if plan.Version != cleanupPlanVersion {
+		return nil, fmt.Errorf("unsupported cleanup plan %s version %d, expected %d", path, plan.Version, cleanupPlanVersion)
+	}
+
+	return plan, nil
+}
+
+// Save writes the plan in JSON or YAML format (by the file extension)
+func (p *CleanupPlan) Save(path string) error {
+	var data []byte
+	var err error
+	if isYamlCleanupPlanPath(path) {
+		data, err = yaml.Marshal(p)
+	} else {
+		data, err = json.MarshalIndent(p, "", "  ")
+		data = append(data, '\n')
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// GetImagesRepo returns decisions of the images repo or nil
+func (p *CleanupPlan) GetImagesRepo(imagesRepo string) *CleanupPlanImagesRepo {
+	for _, planImagesRepo := range p.ImagesRepos {
+		if planImagesRepo.ImagesRepo == imagesRepo {
+			return planImagesRepo
+		}
+	}
+
+	return nil
+}
+
+func (p *CleanupPlan) imagesRepo(imagesRepo string) *CleanupPlanImagesRepo {
+	if p == nil {
+		return nil
+	}
+
+	if planImagesRepo := p.GetImagesRepo(imagesRepo); planImagesRepo != nil {
+		return planImagesRepo
+	}
+
+	planImagesRepo := &CleanupPlanImagesRepo{ImagesRepo: imagesRepo}
+	p.ImagesRepos = append(p.ImagesRepos, planImagesRepo)
+
+	return planImagesRepo
+}
+
+func isYamlCleanupPlanPath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// keep and remove record the decision for the image, later cleanup steps override the decision of the previous ones
+func (r *CleanupPlanImagesRepo) keep(imageName string, repoImage docker_registry.RepoImage, reason, details string) {
+	if r == nil {
+		return
+	}
+
+	r.set(imageName, repoImage, CleanupPlanKeep, reason, details).Digest = ""
+}
+
+// remove also records the digest of the image, which is verified when the plan is applied
+func (r *CleanupPlanImagesRepo) remove(imageName string, repoImage docker_registry.RepoImage, reason, details string) error {
+	if r == nil {
+		return nil
+	}
+
+	digest, err := repoImage.Digest()
+	if err != nil {
+		return fmt.Errorf("cannot get digest of %s:%s: %s", repoImage.Repository, repoImage.Tag, err)
+	}
+
+	r.set(imageName, repoImage, CleanupPlanDelete, reason, details).Digest = digest.String()
+
+	return nil
+}
+
+func (r *CleanupPlanImagesRepo) set(imageName string, repoImage docker_registry.RepoImage, decision, reason, details string) *CleanupPlanImage {
+	for _, planImage := range r.Images {
+		if planImage.Repository == repoImage.Repository && planImage.Tag == repoImage.Tag {
+			planImage.Decision = decision
+			planImage.Reason = reason
+			planImage.Details = details
+			return planImage
+		}
+	}
+
+	planImage := &CleanupPlanImage{
+		ImageName:  imageName,
+		Repository: repoImage.Repository,
+		Tag:        repoImage.Tag,
+		Decision:   decision,
+		Reason:     reason,
+		Details:    details,
+	}
+	r.Images = append(r.Images, planImage)
+
+	return planImage
+}
+
+// applyCleanupPlan removes the images to delete from the plan.
+// Images protected since the plan was made are skipped.
+// Nothing is removed if the digest of any image has changed since the plan was made
+func applyCleanupPlan(planImagesRepo *CleanupPlanImagesRepo, options ImagesCleanupOptions) error {
+	var repoImagesToRemove []docker_registry.RepoImage
+	var changedImages []string
+	recordsByRepository := map[string]map[string]docker_registry.ImageMetadata{}
+	for _, planImage := range planImagesRepo.Images {
+		if planImage.Decision != CleanupPlanDelete {
+			continue
+		}
+
+		reference := strings.Join([]string{planImage.Repository, planImage.Tag}, ":")
+
+		records, ok := recordsByRepository[planImage.Repository]
+		if !ok {
+			var err error
+			records, err = docker_registry.ImagesMetadata(planImage.Repository)
+			if err != nil {
+				return fmt.Errorf("cannot read images metadata of %s: %s", planImage.Repository, err)
+			}
+
+			recordsByRepository[planImage.Repository] = records
+		}
+
+		repoImage := docker_registry.NewRepoImage(planImage.Repository, planImage.Tag)
+		if record, ok := records[planImage.Tag]; ok {
+			repoImage.Metadata = &record
+		}
+		// the marker might have been written since the plan was made
+		repoImage.HasProtectionMarker = true
+
+		protection, err := repoImageProtection(repoImage, options.ProtectedTags)
+		if err != nil {
+			if strings.Contains(err.Error(), "MANIFEST_UNKNOWN") || strings.Contains(err.Error(), "NAME_UNKNOWN") {
+				logboek.LogInfoF("Tag %s has already been removed\n", reference)
+				continue
+			}
+
+			return err
+		}
+
+		if protection != "" {
+			logboek.LogInfoF("Tag %s is protected (%s), skipping\n", reference, protection)
+			continue
+		}
+
+		digest, err := docker_registry.ImageDigest(reference)
+		if err != nil {
+			if strings.Contains(err.Error(), "MANIFEST_UNKNOWN") || strings.Contains(err.Error(), "NAME_UNKNOWN") {
+				logboek.LogInfoF("Tag %s has already been removed\n", reference)
+				continue
+			}
+
+			return err
+		}
+
+		if digest != planImage.Digest {
+			changedImages = append(changedImages, fmt.Sprintf("%s: planned %s, actual %s", reference, planImage.Digest, digest))
+			continue
+		}
+
+		repoImagesToRemove = append(repoImagesToRemove, repoImage)
+	}
+
+	if len(changedImages) != 0 {
+		return fmt.Errorf("images have changed since the cleanup plan was made, make a new plan:\n%s", strings.Join(changedImages, "\n"))
+	}
+
+	if len(repoImagesToRemove) != 0 {
+		var err error
+		logboek.LogBlock("Removed tags by cleanup plan", logboek.LogBlockOptions{}, func() {
+			err = repoImagesRemove(repoImagesToRemove, options.CommonRepoOptions)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return repoImagesMetadataSync(options.CommonRepoOptions)
+}
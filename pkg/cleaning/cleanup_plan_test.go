@@ -0,0 +1,146 @@
+package cleaning
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flant/go-containerregistry/pkg/registry"
+	"github.com/flant/go-containerregistry/pkg/v1/random"
+
+	"github.com/flant/werf/pkg/docker_registry"
+)
+
+type testImagesRepoManager struct {
+	imagesRepo string
+}
+
+func (m testImagesRepoManager) ImagesRepo() string { return m.imagesRepo }
+func (m testImagesRepoManager) ImageRepo(imageName string) string {
+	return m.imagesRepo + "/" + imageName
+}
+func (m testImagesRepoManager) ImageRepoWithTag(imageName, tag string) string {
+	return m.ImageRepo(imageName) + ":" + tag
+}
+func (m testImagesRepoManager) IsMonorepo() bool { return false }
+func (m testImagesRepoManager) IsTemplate() bool { return false }
+func (m testImagesRepoManager) ParseImageRepoTag(_, _, imageRepoTag string) (string, bool) {
+	return imageRepoTag, true
+}
+
+func pushRandomTestImage(t *testing.T, reference string) string {
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := docker_registry.PushImage(img, reference, docker_registry.PushOptions{MaxAttempts: 1}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return digest.String()
+}
+
+func TestCleanupPlan(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	imagesRepo := fmt.Sprintf("%s/project", strings.TrimPrefix(server.URL, "http://"))
+	repository := imagesRepo + "/app"
+
+	oldDigest := pushRandomTestImage(t, repository+":old")
+	pushRandomTestImage(t, repository+":new")
+
+	now := time.Now()
+	oldRepoImage := docker_registry.NewRepoImage(repository, "old")
+	oldRepoImage.Metadata = &docker_registry.ImageMetadata{ImageName: "app", TagStrategy: "git-branch", ImageTag: "old", Created: now.Add(-time.Hour)}
+	newRepoImage := docker_registry.NewRepoImage(repository, "new")
+	newRepoImage.Metadata = &docker_registry.ImageMetadata{ImageName: "app", TagStrategy: "git-branch", ImageTag: "new", Created: now}
+
+	plan := NewCleanupPlan()
+	options := ImagesCleanupOptions{
+		CommonRepoOptions: CommonRepoOptions{ImagesRepoManager: testImagesRepoManager{imagesRepo: imagesRepo}, DryRun: true},
+		Rules: []ImagesCleanupRule{
+			{Description: "last branch", TagStrategies: []string{"git-branch"}, HasKeepLast: true, KeepLast: 1},
+		},
+		Plan:           plan,
+		planImagesRepo: plan.imagesRepo(imagesRepo),
+	}
+
+	repoImages := []docker_registry.RepoImage{oldRepoImage, newRepoImage}
+	for _, repoImage := range repoImages {
+		options.planImagesRepo.keep("app", repoImage, CleanupPlanReasonNotManaged, "")
+	}
+
+	if _, err := repoImagesCleanupByRules("app", repoImages, options); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expectedImages := []*CleanupPlanImage{
+		{
+			ImageName:  "app",
+			Repository: repository,
+			Tag:        "old",
+			Digest:     oldDigest,
+			Decision:   CleanupPlanDelete,
+			Reason:     CleanupPlanReasonRuleLimit,
+			Details:    fmt.Sprintf("rule last branch, published %s, not in the last 1", now.Add(-time.Hour).Format("2006-01-02T15:04:05-0700")),
+		},
+		{
+			ImageName:  "app",
+			Repository: repository,
+			Tag:        "new",
+			Decision:   CleanupPlanKeep,
+			Reason:     CleanupPlanReasonRuleKeep,
+			Details:    fmt.Sprintf("rule last branch, published %s", now.Format("2006-01-02T15:04:05-0700")),
+		},
+	}
+
+	if !reflect.DeepEqual(plan.GetImagesRepo(imagesRepo).Images, expectedImages) {
+		t.Errorf("\n[EXPECTED]: %+v\n[GOT]: %+v", expectedImages, plan.GetImagesRepo(imagesRepo).Images)
+	}
+
+	tmpDir, err := ioutil.TempDir("", "werf-cleanup-plan-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, fileName := range []string{"plan.json", "plan.yaml"} {
+		path := filepath.Join(tmpDir, fileName)
+		if err := plan.Save(path); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		loadedPlan, err := LoadCleanupPlan(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if !reflect.DeepEqual(loadedPlan, plan) {
+			t.Errorf("%s:\n[EXPECTED]: %+v\n[GOT]: %+v", fileName, plan, loadedPlan)
+		}
+	}
+
+	if err := applyCleanupPlan(plan.GetImagesRepo(imagesRepo), options); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	pushRandomTestImage(t, repository+":old")
+
+	err = applyCleanupPlan(plan.GetImagesRepo(imagesRepo), options)
+	if err == nil || !strings.Contains(err.Error(), "images have changed since the cleanup plan was made") {
+		t.Errorf("expected changed images error, got %v", err)
+	}
+}
@@ -1,12 +1,15 @@
 package cleaning
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/flant/logboek"
+	"github.com/flant/shluz"
 
 	"github.com/flant/werf/pkg/docker_registry"
 	"github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/util"
 )
 
 type CommonRepoOptions struct {
@@ -14,6 +17,7 @@ type CommonRepoOptions struct {
 	ImagesRepoManager ImagesRepoManager
 	ImagesNames       []string
 	DryRun            bool
+	DeleteOptions     RepoImagesDeleteOptions
 }
 
 type ImagesRepoManager interface {
@@ -21,6 +25,8 @@ type ImagesRepoManager interface {
 	ImageRepo(imageName string) string
 	ImageRepoWithTag(imageName, tag string) string
 	IsMonorepo() bool
+	IsTemplate() bool
+	ParseImageRepoTag(imageName, imageRepo, imageRepoTag string) (string, bool)
 }
 
 func repoImages(options CommonRepoOptions) (repoImages []docker_registry.RepoImage, err error) {
@@ -38,7 +44,9 @@ func repoImages(options CommonRepoOptions) (repoImages []docker_registry.RepoIma
 
 func repoImagesByImageName(options CommonRepoOptions) (repoImagesByImageName map[string][]docker_registry.RepoImage, err error) {
 	if err := logboek.LogProcess("Getting repo images", logboek.LogProcessOptions{}, func() error {
-		if options.ImagesRepoManager.IsMonorepo() {
+		if options.ImagesRepoManager.IsTemplate() {
+			repoImagesByImageName, err = templateRepoImages(options)
+		} else if options.ImagesRepoManager.IsMonorepo() {
 			repoImagesByImageName, err = monorepoRepoImages(options)
 		} else {
 			repoImagesByImageName, err = multirepoRepoImages(options)
@@ -60,7 +68,7 @@ func monorepoRepoImages(options CommonRepoOptions) (map[string][]docker_registry
 		repoImagesByImageName[imageName] = []docker_registry.RepoImage{}
 	}
 
-	repoImages, err := docker_registry.ImagesByWerfImageLabel(options.ImagesRepoManager.ImagesRepo(), "true")
+	repoImages, err := docker_registry.WerfImages(options.ImagesRepoManager.ImagesRepo())
 	if err != nil {
 		return nil, err
 	}
@@ -94,7 +102,7 @@ func multirepoRepoImages(options CommonRepoOptions) (map[string][]docker_registr
 		repoImagesByImageName[imageName] = []docker_registry.RepoImage{}
 
 		imageRepo := options.ImagesRepoManager.ImageRepo(imageName)
-		images, err := docker_registry.ImagesByWerfImageLabel(imageRepo, "true")
+		images, err := docker_registry.WerfImages(imageRepo)
 		if err != nil {
 			return nil, err
 		}
@@ -105,69 +113,138 @@ func multirepoRepoImages(options CommonRepoOptions) (map[string][]docker_registr
 	return repoImagesByImageName, nil
 }
 
-func repoImageStagesImages(options CommonRepoOptions) ([]docker_registry.RepoImage, error) {
-	return docker_registry.ImagesByWerfImageLabel(options.StagesStorage, "false")
-}
+// templateRepoImages matches repo images with images by inverting images repo templates:
+// the image repository may be shared by several images and contain tags of other projects or environments
+func templateRepoImages(options CommonRepoOptions) (map[string][]docker_registry.RepoImage, error) {
+	repoImagesByImageName := map[string][]docker_registry.RepoImage{}
 
-func repoImagesRemove(images []docker_registry.RepoImage, options CommonRepoOptions) error {
-	isGCR, err := docker_registry.IsGCR(options.ImagesRepoManager.ImagesRepo())
-	if err != nil {
-		return err
+	var imagesRepos []string
+	imagesNamesByImageRepo := map[string][]string{}
+	for _, imageName := range options.ImagesNames {
+		repoImagesByImageName[imageName] = []docker_registry.RepoImage{}
+
+		imageRepo := options.ImagesRepoManager.ImageRepo(imageName)
+		if _, ok := imagesNamesByImageRepo[imageRepo]; !ok {
+			imagesRepos = append(imagesRepos, imageRepo)
+		}
+
+		imagesNamesByImageRepo[imageRepo] = append(imagesNamesByImageRepo[imageRepo], imageName)
 	}
 
-	for _, image := range images {
-		if isGCR {
-			if err := GCRImageRemove(image, options); err != nil {
-				return err
+	for _, imageRepo := range imagesRepos {
+		repoImages, err := docker_registry.WerfImages(imageRepo)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repoImage := range repoImages {
+			// the longest image name is the most specific match, e.g. tag app-web-v1 with {{ .Image }}-{{ .Tag }} template belongs to the image app-web, not app
+			var matchedImageName string
+			var isMatched bool
+			for _, imageName := range imagesNamesByImageRepo[imageRepo] {
+				if _, ok := options.ImagesRepoManager.ParseImageRepoTag(imageName, repoImage.Repository, repoImage.Tag); ok {
+					if !isMatched || len(imageName) > len(matchedImageName) {
+						matchedImageName = imageName
+						isMatched = true
+					}
+				}
 			}
-		} else {
-			if err := repoImageRemove(image, options); err != nil {
-				return err
+
+			if isMatched {
+				repoImagesByImageName[matchedImageName] = append(repoImagesByImageName[matchedImageName], repoImage)
 			}
 		}
 	}
 
-	return nil
+	return repoImagesByImageName, nil
 }
 
-func GCRImageRemove(image docker_registry.RepoImage, options CommonRepoOptions) error {
-	reference := strings.Join([]string{image.Repository, image.Tag}, ":")
-	if err := repoReferenceRemove(reference, options); err != nil {
-		return err
+// imagesRepoImageRepos returns image repositories of the project images without duplicates
+func imagesRepoImageRepos(options CommonRepoOptions) []string {
+	if options.ImagesRepoManager.IsMonorepo() {
+		return []string{options.ImagesRepoManager.ImagesRepo()}
+	}
+
+	var imageRepos []string
+	for _, imageName := range options.ImagesNames {
+		imageRepo := options.ImagesRepoManager.ImageRepo(imageName)
+		if !util.IsStringsContainValue(imageRepos, imageRepo) {
+			imageRepos = append(imageRepos, imageRepo)
+		}
+	}
+
+	return imageRepos
+}
+
+// repoImagesMetadataSync drops metadata records and protection marker tags of removed tags, the metadata tag is removed along with the last record.
+// Records of the other projects sharing the repository are kept
+func repoImagesMetadataSync(options CommonRepoOptions) error {
+	if options.DryRun {
+		return nil
+	}
+
+	for _, imageRepo := range imagesRepoImageRepos(options) {
+		if err := shluz.WithLock(docker_registry.ImagesMetadataLockName(imageRepo), shluz.LockOptions{}, func() error {
+			return repoImageMetadataSync(imageRepo, options)
+		}); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func repoImageRemove(image docker_registry.RepoImage, options CommonRepoOptions) error {
-	digest, err := image.Digest()
+func repoImageMetadataSync(imageRepo string, options CommonRepoOptions) error {
+	tags, err := docker_registry.Tags(imageRepo)
 	if err != nil {
 		return err
 	}
 
-	reference := strings.Join([]string{image.Repository, digest.String()}, "@")
-	if err := repoReferenceRemove(reference, options); err != nil {
-		return err
+	var orphanedMarkers []docker_registry.RepoImage
+	for _, markerTag := range docker_registry.OrphanedProtectionMarkerTags(tags) {
+		orphanedMarkers = append(orphanedMarkers, docker_registry.NewRepoImage(imageRepo, markerTag))
 	}
 
-	logboek.LogInfoF("  tag: %s\n", image.Tag)
-	logboek.LogOptionalLn()
+	if len(orphanedMarkers) != 0 {
+		if err := repoImagesRemove(orphanedMarkers, options); err != nil {
+			return err
+		}
+	}
 
-	return nil
-}
+	if !util.IsStringsContainValue(tags, docker_registry.ImagesMetadataTag) {
+		return nil
+	}
 
-func repoReferenceRemove(reference string, options CommonRepoOptions) error {
-	logboek.LogLn(reference)
-	if !options.DryRun {
-		err := docker_registry.ImageDelete(reference)
-		if err != nil {
+	records, err := docker_registry.ImagesMetadata(imageRepo)
+	if err != nil {
+		return fmt.Errorf("cannot read images metadata of %s: %s", imageRepo, err)
+	}
+
+	actualRecords := map[string]docker_registry.ImageMetadata{}
+	for tag, record := range records {
+		if util.IsStringsContainValue(tags, tag) {
+			actualRecords[tag] = record
+		}
+	}
+
+	if len(actualRecords) == 0 {
+		metadataRepoImage := docker_registry.NewRepoImage(imageRepo, docker_registry.ImagesMetadataTag)
+		if err := repoImagesRemove([]docker_registry.RepoImage{metadataRepoImage}, options); err != nil {
 			return err
 		}
+	} else if len(actualRecords) != len(records) {
+		if err := docker_registry.WriteImagesMetadata(imageRepo, actualRecords); err != nil {
+			return fmt.Errorf("unable to write images metadata of %s: %s", imageRepo, err)
+		}
 	}
 
 	return nil
 }
 
+func repoImageStagesImages(options CommonRepoOptions) ([]docker_registry.RepoImage, error) {
+	return docker_registry.ImagesByWerfImageLabel(options.StagesStorage, "false")
+}
+
 func exceptRepoImages(repoImages []docker_registry.RepoImage, repoImagesToExclude ...docker_registry.RepoImage) []docker_registry.RepoImage {
 	var newRepoImages []docker_registry.RepoImage
 
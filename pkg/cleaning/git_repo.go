@@ -4,4 +4,5 @@ type GitRepo interface {
 	IsCommitExists(commit string) (bool, error)
 	TagsList() ([]string, error)
 	RemoteBranchesList() ([]string, error)
+	ReferencesCommits() ([]string, error)
 }
@@ -0,0 +1,85 @@
+package cleaning
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/storage/driver"
+
+	"github.com/flant/werf/pkg/deploy/helm"
+)
+
+type helmReleaseManifest struct {
+	Release  string
+	Revision int32
+	Manifest string
+}
+
+// helmReleasesManifests returns manifests (including hooks) of the last revisions of helm releases stored in the helm release storage (all revisions if revisions is 0)
+func helmReleasesManifests(kubernetesClient kubernetes.Interface, helmReleaseStorageNamespace, helmReleaseStorageType string, revisions int) ([]helmReleaseManifest, error) {
+	var releaseStorageDriver driver.Driver
+	switch helmReleaseStorageType {
+	case helm.ConfigMapStorage:
+		releaseStorageDriver = driver.NewConfigMaps(kubernetesClient.CoreV1().ConfigMaps(helmReleaseStorageNamespace))
+	case helm.SecretStorage:
+		releaseStorageDriver = driver.NewSecrets(kubernetesClient.CoreV1().Secrets(helmReleaseStorageNamespace))
+	default:
+		return nil, fmt.Errorf("unknown helm release storage type '%s'", helmReleaseStorageType)
+	}
+
+	releases, err := releaseStorageDriver.List(func(*release.Release) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+
+	// the last revisions go first
+	sort.SliceStable(releases, func(i, j int) bool {
+		if releases[i].Name != releases[j].Name {
+			return releases[i].Name < releases[j].Name
+		}
+
+		return releases[i].Version > releases[j].Version
+	})
+
+	var manifests []helmReleaseManifest
+	releaseRevisions := map[string]int{}
+	for _, r := range releases {
+		if revisions != 0 && releaseRevisions[r.Name] >= revisions {
+			continue
+		}
+		releaseRevisions[r.Name]++
+
+		manifests = append(manifests, helmReleaseManifest{Release: r.Name, Revision: r.Version, Manifest: r.Manifest})
+
+		for _, hook := range r.Hooks {
+			manifests = append(manifests, helmReleaseManifest{Release: r.Name, Revision: r.Version, Manifest: hook.Manifest})
+		}
+	}
+
+	return manifests, nil
+}
+
+// manifestReferencesDockerImage checks that the manifest contains the image, which is not a prefix of another image (e.g. app:1.2 and app:1.2.0)
+func manifestReferencesDockerImage(manifest, dockerImageName string) bool {
+	for ind := strings.Index(manifest, dockerImageName); ind != -1; {
+		end := ind + len(dockerImageName)
+		if end == len(manifest) || !isDockerTagChar(manifest[end]) {
+			return true
+		}
+
+		next := strings.Index(manifest[end:], dockerImageName)
+		if next == -1 {
+			break
+		}
+		ind = end + next
+	}
+
+	return false
+}
+
+func isDockerTagChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-'
+}
@@ -16,6 +16,11 @@ import (
 
 type HostCleanupOptions struct {
 	DryRun bool
+
+	// The least valuable stages of all projects are removed if the docker storage usage exceeds the threshold until the usage reaches the target (percentages)
+	HasDockerStorageUsageThreshold bool
+	DockerStorageUsageThreshold    float64
+	DockerStorageUsageTarget       float64
 }
 
 func HostCleanup(options HostCleanupOptions) error {
@@ -39,13 +44,23 @@ func HostCleanup(options HostCleanupOptions) error {
 			return nil
 		}
 
-		return shluz.WithLock("gc", shluz.LockOptions{}, func() error {
+		if err := shluz.WithLock("gc", shluz.LockOptions{}, func() error {
 			if err := tmp_manager.GC(commonOptions.DryRun); err != nil {
 				return fmt.Errorf("tmp files gc failed: %s", err)
 			}
 
 			return nil
-		})
+		}); err != nil {
+			return err
+		}
+
+		if options.HasDockerStorageUsageThreshold {
+			return logboek.LogProcess("Running cleanup for stages of all projects by docker storage usage", logboek.LogProcessOptions{}, func() error {
+				return hostStagesCleanupByDockerStorageUsage(options, commonOptions)
+			})
+		}
+
+		return nil
 	})
 }
 
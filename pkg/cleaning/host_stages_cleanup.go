@@ -0,0 +1,247 @@
+package cleaning
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-units"
+
+	"github.com/flant/logboek"
+	"github.com/flant/shluz"
+	"github.com/flant/werf/pkg/docker"
+	"github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/stages_usage"
+	"github.com/flant/werf/pkg/util"
+)
+
+type hostImageStage struct {
+	types.ImageSummary
+	name string
+}
+
+// hostStagesCleanupByDockerStorageUsage removes the least valuable local stages of all projects until the docker storage usage reaches the target
+func hostStagesCleanupByDockerStorageUsage(options HostCleanupOptions, commonOptions CommonOptions) error {
+	info, err := docker.Info()
+	if err != nil {
+		return fmt.Errorf("cannot get docker info: %s", err)
+	}
+
+	usage, err := util.GetFilesystemUsage(info.DockerRootDir)
+	if err != nil {
+		return fmt.Errorf("cannot get usage of docker root dir %s filesystem: %s", info.DockerRootDir, err)
+	}
+
+	logboek.LogInfoF("Docker storage %s usage: %.2f%% (%s of %s)\n", info.DockerRootDir, usage.UsedPercentage(), units.BytesSize(float64(usage.UsedBytes())), units.BytesSize(float64(usage.TotalBytes)))
+
+	if usage.UsedPercentage() < options.DockerStorageUsageThreshold {
+		logboek.LogInfoF("Docker storage usage is below the threshold %.2f%%\n", options.DockerStorageUsageThreshold)
+		return nil
+	}
+
+	bytesToFree := int64(usage.UsedBytes()) - int64(float64(usage.TotalBytes)*options.DockerStorageUsageTarget/100)
+	logboek.LogInfoF("Need to free %s to reach the target %.2f%%\n", units.BytesSize(float64(bytesToFree)), options.DockerStorageUsageTarget)
+
+	images, err := docker.Images(types.ImageListOptions{All: true})
+	if err != nil {
+		return err
+	}
+
+	var imageStages []types.ImageSummary
+	for _, img := range images {
+		if hostImageStageName(img) != "" {
+			imageStages = append(imageStages, img)
+		}
+	}
+
+	imageStages, err = processUsedImages(imageStages, commonOptions)
+	if err != nil {
+		return err
+	}
+
+	lastUsed, err := hostImageStagesLastUsed(imageStages)
+	if err != nil {
+		return err
+	}
+
+	removedImageStages := map[string]bool{}
+	var freedBytes int64
+	for _, imageStage := range hostImageStagesEvictionOrder(imageStages, images, lastUsed) {
+		if freedBytes >= bytesToFree {
+			break
+		}
+
+		// the stage, which child has been skipped, is still used by the child
+		if hasNotRemovedChildImage(imageStage.ImageSummary, images, removedImageStages) {
+			continue
+		}
+
+		isRemoved, err := hostImageStageRemove(imageStage, commonOptions)
+		if err != nil {
+			return err
+		}
+
+		if isRemoved {
+			removedImageStages[imageStage.ID] = true
+			freedBytes += imageStageOwnSize(imageStage.ImageSummary, images)
+		}
+	}
+
+	logboek.LogInfoF("Freed %s\n", units.BytesSize(float64(freedBytes)))
+
+	if commonOptions.DryRun {
+		return nil
+	}
+
+	existingSignatures := map[string][]string{}
+	for _, imageStage := range imageStages {
+		projectName, signature := hostImageStageProjectNameAndSignature(hostImageStageName(imageStage))
+		if !removedImageStages[imageStage.ID] {
+			existingSignatures[projectName] = append(existingSignatures[projectName], signature)
+		} else if _, exist := existingSignatures[projectName]; !exist {
+			existingSignatures[projectName] = nil
+		}
+	}
+
+	for projectName, signatures := range existingSignatures {
+		if err := stages_usage.Prune(projectName, signatures); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hostImageStageRemove removes the stage unless it is locked by the running build
+func hostImageStageRemove(imageStage hostImageStage, options CommonOptions) (bool, error) {
+	imageLockName := image.ImageLockName(imageStage.name)
+	isLocked, err := shluz.TryLock(imageLockName, shluz.TryLockOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to lock %s for image %s: %s", imageLockName, imageStage.name, err)
+	}
+
+	if !isLocked {
+		logboek.LogInfoF("Ignore image %s used by another process\n", imageStage.name)
+		return false, nil
+	}
+	defer shluz.Unlock(imageLockName)
+
+	if err := imagesRemove([]types.ImageSummary{imageStage.ImageSummary}, options); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// hostImageStagesLastUsed returns the last usage time of the stages by image id
+func hostImageStagesLastUsed(imageStages []types.ImageSummary) (map[string]time.Time, error) {
+	projectsLastUsed := map[string]map[string]time.Time{}
+	res := map[string]time.Time{}
+	for _, imageStage := range imageStages {
+		projectName, signature := hostImageStageProjectNameAndSignature(hostImageStageName(imageStage))
+
+		projectLastUsed, exist := projectsLastUsed[projectName]
+		if !exist {
+			var err error
+			projectLastUsed, err = stages_usage.LastUsed(projectName)
+			if err != nil {
+				return nil, err
+			}
+
+			projectsLastUsed[projectName] = projectLastUsed
+		}
+
+		if usedAt, exist := projectLastUsed[signature]; exist {
+			res[imageStage.ID] = usedAt
+		}
+	}
+
+	return res, nil
+}
+
+// hostImageStagesEvictionOrder returns the stages in the order of eviction.
+// The least recently used stage goes first (the stage, which usage has not been recorded, is considered used when it was created), the bigger stage goes first among stages used at the same time.
+// The stage goes only after all its child images, because the layers of the parent are not freed otherwise
+func hostImageStagesEvictionOrder(imageStages []types.ImageSummary, images []types.ImageSummary, lastUsed map[string]time.Time) []hostImageStage {
+	childrenCount := map[string]int{}
+	for _, img := range images {
+		if img.ParentID != "" {
+			childrenCount[img.ParentID]++
+		}
+	}
+
+	usedAt := func(imageStage types.ImageSummary) time.Time {
+		if t, exist := lastUsed[imageStage.ID]; exist {
+			return t
+		}
+
+		return time.Unix(imageStage.Created, 0)
+	}
+
+	remaining := make([]types.ImageSummary, len(imageStages))
+	copy(remaining, imageStages)
+	sort.SliceStable(remaining, func(i, j int) bool {
+		iUsedAt, jUsedAt := usedAt(remaining[i]), usedAt(remaining[j])
+		if !iUsedAt.Equal(jUsedAt) {
+			return iUsedAt.Before(jUsedAt)
+		}
+
+		return imageStageOwnSize(remaining[i], images) > imageStageOwnSize(remaining[j], images)
+	})
+
+	var res []hostImageStage
+	for {
+		ind := -1
+		for i, imageStage := range remaining {
+			if childrenCount[imageStage.ID] == 0 {
+				ind = i
+				break
+			}
+		}
+
+		if ind == -1 {
+			break
+		}
+
+		imageStage := remaining[ind]
+		remaining = append(remaining[:ind], remaining[ind+1:]...)
+		if imageStage.ParentID != "" {
+			childrenCount[imageStage.ParentID]--
+		}
+
+		res = append(res, hostImageStage{ImageSummary: imageStage, name: hostImageStageName(imageStage)})
+	}
+
+	return res
+}
+
+func hasNotRemovedChildImage(img types.ImageSummary, images []types.ImageSummary, removedImages map[string]bool) bool {
+	for _, childImage := range images {
+		if childImage.ParentID == img.ID && !removedImages[childImage.ID] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hostImageStageName(img types.ImageSummary) string {
+	for _, repoTag := range img.RepoTags {
+		if strings.HasPrefix(repoTag, image.LocalImageStageImageNamePrefix) {
+			return repoTag
+		}
+	}
+
+	return ""
+}
+
+func hostImageStageProjectNameAndSignature(name string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(name, image.LocalImageStageImageNamePrefix), ":", 2)
+	if len(parts) != 2 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
@@ -0,0 +1,68 @@
+package cleaning
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+
+	"github.com/flant/werf/pkg/image"
+)
+
+func TestHostImageStagesEvictionOrder(t *testing.T) {
+	now := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	newImageStage := func(projectName, signature, parentSignature string, size int64) types.ImageSummary {
+		imageStage := types.ImageSummary{
+			ID:       "sha256:" + signature,
+			RepoTags: []string{fmt.Sprintf(image.LocalImageStageImageFormat, projectName, signature)},
+			Size:     size,
+			Created:  now.Add(-30 * 24 * time.Hour).Unix(),
+		}
+
+		if parentSignature != "" {
+			imageStage.ParentID = "sha256:" + parentSignature
+		}
+
+		return imageStage
+	}
+
+	imageStages := []types.ImageSummary{
+		newImageStage("first", "from", "", 100),
+		newImageStage("first", "install", "from", 150),
+		newImageStage("first", "setup", "from", 400),
+		newImageStage("second", "base", "", 300),
+		newImageStage("second", "beforeInstall", "base", 300),
+		newImageStage("third", "other", "", 50),
+	}
+
+	// the image built from the stage by user keeps the stage
+	images := append([]types.ImageSummary{{ID: "sha256:app", ParentID: "sha256:other", RepoTags: []string{"app:latest"}}}, imageStages...)
+
+	lastUsed := map[string]time.Time{
+		"sha256:install":       now.Add(-10 * 24 * time.Hour),
+		"sha256:setup":         now.Add(-10 * 24 * time.Hour),
+		"sha256:base":          now.Add(-time.Hour),
+		"sha256:beforeInstall": now.Add(-time.Hour),
+		"sha256:other":         now.Add(-40 * 24 * time.Hour),
+	}
+
+	var names []string
+	for _, imageStage := range hostImageStagesEvictionOrder(imageStages, images, lastUsed) {
+		names = append(names, imageStage.name)
+	}
+
+	expected := []string{
+		"werf-stages-storage/first:setup",
+		"werf-stages-storage/first:install",
+		"werf-stages-storage/first:from",
+		"werf-stages-storage/second:beforeInstall",
+		"werf-stages-storage/second:base",
+	}
+
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, names)
+	}
+}
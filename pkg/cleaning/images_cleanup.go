@@ -2,12 +2,14 @@ package cleaning
 
 import (
 	"fmt"
-	"log"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/flant/logboek"
@@ -18,49 +20,126 @@ import (
 	"github.com/flant/werf/pkg/logging"
 	"github.com/flant/werf/pkg/slug"
 	"github.com/flant/werf/pkg/tag_strategy"
+	"github.com/flant/werf/pkg/util"
 )
 
-type ImagesCleanupPolicies struct {
-	GitTagStrategyHasLimit bool // No limit by default!
-	GitTagStrategyLimit    int64
+// ImagesCleanupRule keeps images published with one of the tag strategies, which references and image names match the rule.
+// Images are kept by the count (the last published) and by the age, an image is removed if it does not satisfy one of the limits
+type ImagesCleanupRule struct {
+	// Description is used in logs to tell which rule kept or dropped the image
+	Description string
 
-	GitTagStrategyHasExpiryPeriod bool // No expiration by default!
-	GitTagStrategyExpiryPeriod    time.Duration
+	TagStrategies []string       // Any strategy if empty
+	References    *regexp.Regexp // Any reference if nil
+	ImageNames    []string       // Any image if empty
 
-	GitCommitStrategyHasLimit bool // No limit by default!
-	GitCommitStrategyLimit    int64
+	HasKeepLast bool // No limit by default!
+	KeepLast    int64
 
-	GitCommitStrategyHasExpiryPeriod bool // No expiration by default!
-	GitCommitStrategyExpiryPeriod    time.Duration
+	HasKeepNewerThan bool // No expiration by default!
+	KeepNewerThan    time.Duration
+}
+
+// match checks the image published with the strategy, the reference is the git branch or tag the image is tagged by
+func (r ImagesCleanupRule) match(imageName, strategy, reference string) bool {
+	if len(r.TagStrategies) != 0 && !util.IsStringsContainValue(r.TagStrategies, strategy) {
+		return false
+	}
+
+	if len(r.ImageNames) != 0 && !util.IsStringsContainValue(r.ImageNames, imageName) {
+		return false
+	}
+
+	if r.References != nil && !r.References.MatchString(reference) {
+		return false
+	}
+
+	return true
 }
 
 type ImagesCleanupOptions struct {
 	CommonRepoOptions         CommonRepoOptions
 	LocalGit                  GitRepo
 	KubernetesContextsClients map[string]kubernetes.Interface
-	WithoutKube               bool
-	Policies                  ImagesCleanupPolicies
+	// KubernetesContextsDynamicClients are used to get images of KubernetesResources
+	KubernetesContextsDynamicClients map[string]dynamic.Interface
+	KubernetesResources              []KubernetesResource
+	WithoutKube                      bool
+	Rules                            []ImagesCleanupRule
+	// ProtectedTags are kept regardless of the cleanup policies, as well as images with the protected label or marker
+	ProtectedTags []*regexp.Regexp
+
+	HelmReleaseStorageNamespace string
+	HelmReleaseStorageType      string
+	// HelmReleaseRevisions limits the number of the last revisions of each release to scan (0 means all stored revisions)
+	HelmReleaseRevisions int
+
+	// Plan collects decisions about the images repo images, ApplyPlan replaces the cleanup policies with the reviewed plan decisions
+	Plan      *CleanupPlan
+	ApplyPlan *CleanupPlan
+
+	planImagesRepo *CleanupPlanImagesRepo
 }
 
 func ImagesCleanup(options ImagesCleanupOptions) error {
 	logProcessOptions := logboek.LogProcessOptions{ColorizeMsgFunc: logboek.ColorizeHighlight}
 	return logboek.LogProcess("Running images cleanup", logProcessOptions, func() error {
-		return imagesCleanup(options)
+		return withRepoImagesDeleteFailures(&options.CommonRepoOptions.DeleteOptions, func() error {
+			return imagesCleanup(options)
+		})
 	})
 }
 
 func imagesCleanup(options ImagesCleanupOptions) error {
 	imagesCleanupLockName := fmt.Sprintf("images-cleanup.%s", options.CommonRepoOptions.ImagesRepoManager.ImagesRepo())
 	return shluz.WithLock(imagesCleanupLockName, shluz.LockOptions{Timeout: time.Second * 600}, func() error {
+		imagesRepo := options.CommonRepoOptions.ImagesRepoManager.ImagesRepo()
+		if options.ApplyPlan != nil {
+			planImagesRepo := options.ApplyPlan.GetImagesRepo(imagesRepo)
+			if planImagesRepo == nil {
+				logboek.LogInfoF("Cleanup plan does not contain images repo %s\n", imagesRepo)
+				return nil
+			}
+
+			return applyCleanupPlan(planImagesRepo, options)
+		}
+
+		options.planImagesRepo = options.Plan.imagesRepo(imagesRepo)
+
 		repoImagesByImageName, err := repoImagesByImageName(options.CommonRepoOptions)
 		if err != nil {
 			return err
 		}
 
+		initialReason := CleanupPlanReasonNotManaged
+		if options.LocalGit == nil {
+			initialReason = CleanupPlanReasonNoGitRepository
+		}
+
+		for imageName, repoImages := range repoImagesByImageName {
+			for _, repoImage := range repoImages {
+				options.planImagesRepo.keep(imageName, repoImage, initialReason, "")
+			}
+		}
+
 		if options.LocalGit != nil {
+			if err := logboek.LogProcess("Skipping protected repo images", logboek.LogProcessOptions{}, func() error {
+				repoImagesByImageName, err = exceptProtectedRepoImages(repoImagesByImageName, options)
+				return err
+			}); err != nil {
+				return err
+			}
+
 			if !options.WithoutKube {
 				if err := logboek.LogProcess("Skipping repo images that are being used in Kubernetes", logboek.LogProcessOptions{}, func() error {
-					repoImagesByImageName, err = exceptRepoImagesByWhitelist(repoImagesByImageName, options.KubernetesContextsClients)
+					repoImagesByImageName, err = exceptRepoImagesByWhitelist(repoImagesByImageName, options)
+					return err
+				}); err != nil {
+					return err
+				}
+
+				if err := logboek.LogProcess("Skipping repo images that are referenced by Helm releases", logboek.LogProcessOptions{}, func() error {
+					repoImagesByImageName, err = exceptRepoImagesByHelmReleases(repoImagesByImageName, options)
 					return err
 				}); err != nil {
 					return err
@@ -70,12 +149,12 @@ func imagesCleanup(options ImagesCleanupOptions) error {
 			for imageName, repoImages := range repoImagesByImageName {
 				logProcessMessage := fmt.Sprintf("Processing image %s", logging.ImageLogName(imageName, false))
 				if err := logboek.LogProcess(logProcessMessage, logboek.LogProcessOptions{ColorizeMsgFunc: logboek.ColorizeHighlight}, func() error {
-					repoImages, err = repoImagesCleanupByNonexistentGitPrimitive(repoImages, options)
+					repoImages, err = repoImagesCleanupByNonexistentGitPrimitive(imageName, repoImages, options)
 					if err != nil {
 						return err
 					}
 
-					repoImages, err = repoImagesCleanupByPolicies(repoImages, options)
+					repoImages, err = repoImagesCleanupByRules(imageName, repoImages, options)
 					if err != nil {
 						return err
 					}
@@ -87,22 +166,97 @@ func imagesCleanup(options ImagesCleanupOptions) error {
 					return err
 				}
 			}
+
+			if err := repoImagesMetadataSync(options.CommonRepoOptions); err != nil {
+				return err
+			}
 		}
 
 		return nil
 	})
 }
 
-func exceptRepoImagesByWhitelist(repoImagesByImageName map[string][]docker_registry.RepoImage, kubernetesContextsClients map[string]kubernetes.Interface) (map[string][]docker_registry.RepoImage, error) {
-	var deployedDockerImagesNames []string
-	for contextName, kubernetesClient := range kubernetesContextsClients {
+// exceptProtectedRepoImages keeps images, which tags match the protected tags patterns or which are marked protected
+func exceptProtectedRepoImages(repoImagesByImageName map[string][]docker_registry.RepoImage, options ImagesCleanupOptions) (map[string][]docker_registry.RepoImage, error) {
+	for imageName, repoImages := range repoImagesByImageName {
+		var newRepoImages []docker_registry.RepoImage
+
+		for _, repoImage := range repoImages {
+			protection, err := repoImageProtection(repoImage, options.ProtectedTags)
+			if err != nil {
+				return nil, err
+			}
+
+			if protection != "" {
+				logboek.LogInfoF("%s:%s\n", repoImage.Repository, repoImage.Tag)
+				options.planImagesRepo.keep(imageName, repoImage, CleanupPlanReasonProtected, protection)
+				continue
+			}
+
+			newRepoImages = append(newRepoImages, repoImage)
+		}
+
+		repoImagesByImageName[imageName] = newRepoImages
+	}
+
+	return repoImagesByImageName, nil
+}
+
+// repoImageProtection returns the description of the image protection or an empty string if the image is not protected
+func repoImageProtection(repoImage docker_registry.RepoImage, protectedTags []*regexp.Regexp) (string, error) {
+	for _, protectedTag := range protectedTags {
+		if protectedTag.MatchString(repoImage.Tag) {
+			return fmt.Sprintf("tag matches protectedTags pattern %s", protectedTag.String()), nil
+		}
+	}
+
+	if repoImage.HasProtectionMarker {
+		protected, exists, err := docker_registry.ProtectionMarker(repoImage.Repository, repoImage.Tag)
+		if err != nil {
+			return "", fmt.Errorf("cannot read protection marker of %s:%s: %s", repoImage.Repository, repoImage.Tag, err)
+		}
+
+		if exists {
+			if protected {
+				return "protection marker", nil
+			}
+
+			return "", nil
+		}
+	}
+
+	labels, err := repoImageLabels(repoImage)
+	if err != nil {
+		return "", err
+	}
+
+	if labels[image.WerfProtectedLabel] == "true" {
+		return fmt.Sprintf("%s label", image.WerfProtectedLabel), nil
+	}
+
+	return "", nil
+}
+
+func exceptRepoImagesByWhitelist(repoImagesByImageName map[string][]docker_registry.RepoImage, options ImagesCleanupOptions) (map[string][]docker_registry.RepoImage, error) {
+	deployedDockerImagesByContext := map[string][]deployedDockerImage{}
+	for contextName, kubernetesClient := range options.KubernetesContextsClients {
+		contextName := contextName
 		if err := logboek.LogProcessInline(fmt.Sprintf("Getting deployed docker images (context %s)", contextName), logboek.LogProcessInlineOptions{}, func() error {
-			kubernetesClientDeployedDockerImagesNames, err := deployedDockerImages(kubernetesClient)
+			kubernetesClientDeployedDockerImages, err := deployedDockerImages(kubernetesClient)
 			if err != nil {
 				return fmt.Errorf("cannot get deployed images: %s", err)
 			}
 
-			deployedDockerImagesNames = append(deployedDockerImagesNames, kubernetesClientDeployedDockerImagesNames...)
+			if dynamicClient, ok := options.KubernetesContextsDynamicClients[contextName]; ok && len(options.KubernetesResources) != 0 {
+				resourcesDeployedDockerImages, err := kubernetesResourcesDeployedDockerImages(kubernetesClient.Discovery(), dynamicClient, options.KubernetesResources)
+				if err != nil {
+					return fmt.Errorf("cannot get deployed images: %s", err)
+				}
+
+				kubernetesClientDeployedDockerImages = append(kubernetesClientDeployedDockerImages, resourcesDeployedDockerImages...)
+			}
+
+			deployedDockerImagesByContext[contextName] = kubernetesClientDeployedDockerImages
 
 			return nil
 		}); err != nil {
@@ -115,11 +269,58 @@ func exceptRepoImagesByWhitelist(repoImagesByImageName map[string][]docker_regis
 
 	Loop:
 		for _, repoImage := range repoImages {
-			imageName := fmt.Sprintf("%s:%s", repoImage.Repository, repoImage.Tag)
-			for _, deployedDockerImageName := range deployedDockerImagesNames {
-				if deployedDockerImageName == imageName {
-					logboek.LogInfoLn(imageName)
-					continue Loop
+			dockerImageName := fmt.Sprintf("%s:%s", repoImage.Repository, repoImage.Tag)
+			for contextName, deployedDockerImages := range deployedDockerImagesByContext {
+				for _, deployedDockerImage := range deployedDockerImages {
+					if deployedDockerImage.Image == dockerImageName {
+						logboek.LogInfoLn(dockerImageName)
+						options.planImagesRepo.keep(imageName, repoImage, CleanupPlanReasonUsedInKubernetes, fmt.Sprintf("context %s, namespace %s, %s", contextName, deployedDockerImage.Namespace, deployedDockerImage.Resource))
+						continue Loop
+					}
+				}
+			}
+
+			newRepoImages = append(newRepoImages, repoImage)
+		}
+
+		repoImagesByImageName[imageName] = newRepoImages
+	}
+
+	return repoImagesByImageName, nil
+}
+
+// exceptRepoImagesByHelmReleases keeps images, which are referenced by the last stored helm release revisions (e.g. a rollback target)
+func exceptRepoImagesByHelmReleases(repoImagesByImageName map[string][]docker_registry.RepoImage, options ImagesCleanupOptions) (map[string][]docker_registry.RepoImage, error) {
+	manifestsByContext := map[string][]helmReleaseManifest{}
+	for contextName, kubernetesClient := range options.KubernetesContextsClients {
+		contextName := contextName
+		if err := logboek.LogProcessInline(fmt.Sprintf("Getting Helm releases manifests (context %s)", contextName), logboek.LogProcessInlineOptions{}, func() error {
+			contextManifests, err := helmReleasesManifests(kubernetesClient, options.HelmReleaseStorageNamespace, options.HelmReleaseStorageType, options.HelmReleaseRevisions)
+			if err != nil {
+				return fmt.Errorf("cannot get Helm releases: %s", err)
+			}
+
+			manifestsByContext[contextName] = contextManifests
+
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	for imageName, repoImages := range repoImagesByImageName {
+		var newRepoImages []docker_registry.RepoImage
+
+	Loop:
+		for _, repoImage := range repoImages {
+			dockerImageName := fmt.Sprintf("%s:%s", repoImage.Repository, repoImage.Tag)
+			for contextName, manifests := range manifestsByContext {
+				for _, manifest := range manifests {
+					if manifestReferencesDockerImage(manifest.Manifest, dockerImageName) {
+						logboek.LogInfoLn(dockerImageName)
+						options.planImagesRepo.keep(imageName, repoImage, CleanupPlanReasonReferencedByHelmRelease, fmt.Sprintf("context %s, release %s revision %d", contextName, manifest.Release, manifest.Revision))
+						continue Loop
+					}
 				}
 			}
 
@@ -132,11 +333,12 @@ func exceptRepoImagesByWhitelist(repoImagesByImageName map[string][]docker_regis
 	return repoImagesByImageName, nil
 }
 
-func repoImagesCleanupByNonexistentGitPrimitive(repoImages []docker_registry.RepoImage, options ImagesCleanupOptions) ([]docker_registry.RepoImage, error) {
-	var nonexistentGitTagRepoImages, nonexistentGitCommitRepoImages, nonexistentGitBranchRepoImages []docker_registry.RepoImage
+func repoImagesCleanupByNonexistentGitPrimitive(imageName string, repoImages []docker_registry.RepoImage, options ImagesCleanupOptions) ([]docker_registry.RepoImage, error) {
+	var nonexistentGitTagRepoImages, nonexistentGitCommitRepoImages, nonexistentGitBranchRepoImages, nonexistentStagesSignatureRepoImages []docker_registry.RepoImage
 
 	var gitTags []string
 	var gitBranches []string
+	var gitReferencesCommits []string
 
 	if options.LocalGit != nil {
 		var err error
@@ -149,6 +351,11 @@ func repoImagesCleanupByNonexistentGitPrimitive(repoImages []docker_registry.Rep
 		if err != nil {
 			return nil, fmt.Errorf("cannot get local git branches list: %s", err)
 		}
+
+		gitReferencesCommits, err = options.LocalGit.ReferencesCommits()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get commits of local git references: %s", err)
+		}
 	}
 
 Loop:
@@ -168,17 +375,50 @@ Loop:
 			repoImageMetaTag = repoImage.Tag
 		}
 
+		keep := func(details string) {
+			options.planImagesRepo.keep(imageName, repoImage, CleanupPlanReasonGitReferenceExists, details)
+		}
+
+		remove := func(details string) error {
+			return options.planImagesRepo.remove(imageName, repoImage, CleanupPlanReasonGitReferenceNonexistent, details)
+		}
+
 		switch strategy {
 		case string(tag_strategy.GitTag):
 			if repoImageMetaTagMatch(repoImageMetaTag, gitTags...) {
+				keep(fmt.Sprintf("git tag %s exists", repoImageMetaTag))
+				continue Loop
+			} else {
+				if err := remove(fmt.Sprintf("git tag %s does not exist", repoImageMetaTag)); err != nil {
+					return nil, err
+				}
+
+				nonexistentGitTagRepoImages = append(nonexistentGitTagRepoImages, repoImage)
+			}
+		case string(tag_strategy.GitSemver):
+			gitTag, ok := labels[image.WerfGitTagLabel]
+			if !ok || util.IsStringsContainValue(gitTags, gitTag) {
+				if ok {
+					keep(fmt.Sprintf("git tag %s exists", gitTag))
+				}
+
 				continue Loop
 			} else {
+				if err := remove(fmt.Sprintf("git tag %s does not exist", gitTag)); err != nil {
+					return nil, err
+				}
+
 				nonexistentGitTagRepoImages = append(nonexistentGitTagRepoImages, repoImage)
 			}
 		case string(tag_strategy.GitBranch):
 			if repoImageMetaTagMatch(repoImageMetaTag, gitBranches...) {
+				keep(fmt.Sprintf("git branch %s exists", repoImageMetaTag))
 				continue Loop
 			} else {
+				if err := remove(fmt.Sprintf("git branch %s does not exist", repoImageMetaTag)); err != nil {
+					return nil, err
+				}
+
 				nonexistentGitBranchRepoImages = append(nonexistentGitBranchRepoImages, repoImage)
 			}
 		case string(tag_strategy.GitCommit):
@@ -198,8 +438,34 @@ Loop:
 			}
 
 			if !exist {
+				if err := remove(fmt.Sprintf("git commit %s does not exist", repoImageMetaTag)); err != nil {
+					return nil, err
+				}
+
 				nonexistentGitCommitRepoImages = append(nonexistentGitCommitRepoImages, repoImage)
+			} else {
+				keep(fmt.Sprintf("git commit %s exists", repoImageMetaTag))
 			}
+		case string(tag_strategy.StagesSignature):
+			// the image is kept while a git branch or tag points to the commit that has published the tag or skipped it as up-to-date
+			// (image without commits is never removed)
+			gitCommits := repoImageGitCommits(repoImage, labels)
+			if len(gitCommits) == 0 || options.LocalGit == nil {
+				continue Loop
+			}
+
+			for _, gitCommit := range gitCommits {
+				if util.IsStringsContainValue(gitReferencesCommits, gitCommit) {
+					keep(fmt.Sprintf("git reference to commit %s exists", gitCommit))
+					continue Loop
+				}
+			}
+
+			if err := remove(fmt.Sprintf("git references to commits %s do not exist", strings.Join(gitCommits, ", "))); err != nil {
+				return nil, err
+			}
+
+			nonexistentStagesSignatureRepoImages = append(nonexistentStagesSignatureRepoImages, repoImage)
 		}
 	}
 
@@ -240,9 +506,34 @@ Loop:
 		repoImages = exceptRepoImages(repoImages, nonexistentGitCommitRepoImages...)
 	}
 
+	if len(nonexistentStagesSignatureRepoImages) != 0 {
+		logboek.LogBlock("Removed tags by nonexistent stages-signature git-reference policy", logboek.LogBlockOptions{}, func() {
+			err = repoImagesRemove(nonexistentStagesSignatureRepoImages, options.CommonRepoOptions)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		repoImages = exceptRepoImages(repoImages, nonexistentStagesSignatureRepoImages...)
+	}
+
 	return repoImages, nil
 }
 
+// repoImageGitCommits returns commits that have published the tag or skipped it as up-to-date (the latter are known only from the metadata record)
+func repoImageGitCommits(repoImage docker_registry.RepoImage, labels map[string]string) []string {
+	if repoImage.Metadata != nil {
+		return repoImage.Metadata.GitCommits()
+	}
+
+	if gitCommit, ok := labels[image.WerfGitCommitLabel]; ok {
+		return []string{gitCommit}
+	}
+
+	return nil
+}
+
 func repoImageMetaTagMatch(imageMetaTag string, matches ...string) bool {
 	for _, match := range matches {
 		if imageMetaTag == slug.DockerTag(match) {
@@ -253,138 +544,143 @@ func repoImageMetaTagMatch(imageMetaTag string, matches ...string) bool {
 	return false
 }
 
-func repoImagesCleanupByPolicies(repoImages []docker_registry.RepoImage, options ImagesCleanupOptions) ([]docker_registry.RepoImage, error) {
-	var repoImagesWithGitTagScheme, repoImagesWithGitCommitScheme []docker_registry.RepoImage
+type repoImageByRule struct {
+	docker_registry.RepoImage
+	created time.Time
+}
 
+// repoImagesCleanupByRules applies the first matching rule to each image published with a tag strategy.
+// Images that do not match any rule are kept
+func repoImagesCleanupByRules(imageName string, repoImages []docker_registry.RepoImage, options ImagesCleanupOptions) ([]docker_registry.RepoImage, error) {
+	if len(options.Rules) == 0 {
+		return repoImages, nil
+	}
+
+	repoImagesByRule := make([][]repoImageByRule, len(options.Rules))
+	var notMatchedRepoImages []docker_registry.RepoImage
+
+Loop:
 	for _, repoImage := range repoImages {
 		labels, err := repoImageLabels(repoImage)
 		if err != nil {
 			return nil, err
 		}
 
+		// images with custom tags are never cleaned up
 		strategy, ok := labels[image.WerfTagStrategyLabel]
-		if !ok {
+		if !ok || strategy == string(tag_strategy.Custom) {
 			continue
 		}
 
-		switch strategy {
-		case string(tag_strategy.GitTag):
-			repoImagesWithGitTagScheme = append(repoImagesWithGitTagScheme, repoImage)
-		case string(tag_strategy.GitCommit):
-			repoImagesWithGitCommitScheme = append(repoImagesWithGitCommitScheme, repoImage)
+		reference, ok := labels[image.WerfImageTagLabel]
+		if !ok { // legacy
+			reference = repoImage.Tag
 		}
-	}
-
-	cleanupByPolicyOptions := repoImagesCleanupByPolicyOptions{
-		hasLimit:          options.Policies.GitTagStrategyHasLimit,
-		limit:             options.Policies.GitTagStrategyLimit,
-		hasExpiryPeriod:   options.Policies.GitTagStrategyHasExpiryPeriod,
-		expiryPeriod:      options.Policies.GitTagStrategyExpiryPeriod,
-		gitPrimitive:      "tag",
-		commonRepoOptions: options.CommonRepoOptions,
-	}
-
-	var err error
-	repoImages, err = repoImagesCleanupByPolicy(repoImages, repoImagesWithGitTagScheme, cleanupByPolicyOptions)
-	if err != nil {
-		return nil, err
-	}
 
-	cleanupByPolicyOptions = repoImagesCleanupByPolicyOptions{
-		hasLimit:          options.Policies.GitCommitStrategyHasLimit,
-		limit:             options.Policies.GitCommitStrategyLimit,
-		hasExpiryPeriod:   options.Policies.GitCommitStrategyHasExpiryPeriod,
-		expiryPeriod:      options.Policies.GitCommitStrategyExpiryPeriod,
-		gitPrimitive:      "commit",
-		commonRepoOptions: options.CommonRepoOptions,
-	}
-
-	repoImages, err = repoImagesCleanupByPolicy(repoImages, repoImagesWithGitCommitScheme, cleanupByPolicyOptions)
-	if err != nil {
-		return nil, err
-	}
+		if strategy == string(tag_strategy.GitSemver) {
+			// floating tags always point to the latest versions and follow the full version tags
+			if tag_strategy.IsSemverFloatingTag(reference) {
+				continue
+			}
 
-	return repoImages, nil
-}
+			if gitTag, ok := labels[image.WerfGitTagLabel]; ok {
+				reference = gitTag
+			}
+		}
 
-type repoImagesCleanupByPolicyOptions struct {
-	hasLimit        bool
-	limit           int64
-	hasExpiryPeriod bool
-	expiryPeriod    time.Duration
+		for ind, rule := range options.Rules {
+			if rule.match(imageName, strategy, reference) {
+				created, err := repoImageCreated(repoImage)
+				if err != nil {
+					return nil, err
+				}
 
-	gitPrimitive      string
-	commonRepoOptions CommonRepoOptions
-}
+				repoImagesByRule[ind] = append(repoImagesByRule[ind], repoImageByRule{RepoImage: repoImage, created: created})
+				continue Loop
+			}
+		}
 
-func repoImagesCleanupByPolicy(repoImages, repoImagesWithScheme []docker_registry.RepoImage, options repoImagesCleanupByPolicyOptions) ([]docker_registry.RepoImage, error) {
-	var expiryTime time.Time
-	if options.hasExpiryPeriod {
-		expiryTime = time.Now().Add(time.Duration(-options.expiryPeriod))
+		notMatchedRepoImages = append(notMatchedRepoImages, repoImage)
 	}
 
-	sort.Slice(repoImagesWithScheme, func(i, j int) bool {
-		iCreated, err := repoImageCreated(repoImagesWithScheme[i])
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		jCreated, err := repoImageCreated(repoImagesWithScheme[j])
-		if err != nil {
-			log.Fatal(err)
+	now := time.Now()
+	var repoImagesToRemove []docker_registry.RepoImage
+	for ind, rule := range options.Rules {
+		ruleRepoImages := repoImagesByRule[ind]
+		if len(ruleRepoImages) == 0 {
+			continue
 		}
 
-		return iCreated.Before(jCreated)
-	})
+		// the last published images go first
+		sort.SliceStable(ruleRepoImages, func(i, j int) bool {
+			return ruleRepoImages[i].created.After(ruleRepoImages[j].created)
+		})
 
-	var notExpiredRepoImages, expiredRepoImages []docker_registry.RepoImage
-	for _, repoImage := range repoImagesWithScheme {
-		created, err := repoImageCreated(repoImage)
-		if err != nil {
-			return nil, err
-		}
+		var err error
+		logboek.LogBlock(fmt.Sprintf("Applying cleanup rule %s", rule.Description), logboek.LogBlockOptions{}, func() {
+			for i, repoImage := range ruleRepoImages {
+				created := repoImage.created.Format("2006-01-02T15:04:05-0700")
+
+				if rule.HasKeepLast && int64(i) >= rule.KeepLast {
+					logboek.LogF("drop %s (published %s, not in the last %d)\n", repoImage.Tag, created, rule.KeepLast)
+					details := fmt.Sprintf("rule %s, published %s, not in the last %d", rule.Description, created, rule.KeepLast)
+					if err = options.planImagesRepo.remove(imageName, repoImage.RepoImage, CleanupPlanReasonRuleLimit, details); err != nil {
+						return
+					}
 
-		if options.hasExpiryPeriod && created.Before(expiryTime) {
-			expiredRepoImages = append(expiredRepoImages, repoImage)
-		} else {
-			notExpiredRepoImages = append(notExpiredRepoImages, repoImage)
-		}
-	}
+					repoImagesToRemove = append(repoImagesToRemove, repoImage.RepoImage)
+				} else if rule.HasKeepNewerThan && repoImage.created.Before(now.Add(-rule.KeepNewerThan)) {
+					logboek.LogF("drop %s (published %s, older than %s)\n", repoImage.Tag, created, rule.KeepNewerThan)
+					details := fmt.Sprintf("rule %s, published %s, older than %s", rule.Description, created, rule.KeepNewerThan)
+					if err = options.planImagesRepo.remove(imageName, repoImage.RepoImage, CleanupPlanReasonRuleExpired, details); err != nil {
+						return
+					}
 
-	var err error
-	if len(expiredRepoImages) != 0 {
-		logBlockMessage := fmt.Sprintf("Removed tags by git-%s date policy (created before %s)", options.gitPrimitive, expiryTime.Format("2006-01-02T15:04:05-0700"))
-		logboek.LogBlock(logBlockMessage, logboek.LogBlockOptions{}, func() {
-			err = repoImagesRemove(expiredRepoImages, options.commonRepoOptions)
+					repoImagesToRemove = append(repoImagesToRemove, repoImage.RepoImage)
+				} else {
+					logboek.LogInfoF("keep %s (published %s)\n", repoImage.Tag, created)
+					options.planImagesRepo.keep(imageName, repoImage.RepoImage, CleanupPlanReasonRuleKeep, fmt.Sprintf("rule %s, published %s", rule.Description, created))
+				}
+			}
 		})
 
 		if err != nil {
 			return nil, err
 		}
-
-		repoImages = exceptRepoImages(repoImages, expiredRepoImages...)
 	}
 
-	if options.hasLimit && int64(len(notExpiredRepoImages)) > options.limit {
-		excessImagesByLimit := notExpiredRepoImages[:int64(len(notExpiredRepoImages))-options.limit]
+	if len(notMatchedRepoImages) != 0 {
+		logboek.LogBlock("Kept tags not matched by cleanup rules", logboek.LogBlockOptions{}, func() {
+			for _, repoImage := range notMatchedRepoImages {
+				logboek.LogInfoLn(repoImage.Tag)
+			}
+		})
+	}
 
-		logBlockMessage := fmt.Sprintf("Removed tags by git-%s limit policy (> %d)", options.gitPrimitive, options.limit)
-		logboek.LogBlock(logBlockMessage, logboek.LogBlockOptions{}, func() {
-			err = repoImagesRemove(excessImagesByLimit, options.commonRepoOptions)
+	if len(repoImagesToRemove) != 0 {
+		var err error
+		logboek.LogBlock("Removed tags by cleanup rules", logboek.LogBlockOptions{}, func() {
+			err = repoImagesRemove(repoImagesToRemove, options.CommonRepoOptions)
 		})
 
 		if err != nil {
 			return nil, err
 		}
 
-		repoImages = exceptRepoImages(repoImages, excessImagesByLimit...)
+		repoImages = exceptRepoImages(repoImages, repoImagesToRemove...)
 	}
 
 	return repoImages, nil
 }
 
-func deployedDockerImages(kubernetesClient kubernetes.Interface) ([]string, error) {
-	var deployedDockerImages []string
+type deployedDockerImage struct {
+	Image     string
+	Namespace string
+	Resource  string
+}
+
+func deployedDockerImages(kubernetesClient kubernetes.Interface) ([]deployedDockerImage, error) {
+	var deployedDockerImages []deployedDockerImage
 
 	images, err := getPodsImages(kubernetesClient)
 	if err != nil {
@@ -445,129 +741,128 @@ func deployedDockerImages(kubernetesClient kubernetes.Interface) ([]string, erro
 	return deployedDockerImages, nil
 }
 
-func getPodsImages(kubernetesClient kubernetes.Interface) ([]string, error) {
-	var images []string
+func podSpecDeployedDockerImages(kind, namespace, name string, podSpec corev1.PodSpec) []deployedDockerImage {
+	var images []deployedDockerImage
+	for _, containers := range [][]corev1.Container{podSpec.Containers, podSpec.InitContainers} {
+		for _, container := range containers {
+			images = append(images, deployedDockerImage{
+				Image:     container.Image,
+				Namespace: namespace,
+				Resource:  fmt.Sprintf("%s/%s", kind, name),
+			})
+		}
+	}
+
+	return images
+}
+
+func getPodsImages(kubernetesClient kubernetes.Interface) ([]deployedDockerImage, error) {
+	var images []deployedDockerImage
 	list, err := kubernetesClient.CoreV1().Pods("").List(v1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	for _, pod := range list.Items {
-		for _, container := range pod.Spec.Containers {
-			images = append(images, container.Image)
-		}
+		images = append(images, podSpecDeployedDockerImages("Pod", pod.Namespace, pod.Name, pod.Spec)...)
 	}
 
 	return images, nil
 }
 
-func getReplicationControllersImages(kubernetesClient kubernetes.Interface) ([]string, error) {
-	var images []string
+func getReplicationControllersImages(kubernetesClient kubernetes.Interface) ([]deployedDockerImage, error) {
+	var images []deployedDockerImage
 	list, err := kubernetesClient.CoreV1().ReplicationControllers("").List(v1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	for _, replicationController := range list.Items {
-		for _, container := range replicationController.Spec.Template.Spec.Containers {
-			images = append(images, container.Image)
-		}
+		images = append(images, podSpecDeployedDockerImages("ReplicationController", replicationController.Namespace, replicationController.Name, replicationController.Spec.Template.Spec)...)
 	}
 
 	return images, nil
 }
 
-func getDeploymentsImages(kubernetesClient kubernetes.Interface) ([]string, error) {
-	var images []string
+func getDeploymentsImages(kubernetesClient kubernetes.Interface) ([]deployedDockerImage, error) {
+	var images []deployedDockerImage
 	list, err := kubernetesClient.AppsV1().Deployments("").List(v1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	for _, deployment := range list.Items {
-		for _, container := range deployment.Spec.Template.Spec.Containers {
-			images = append(images, container.Image)
-		}
+		images = append(images, podSpecDeployedDockerImages("Deployment", deployment.Namespace, deployment.Name, deployment.Spec.Template.Spec)...)
 	}
 
 	return images, nil
 }
 
-func getStatefulSetsImages(kubernetesClient kubernetes.Interface) ([]string, error) {
-	var images []string
+func getStatefulSetsImages(kubernetesClient kubernetes.Interface) ([]deployedDockerImage, error) {
+	var images []deployedDockerImage
 	list, err := kubernetesClient.AppsV1().StatefulSets("").List(v1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	for _, statefulSet := range list.Items {
-		for _, container := range statefulSet.Spec.Template.Spec.Containers {
-			images = append(images, container.Image)
-		}
+		images = append(images, podSpecDeployedDockerImages("StatefulSet", statefulSet.Namespace, statefulSet.Name, statefulSet.Spec.Template.Spec)...)
 	}
 
 	return images, nil
 }
 
-func getDaemonSetsImages(kubernetesClient kubernetes.Interface) ([]string, error) {
-	var images []string
+func getDaemonSetsImages(kubernetesClient kubernetes.Interface) ([]deployedDockerImage, error) {
+	var images []deployedDockerImage
 	list, err := kubernetesClient.AppsV1().DaemonSets("").List(v1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	for _, daemonSets := range list.Items {
-		for _, container := range daemonSets.Spec.Template.Spec.Containers {
-			images = append(images, container.Image)
-		}
+	for _, daemonSet := range list.Items {
+		images = append(images, podSpecDeployedDockerImages("DaemonSet", daemonSet.Namespace, daemonSet.Name, daemonSet.Spec.Template.Spec)...)
 	}
 
 	return images, nil
 }
 
-func getReplicaSetsImages(kubernetesClient kubernetes.Interface) ([]string, error) {
-	var images []string
+func getReplicaSetsImages(kubernetesClient kubernetes.Interface) ([]deployedDockerImage, error) {
+	var images []deployedDockerImage
 	list, err := kubernetesClient.AppsV1().ReplicaSets("").List(v1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	for _, replicaSet := range list.Items {
-		for _, container := range replicaSet.Spec.Template.Spec.Containers {
-			images = append(images, container.Image)
-		}
+		images = append(images, podSpecDeployedDockerImages("ReplicaSet", replicaSet.Namespace, replicaSet.Name, replicaSet.Spec.Template.Spec)...)
 	}
 
 	return images, nil
 }
 
-func getCronJobsImages(kubernetesClient kubernetes.Interface) ([]string, error) {
-	var images []string
+func getCronJobsImages(kubernetesClient kubernetes.Interface) ([]deployedDockerImage, error) {
+	var images []deployedDockerImage
 	list, err := kubernetesClient.BatchV1beta1().CronJobs("").List(v1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	for _, cronJob := range list.Items {
-		for _, container := range cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers {
-			images = append(images, container.Image)
-		}
+		images = append(images, podSpecDeployedDockerImages("CronJob", cronJob.Namespace, cronJob.Name, cronJob.Spec.JobTemplate.Spec.Template.Spec)...)
 	}
 
 	return images, nil
 }
 
-func getJobsImages(kubernetesClient kubernetes.Interface) ([]string, error) {
-	var images []string
+func getJobsImages(kubernetesClient kubernetes.Interface) ([]deployedDockerImage, error) {
+	var images []deployedDockerImage
 	list, err := kubernetesClient.BatchV1().Jobs("").List(v1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	for _, job := range list.Items {
-		for _, container := range job.Spec.Template.Spec.Containers {
-			images = append(images, container.Image)
-		}
+		images = append(images, podSpecDeployedDockerImages("Job", job.Namespace, job.Name, job.Spec.Template.Spec)...)
 	}
 
 	return images, nil
@@ -0,0 +1,324 @@
+package cleaning
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flant/go-containerregistry/pkg/registry"
+	v1 "github.com/flant/go-containerregistry/pkg/v1"
+	"github.com/flant/go-containerregistry/pkg/v1/mutate"
+	"github.com/flant/go-containerregistry/pkg/v1/random"
+
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/image"
+)
+
+// gcrImagesRepoManager allows to remove images in dry run mode without requests to the registry
+type gcrImagesRepoManager struct{}
+
+func (m gcrImagesRepoManager) ImagesRepo() string { return "gcr.io/project" }
+func (m gcrImagesRepoManager) ImageRepo(imageName string) string {
+	return "gcr.io/project/" + imageName
+}
+func (m gcrImagesRepoManager) ImageRepoWithTag(imageName, tag string) string {
+	return m.ImageRepo(imageName) + ":" + tag
+}
+func (m gcrImagesRepoManager) IsMonorepo() bool { return false }
+func (m gcrImagesRepoManager) IsTemplate() bool { return false }
+func (m gcrImagesRepoManager) ParseImageRepoTag(_, _, imageRepoTag string) (string, bool) {
+	return imageRepoTag, true
+}
+
+func newRuleTestRepoImage(tag string, metadata docker_registry.ImageMetadata) docker_registry.RepoImage {
+	repoImage := docker_registry.NewRepoImage("gcr.io/project/app", tag)
+	repoImage.Metadata = &metadata
+	return repoImage
+}
+
+func TestRepoImagesCleanupByRules(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+
+	repoImages := []docker_registry.RepoImage{
+		newRuleTestRepoImage("master", docker_registry.ImageMetadata{ImageName: "app", TagStrategy: "git-branch", ImageTag: "master", Created: now.Add(-100 * day)}),
+		newRuleTestRepoImage("feature-a", docker_registry.ImageMetadata{ImageName: "app", TagStrategy: "git-branch", ImageTag: "feature-a", Created: now.Add(-20 * day)}),
+		newRuleTestRepoImage("feature-b", docker_registry.ImageMetadata{ImageName: "app", TagStrategy: "git-branch", ImageTag: "feature-b", Created: now.Add(-1 * day)}),
+		newRuleTestRepoImage("1.0.0", docker_registry.ImageMetadata{ImageName: "app", TagStrategy: "git-semver", ImageTag: "1.0.0", GitTag: "v1.0.0", Created: now.Add(-30 * day)}),
+		newRuleTestRepoImage("1.1.0", docker_registry.ImageMetadata{ImageName: "app", TagStrategy: "git-semver", ImageTag: "1.1.0", GitTag: "v1.1.0", Created: now.Add(-20 * day)}),
+		newRuleTestRepoImage("1.2.0", docker_registry.ImageMetadata{ImageName: "app", TagStrategy: "git-semver", ImageTag: "1.2.0", GitTag: "v1.2.0", Created: now.Add(-10 * day)}),
+		newRuleTestRepoImage("1", docker_registry.ImageMetadata{ImageName: "app", TagStrategy: "git-semver", ImageTag: "1", GitTag: "v1.2.0", Created: now.Add(-10 * day)}),
+		newRuleTestRepoImage("custom", docker_registry.ImageMetadata{ImageName: "app", TagStrategy: "custom", ImageTag: "custom", Created: now.Add(-100 * day)}),
+	}
+
+	options := ImagesCleanupOptions{
+		CommonRepoOptions: CommonRepoOptions{ImagesRepoManager: gcrImagesRepoManager{}, DryRun: true},
+		Rules: []ImagesCleanupRule{
+			{
+				Description:   "keep master",
+				TagStrategies: []string{"git-branch"},
+				References:    regexp.MustCompile("^master$"),
+			},
+			{
+				Description:      "branches for a week",
+				TagStrategies:    []string{"git-branch"},
+				HasKeepNewerThan: true,
+				KeepNewerThan:    7 * day,
+			},
+			{
+				Description:   "last two releases",
+				TagStrategies: []string{"git-semver"},
+				HasKeepLast:   true,
+				KeepLast:      2,
+			},
+			{
+				Description: "other image",
+				ImageNames:  []string{"backend"},
+				HasKeepLast: true,
+				KeepLast:    0,
+			},
+		},
+	}
+
+	res, err := repoImagesCleanupByRules("app", repoImages, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var tags []string
+	for _, repoImage := range res {
+		tags = append(tags, repoImage.Tag)
+	}
+
+	expectedTags := []string{"master", "feature-b", "1.1.0", "1.2.0", "1", "custom"}
+	if !reflect.DeepEqual(tags, expectedTags) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expectedTags, tags)
+	}
+}
+
+// testGitRepo is the shallow clone, which does not have commit objects except the branches and tags heads
+type testGitRepo struct {
+	branches map[string]string
+	tags     map[string]string
+}
+
+func (r testGitRepo) IsCommitExists(commit string) (bool, error) {
+	commits, _ := r.ReferencesCommits()
+	for _, c := range commits {
+		if c == commit {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r testGitRepo) TagsList() ([]string, error) {
+	var tags []string
+	for tag := range r.tags {
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+func (r testGitRepo) RemoteBranchesList() ([]string, error) {
+	var branches []string
+	for branch := range r.branches {
+		branches = append(branches, branch)
+	}
+
+	return branches, nil
+}
+
+func (r testGitRepo) ReferencesCommits() ([]string, error) {
+	var commits []string
+	for _, commit := range r.branches {
+		commits = append(commits, commit)
+	}
+
+	for _, commit := range r.tags {
+		commits = append(commits, commit)
+	}
+
+	return commits, nil
+}
+
+func TestRepoImagesCleanupByStagesSignature(t *testing.T) {
+	newStagesSignatureRepoImage := func(signature, gitCommit string, referencingGitCommits ...string) docker_registry.RepoImage {
+		return newRuleTestRepoImage(signature, docker_registry.ImageMetadata{ImageName: "app", TagStrategy: "stages-signature", ImageTag: signature, GitCommit: gitCommit, ReferencingGitCommits: referencingGitCommits})
+	}
+
+	repoImages := []docker_registry.RepoImage{
+		// master has advanced, the image content is unchanged and the commit of the first publication is gone
+		newStagesSignatureRepoImage("0a1b", "c1", "c2", "c3"),
+		// the commit of the first publication is the tag
+		newStagesSignatureRepoImage("2c3d", "c4"),
+		// branches with the image have been removed
+		newStagesSignatureRepoImage("4e5f", "c5", "c6"),
+		// the image without commits
+		newStagesSignatureRepoImage("6a7b", ""),
+	}
+
+	options := ImagesCleanupOptions{
+		CommonRepoOptions: CommonRepoOptions{ImagesRepoManager: gcrImagesRepoManager{}, DryRun: true},
+		LocalGit: testGitRepo{
+			branches: map[string]string{"master": "c3", "feature-a": "c7"},
+			tags:     map[string]string{"v1.0.0": "c4"},
+		},
+	}
+
+	res, err := repoImagesCleanupByNonexistentGitPrimitive("app", repoImages, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var tags []string
+	for _, repoImage := range res {
+		tags = append(tags, repoImage.Tag)
+	}
+
+	expectedTags := []string{"0a1b", "2c3d", "6a7b"}
+	if !reflect.DeepEqual(tags, expectedTags) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expectedTags, tags)
+	}
+}
+
+func TestImagesCleanupRuleMatch(t *testing.T) {
+	rule := ImagesCleanupRule{
+		TagStrategies: []string{"git-tag", "git-semver"},
+		References:    regexp.MustCompile("^v2\\."),
+		ImageNames:    []string{"backend"},
+	}
+
+	tests := []struct {
+		imageName, strategy, reference string
+		expected                       bool
+	}{
+		{"backend", "git-semver", "v2.1.0", true},
+		{"backend", "git-tag", "v2.0.0", true},
+		{"backend", "git-branch", "v2.0.0", false},
+		{"frontend", "git-tag", "v2.0.0", false},
+		{"backend", "git-tag", "v1.0.0", false},
+	}
+
+	for _, test := range tests {
+		if res := rule.match(test.imageName, test.strategy, test.reference); res != test.expected {
+			t.Errorf("match(%q, %q, %q): expected %v, got %v", test.imageName, test.strategy, test.reference, test.expected, res)
+		}
+	}
+}
+
+func TestExceptProtectedRepoImages(t *testing.T) {
+	repoImages := []docker_registry.RepoImage{
+		newRuleTestRepoImage("master", docker_registry.ImageMetadata{ImageName: "app", TagStrategy: "git-branch", ImageTag: "master"}),
+		newRuleTestRepoImage("feature-a", docker_registry.ImageMetadata{ImageName: "app", TagStrategy: "git-branch", ImageTag: "feature-a", Protected: true}),
+		newRuleTestRepoImage("release-1.0", docker_registry.ImageMetadata{ImageName: "app", TagStrategy: "git-branch", ImageTag: "release-1.0"}),
+	}
+
+	plan := NewCleanupPlan()
+	options := ImagesCleanupOptions{
+		ProtectedTags:  []*regexp.Regexp{regexp.MustCompile(`^release-`)},
+		planImagesRepo: plan.imagesRepo("gcr.io/project"),
+	}
+
+	repoImagesByImageName, err := exceptProtectedRepoImages(map[string][]docker_registry.RepoImage{"app": repoImages}, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var tags []string
+	for _, repoImage := range repoImagesByImageName["app"] {
+		tags = append(tags, repoImage.Tag)
+	}
+
+	if expected := []string{"master"}; !reflect.DeepEqual(tags, expected) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, tags)
+	}
+
+	expectedDetails := map[string]string{
+		"feature-a":   "werf.io/protected label",
+		"release-1.0": "tag matches protectedTags pattern ^release-",
+	}
+
+	details := map[string]string{}
+	for _, planImage := range plan.GetImagesRepo("gcr.io/project").Images {
+		if planImage.Decision != CleanupPlanKeep || planImage.Reason != CleanupPlanReasonProtected {
+			t.Errorf("unexpected decision for %s: %s (%s)", planImage.Tag, planImage.Decision, planImage.Reason)
+		}
+
+		details[planImage.Tag] = planImage.Details
+	}
+
+	if !reflect.DeepEqual(details, expectedDetails) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expectedDetails, details)
+	}
+}
+
+func TestRepoImageProtectionMarker(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	repository := fmt.Sprintf("%s/project/app", strings.TrimPrefix(server.URL, "http://"))
+
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err = mutate.Config(img, v1.Config{Labels: map[string]string{image.WerfImageLabel: "true", image.WerfProtectedLabel: "true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := docker_registry.PushImage(img, repository+":master", docker_registry.PushOptions{MaxAttempts: 1}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		name       string
+		marker     *bool
+		protection string
+	}{
+		{
+			name:       "protectedLabelWithoutMarker",
+			protection: "werf.io/protected label",
+		},
+		{
+			name:       "unprotectedMarkerOverridesLabel",
+			marker:     new(bool),
+			protection: "",
+		},
+		{
+			name:       "protectedMarker",
+			marker:     func() *bool { protected := true; return &protected }(),
+			protection: "protection marker",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repoImage := docker_registry.NewRepoImage(repository, "master")
+			if test.marker != nil {
+				if err := docker_registry.WriteProtectionMarker(repository, "master", *test.marker); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+
+				repoImage.HasProtectionMarker = true
+			}
+
+			protection, err := repoImageProtection(repoImage, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if protection != test.protection {
+				t.Errorf("\n[EXPECTED]: %q\n[GOT]: %q", test.protection, protection)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package cleaning
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/docker_registry"
+)
+
+type ImagesProtectOptions struct {
+	ImagesRepoManager ImagesRepoManager
+	ImageName         string
+	Tag               string
+	// Protected marks the image protected from cleanup, false removes the protection
+	Protected bool
+}
+
+// ImagesProtect writes the protection marker tag of the published image.
+// The marker overrides the protected label the image has been published with
+func ImagesProtect(options ImagesProtectOptions) error {
+	imageRepo := options.ImagesRepoManager.ImageRepo(options.ImageName)
+	imageRepoTag := options.ImagesRepoManager.ImageRepoWithTag(options.ImageName, options.Tag)
+
+	logProcessMsg := fmt.Sprintf("Protecting %s", imageRepoTag)
+	if !options.Protected {
+		logProcessMsg = fmt.Sprintf("Unprotecting %s", imageRepoTag)
+	}
+
+	return logboek.LogProcessInline(logProcessMsg, logboek.LogProcessInlineOptions{}, func() error {
+		tag := strings.TrimPrefix(imageRepoTag, imageRepo+":")
+		return docker_registry.WriteProtectionMarker(imageRepo, tag, options.Protected)
+	})
+}
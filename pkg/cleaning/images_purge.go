@@ -6,12 +6,15 @@ type ImagesPurgeOptions struct {
 	ImagesRepoManager ImagesRepoManager
 	ImagesNames       []string
 	DryRun            bool
+	DeleteOptions     RepoImagesDeleteOptions
 }
 
 func ImagesPurge(options ImagesPurgeOptions) error {
 	logProcessOptions := logboek.LogProcessOptions{ColorizeMsgFunc: logboek.ColorizeHighlight}
 	return logboek.LogProcess("Running images purge", logProcessOptions, func() error {
-		return imagesPurge(options)
+		return withRepoImagesDeleteFailures(&options.DeleteOptions, func() error {
+			return imagesPurge(options)
+		})
 	})
 }
 
@@ -20,6 +23,7 @@ func imagesPurge(options ImagesPurgeOptions) error {
 		ImagesRepoManager: options.ImagesRepoManager,
 		ImagesNames:       options.ImagesNames,
 		DryRun:            options.DryRun,
+		DeleteOptions:     options.DeleteOptions,
 	}
 
 	imageImages, err := repoImages(commonRepoOptions)
@@ -32,5 +36,9 @@ func imagesPurge(options ImagesPurgeOptions) error {
 		return err
 	}
 
+	if err := repoImagesMetadataSync(commonRepoOptions); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,113 @@
+package cleaning
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flant/logboek"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// KubernetesResource is the kind of objects (e.g. custom resources), which images are found by JSONPath templates ({.spec.template.spec.containers[*].image})
+type KubernetesResource struct {
+	GroupVersionKind schema.GroupVersionKind
+	ImagePaths       []string
+}
+
+// kubernetesResourcesDeployedDockerImages returns images of objects of the specified kinds, kinds that are not served by the cluster are skipped
+func kubernetesResourcesDeployedDockerImages(discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, resources []KubernetesResource) ([]deployedDockerImage, error) {
+	var images []deployedDockerImage
+	for _, resource := range resources {
+		gvk := resource.GroupVersionKind
+
+		gvr, namespaced, found, err := kubernetesResourceGroupVersionResource(discoveryClient, gvk)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get %s resource: %s", gvk.String(), err)
+		}
+
+		if !found {
+			logboek.LogInfoF("Kind %s is not served by the cluster, skipping\n", gvk.String())
+			continue
+		}
+
+		var resourceClient dynamic.ResourceInterface
+		if namespaced {
+			resourceClient = dynamicClient.Resource(gvr).Namespace("")
+		} else {
+			resourceClient = dynamicClient.Resource(gvr)
+		}
+
+		list, err := resourceClient.List(v1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("cannot get %s: %s", gvk.String(), err)
+		}
+
+		for _, item := range list.Items {
+			for _, imagePath := range resource.ImagePaths {
+				values, err := jsonPathStringValues(imagePath, item.Object)
+				if err != nil {
+					return nil, fmt.Errorf("cannot get images of %s/%s by %s: %s", gvk.Kind, item.GetName(), imagePath, err)
+				}
+
+				for _, value := range values {
+					images = append(images, deployedDockerImage{
+						Image:     value,
+						Namespace: item.GetNamespace(),
+						Resource:  fmt.Sprintf("%s/%s", gvk.Kind, item.GetName()),
+					})
+				}
+			}
+		}
+	}
+
+	return images, nil
+}
+
+func kubernetesResourceGroupVersionResource(discoveryClient discovery.DiscoveryInterface, gvk schema.GroupVersionKind) (schema.GroupVersionResource, bool, bool, error) {
+	resourceList, err := discoveryClient.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return schema.GroupVersionResource{}, false, false, nil
+		}
+
+		return schema.GroupVersionResource{}, false, false, err
+	}
+
+	for _, apiResource := range resourceList.APIResources {
+		// subresources (e.g. rollouts/status) have the kind of the parent resource
+		if apiResource.Kind == gvk.Kind && !strings.Contains(apiResource.Name, "/") {
+			return gvk.GroupVersion().WithResource(apiResource.Name), apiResource.Namespaced, true, nil
+		}
+	}
+
+	return schema.GroupVersionResource{}, false, false, nil
+}
+
+func jsonPathStringValues(template string, object map[string]interface{}) ([]string, error) {
+	jp := jsonpath.New("")
+	jp.AllowMissingKeys(true)
+	if err := jp.Parse(template); err != nil {
+		return nil, err
+	}
+
+	results, err := jp.FindResults(object)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for _, result := range results {
+		for _, value := range result {
+			if s, ok := value.Interface().(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+
+	return values, nil
+}
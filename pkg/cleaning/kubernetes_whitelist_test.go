@@ -0,0 +1,157 @@
+package cleaning
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/storage/driver"
+
+	"github.com/flant/werf/pkg/deploy/helm"
+)
+
+func TestDeployedDockerImages(t *testing.T) {
+	kubernetesClient := fake.NewSimpleClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "backend", Namespace: "production"},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						InitContainers: []corev1.Container{{Name: "migrate", Image: "registry.example.com/app/migrate:master"}},
+						Containers:     []corev1.Container{{Name: "backend", Image: "registry.example.com/app/backend:master"}},
+					},
+				},
+			},
+		},
+	)
+
+	images, err := deployedDockerImages(kubernetesClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []deployedDockerImage{
+		{Image: "registry.example.com/app/backend:master", Namespace: "production", Resource: "Deployment/backend"},
+		{Image: "registry.example.com/app/migrate:master", Namespace: "production", Resource: "Deployment/backend"},
+	}
+
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, images)
+	}
+}
+
+func TestKubernetesResourcesDeployedDockerImages(t *testing.T) {
+	kubernetesClient := fake.NewSimpleClientset()
+	kubernetesClient.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "argoproj.io/v1alpha1",
+			APIResources: []metav1.APIResource{
+				{Name: "rollouts", Kind: "Rollout", Namespaced: true},
+				{Name: "rollouts/status", Kind: "Rollout", Namespaced: true},
+			},
+		},
+	}
+
+	rollout := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Rollout",
+		"metadata":   map[string]interface{}{"name": "frontend", "namespace": "staging"},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "frontend", "image": "registry.example.com/app/frontend:v1.2.0"},
+						map[string]interface{}{"name": "sidecar", "image": "registry.example.com/app/sidecar:v1.2.0"},
+					},
+				},
+			},
+		},
+	}}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), rollout)
+
+	resources := []KubernetesResource{
+		{
+			GroupVersionKind: schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"},
+			ImagePaths:       []string{"{.spec.template.spec.containers[*].image}", "{.spec.template.spec.initContainers[*].image}"},
+		},
+		{
+			GroupVersionKind: schema.GroupVersionKind{Group: "serving.knative.dev", Version: "v1", Kind: "Service"},
+			ImagePaths:       []string{"{.spec.template.spec.containers[*].image}"},
+		},
+	}
+
+	images, err := kubernetesResourcesDeployedDockerImages(kubernetesClient.Discovery(), dynamicClient, resources)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []deployedDockerImage{
+		{Image: "registry.example.com/app/frontend:v1.2.0", Namespace: "staging", Resource: "Rollout/frontend"},
+		{Image: "registry.example.com/app/sidecar:v1.2.0", Namespace: "staging", Resource: "Rollout/frontend"},
+	}
+
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, images)
+	}
+}
+
+func TestHelmReleasesManifests(t *testing.T) {
+	kubernetesClient := fake.NewSimpleClientset()
+	releaseStorageDriver := driver.NewConfigMaps(kubernetesClient.CoreV1().ConfigMaps("kube-system"))
+
+	for _, r := range []*release.Release{
+		{Name: "app", Version: 1, Manifest: "image: app:1", Info: &release.Info{Status: &release.Status{Code: release.Status_SUPERSEDED}}},
+		{Name: "app", Version: 2, Manifest: "image: app:2", Info: &release.Info{Status: &release.Status{Code: release.Status_SUPERSEDED}}},
+		{Name: "app", Version: 3, Manifest: "image: app:3", Info: &release.Info{Status: &release.Status{Code: release.Status_DEPLOYED}}, Hooks: []*release.Hook{{Manifest: "image: app:3-hook"}}},
+		{Name: "db", Version: 1, Manifest: "image: db:1", Info: &release.Info{Status: &release.Status{Code: release.Status_DEPLOYED}}},
+	} {
+		if err := releaseStorageDriver.Create(fmt.Sprintf("%s.v%d", r.Name, r.Version), r); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	manifests, err := helmReleasesManifests(kubernetesClient, "kube-system", helm.ConfigMapStorage, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []helmReleaseManifest{
+		{Release: "app", Revision: 3, Manifest: "image: app:3"},
+		{Release: "app", Revision: 3, Manifest: "image: app:3-hook"},
+		{Release: "app", Revision: 2, Manifest: "image: app:2"},
+		{Release: "db", Revision: 1, Manifest: "image: db:1"},
+	}
+
+	if !reflect.DeepEqual(manifests, expected) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, manifests)
+	}
+}
+
+func TestManifestReferencesDockerImage(t *testing.T) {
+	tests := []struct {
+		manifest, dockerImageName string
+		expected                  bool
+	}{
+		{"image: registry.example.com/app:1.2", "registry.example.com/app:1.2", true},
+		{"image: \"registry.example.com/app:1.2\"\n", "registry.example.com/app:1.2", true},
+		{"image: registry.example.com/app:1.2.0", "registry.example.com/app:1.2", false},
+		{"a: registry.example.com/app:1.2.0\nb: registry.example.com/app:1.2\n", "registry.example.com/app:1.2", true},
+		{"image: registry.example.com/app:1.2-rc", "registry.example.com/app:1.2", false},
+	}
+
+	for _, test := range tests {
+		if res := manifestReferencesDockerImage(test.manifest, test.dockerImageName); res != test.expected {
+			t.Errorf("manifestReferencesDockerImage(%q, %q): expected %v, got %v", test.manifest, test.dockerImageName, test.expected, res)
+		}
+	}
+}
@@ -6,13 +6,14 @@ type PurgeOptions struct {
 }
 
 func Purge(options PurgeOptions) error {
-	if err := ImagesPurge(options.ImagesPurgeOptions); err != nil {
-		return err
+	imagesPurgeErr := ImagesPurge(options.ImagesPurgeOptions)
+	if imagesPurgeErr != nil && !IsRepoImagesDeleteError(imagesPurgeErr) {
+		return imagesPurgeErr
 	}
 
 	if err := StagesPurge(options.StagesPurgeOptions); err != nil {
 		return err
 	}
 
-	return nil
+	return imagesPurgeErr
 }
@@ -0,0 +1,219 @@
+package cleaning
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/docker_registry"
+)
+
+// RepoImagesDeleteOptions control the deletion of the images repo and stages storage images
+type RepoImagesDeleteOptions struct {
+	Concurrency int     // Sequential deletion if not positive
+	RateLimit   float64 // Deletion requests per second, no limit if not positive
+	FailFast    bool    // Abort on the first failed deletion, otherwise failures are reported after the cleanup
+
+	failures *repoImagesDeleteFailures
+}
+
+var (
+	repoImageDeleteMaxAttempts       = 5
+	repoImageDeleteRetryInitialDelay = time.Second
+	repoImageDeleteRetryMaxDelay     = 30 * time.Second
+)
+
+type repoImageDeleteFailure struct {
+	image docker_registry.RepoImage
+	err   error
+}
+
+// repoImagesDeleteFailures collects failed deletions of all steps of the cleanup
+type repoImagesDeleteFailures struct {
+	failures []repoImageDeleteFailure
+	mutex    sync.Mutex
+}
+
+func (f *repoImagesDeleteFailures) add(image docker_registry.RepoImage, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.failures = append(f.failures, repoImageDeleteFailure{image: image, err: err})
+}
+
+// report logs the summary of failed deletions
+func (f *repoImagesDeleteFailures) report() error {
+	if len(f.failures) == 0 {
+		return nil
+	}
+
+	logboek.LogErrorF("Failed to delete %d images:\n", len(f.failures))
+	for _, failure := range f.failures {
+		logboek.LogErrorF("  %s:%s: %s\n", failure.image.Repository, failure.image.Tag, failure.err)
+	}
+	logboek.LogOptionalLn()
+
+	return &repoImagesDeleteError{count: len(f.failures)}
+}
+
+type repoImagesDeleteError struct {
+	count int
+}
+
+func (e *repoImagesDeleteError) Error() string {
+	return fmt.Sprintf("failed to delete %d images", e.count)
+}
+
+// IsRepoImagesDeleteError checks the cleanup has been done, but some images have not been deleted from the registry
+func IsRepoImagesDeleteError(err error) bool {
+	_, ok := err.(*repoImagesDeleteError)
+	return ok
+}
+
+// withRepoImagesDeleteFailures does not abort f on failed deletions unless fail-fast is set, failures are reported after f is done
+func withRepoImagesDeleteFailures(options *RepoImagesDeleteOptions, f func() error) error {
+	if options.FailFast {
+		return f()
+	}
+
+	options.failures = &repoImagesDeleteFailures{}
+	if err := f(); err != nil {
+		return err
+	}
+
+	return options.failures.report()
+}
+
+func repoImagesRemove(images []docker_registry.RepoImage, options CommonRepoOptions) error {
+	logMutex := &sync.Mutex{}
+	return runRepoImagesRemove(images, options, func(image docker_registry.RepoImage) error {
+		return repoImageRemove(image, options, logMutex)
+	})
+}
+
+// runRepoImagesRemove removes images with the pool of workers limiting the rate of requests and retrying temporary registry errors
+func runRepoImagesRemove(images []docker_registry.RepoImage, options CommonRepoOptions, remove func(image docker_registry.RepoImage) error) error {
+	concurrency := options.DeleteOptions.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if options.DeleteOptions.RateLimit > 0 {
+		limiter = rate.NewLimiter(rate.Limit(options.DeleteOptions.RateLimit), 1)
+	}
+
+	var failFastErr error
+	var mutex sync.Mutex
+	isAborted := func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return failFastErr != nil
+	}
+
+	imagesCh := make(chan docker_registry.RepoImage)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for image := range imagesCh {
+				if isAborted() {
+					continue
+				}
+
+				err := repoImageRemoveWithRetries(image, limiter, remove)
+				if err == nil {
+					continue
+				}
+
+				if options.DeleteOptions.failures != nil {
+					logboek.LogErrorF("Failed to delete %s:%s: %s\n", image.Repository, image.Tag, err)
+					options.DeleteOptions.failures.add(image, err)
+					continue
+				}
+
+				mutex.Lock()
+				if failFastErr == nil {
+					failFastErr = err
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, image := range images {
+		if isAborted() {
+			break
+		}
+
+		imagesCh <- image
+	}
+	close(imagesCh)
+	wg.Wait()
+
+	return failFastErr
+}
+
+func repoImageRemoveWithRetries(image docker_registry.RepoImage, limiter *rate.Limiter, remove func(image docker_registry.RepoImage) error) error {
+	delay := repoImageDeleteRetryInitialDelay
+	for attempt := 1; ; attempt++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			return err
+		}
+
+		err := remove(image)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= repoImageDeleteMaxAttempts || !docker_registry.IsTemporaryError(err) {
+			return err
+		}
+
+		logboek.LogErrorF("Deleting %s:%s failed: %s\n", image.Repository, image.Tag, err)
+		logboek.LogInfoF("Retrying in %s (%d/%d) ...\n", delay, attempt, repoImageDeleteMaxAttempts-1)
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > repoImageDeleteRetryMaxDelay {
+			delay = repoImageDeleteRetryMaxDelay
+		}
+	}
+}
+
+func repoImageRemove(image docker_registry.RepoImage, options CommonRepoOptions, logMutex *sync.Mutex) error {
+	implementation, err := docker_registry.Implementation(image.Repository)
+	if err != nil {
+		return err
+	}
+
+	reference, err := implementation.DeleteReference(image)
+	if err != nil {
+		return err
+	}
+
+	if !options.DryRun {
+		if err := implementation.Delete(reference); err != nil {
+			return err
+		}
+	}
+
+	logMutex.Lock()
+	defer logMutex.Unlock()
+
+	logboek.LogLn(reference)
+	if !strings.HasSuffix(reference, ":"+image.Tag) {
+		logboek.LogInfoF("  tag: %s\n", image.Tag)
+		logboek.LogOptionalLn()
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package cleaning
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flant/werf/pkg/docker_registry"
+)
+
+func testRepoImages(count int) []docker_registry.RepoImage {
+	var images []docker_registry.RepoImage
+	for i := 0; i < count; i++ {
+		images = append(images, docker_registry.NewRepoImage("registry.example.com/app", fmt.Sprintf("tag-%d", i)))
+	}
+
+	return images
+}
+
+func TestRunRepoImagesRemove(t *testing.T) {
+	defer func(delay time.Duration) { repoImageDeleteRetryInitialDelay = delay }(repoImageDeleteRetryInitialDelay)
+	repoImageDeleteRetryInitialDelay = time.Millisecond
+
+	t.Run("retries temporary errors", func(t *testing.T) {
+		attempts := map[string]int{}
+		var mutex sync.Mutex
+
+		err := runRepoImagesRemove(testRepoImages(3), CommonRepoOptions{DeleteOptions: RepoImagesDeleteOptions{Concurrency: 2}}, func(image docker_registry.RepoImage) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			attempts[image.Tag]++
+			if image.Tag == "tag-1" && attempts[image.Tag] < 3 {
+				return fmt.Errorf("deleting image %q: unsupported status code 503; body: ", image.Tag)
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if attempts["tag-0"] != 1 || attempts["tag-1"] != 3 || attempts["tag-2"] != 1 {
+			t.Errorf("unexpected attempts: %v", attempts)
+		}
+	})
+
+	t.Run("reports failures after all deletions", func(t *testing.T) {
+		var removed []string
+		deleteOptions := RepoImagesDeleteOptions{}
+
+		err := withRepoImagesDeleteFailures(&deleteOptions, func() error {
+			return runRepoImagesRemove(testRepoImages(4), CommonRepoOptions{DeleteOptions: deleteOptions}, func(image docker_registry.RepoImage) error {
+				if image.Tag == "tag-0" || image.Tag == "tag-2" {
+					return fmt.Errorf("deleting image %q: MANIFEST_UNKNOWN: manifest unknown", image.Tag)
+				}
+
+				removed = append(removed, image.Tag)
+				return nil
+			})
+		})
+
+		if !IsRepoImagesDeleteError(err) || err.Error() != "failed to delete 2 images" {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if len(removed) != 2 {
+			t.Errorf("expected 2 removed images, got %v", removed)
+		}
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		var attempted []string
+
+		err := runRepoImagesRemove(testRepoImages(4), CommonRepoOptions{DeleteOptions: RepoImagesDeleteOptions{FailFast: true}}, func(image docker_registry.RepoImage) error {
+			attempted = append(attempted, image.Tag)
+			return fmt.Errorf("deleting image %q: DENIED: requested access to the resource is denied", image.Tag)
+		})
+
+		if err == nil || IsRepoImagesDeleteError(err) {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if len(attempted) != 1 {
+			t.Errorf("expected the only attempt, got %v", attempted)
+		}
+	})
+
+	t.Run("limits concurrency", func(t *testing.T) {
+		var mutex sync.Mutex
+		var current, max int
+
+		err := runRepoImagesRemove(testRepoImages(12), CommonRepoOptions{DeleteOptions: RepoImagesDeleteOptions{Concurrency: 3}}, func(image docker_registry.RepoImage) error {
+			mutex.Lock()
+			current++
+			if current > max {
+				max = current
+			}
+			mutex.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mutex.Lock()
+			current--
+			mutex.Unlock()
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if max != 3 {
+			t.Errorf("expected 3 concurrent deletions, got %d", max)
+		}
+	})
+
+	t.Run("limits rate", func(t *testing.T) {
+		start := time.Now()
+		err := runRepoImagesRemove(testRepoImages(6), CommonRepoOptions{DeleteOptions: RepoImagesDeleteOptions{Concurrency: 6, RateLimit: 50}}, func(image docker_registry.RepoImage) error {
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+			t.Errorf("expected 6 deletions with 50 requests per second to take at least 100ms, took %s", elapsed)
+		}
+	})
+}
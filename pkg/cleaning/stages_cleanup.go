@@ -23,12 +23,21 @@ type StagesCleanupOptions struct {
 	StagesStorage     string
 	ImagesNames       []string
 	DryRun            bool
+	DeleteOptions     RepoImagesDeleteOptions
+
+	// The least recently used local stages are removed if they are not used within the period or do not fit in the size
+	HasKeepUsedWithin bool
+	KeepUsedWithin    time.Duration
+	HasKeepSize       bool
+	KeepSize          int64
 }
 
 func StagesCleanup(options StagesCleanupOptions) error {
 	logProcessOptions := logboek.LogProcessOptions{ColorizeMsgFunc: logboek.ColorizeHighlight}
 	return logboek.LogProcess("Running stages cleanup", logProcessOptions, func() error {
-		return stagesCleanup(options)
+		return withRepoImagesDeleteFailures(&options.DeleteOptions, func() error {
+			return stagesCleanup(options)
+		})
 	})
 }
 
@@ -48,6 +57,12 @@ func stagesCleanup(options StagesCleanupOptions) error {
 		StagesStorage:     options.StagesStorage,
 		ImagesNames:       options.ImagesNames,
 		DryRun:            options.DryRun,
+		DeleteOptions:     options.DeleteOptions,
+	}
+
+	isCleanupByUsage := options.HasKeepUsedWithin || options.HasKeepSize
+	if isCleanupByUsage && options.StagesStorage != localStagesStorage {
+		return fmt.Errorf("stages cleanup by usage is supported only for %s stages storage", localStagesStorage)
 	}
 
 	projectStagesCleanupLockName := fmt.Sprintf("stages-cleanup.%s", commonProjectOptions.ProjectName)
@@ -62,6 +77,14 @@ func stagesCleanup(options StagesCleanupOptions) error {
 				if err := projectImageStagesSyncByRepoImages(repoImages, commonProjectOptions); err != nil {
 					return err
 				}
+
+				if isCleanupByUsage {
+					if err := logboek.LogProcess("Removing least recently used stages", logboek.LogProcessOptions{}, func() error {
+						return projectStagesCleanupByUsage(options, commonProjectOptions)
+					}); err != nil {
+						return err
+					}
+				}
 			} else {
 				if err := repoImageStagesSyncByRepoImages(repoImages, commonRepoOptions); err != nil {
 					return err
@@ -212,6 +235,10 @@ func repoImageParentId(repoImage docker_registry.RepoImage) (string, error) {
 }
 
 func repoImageLabels(repoImage docker_registry.RepoImage) (map[string]string, error) {
+	if repoImage.Metadata != nil {
+		return repoImage.Metadata.Labels(), nil
+	}
+
 	configFile, err := repoImage.Image.ConfigFile()
 	if err != nil {
 		return nil, err
@@ -221,6 +248,10 @@ func repoImageLabels(repoImage docker_registry.RepoImage) (map[string]string, er
 }
 
 func repoImageCreated(repoImage docker_registry.RepoImage) (time.Time, error) {
+	if repoImage.Metadata != nil {
+		return repoImage.Metadata.Created, nil
+	}
+
 	configFile, err := repoImage.Image.ConfigFile()
 	if err != nil {
 		return time.Time{}, err
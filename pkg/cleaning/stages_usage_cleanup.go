@@ -0,0 +1,163 @@
+package cleaning
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-units"
+
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/stages_usage"
+)
+
+type stageUsage struct {
+	types.ImageSummary
+	signature string
+	lastUsed  time.Time
+}
+
+// projectStagesCleanupByUsage removes the least recently used local stages of the project
+func projectStagesCleanupByUsage(options StagesCleanupOptions, commonProjectOptions CommonProjectOptions) error {
+	imageStages, err := projectImageStages(commonProjectOptions)
+	if err != nil {
+		return err
+	}
+
+	lastUsed, err := stages_usage.LastUsed(options.ProjectName)
+	if err != nil {
+		return err
+	}
+
+	imageStagesToRemove, err := stagesToEvictByUsage(imageStages, lastUsed, options, commonProjectOptions, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if os.Getenv("WERF_DISABLE_STAGES_CLEANUP_DATE_PERIOD_POLICY") == "" {
+		for _, imageStage := range imageStagesToRemove {
+			if time.Now().Unix()-imageStage.Created < stagesCleanupDefaultIgnorePeriodPolicy {
+				imageStagesToRemove = exceptImage(imageStagesToRemove, imageStage)
+			}
+		}
+	}
+
+	imageStagesToRemove, err = processUsedImages(imageStagesToRemove, commonProjectOptions.CommonOptions)
+	if err != nil {
+		return err
+	}
+
+	if err := imagesRemove(imageStagesToRemove, commonProjectOptions.CommonOptions); err != nil {
+		return err
+	}
+
+	if options.DryRun {
+		return nil
+	}
+
+	var existingSignatures []string
+	for _, imageStage := range exceptImages(imageStages, imageStagesToRemove...) {
+		if signature := imageStageSignature(imageStage, commonProjectOptions); signature != "" {
+			existingSignatures = append(existingSignatures, signature)
+		}
+	}
+
+	return stages_usage.Prune(options.ProjectName, existingSignatures)
+}
+
+// stagesToEvictByUsage returns the stages to remove: stages are kept starting from the most recently used one while they are used within the period and the kept stages fit in the size.
+// The parent chain and imports of the kept stage are kept too and count towards the size.
+// The stage, which usage has not been recorded, is considered used when it was created
+func stagesToEvictByUsage(imageStages []types.ImageSummary, lastUsed map[string]time.Time, options StagesCleanupOptions, commonProjectOptions CommonProjectOptions, now time.Time) ([]types.ImageSummary, error) {
+	var stagesUsage []stageUsage
+	for _, imageStage := range imageStages {
+		signature := imageStageSignature(imageStage, commonProjectOptions)
+
+		usedAt, ok := lastUsed[signature]
+		if !ok {
+			usedAt = time.Unix(imageStage.Created, 0)
+		}
+
+		stagesUsage = append(stagesUsage, stageUsage{ImageSummary: imageStage, signature: signature, lastUsed: usedAt})
+	}
+
+	// the most recently used stages go first
+	sort.SliceStable(stagesUsage, func(i, j int) bool {
+		return stagesUsage[i].lastUsed.After(stagesUsage[j].lastUsed)
+	})
+
+	imageStagesToRemove := imageStages
+	var keptSize int64
+	var isKeepSizeExceeded bool
+	for _, stage := range stagesUsage {
+		// already kept as a parent or an import of the more recently used stage
+		if findImageStageByImageId(imageStagesToRemove, stage.ID) == nil {
+			continue
+		}
+
+		if isKeepSizeExceeded {
+			logboek.LogInfoF("drop %s (last used %s, kept stages size exceeds %s)\n", stage.signature, stage.lastUsed.Format(time.RFC3339), units.BytesSize(float64(options.KeepSize)))
+			continue
+		}
+
+		if options.HasKeepUsedWithin && stage.lastUsed.Before(now.Add(-options.KeepUsedWithin)) {
+			logboek.LogInfoF("drop %s (last used %s, not used within %s)\n", stage.signature, stage.lastUsed.Format(time.RFC3339), options.KeepUsedWithin)
+			continue
+		}
+
+		newImageStagesToRemove, err := exceptImageStagesByImageStage(imageStagesToRemove, stage.ImageSummary, commonProjectOptions)
+		if err != nil {
+			return nil, err
+		}
+
+		var size int64
+		for _, keptImageStage := range exceptImages(imageStagesToRemove, newImageStagesToRemove...) {
+			size += imageStageOwnSize(keptImageStage, imageStages)
+		}
+
+		if options.HasKeepSize && keptSize+size > options.KeepSize {
+			isKeepSizeExceeded = true
+			logboek.LogInfoF("drop %s (last used %s, kept stages size exceeds %s)\n", stage.signature, stage.lastUsed.Format(time.RFC3339), units.BytesSize(float64(options.KeepSize)))
+			continue
+		}
+
+		logboek.LogInfoF("keep %s (last used %s)\n", stage.signature, stage.lastUsed.Format(time.RFC3339))
+		keptSize += size
+		imageStagesToRemove = newImageStagesToRemove
+	}
+
+	return imageStagesToRemove, nil
+}
+
+func imageStageSignature(imageStage types.ImageSummary, options CommonProjectOptions) string {
+	prefix := fmt.Sprintf(image.LocalImageStageImageFormat, options.ProjectName, "")
+	for _, repoTag := range imageStage.RepoTags {
+		if strings.HasPrefix(repoTag, prefix) {
+			return strings.TrimPrefix(repoTag, prefix)
+		}
+	}
+
+	return ""
+}
+
+// imageStageOwnSize returns the size of the layers that the stage adds to the parent stage
+func imageStageOwnSize(imageStage types.ImageSummary, imageStages []types.ImageSummary) int64 {
+	if parent := findImageStageByImageId(imageStages, imageStage.ParentID); parent != nil && parent.Size <= imageStage.Size {
+		return imageStage.Size - parent.Size
+	}
+
+	return imageStage.Size
+}
+
+func exceptImages(images []types.ImageSummary, imagesToExclude ...types.ImageSummary) []types.ImageSummary {
+	for _, imageToExclude := range imagesToExclude {
+		images = exceptImage(images, imageToExclude)
+	}
+
+	return images
+}
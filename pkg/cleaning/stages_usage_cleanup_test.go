@@ -0,0 +1,97 @@
+package cleaning
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+
+	"github.com/flant/werf/pkg/image"
+)
+
+func TestStagesToEvictByUsage(t *testing.T) {
+	now := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	commonProjectOptions := CommonProjectOptions{ProjectName: "project"}
+
+	newImageStage := func(signature, parentSignature string, size int64) types.ImageSummary {
+		imageStage := types.ImageSummary{
+			ID:       "sha256:" + signature,
+			RepoTags: []string{fmt.Sprintf(image.LocalImageStageImageFormat, "project", signature)},
+			Size:     size,
+			Created:  now.Add(-30 * 24 * time.Hour).Unix(),
+		}
+
+		if parentSignature != "" {
+			imageStage.ParentID = "sha256:" + parentSignature
+		}
+
+		return imageStage
+	}
+
+	imageStages := []types.ImageSummary{
+		newImageStage("from", "", 100),
+		newImageStage("install", "from", 150),
+		newImageStage("setup", "install", 400),
+		newImageStage("other", "", 300),
+	}
+
+	lastUsed := map[string]time.Time{
+		"install": now.Add(-time.Hour),
+		"other":   now.Add(-10 * 24 * time.Hour),
+		"setup":   now.Add(-20 * 24 * time.Hour),
+	}
+
+	tests := []struct {
+		name     string
+		options  StagesCleanupOptions
+		expected []string
+	}{
+		{
+			name:     "keep used within",
+			options:  StagesCleanupOptions{HasKeepUsedWithin: true, KeepUsedWithin: 14 * 24 * time.Hour},
+			expected: []string{"setup"},
+		},
+		{
+			name:     "keep used within preserves parent chain",
+			options:  StagesCleanupOptions{HasKeepUsedWithin: true, KeepUsedWithin: 7 * 24 * time.Hour},
+			expected: []string{"other", "setup"},
+		},
+		{
+			name:     "keep size",
+			options:  StagesCleanupOptions{HasKeepSize: true, KeepSize: 500},
+			expected: []string{"setup"},
+		},
+		{
+			name:     "keep size evicts least recently used stages",
+			options:  StagesCleanupOptions{HasKeepSize: true, KeepSize: 200},
+			expected: []string{"other", "setup"},
+		},
+		{
+			name:     "keep size counts own stage size",
+			options:  StagesCleanupOptions{HasKeepSize: true, KeepSize: 700},
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			imageStagesToRemove, err := stagesToEvictByUsage(imageStages, lastUsed, test.options, commonProjectOptions, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var signatures []string
+			for _, imageStage := range imageStagesToRemove {
+				signatures = append(signatures, imageStageSignature(imageStage, commonProjectOptions))
+			}
+			sort.Strings(signatures)
+
+			if !reflect.DeepEqual(signatures, test.expected) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", test.expected, signatures)
+			}
+		})
+	}
+}
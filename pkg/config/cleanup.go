@@ -0,0 +1,34 @@
+package config
+
+import "time"
+
+type Cleanup struct {
+	Rules               []*CleanupRule
+	KubernetesWhitelist CleanupKubernetesWhitelist
+	// ProtectedTags are regular expressions of tags, which images are never removed
+	ProtectedTags []string
+}
+
+// CleanupRule keeps images published with one of the tagging strategies, which references and image names match the rule.
+// Images are kept by the count (the last published) and by the age, the first matching rule is applied to the image
+type CleanupRule struct {
+	TagStrategies []string
+	References    string
+	ImageNames    []string
+	KeepLast      *int
+	KeepNewerThan *time.Duration
+}
+
+// CleanupKubernetesWhitelist extends the set of Kubernetes objects, which images are never removed.
+// HelmReleaseRevisions limits the number of the last revisions of each Helm release to scan (0 means all stored revisions)
+type CleanupKubernetesWhitelist struct {
+	HelmReleaseRevisions int
+	Resources            []*CleanupKubernetesResource
+}
+
+// CleanupKubernetesResource is the kind of the custom resource, which images are found by JSONPath templates
+type CleanupKubernetesResource struct {
+	ApiVersion string
+	Kind       string
+	ImagePaths []string
+}
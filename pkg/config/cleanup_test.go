@@ -0,0 +1,143 @@
+package config
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("cleanup rules", func() {
+	parseMeta := func(content string) (*Meta, error) {
+		meta, _, _, err := splitByMetaAndRawImages([]*doc{{Content: []byte(content)}})
+		return meta, err
+	}
+
+	It("parses rules", func() {
+		meta, err := parseMeta(`configVersion: 1
+project: name
+cleanup:
+  rules:
+  - tagStrategy: git-branch
+    references: ^(master|production)$
+  - tagStrategy: [git-tag, git-semver]
+    image: backend
+    keepLast: 10
+    keepNewerThan: 30d
+  - keepNewerThan: 12h
+`)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(meta.Cleanup.Rules).Should(HaveLen(3))
+
+		Ω(meta.Cleanup.Rules[0].TagStrategies).Should(Equal([]string{"git-branch"}))
+		Ω(meta.Cleanup.Rules[0].References).Should(Equal("^(master|production)$"))
+		Ω(meta.Cleanup.Rules[0].KeepLast).Should(BeNil())
+		Ω(meta.Cleanup.Rules[0].KeepNewerThan).Should(BeNil())
+
+		Ω(meta.Cleanup.Rules[1].TagStrategies).Should(Equal([]string{"git-tag", "git-semver"}))
+		Ω(meta.Cleanup.Rules[1].ImageNames).Should(Equal([]string{"backend"}))
+		Ω(*meta.Cleanup.Rules[1].KeepLast).Should(Equal(10))
+		Ω(*meta.Cleanup.Rules[1].KeepNewerThan).Should(Equal(30 * 24 * time.Hour))
+
+		Ω(meta.Cleanup.Rules[2].TagStrategies).Should(BeEmpty())
+		Ω(*meta.Cleanup.Rules[2].KeepNewerThan).Should(Equal(12 * time.Hour))
+	})
+
+	It("has no rules by default", func() {
+		meta, err := parseMeta("configVersion: 1\nproject: name\n")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(meta.Cleanup.Rules).Should(BeEmpty())
+	})
+
+	DescribeTable("rejects bad rules", func(rule, expectedErrorSubstring string) {
+		_, err := parseMeta("configVersion: 1\nproject: name\ncleanup:\n  rules:\n  - " + rule + "\n")
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring(expectedErrorSubstring))
+	},
+		Entry("unknown tag strategy", "tagStrategy: custom", "unsupported tagStrategy 'custom'"),
+		Entry("bad references", "references: '(master'", "bad references regular expression"),
+		Entry("negative keepLast", "keepLast: -1", "keepLast field should be non-negative"),
+		Entry("bad keepNewerThan", "keepNewerThan: month", "bad keepNewerThan duration"),
+		Entry("unknown field", "keepFirst: 1", "keepFirst"),
+	)
+
+	It("validates rules by the schema", func() {
+		validationErrors, isMeta, err := validateDoc(1, &doc{Content: []byte(`configVersion: 1
+project: name
+cleanup:
+  rules:
+  - tagStrategy: git-commit
+    keepLast: 5
+  - tagStrategy: custom
+    keepNewerThan: 30d
+`)})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(isMeta).Should(BeTrue())
+		Ω(validationErrors).Should(HaveLen(1))
+		Ω(validationErrors[0].Field).Should(Equal("cleanup.rules.1.tagStrategy"))
+	})
+
+	It("parses kubernetes whitelist", func() {
+		meta, err := parseMeta(`configVersion: 1
+project: name
+cleanup:
+  kubernetesWhitelist:
+    helmReleaseRevisions: 5
+    resources:
+    - apiVersion: argoproj.io/v1alpha1
+      kind: Rollout
+      imagePaths: '{.spec.template.spec.containers[*].image}'
+    - apiVersion: serving.knative.dev/v1
+      kind: Service
+      imagePaths:
+      - .spec.template.spec.containers[*].image
+      - .spec.template.spec.initContainers[*].image
+`)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		whitelist := meta.Cleanup.KubernetesWhitelist
+		Ω(whitelist.HelmReleaseRevisions).Should(Equal(5))
+		Ω(whitelist.Resources).Should(Equal([]*CleanupKubernetesResource{
+			{
+				ApiVersion: "argoproj.io/v1alpha1",
+				Kind:       "Rollout",
+				ImagePaths: []string{"{.spec.template.spec.containers[*].image}"},
+			},
+			{
+				ApiVersion: "serving.knative.dev/v1",
+				Kind:       "Service",
+				ImagePaths: []string{"{.spec.template.spec.containers[*].image}", "{.spec.template.spec.initContainers[*].image}"},
+			},
+		}))
+	})
+
+	DescribeTable("rejects bad kubernetes whitelist", func(whitelist, expectedErrorSubstring string) {
+		_, err := parseMeta("configVersion: 1\nproject: name\ncleanup:\n  kubernetesWhitelist:\n" + whitelist + "\n")
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring(expectedErrorSubstring))
+	},
+		Entry("negative helmReleaseRevisions", "    helmReleaseRevisions: -1", "helmReleaseRevisions field should be non-negative"),
+		Entry("resource without kind", "    resources:\n    - apiVersion: v1\n      imagePaths: .spec.image", "kind field cannot be empty"),
+		Entry("resource without imagePaths", "    resources:\n    - apiVersion: v1\n      kind: Foo", "imagePaths field cannot be empty"),
+		Entry("bad imagePaths", "    resources:\n    - apiVersion: v1\n      kind: Foo\n      imagePaths: '.spec.containers[*'", "bad imagePaths JSONPath"),
+	)
+
+	It("parses protected tags", func() {
+		meta, err := parseMeta(`configVersion: 1
+project: name
+cleanup:
+  protectedTags:
+  - ^hotfix-
+  - ^v1\.2\.3$
+`)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(meta.Cleanup.ProtectedTags).Should(Equal([]string{"^hotfix-", "^v1\\.2\\.3$"}))
+	})
+
+	It("rejects bad protected tags", func() {
+		_, err := parseMeta("configVersion: 1\nproject: name\ncleanup:\n  protectedTags: '(hotfix'\n")
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("bad protectedTags regular expression"))
+	})
+})
@@ -17,6 +17,18 @@ type doc struct {
 	Content        []byte
 	Line           int
 	RenderFilePath string
+
+	// ResolvedContent is the Content merged with the extended templates (Templates)
+	ResolvedContent []byte
+	Templates       []*doc
+}
+
+func (d *doc) resolvedContent() []byte {
+	if d.ResolvedContent != nil {
+		return d.ResolvedContent
+	}
+
+	return d.Content
 }
 
 func checkOverflow(m map[string]interface{}, configSection interface{}, doc *doc) error {
@@ -5,4 +5,18 @@ type DeployTemplates struct {
 	HelmReleaseSlug bool
 	Namespace       string
 	NamespaceSlug   bool
+	// PostRenderer is the path of the executable relative to the project directory or the name of the executable in PATH
+	PostRenderer string
+	Clusters     []*DeployCluster
+}
+
+// DeployCluster is the cluster, which the release is deployed to by the single werf deploy command
+type DeployCluster struct {
+	Name        string
+	KubeContext string
+	// Values are the values files of the cluster, which override the common values
+	Values []string
+	// HelmRelease and Namespace override the templates of the deploy section for the cluster
+	HelmRelease string
+	Namespace   string
 }
@@ -0,0 +1,75 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("deploy clusters", func() {
+	parseMeta := func(content string) (*Meta, error) {
+		meta, _, _, err := splitByMetaAndRawImages([]*doc{{Content: []byte(content)}})
+		return meta, err
+	}
+
+	It("parses clusters", func() {
+		meta, err := parseMeta(`configVersion: 1
+project: name
+deploy:
+  clusters:
+  - name: eu
+  - name: us
+    kubeContext: us-production
+    values: [.helm/values-us.yaml, .helm/values-us-extra.yaml]
+    helmRelease: "[[ project ]]-us"
+    namespace: "[[ project ]]"
+`)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(meta.DeployTemplates.Clusters).Should(HaveLen(2))
+
+		Ω(*meta.DeployTemplates.Clusters[0]).Should(Equal(DeployCluster{
+			Name:        "eu",
+			KubeContext: "eu",
+			Values:      []string{},
+		}))
+
+		Ω(*meta.DeployTemplates.Clusters[1]).Should(Equal(DeployCluster{
+			Name:        "us",
+			KubeContext: "us-production",
+			Values:      []string{".helm/values-us.yaml", ".helm/values-us-extra.yaml"},
+			HelmRelease: "[[ project ]]-us",
+			Namespace:   "[[ project ]]",
+		}))
+	})
+
+	It("has no clusters by default", func() {
+		meta, err := parseMeta("configVersion: 1\nproject: name\n")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(meta.DeployTemplates.Clusters).Should(BeEmpty())
+	})
+
+	DescribeTable("rejects bad clusters", func(clusters, expectedErrorSubstring string) {
+		_, err := parseMeta("configVersion: 1\nproject: name\ndeploy:\n  clusters:\n" + clusters)
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring(expectedErrorSubstring))
+	},
+		Entry("without name", "  - kubeContext: eu\n", "name field cannot be empty"),
+		Entry("with empty kubeContext", "  - name: eu\n    kubeContext: ''\n", "kubeContext field cannot be empty"),
+		Entry("with duplicated name", "  - name: eu\n  - name: eu\n", "cluster name 'eu' should be unique"),
+		Entry("with unknown field", "  - name: eu\n    context: eu\n", "context"),
+	)
+})
+
+var _ = Describe("deploy postRenderer", func() {
+	It("parses postRenderer", func() {
+		meta, _, _, err := splitByMetaAndRawImages([]*doc{{Content: []byte("configVersion: 1\nproject: name\ndeploy:\n  postRenderer: .helm/post-render.sh\n")}})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(meta.DeployTemplates.PostRenderer).Should(Equal(".helm/post-render.sh"))
+	})
+
+	It("rejects empty postRenderer", func() {
+		_, _, _, err := splitByMetaAndRawImages([]*doc{{Content: []byte("configVersion: 1\nproject: name\ndeploy:\n  postRenderer: ''\n")}})
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("postRenderer field cannot be empty"))
+	})
+})
@@ -60,5 +60,11 @@ func dumpConfigDoc(doc *doc) string {
 	res += util.NumerateLines(string(doc.Content), doc.Line+1)
 	res += "\n"
 
+	for _, templateDoc := range doc.Templates {
+		res += "\nextended template config section:\n\n"
+		res += util.NumerateLines(string(templateDoc.Content), templateDoc.Line+1)
+		res += "\n"
+	}
+
 	return res
 }
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Abstract image template config section (`template: NAME`) could be extended by image, artifact or another template
+// config section with `extends: NAME` (or `extends: [NAME, ...]`, templates are applied in the specified order).
+//
+// Merge semantics:
+//   - lists are appended (template items go first), a single string is treated as one-item list when merged with a list;
+//   - maps are merged recursively;
+//   - scalars are overridden by the extending config section.
+type imageTemplate struct {
+	Name string
+
+	raw map[interface{}]interface{}
+	doc *doc
+}
+
+func isTemplateDoc(h map[string]interface{}) bool {
+	_, ok := h["template"]
+	return ok
+}
+
+func isExtendingDoc(h map[string]interface{}) bool {
+	_, ok := h["extends"]
+	return ok
+}
+
+func collectImageTemplates(docs []*doc) (map[string]*imageTemplate, error) {
+	templates := map[string]*imageTemplate{}
+
+	for _, doc := range docs {
+		var raw map[string]interface{}
+		if err := yaml.Unmarshal(doc.Content, &raw); err != nil {
+			return nil, newYamlUnmarshalError(err, doc)
+		}
+
+		if !isTemplateDoc(raw) {
+			continue
+		}
+
+		name, ok := raw["template"].(string)
+		if !ok || name == "" {
+			return nil, newDetailedConfigError("`template: NAME` non-empty template name required!", nil, doc)
+		}
+
+		for _, field := range []string{"image", "artifact", "dockerfile", "configVersion"} {
+			if _, ok := raw[field]; ok {
+				return nil, newDetailedConfigError(fmt.Sprintf("template config section cannot define `%s` directive!", field), nil, doc)
+			}
+		}
+
+		if _, exist := templates[name]; exist {
+			return nil, newDetailedConfigError(fmt.Sprintf("duplicate template `%s` definition!", name), nil, doc)
+		}
+
+		var templateRaw map[interface{}]interface{}
+		if err := yaml.Unmarshal(doc.Content, &templateRaw); err != nil {
+			return nil, newYamlUnmarshalError(err, doc)
+		}
+		delete(templateRaw, "template")
+
+		templates[name] = &imageTemplate{Name: name, raw: templateRaw, doc: doc}
+	}
+
+	return templates, nil
+}
+
+// resolveDocTemplates merges extended templates into the doc and sets doc.ResolvedContent and doc.Templates
+func resolveDocTemplates(doc *doc, templates map[string]*imageTemplate) error {
+	var raw map[interface{}]interface{}
+	if err := yaml.Unmarshal(doc.Content, &raw); err != nil {
+		return newYamlUnmarshalError(err, doc)
+	}
+
+	resolved, templateDocs, err := resolveRawTemplates(raw, doc, templates, nil)
+	if err != nil {
+		return err
+	}
+
+	resolvedContent, err := yaml.Marshal(resolvedConfigSection(resolved))
+	if err != nil {
+		return newDetailedConfigError(fmt.Sprintf("unable to marshal resolved config section: %s", err), nil, doc)
+	}
+
+	doc.ResolvedContent = resolvedContent
+	doc.Templates = templateDocs
+
+	return nil
+}
+
+// resolvedConfigSection places the image (artifact) name first, other directives are sorted by name
+func resolvedConfigSection(resolved map[interface{}]interface{}) yaml.MapSlice {
+	var keys []string
+	for k := range resolved {
+		if key, ok := k.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var res yaml.MapSlice
+	for _, key := range []string{"image", "artifact"} {
+		if value, ok := resolved[key]; ok {
+			res = append(res, yaml.MapItem{Key: key, Value: value})
+		}
+	}
+
+	for _, key := range keys {
+		if key != "image" && key != "artifact" {
+			res = append(res, yaml.MapItem{Key: key, Value: resolved[key]})
+		}
+	}
+
+	return res
+}
+
+func resolveRawTemplates(raw map[interface{}]interface{}, rawDoc *doc, templates map[string]*imageTemplate, chain []string) (map[interface{}]interface{}, []*doc, error) {
+	extends, err := InterfaceToStringArray(raw["extends"], nil, rawDoc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	own := map[interface{}]interface{}{}
+	for k, v := range raw {
+		if k != "extends" {
+			own[k] = v
+		}
+	}
+
+	var templateDocs []*doc
+	resolved := map[interface{}]interface{}{}
+	for _, name := range extends {
+		for _, chainName := range chain {
+			if chainName == name {
+				return nil, nil, newDetailedConfigError(fmt.Sprintf("infinite loop detected in templates extending: %s -> %s", strings.Join(chain, " -> "), name), nil, rawDoc)
+			}
+		}
+
+		template, ok := templates[name]
+		if !ok {
+			return nil, nil, newDetailedConfigError(fmt.Sprintf("template `%s` not found: add `template: %s` config section!", name, name), nil, rawDoc)
+		}
+
+		templateResolved, templateTemplateDocs, err := resolveRawTemplates(template.raw, template.doc, templates, append(chain, name))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		resolved = mergeTemplateValue(resolved, templateResolved).(map[interface{}]interface{})
+		templateDocs = append(templateDocs, templateTemplateDocs...)
+		templateDocs = append(templateDocs, template.doc)
+	}
+
+	resolved = mergeTemplateValue(resolved, own).(map[interface{}]interface{})
+
+	return resolved, templateDocs, nil
+}
+
+func mergeTemplateValue(base, override interface{}) interface{} {
+	switch overrideValue := override.(type) {
+	case map[interface{}]interface{}:
+		if baseMap, ok := base.(map[interface{}]interface{}); ok {
+			res := map[interface{}]interface{}{}
+			for k, v := range baseMap {
+				res[k] = v
+			}
+
+			for k, v := range overrideValue {
+				if baseValue, exist := res[k]; exist {
+					res[k] = mergeTemplateValue(baseValue, v)
+				} else {
+					res[k] = v
+				}
+			}
+
+			return res
+		}
+	case []interface{}:
+		switch baseValue := base.(type) {
+		case []interface{}:
+			return append(append([]interface{}{}, baseValue...), overrideValue...)
+		case string:
+			return append([]interface{}{baseValue}, overrideValue...)
+		}
+	case string:
+		if baseList, ok := base.([]interface{}); ok {
+			return append(append([]interface{}{}, baseList...), overrideValue)
+		}
+	}
+
+	return override
+}
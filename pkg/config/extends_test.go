@@ -0,0 +1,88 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+)
+
+var _ = Describe("image templates", func() {
+	newDocs := func(contents ...string) []*doc {
+		var docs []*doc
+		for _, content := range contents {
+			docs = append(docs, &doc{Content: []byte(content)})
+		}
+		return docs
+	}
+
+	resolve := func(docs []*doc, imageDoc *doc) (map[interface{}]interface{}, error) {
+		templates, err := collectImageTemplates(docs)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := resolveDocTemplates(imageDoc, templates); err != nil {
+			return nil, err
+		}
+
+		var res map[interface{}]interface{}
+		Ω(yaml.Unmarshal(imageDoc.ResolvedContent, &res)).Should(Succeed())
+
+		return res, nil
+	}
+
+	It("appends lists, merges maps and overrides scalars", func() {
+		docs := newDocs(`
+template: base
+from: node:12
+shell:
+  beforeInstall: apt-get update
+docker:
+  LABEL:
+    team: web
+`, `
+template: tools
+extends: base
+shell:
+  beforeInstall:
+  - apt-get install -y curl
+`, `
+image: api
+extends: tools
+from: node:13
+docker:
+  LABEL:
+    component: api
+`)
+
+		res, err := resolve(docs, docs[2])
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(res).Should(Equal(map[interface{}]interface{}{
+			"image": "api",
+			"from":  "node:13",
+			"shell": map[interface{}]interface{}{
+				"beforeInstall": []interface{}{"apt-get update", "apt-get install -y curl"},
+			},
+			"docker": map[interface{}]interface{}{
+				"LABEL": map[interface{}]interface{}{"team": "web", "component": "api"},
+			},
+		}))
+		Ω(docs[2].Templates).Should(Equal([]*doc{docs[0], docs[1]}))
+	})
+
+	It("detects infinite loop", func() {
+		docs := newDocs("template: a\nextends: b\n", "template: b\nextends: a\n", "image: app\nextends: a\n")
+
+		_, err := resolve(docs, docs[2])
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("infinite loop detected in templates extending: a -> b -> a"))
+	})
+
+	It("fails on unknown template", func() {
+		docs := newDocs("image: app\nextends: unknown\n")
+
+		_, err := resolve(docs, docs[0])
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("template `unknown` not found"))
+	})
+})
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	ImagesGraphNodeImage      = "image"
+	ImagesGraphNodeArtifact   = "artifact"
+	ImagesGraphNodeDockerfile = "dockerfile"
+
+	ImagesGraphEdgeFromImage         = "fromImage"
+	ImagesGraphEdgeFromImageArtifact = "fromImageArtifact"
+	ImagesGraphEdgeImport            = "import"
+)
+
+// ImagesGraph describes relations between images and artifacts defined in werf.yaml.
+// Edges point from the dependency to the dependent image (artifact).
+type ImagesGraph struct {
+	Nodes []*ImagesGraphNode `json:"nodes"`
+	Edges []*ImagesGraphEdge `json:"edges"`
+}
+
+type ImagesGraphNode struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// Signature and CacheStatus are optional annotations, which are not related to the config itself
+	Signature   string `json:"signature,omitempty"`
+	CacheStatus string `json:"cacheStatus,omitempty"`
+}
+
+type ImagesGraphEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Relation string `json:"relation"`
+	// Stage is set for import relation (e.g. `before install`)
+	Stage string `json:"stage,omitempty"`
+}
+
+func (e *ImagesGraphEdge) Label() string {
+	if e.Stage == "" {
+		return e.Relation
+	}
+
+	return fmt.Sprintf("%s (%s)", e.Relation, e.Stage)
+}
+
+func (c *WerfConfig) ImagesGraph() *ImagesGraph {
+	graph := &ImagesGraph{}
+
+	addStapelImage := func(i *StapelImageBase, nodeType string) {
+		graph.Nodes = append(graph.Nodes, &ImagesGraphNode{Name: i.Name, Type: nodeType})
+
+		if i.FromImageName != "" {
+			graph.Edges = append(graph.Edges, &ImagesGraphEdge{From: i.FromImageName, To: i.Name, Relation: ImagesGraphEdgeFromImage})
+		}
+
+		if i.FromImageArtifactName != "" {
+			graph.Edges = append(graph.Edges, &ImagesGraphEdge{From: i.FromImageArtifactName, To: i.Name, Relation: ImagesGraphEdgeFromImageArtifact})
+		}
+
+		for _, imp := range i.imports() {
+			edge := &ImagesGraphEdge{To: i.Name, Relation: ImagesGraphEdgeImport}
+
+			if imp.ImageName != "" {
+				edge.From = imp.ImageName
+			} else {
+				edge.From = imp.ArtifactName
+			}
+
+			if imp.Before != "" {
+				edge.Stage = fmt.Sprintf("before %s", imp.Before)
+			} else if imp.After != "" {
+				edge.Stage = fmt.Sprintf("after %s", imp.After)
+			}
+
+			graph.Edges = append(graph.Edges, edge)
+		}
+	}
+
+	for _, image := range c.StapelImages {
+		addStapelImage(image.StapelImageBase, ImagesGraphNodeImage)
+	}
+
+	for _, image := range c.ImagesFromDockerfile {
+		graph.Nodes = append(graph.Nodes, &ImagesGraphNode{Name: image.Name, Type: ImagesGraphNodeDockerfile})
+	}
+
+	for _, artifact := range c.Artifacts {
+		addStapelImage(artifact.StapelImageBase, ImagesGraphNodeArtifact)
+	}
+
+	return graph
+}
+
+func (g *ImagesGraph) Json() ([]byte, error) {
+	return json.MarshalIndent(g, "", "  ")
+}
+
+func (g *ImagesGraph) Dot() []byte {
+	buf := bytes.NewBuffer(nil)
+
+	fmt.Fprintln(buf, "digraph werf {")
+	fmt.Fprintln(buf, "  rankdir=LR;")
+
+	for _, node := range g.Nodes {
+		shape := "box"
+		switch node.Type {
+		case ImagesGraphNodeArtifact:
+			shape = "ellipse"
+		case ImagesGraphNodeDockerfile:
+			shape = "note"
+		}
+
+		fmt.Fprintf(buf, "  %s [label=%s, shape=%s];\n", strconv.Quote(imagesGraphNodeName(node.Name)), strconv.Quote(strings.Join(node.labelLines(), "\n")), shape)
+	}
+
+	for _, edge := range g.Edges {
+		fmt.Fprintf(buf, "  %s -> %s [label=%s];\n", strconv.Quote(imagesGraphNodeName(edge.From)), strconv.Quote(imagesGraphNodeName(edge.To)), strconv.Quote(edge.Label()))
+	}
+
+	fmt.Fprintln(buf, "}")
+
+	return buf.Bytes()
+}
+
+func (g *ImagesGraph) Mermaid() []byte {
+	buf := bytes.NewBuffer(nil)
+
+	// mermaid node ids cannot contain arbitrary characters, thus names are used only in labels
+	ids := map[string]string{}
+	for ind, node := range g.Nodes {
+		ids[node.Name] = fmt.Sprintf("n%d", ind)
+	}
+
+	nodeId := func(name string) string {
+		if id, ok := ids[name]; ok {
+			return id
+		}
+
+		id := fmt.Sprintf("n%d", len(ids))
+		ids[name] = id
+
+		return id
+	}
+
+	fmt.Fprintln(buf, "graph LR")
+
+	for _, node := range g.Nodes {
+		label := mermaidEscape(strings.Join(node.labelLines(), "<br/>"))
+
+		switch node.Type {
+		case ImagesGraphNodeArtifact:
+			fmt.Fprintf(buf, "  %s([\"%s\"])\n", nodeId(node.Name), label)
+		case ImagesGraphNodeDockerfile:
+			fmt.Fprintf(buf, "  %s[/\"%s\"/]\n", nodeId(node.Name), label)
+		default:
+			fmt.Fprintf(buf, "  %s[\"%s\"]\n", nodeId(node.Name), label)
+		}
+	}
+
+	for _, edge := range g.Edges {
+		fmt.Fprintf(buf, "  %s -->|\"%s\"| %s\n", nodeId(edge.From), mermaidEscape(edge.Label()), nodeId(edge.To))
+	}
+
+	return buf.Bytes()
+}
+
+func (n *ImagesGraphNode) labelLines() []string {
+	lines := []string{fmt.Sprintf("%s: %s", n.Type, imagesGraphNodeName(n.Name))}
+
+	if n.Signature != "" {
+		lines = append(lines, fmt.Sprintf("signature: %s", n.Signature))
+	}
+
+	if n.CacheStatus != "" {
+		lines = append(lines, fmt.Sprintf("cache: %s", n.CacheStatus))
+	}
+
+	return lines
+}
+
+func imagesGraphNodeName(name string) string {
+	if name == "" {
+		return "~"
+	}
+
+	return name
+}
+
+func mermaidEscape(s string) string {
+	return strings.Replace(s, "\"", "#quot;", -1)
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("images graph", func() {
+	werfConfig := func(content string) *WerfConfig {
+		docs, err := splitByDocs(content, "werf.yaml")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		meta, rawStapelImages, rawImagesFromDockerfile, err := splitByMetaAndRawImages(docs)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		c, err := prepareWerfConfig(rawStapelImages, rawImagesFromDockerfile, meta)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return c
+	}
+
+	content := `
+configVersion: 1
+project: demo
+---
+image: base
+from: alpine
+---
+image: app
+fromImage: base
+import:
+- artifact: assets
+  add: /app/public
+  to: /app/public
+  before: setup
+---
+image: web
+dockerfile: Dockerfile
+---
+artifact: assets
+fromImageArtifact: builder
+---
+artifact: builder
+from: node:12
+`
+
+	It("resolves relations", func() {
+		graph := werfConfig(content).ImagesGraph()
+
+		var nodes []ImagesGraphNode
+		for _, node := range graph.Nodes {
+			nodes = append(nodes, *node)
+		}
+
+		Ω(nodes).Should(Equal([]ImagesGraphNode{
+			{Name: "base", Type: ImagesGraphNodeImage},
+			{Name: "app", Type: ImagesGraphNodeImage},
+			{Name: "web", Type: ImagesGraphNodeDockerfile},
+			{Name: "assets", Type: ImagesGraphNodeArtifact},
+			{Name: "builder", Type: ImagesGraphNodeArtifact},
+		}))
+
+		var edges []ImagesGraphEdge
+		for _, edge := range graph.Edges {
+			edges = append(edges, *edge)
+		}
+
+		Ω(edges).Should(Equal([]ImagesGraphEdge{
+			{From: "base", To: "app", Relation: ImagesGraphEdgeFromImage},
+			{From: "assets", To: "app", Relation: ImagesGraphEdgeImport, Stage: "before setup"},
+			{From: "builder", To: "assets", Relation: ImagesGraphEdgeFromImageArtifact},
+		}))
+	})
+
+	It("renders dot", func() {
+		graph := werfConfig(content).ImagesGraph()
+		graph.Nodes[0].Signature = "abc"
+		graph.Nodes[0].CacheStatus = "cached"
+
+		Ω(string(graph.Dot())).Should(Equal(`digraph werf {
+  rankdir=LR;
+  "base" [label="image: base\nsignature: abc\ncache: cached", shape=box];
+  "app" [label="image: app", shape=box];
+  "web" [label="dockerfile: web", shape=note];
+  "assets" [label="artifact: assets", shape=ellipse];
+  "builder" [label="artifact: builder", shape=ellipse];
+  "base" -> "app" [label="fromImage"];
+  "assets" -> "app" [label="import (before setup)"];
+  "builder" -> "assets" [label="fromImageArtifact"];
+}
+`))
+	})
+
+	It("renders mermaid", func() {
+		graph := werfConfig(content).ImagesGraph()
+
+		Ω(string(graph.Mermaid())).Should(Equal(`graph LR
+  n0["image: base"]
+  n1["image: app"]
+  n2[/"dockerfile: web"/]
+  n3(["artifact: assets"])
+  n4(["artifact: builder"])
+  n0 -->|"fromImage"| n1
+  n3 -->|"import (before setup)"| n1
+  n4 -->|"fromImageArtifact"| n3
+`))
+	})
+})
@@ -25,14 +25,45 @@ import (
 	"github.com/flant/werf/pkg/util"
 )
 
-func RenderWerfConfig(werfConfigPath string, imagesToProcess []string) error {
-	werfConfig, err := GetWerfConfig(werfConfigPath, false)
+// RenderWerfConfig prints rendered werf.yaml or config sections of the specified images.
+// Image and artifact config sections are printed merged with the extended templates when resolved is set.
+func RenderWerfConfig(werfConfigPath string, imagesToProcess []string, resolved bool, opts WerfConfigOptions) error {
+	opts.LogRenderedFilePath = false
+	werfConfig, err := GetWerfConfig(werfConfigPath, opts)
 	if err != nil {
 		return err
 	}
 
-	if len(imagesToProcess) == 0 {
-		werfConfigRenderContent, err := parseWerfConfigYaml(werfConfigPath)
+	if len(imagesToProcess) == 0 && resolved {
+		docs, err := renderWerfConfigDocs(werfConfigPath, opts)
+		if err != nil {
+			return err
+		}
+
+		if _, _, _, err := splitByMetaAndRawImages(docs); err != nil {
+			return err
+		}
+
+		var docsContents []string
+		for _, d := range docs {
+			var raw map[string]interface{}
+			if err := yaml.Unmarshal(d.Content, &raw); err != nil {
+				return newYamlUnmarshalError(err, d)
+			}
+
+			if !isTemplateDoc(raw) {
+				docsContents = append(docsContents, string(d.resolvedContent()))
+			}
+		}
+
+		fmt.Print(strings.Join(docsContents, "---\n"))
+	} else if len(imagesToProcess) == 0 {
+		values, err := readConfigValues(filepath.Dir(werfConfigPath), opts)
+		if err != nil {
+			return err
+		}
+
+		werfConfigRenderContent, err := parseWerfConfigYaml(werfConfigPath, values)
 		if err != nil {
 			return fmt.Errorf("cannot parse config: %s", err)
 		}
@@ -46,9 +77,9 @@ func RenderWerfConfig(werfConfigPath string, imagesToProcess []string) error {
 				return fmt.Errorf("specified image %s is not defined in werf.yaml", logging.ImageLogName(imageToProcess, false))
 			} else {
 				if i := werfConfig.GetArtifact(imageToProcess); i != nil {
-					imageDocs = append(imageDocs, string(i.raw.doc.Content))
+					imageDocs = append(imageDocs, string(renderDocContent(i.raw.doc, resolved)))
 				} else if i := werfConfig.GetStapelImage(imageToProcess); i != nil {
-					imageDocs = append(imageDocs, string(i.raw.doc.Content))
+					imageDocs = append(imageDocs, string(renderDocContent(i.raw.doc, resolved)))
 				} else if i := werfConfig.GetDockerfileImage(imageToProcess); i != nil {
 					imageDocs = append(imageDocs, string(i.raw.doc.Content))
 				}
@@ -61,27 +92,16 @@ func RenderWerfConfig(werfConfigPath string, imagesToProcess []string) error {
 	return nil
 }
 
-func GetWerfConfig(werfConfigPath string, logRenderedFilePath bool) (*WerfConfig, error) {
-	werfConfigRenderContent, err := parseWerfConfigYaml(werfConfigPath)
-	if err != nil {
-		return nil, fmt.Errorf("cannot parse config: %s", err)
+func renderDocContent(d *doc, resolved bool) []byte {
+	if resolved {
+		return d.resolvedContent()
 	}
 
-	werfConfigRenderPath, err := tmp_manager.CreateWerfConfigRender()
-	if err != nil {
-		return nil, err
-	}
-
-	if logRenderedFilePath {
-		logboek.LogF("Using werf config render file: %s\n", werfConfigRenderPath)
-	}
-
-	err = writeWerfConfigRender(werfConfigRenderContent, werfConfigRenderPath)
-	if err != nil {
-		return nil, fmt.Errorf("unable to write rendered config to %s: %s", werfConfigRenderPath, err)
-	}
+	return d.Content
+}
 
-	docs, err := splitByDocs(werfConfigRenderContent, werfConfigRenderPath)
+func GetWerfConfig(werfConfigPath string, opts WerfConfigOptions) (*WerfConfig, error) {
+	docs, err := renderWerfConfigDocs(werfConfigPath, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -121,6 +141,38 @@ func GetWerfConfig(werfConfigPath string, logRenderedFilePath bool) (*WerfConfig
 	return werfConfig, nil
 }
 
+func renderWerfConfigDocs(werfConfigPath string, opts WerfConfigOptions) ([]*doc, error) {
+	values, err := readConfigValues(filepath.Dir(werfConfigPath), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	werfConfigRenderContent, err := parseWerfConfigYaml(werfConfigPath, values)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse config: %s", err)
+	}
+
+	werfConfigRenderPath, err := tmp_manager.CreateWerfConfigRender()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.LogRenderedFilePath {
+		for _, line := range values.logLines() {
+			logboek.LogLn(line)
+		}
+
+		logboek.LogF("Using werf config render file: %s\n", werfConfigRenderPath)
+	}
+
+	err = writeWerfConfigRender(werfConfigRenderContent, werfConfigRenderPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to write rendered config to %s: %s", werfConfigRenderPath, err)
+	}
+
+	return splitByDocs(werfConfigRenderContent, werfConfigRenderPath)
+}
+
 func GetProjectName(projectDir string) (string, error) {
 	name := filepath.Base(projectDir)
 
@@ -202,7 +254,7 @@ func splitByDocs(werfConfigRenderContent string, werfConfigRenderPath string) ([
 	return docs, nil
 }
 
-func parseWerfConfigYaml(werfConfigPath string) (string, error) {
+func parseWerfConfigYaml(werfConfigPath string, values *configValues) (string, error) {
 	data, err := ioutil.ReadFile(werfConfigPath)
 	if err != nil {
 		return "", err
@@ -243,7 +295,7 @@ func parseWerfConfigYaml(werfConfigPath string) (string, error) {
 	}
 
 	files := files{filepath.Dir(werfConfigPath)}
-	config, err := executeTemplate(tmpl, "werfConfig", map[string]interface{}{"Files": files})
+	config, err := executeTemplate(tmpl, "werfConfig", map[string]interface{}{"Files": files, "Values": values.Values})
 
 	return config, err
 }
@@ -287,6 +339,14 @@ func funcMap(tmpl *template.Template) template.FuncMap {
 	funcMap["include"] = func(name string, data interface{}) (string, error) {
 		return executeTemplate(tmpl, name, data)
 	}
+	funcMap["required"] = func(msg string, val interface{}) (interface{}, error) {
+		if val == nil {
+			return val, errors.New(msg)
+		} else if _, ok := val.(string); ok && val == "" {
+			return val, errors.New(msg)
+		}
+		return val, nil
+	}
 	return funcMap
 }
 
@@ -498,6 +558,11 @@ func splitByMetaAndRawImages(docs []*doc) (*Meta, []*rawStapelImage, []*rawImage
 	var rawImagesFromDockerfile []*rawImageFromDockerfile
 	var resultMeta *Meta
 
+	templates, err := collectImageTemplates(docs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	parentStack = util.NewStack()
 	for _, doc := range docs {
 		var raw map[string]interface{}
@@ -506,7 +571,9 @@ func splitByMetaAndRawImages(docs []*doc) (*Meta, []*rawStapelImage, []*rawImage
 			return nil, nil, nil, newYamlUnmarshalError(err, doc)
 		}
 
-		if isMetaDoc(raw) {
+		if isTemplateDoc(raw) {
+			continue
+		} else if isMetaDoc(raw) {
 			if resultMeta != nil {
 				return nil, nil, nil, newYamlUnmarshalError(errors.New("duplicate meta config section definition"), doc)
 			}
@@ -527,15 +594,21 @@ func splitByMetaAndRawImages(docs []*doc) (*Meta, []*rawStapelImage, []*rawImage
 
 			rawImagesFromDockerfile = append(rawImagesFromDockerfile, imageFromDockerfile)
 		} else if isImageDoc(raw) {
+			if isExtendingDoc(raw) {
+				if err := resolveDocTemplates(doc, templates); err != nil {
+					return nil, nil, nil, err
+				}
+			}
+
 			image := &rawStapelImage{doc: doc}
-			err := yaml.Unmarshal(doc.Content, &image)
+			err := yaml.Unmarshal(doc.resolvedContent(), &image)
 			if err != nil {
 				return nil, nil, nil, newYamlUnmarshalError(err, doc)
 			}
 
 			rawStapelImages = append(rawStapelImages, image)
 		} else {
-			return nil, nil, nil, newYamlUnmarshalError(errors.New("cannot recognize type of config section (part of YAML stream separated by three hyphens, https://yaml.org/spec/1.2/spec.html#id2800132):\n * 'configVersion' required for meta config section;\n * 'image' required for the image config sections;\n * 'artifact' required for the artifact config sections;"), doc)
+			return nil, nil, nil, newYamlUnmarshalError(errors.New("cannot recognize type of config section (part of YAML stream separated by three hyphens, https://yaml.org/spec/1.2/spec.html#id2800132):\n * 'configVersion' required for meta config section;\n * 'image' required for the image config sections;\n * 'artifact' required for the artifact config sections;\n * 'template' required for the image template config sections;"), doc)
 		}
 	}
 
@@ -574,6 +647,10 @@ func newYamlUnmarshalError(err error, doc *doc) error {
 		return err
 	default:
 		message := err.Error()
+		if doc.ResolvedContent != nil {
+			return newDetailedConfigError(fmt.Sprintf("%s (in the config section merged with extended templates)", message), nil, doc)
+		}
+
 		reg, err := regexp.Compile("line ([0-9]+)")
 		if err != nil {
 			return err
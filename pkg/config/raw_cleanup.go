@@ -0,0 +1,311 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/flant/werf/pkg/tag_strategy"
+	"github.com/flant/werf/pkg/util"
+)
+
+var cleanupRuleTagStrategies = []tag_strategy.TagStrategy{
+	tag_strategy.GitBranch,
+	tag_strategy.GitTag,
+	tag_strategy.GitCommit,
+	tag_strategy.GitSemver,
+	tag_strategy.StagesSignature,
+}
+
+type rawCleanup struct {
+	Rules               []*rawCleanupRule              `yaml:"rules,omitempty"`
+	KubernetesWhitelist *rawCleanupKubernetesWhitelist `yaml:"kubernetesWhitelist,omitempty"`
+	ProtectedTags       interface{}                    `yaml:"protectedTags,omitempty"`
+
+	rawMeta *rawMeta
+
+	protectedTags []string
+
+	UnsupportedAttributes map[string]interface{} `yaml:",inline"`
+}
+
+func (c *rawCleanup) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if parent, ok := parentStack.Peek().(*rawMeta); ok {
+		c.rawMeta = parent
+	}
+
+	parentStack.Push(c)
+	type plain rawCleanup
+	err := unmarshal((*plain)(c))
+	parentStack.Pop()
+	if err != nil {
+		return err
+	}
+
+	if err := checkOverflow(c.UnsupportedAttributes, nil, c.rawMeta.doc); err != nil {
+		return err
+	}
+
+	protectedTags, err := InterfaceToStringArray(c.ProtectedTags, nil, c.rawMeta.doc)
+	if err != nil {
+		return err
+	}
+
+	for _, protectedTag := range protectedTags {
+		if _, err := regexp.Compile(protectedTag); err != nil {
+			return newDetailedConfigError(fmt.Sprintf("bad protectedTags regular expression '%s': %s", protectedTag, err), nil, c.rawMeta.doc)
+		}
+	}
+	c.protectedTags = protectedTags
+
+	return nil
+}
+
+func (c *rawCleanup) toCleanup() Cleanup {
+	cleanup := Cleanup{ProtectedTags: c.protectedTags}
+
+	for _, rawRule := range c.Rules {
+		cleanup.Rules = append(cleanup.Rules, rawRule.toCleanupRule())
+	}
+
+	if c.KubernetesWhitelist != nil {
+		cleanup.KubernetesWhitelist = c.KubernetesWhitelist.toCleanupKubernetesWhitelist()
+	}
+
+	return cleanup
+}
+
+type rawCleanupKubernetesWhitelist struct {
+	HelmReleaseRevisions *int                            `yaml:"helmReleaseRevisions,omitempty"`
+	Resources            []*rawCleanupKubernetesResource `yaml:"resources,omitempty"`
+
+	rawCleanup *rawCleanup
+
+	UnsupportedAttributes map[string]interface{} `yaml:",inline"`
+}
+
+func (c *rawCleanupKubernetesWhitelist) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if parent, ok := parentStack.Peek().(*rawCleanup); ok {
+		c.rawCleanup = parent
+	}
+
+	parentStack.Push(c)
+	type plain rawCleanupKubernetesWhitelist
+	err := unmarshal((*plain)(c))
+	parentStack.Pop()
+	if err != nil {
+		return err
+	}
+
+	doc := c.rawCleanup.rawMeta.doc
+
+	if err := checkOverflow(c.UnsupportedAttributes, c, doc); err != nil {
+		return err
+	}
+
+	if c.HelmReleaseRevisions != nil && *c.HelmReleaseRevisions < 0 {
+		return newDetailedConfigError(fmt.Sprintf("helmReleaseRevisions field should be non-negative, got %d!", *c.HelmReleaseRevisions), c, doc)
+	}
+
+	return nil
+}
+
+func (c *rawCleanupKubernetesWhitelist) toCleanupKubernetesWhitelist() CleanupKubernetesWhitelist {
+	whitelist := CleanupKubernetesWhitelist{}
+
+	if c.HelmReleaseRevisions != nil {
+		whitelist.HelmReleaseRevisions = *c.HelmReleaseRevisions
+	}
+
+	for _, rawResource := range c.Resources {
+		whitelist.Resources = append(whitelist.Resources, rawResource.toCleanupKubernetesResource())
+	}
+
+	return whitelist
+}
+
+type rawCleanupKubernetesResource struct {
+	ApiVersion string      `yaml:"apiVersion,omitempty"`
+	Kind       string      `yaml:"kind,omitempty"`
+	ImagePaths interface{} `yaml:"imagePaths,omitempty"`
+
+	rawCleanupKubernetesWhitelist *rawCleanupKubernetesWhitelist
+
+	imagePaths []string
+
+	UnsupportedAttributes map[string]interface{} `yaml:",inline"`
+}
+
+func (c *rawCleanupKubernetesResource) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if parent, ok := parentStack.Peek().(*rawCleanupKubernetesWhitelist); ok {
+		c.rawCleanupKubernetesWhitelist = parent
+	}
+
+	type plain rawCleanupKubernetesResource
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	doc := c.rawCleanupKubernetesWhitelist.rawCleanup.rawMeta.doc
+
+	if err := checkOverflow(c.UnsupportedAttributes, c, doc); err != nil {
+		return err
+	}
+
+	if c.ApiVersion == "" {
+		return newDetailedConfigError("apiVersion field cannot be empty!", c, doc)
+	}
+
+	if c.Kind == "" {
+		return newDetailedConfigError("kind field cannot be empty!", c, doc)
+	}
+
+	imagePaths, err := InterfaceToStringArray(c.ImagePaths, c, doc)
+	if err != nil {
+		return err
+	}
+
+	if len(imagePaths) == 0 {
+		return newDetailedConfigError("imagePaths field cannot be empty!", c, doc)
+	}
+
+	for _, imagePath := range imagePaths {
+		imagePath = CleanupKubernetesResourceImagePathTemplate(imagePath)
+		if err := jsonpath.New("").Parse(imagePath); err != nil {
+			return newDetailedConfigError(fmt.Sprintf("bad imagePaths JSONPath '%s': %s", imagePath, err), c, doc)
+		}
+
+		c.imagePaths = append(c.imagePaths, imagePath)
+	}
+
+	return nil
+}
+
+func (c *rawCleanupKubernetesResource) toCleanupKubernetesResource() *CleanupKubernetesResource {
+	return &CleanupKubernetesResource{
+		ApiVersion: c.ApiVersion,
+		Kind:       c.Kind,
+		ImagePaths: c.imagePaths,
+	}
+}
+
+// CleanupKubernetesResourceImagePathTemplate returns the JSONPath template in the kubectl format ({.spec.image}) for the plain path (.spec.image)
+func CleanupKubernetesResourceImagePathTemplate(imagePath string) string {
+	if strings.HasPrefix(imagePath, "{") {
+		return imagePath
+	}
+
+	return fmt.Sprintf("{%s}", imagePath)
+}
+
+type rawCleanupRule struct {
+	TagStrategy   interface{} `yaml:"tagStrategy,omitempty"`
+	References    *string     `yaml:"references,omitempty"`
+	Image         interface{} `yaml:"image,omitempty"`
+	KeepLast      *int        `yaml:"keepLast,omitempty"`
+	KeepNewerThan *string     `yaml:"keepNewerThan,omitempty"`
+
+	rawCleanup *rawCleanup
+
+	tagStrategies []string
+	imageNames    []string
+	keepNewerThan *time.Duration
+
+	UnsupportedAttributes map[string]interface{} `yaml:",inline"`
+}
+
+func (c *rawCleanupRule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if parent, ok := parentStack.Peek().(*rawCleanup); ok {
+		c.rawCleanup = parent
+	}
+
+	type plain rawCleanupRule
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	doc := c.rawCleanup.rawMeta.doc
+
+	if err := checkOverflow(c.UnsupportedAttributes, c, doc); err != nil {
+		return err
+	}
+
+	tagStrategies, err := InterfaceToStringArray(c.TagStrategy, c, doc)
+	if err != nil {
+		return err
+	}
+
+	for _, tagStrategy := range tagStrategies {
+		if !isCleanupRuleTagStrategy(tagStrategy) {
+			return newDetailedConfigError(fmt.Sprintf("unsupported tagStrategy '%s' for the cleanup rule, expected one of: %s!", tagStrategy, strings.Join(cleanupRuleTagStrategiesNames(), ", ")), c, doc)
+		}
+	}
+	c.tagStrategies = tagStrategies
+
+	if c.References != nil {
+		if *c.References == "" {
+			return newDetailedConfigError("references field cannot be empty!", c, doc)
+		}
+
+		if _, err := regexp.Compile(*c.References); err != nil {
+			return newDetailedConfigError(fmt.Sprintf("bad references regular expression '%s': %s", *c.References, err), c, doc)
+		}
+	}
+
+	imageNames, err := InterfaceToStringArray(c.Image, c, doc)
+	if err != nil {
+		return err
+	}
+	c.imageNames = imageNames
+
+	if c.KeepLast != nil && *c.KeepLast < 0 {
+		return newDetailedConfigError(fmt.Sprintf("keepLast field should be non-negative, got %d!", *c.KeepLast), c, doc)
+	}
+
+	if c.KeepNewerThan != nil {
+		keepNewerThan, err := util.ParseDuration(*c.KeepNewerThan)
+		if err != nil {
+			return newDetailedConfigError(fmt.Sprintf("bad keepNewerThan duration '%s': %s", *c.KeepNewerThan, err), c, doc)
+		}
+		c.keepNewerThan = &keepNewerThan
+	}
+
+	return nil
+}
+
+func (c *rawCleanupRule) toCleanupRule() *CleanupRule {
+	rule := &CleanupRule{
+		TagStrategies: c.tagStrategies,
+		ImageNames:    c.imageNames,
+		KeepLast:      c.KeepLast,
+		KeepNewerThan: c.keepNewerThan,
+	}
+
+	if c.References != nil {
+		rule.References = *c.References
+	}
+
+	return rule
+}
+
+func isCleanupRuleTagStrategy(value string) bool {
+	for _, tagStrategy := range cleanupRuleTagStrategies {
+		if string(tagStrategy) == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func cleanupRuleTagStrategiesNames() []string {
+	var names []string
+	for _, tagStrategy := range cleanupRuleTagStrategies {
+		names = append(names, string(tagStrategy))
+	}
+
+	return names
+}
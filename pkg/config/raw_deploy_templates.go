@@ -1,10 +1,15 @@
 package config
 
+import "fmt"
+
 type rawDeployTemplates struct {
 	HelmRelease     *string `yaml:"helmRelease,omitempty"`
 	HelmReleaseSlug *bool   `yaml:"helmReleaseSlug,omitempty"`
 	Namespace       *string `yaml:"namespace,omitempty"`
 	NamespaceSlug   *bool   `yaml:"namespaceSlug,omitempty"`
+	PostRenderer    *string `yaml:"postRenderer,omitempty"`
+
+	Clusters []*rawDeployCluster `yaml:"clusters,omitempty"`
 
 	rawMeta *rawMeta
 
@@ -36,6 +41,18 @@ func (c *rawDeployTemplates) UnmarshalYAML(unmarshal func(interface{}) error) er
 		return newDetailedConfigError("namespace field cannot be empty!", nil, c.rawMeta.doc)
 	}
 
+	if c.PostRenderer != nil && *c.PostRenderer == "" {
+		return newDetailedConfigError("postRenderer field cannot be empty!", nil, c.rawMeta.doc)
+	}
+
+	clusterNames := map[string]bool{}
+	for _, cluster := range c.Clusters {
+		if clusterNames[*cluster.Name] {
+			return newDetailedConfigError(fmt.Sprintf("cluster name '%s' should be unique!", *cluster.Name), cluster, c.rawMeta.doc)
+		}
+		clusterNames[*cluster.Name] = true
+	}
+
 	return nil
 }
 
@@ -60,5 +77,90 @@ func (c *rawDeployTemplates) toDeployTemplates() DeployTemplates {
 		deployTemplates.NamespaceSlug = *c.NamespaceSlug
 	}
 
+	if c.PostRenderer != nil {
+		deployTemplates.PostRenderer = *c.PostRenderer
+	}
+
+	for _, rawCluster := range c.Clusters {
+		deployTemplates.Clusters = append(deployTemplates.Clusters, rawCluster.toDeployCluster())
+	}
+
 	return deployTemplates
 }
+
+type rawDeployCluster struct {
+	Name        *string     `yaml:"name,omitempty"`
+	KubeContext *string     `yaml:"kubeContext,omitempty"`
+	Values      interface{} `yaml:"values,omitempty"`
+	HelmRelease *string     `yaml:"helmRelease,omitempty"`
+	Namespace   *string     `yaml:"namespace,omitempty"`
+
+	rawDeployTemplates *rawDeployTemplates
+
+	values []string
+
+	UnsupportedAttributes map[string]interface{} `yaml:",inline"`
+}
+
+func (c *rawDeployCluster) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if parent, ok := parentStack.Peek().(*rawDeployTemplates); ok {
+		c.rawDeployTemplates = parent
+	}
+
+	type plain rawDeployCluster
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	doc := c.rawDeployTemplates.rawMeta.doc
+
+	if err := checkOverflow(c.UnsupportedAttributes, c, doc); err != nil {
+		return err
+	}
+
+	if c.Name == nil || *c.Name == "" {
+		return newDetailedConfigError("name field cannot be empty!", c, doc)
+	}
+
+	if c.KubeContext != nil && *c.KubeContext == "" {
+		return newDetailedConfigError("kubeContext field cannot be empty!", c, doc)
+	}
+
+	if c.HelmRelease != nil && *c.HelmRelease == "" {
+		return newDetailedConfigError("helmRelease field cannot be empty!", c, doc)
+	}
+
+	if c.Namespace != nil && *c.Namespace == "" {
+		return newDetailedConfigError("namespace field cannot be empty!", c, doc)
+	}
+
+	values, err := InterfaceToStringArray(c.Values, c, doc)
+	if err != nil {
+		return err
+	}
+	c.values = values
+
+	return nil
+}
+
+func (c *rawDeployCluster) toDeployCluster() *DeployCluster {
+	cluster := &DeployCluster{
+		Name:        *c.Name,
+		KubeContext: *c.Name,
+		Values:      c.values,
+	}
+
+	if c.KubeContext != nil {
+		cluster.KubeContext = *c.KubeContext
+	}
+
+	if c.HelmRelease != nil {
+		cluster.HelmRelease = *c.HelmRelease
+	}
+
+	if c.Namespace != nil {
+		cluster.Namespace = *c.Namespace
+	}
+
+	return cluster
+}
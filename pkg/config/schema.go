@@ -0,0 +1,286 @@
+package config
+
+import (
+	"encoding/json"
+)
+
+const (
+	metaSchemaDefinition                = "meta"
+	stapelImageSchemaDefinition         = "stapelImage"
+	stapelArtifactSchemaDefinition      = "stapelArtifact"
+	imageFromDockerfileSchemaDefinition = "imageFromDockerfile"
+	imageTemplateSchemaDefinition       = "imageTemplate"
+)
+
+// JsonSchema returns JSON Schema (draft-04) for werf.yaml documents.
+// Each document of the werf.yaml YAML stream should match one of the meta, image, artifact, image template or dockerfile image definitions.
+func JsonSchema() ([]byte, error) {
+	return json.MarshalIndent(jsonSchema(""), "", "  ")
+}
+
+func jsonSchema(rootDefinition string) map[string]interface{} {
+	schema := map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-04/schema#",
+		"id":          "https://werf.io/schemas/werf.schema.json",
+		"title":       "werf.yaml",
+		"description": "werf.yaml config document: meta, stapel image, stapel artifact, image template or dockerfile image",
+		"definitions": jsonSchemaDefinitions(),
+	}
+
+	if rootDefinition == "" {
+		schema["oneOf"] = []interface{}{
+			schemaRef(metaSchemaDefinition),
+			schemaRef(stapelImageSchemaDefinition),
+			schemaRef(stapelArtifactSchemaDefinition),
+			schemaRef(imageTemplateSchemaDefinition),
+			schemaRef(imageFromDockerfileSchemaDefinition),
+		}
+	} else {
+		schema["allOf"] = []interface{}{schemaRef(rootDefinition)}
+	}
+
+	return schema
+}
+
+func jsonSchemaDefinitions() map[string]interface{} {
+	return map[string]interface{}{
+		"stringOrStringArray": map[string]interface{}{
+			"oneOf": []interface{}{
+				schemaString(),
+				schemaArray(schemaString()),
+			},
+		},
+		"imageName": map[string]interface{}{
+			"oneOf": []interface{}{
+				schemaString(),
+				schemaArray(schemaString()),
+				map[string]interface{}{"type": "null"},
+			},
+		},
+		metaSchemaDefinition: schemaObject(map[string]interface{}{
+			"configVersion": map[string]interface{}{"type": "integer", "enum": []interface{}{1}},
+			"project":       map[string]interface{}{"type": "string", "minLength": 1},
+			"deploy":        schemaRef("deploy"),
+			"cleanup":       schemaRef("cleanup"),
+		}, "configVersion", "project"),
+		"deploy": schemaObject(map[string]interface{}{
+			"helmRelease":     map[string]interface{}{"type": "string", "minLength": 1},
+			"helmReleaseSlug": schemaBoolean(),
+			"namespace":       map[string]interface{}{"type": "string", "minLength": 1},
+			"namespaceSlug":   schemaBoolean(),
+			"postRenderer":    map[string]interface{}{"type": "string", "minLength": 1},
+			"clusters":        schemaArray(schemaRef("deployCluster")),
+		}),
+		"deployCluster": schemaObject(map[string]interface{}{
+			"name":        map[string]interface{}{"type": "string", "minLength": 1},
+			"kubeContext": map[string]interface{}{"type": "string", "minLength": 1},
+			"values":      schemaRef("stringOrStringArray"),
+			"helmRelease": map[string]interface{}{"type": "string", "minLength": 1},
+			"namespace":   map[string]interface{}{"type": "string", "minLength": 1},
+		}, "name"),
+		"cleanup": schemaObject(map[string]interface{}{
+			"rules":               schemaArray(schemaRef("cleanupRule")),
+			"kubernetesWhitelist": schemaRef("cleanupKubernetesWhitelist"),
+			"protectedTags":       schemaRef("stringOrStringArray"),
+		}),
+		"cleanupKubernetesWhitelist": schemaObject(map[string]interface{}{
+			"helmReleaseRevisions": map[string]interface{}{"type": "integer", "minimum": 0},
+			"resources":            schemaArray(schemaRef("cleanupKubernetesResource")),
+		}),
+		"cleanupKubernetesResource": schemaObject(map[string]interface{}{
+			"apiVersion": map[string]interface{}{"type": "string", "minLength": 1},
+			"kind":       map[string]interface{}{"type": "string", "minLength": 1},
+			"imagePaths": schemaRef("stringOrStringArray"),
+		}, "apiVersion", "kind", "imagePaths"),
+		"cleanupRule": schemaObject(map[string]interface{}{
+			"tagStrategy":   schemaRef("cleanupRuleTagStrategy"),
+			"references":    map[string]interface{}{"type": "string", "minLength": 1},
+			"image":         schemaRef("stringOrStringArray"),
+			"keepLast":      map[string]interface{}{"type": "integer", "minimum": 0},
+			"keepNewerThan": map[string]interface{}{"type": "string", "pattern": "^([0-9]+d|([0-9.]+(ns|us|µs|ms|s|m|h))+)$"},
+		}),
+		"cleanupRuleTagStrategy": map[string]interface{}{
+			"oneOf": []interface{}{
+				schemaCleanupRuleTagStrategy(),
+				schemaArray(schemaCleanupRuleTagStrategy()),
+			},
+		},
+
+		stapelImageSchemaDefinition:    schemaObject(stapelImageSchemaProperties("image"), "image"),
+		stapelArtifactSchemaDefinition: schemaObject(stapelImageSchemaProperties("artifact"), "artifact"),
+		imageTemplateSchemaDefinition:  schemaObject(stapelImageSchemaProperties("template"), "template"),
+		imageFromDockerfileSchemaDefinition: schemaObject(map[string]interface{}{
+			"image":      schemaRef("imageName"),
+			"dockerfile": schemaString(),
+			"context":    schemaString(),
+			"target":     schemaString(),
+			"args":       map[string]interface{}{"type": "object"},
+			"addHost":    schemaRef("stringOrStringArray"),
+		}, "dockerfile"),
+
+		"git": schemaObject(mergeSchemaProperties(exportBaseSchemaProperties(), map[string]interface{}{
+			"url":               schemaString(),
+			"branch":            schemaString(),
+			"tag":               schemaString(),
+			"commit":            schemaString(),
+			"stageDependencies": schemaRef("stageDependencies"),
+		})),
+		"stageDependencies": schemaObject(map[string]interface{}{
+			"install":     schemaRef("stringOrStringArray"),
+			"beforeSetup": schemaRef("stringOrStringArray"),
+			"setup":       schemaRef("stringOrStringArray"),
+		}),
+		"shell": schemaObject(map[string]interface{}{
+			"beforeInstall":             schemaRef("stringOrStringArray"),
+			"install":                   schemaRef("stringOrStringArray"),
+			"beforeSetup":               schemaRef("stringOrStringArray"),
+			"setup":                     schemaRef("stringOrStringArray"),
+			"cacheVersion":              schemaScalar(),
+			"beforeInstallCacheVersion": schemaScalar(),
+			"installCacheVersion":       schemaScalar(),
+			"beforeSetupCacheVersion":   schemaScalar(),
+			"setupCacheVersion":         schemaScalar(),
+		}),
+		"ansible": schemaObject(map[string]interface{}{
+			"beforeInstall":             schemaArray(schemaRef("ansibleTask")),
+			"install":                   schemaArray(schemaRef("ansibleTask")),
+			"beforeSetup":               schemaArray(schemaRef("ansibleTask")),
+			"setup":                     schemaArray(schemaRef("ansibleTask")),
+			"cacheVersion":              schemaScalar(),
+			"beforeInstallCacheVersion": schemaScalar(),
+			"installCacheVersion":       schemaScalar(),
+			"beforeSetupCacheVersion":   schemaScalar(),
+			"setupCacheVersion":         schemaScalar(),
+		}),
+		"ansibleTask": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"block":  schemaArray(schemaRef("ansibleTask")),
+				"rescue": schemaArray(schemaRef("ansibleTask")),
+				"always": schemaArray(schemaRef("ansibleTask")),
+			},
+		},
+		"mount": schemaObject(map[string]interface{}{
+			"to":       schemaString(),
+			"from":     map[string]interface{}{"type": "string", "enum": []interface{}{"tmp_dir", "build_dir"}},
+			"fromPath": schemaString(),
+		}, "to"),
+		"docker": schemaObject(map[string]interface{}{
+			"VOLUME":      schemaRef("stringOrStringArray"),
+			"EXPOSE":      schemaRef("stringOrStringArray"),
+			"ENV":         schemaStringMap(),
+			"LABEL":       schemaStringMap(),
+			"CMD":         schemaRef("stringOrStringArray"),
+			"WORKDIR":     schemaString(),
+			"USER":        schemaScalar(),
+			"ENTRYPOINT":  schemaRef("stringOrStringArray"),
+			"HEALTHCHECK": schemaString(),
+		}),
+		"import": schemaObject(mergeSchemaProperties(exportBaseSchemaProperties(), map[string]interface{}{
+			"image":    schemaString(),
+			"artifact": schemaString(),
+			"before":   map[string]interface{}{"type": "string", "enum": []interface{}{"install", "setup"}},
+			"after":    map[string]interface{}{"type": "string", "enum": []interface{}{"install", "setup"}},
+		}), "add"),
+	}
+}
+
+func stapelImageSchemaProperties(nameField string) map[string]interface{} {
+	properties := map[string]interface{}{
+		"from":              schemaString(),
+		"fromLatest":        schemaBoolean(),
+		"fromCacheVersion":  schemaScalar(),
+		"fromImage":         schemaString(),
+		"fromImageArtifact": schemaString(),
+		"git":               schemaArray(schemaRef("git")),
+		"shell":             schemaRef("shell"),
+		"ansible":           schemaRef("ansible"),
+		"mount":             schemaArray(schemaRef("mount")),
+		"import":            schemaArray(schemaRef("import")),
+		"asLayers":          schemaBoolean(),
+		"extends":           schemaRef("stringOrStringArray"),
+	}
+
+	switch nameField {
+	case "image":
+		properties["image"] = schemaRef("imageName")
+		properties["docker"] = schemaRef("docker")
+	case "artifact":
+		properties["artifact"] = map[string]interface{}{"type": "string", "minLength": 1}
+	case "template":
+		properties["template"] = map[string]interface{}{"type": "string", "minLength": 1}
+		properties["docker"] = schemaRef("docker")
+	}
+
+	return properties
+}
+
+func exportBaseSchemaProperties() map[string]interface{} {
+	return map[string]interface{}{
+		"add":          schemaString(),
+		"to":           schemaString(),
+		"includePaths": schemaRef("stringOrStringArray"),
+		"excludePaths": schemaRef("stringOrStringArray"),
+		"owner":        schemaScalar(),
+		"group":        schemaScalar(),
+	}
+}
+
+func mergeSchemaProperties(propertiesList ...map[string]interface{}) map[string]interface{} {
+	res := map[string]interface{}{}
+	for _, properties := range propertiesList {
+		for k, v := range properties {
+			res[k] = v
+		}
+	}
+
+	return res
+}
+
+func schemaCleanupRuleTagStrategy() map[string]interface{} {
+	var values []interface{}
+	for _, name := range cleanupRuleTagStrategiesNames() {
+		values = append(values, name)
+	}
+
+	return map[string]interface{}{"type": "string", "enum": values}
+}
+
+func schemaObject(properties map[string]interface{}, required ...string) map[string]interface{} {
+	object := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+
+	if len(required) != 0 {
+		object["required"] = required
+	}
+
+	return object
+}
+
+func schemaArray(items interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": items}
+}
+
+func schemaStringMap() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "additionalProperties": schemaScalar()}
+}
+
+func schemaString() map[string]interface{} {
+	return map[string]interface{}{"type": "string"}
+}
+
+// schemaScalar is used for string fields, which are decoded from any YAML scalar (e.g. `cacheVersion: 1`)
+func schemaScalar() map[string]interface{} {
+	return map[string]interface{}{"type": []interface{}{"string", "number", "boolean"}}
+}
+
+func schemaBoolean() map[string]interface{} {
+	return map[string]interface{}{"type": "boolean"}
+}
+
+func schemaRef(definition string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/definitions/" + definition}
+}
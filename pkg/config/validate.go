@@ -0,0 +1,372 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	ghodssYaml "github.com/ghodss/yaml"
+	"github.com/xeipuuv/gojsonschema"
+	"gopkg.in/yaml.v2"
+)
+
+type ValidationError struct {
+	Document int    `json:"document"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (e *ValidationError) String() string {
+	var parts []string
+	if e.Document != 0 {
+		parts = append(parts, fmt.Sprintf("document %d", e.Document))
+	}
+
+	if e.Line != 0 {
+		parts = append(parts, fmt.Sprintf("line %d", e.Line))
+	}
+
+	if e.Column != 0 {
+		parts = append(parts, fmt.Sprintf("column %d", e.Column))
+	}
+
+	message := e.Message
+	if e.Field != "" {
+		message = fmt.Sprintf("%s: %s", e.Field, message)
+	}
+
+	if len(parts) == 0 {
+		return message
+	}
+
+	return fmt.Sprintf("%s: %s", strings.Join(parts, ", "), message)
+}
+
+// ValidateWerfConfig renders werf.yaml and checks each document against the werf.yaml JSON Schema.
+// Documents are numbered from 1, lines and columns refer to the rendered config.
+// When the schema check passes the config is parsed as usual and the parser error (if any) is returned as a single violation.
+func ValidateWerfConfig(werfConfigPath string, opts WerfConfigOptions) ([]*ValidationError, error) {
+	opts.LogRenderedFilePath = false
+	docs, err := renderWerfConfigDocs(werfConfigPath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var validationErrors []*ValidationError
+	var metaDefined bool
+	for ind, doc := range docs {
+		docValidationErrors, isMeta, err := validateDoc(ind+1, doc)
+		if err != nil {
+			return nil, err
+		}
+
+		if isMeta {
+			if metaDefined {
+				docValidationErrors = append(docValidationErrors, &ValidationError{
+					Document: ind + 1,
+					Line:     doc.Line + 1,
+					Column:   1,
+					Message:  "duplicate meta config section definition",
+				})
+			}
+
+			metaDefined = true
+		}
+
+		validationErrors = append(validationErrors, docValidationErrors...)
+	}
+
+	if !metaDefined {
+		validationErrors = append(validationErrors, &ValidationError{Message: "meta config section is not defined"})
+	}
+
+	if len(validationErrors) != 0 {
+		return validationErrors, nil
+	}
+
+	meta, rawStapelImages, rawImagesFromDockerfile, err := splitByMetaAndRawImages(docs)
+	if err == nil {
+		_, err = prepareWerfConfig(rawStapelImages, rawImagesFromDockerfile, meta)
+	}
+
+	if err != nil {
+		return []*ValidationError{{Message: err.Error()}}, nil
+	}
+
+	return nil, nil
+}
+
+func validateDoc(docIndex int, doc *doc) ([]*ValidationError, bool, error) {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(doc.Content, &raw); err != nil {
+		return []*ValidationError{newYamlValidationError(docIndex, doc, err)}, false, nil
+	}
+
+	var schemaDefinition string
+	switch {
+	case isTemplateDoc(raw):
+		schemaDefinition = imageTemplateSchemaDefinition
+	case isMetaDoc(raw):
+		schemaDefinition = metaSchemaDefinition
+	case isImageFromDockerfileDoc(raw):
+		schemaDefinition = imageFromDockerfileSchemaDefinition
+	case isImageDoc(raw):
+		if _, ok := raw["image"]; ok {
+			schemaDefinition = stapelImageSchemaDefinition
+		} else {
+			schemaDefinition = stapelArtifactSchemaDefinition
+		}
+	default:
+		return []*ValidationError{{
+			Document: docIndex,
+			Line:     doc.Line + 1,
+			Column:   1,
+			Message:  "cannot recognize type of config section: 'configVersion' required for meta config section, 'image' required for the image config sections, 'artifact' required for the artifact config sections, 'template' required for the image template config sections",
+		}}, false, nil
+	}
+
+	jsonContent, err := ghodssYaml.YAMLToJSON(doc.Content)
+	if err != nil {
+		return []*ValidationError{newYamlValidationError(docIndex, doc, err)}, false, nil
+	}
+
+	result, err := gojsonschema.Validate(gojsonschema.NewGoLoader(jsonSchema(schemaDefinition)), gojsonschema.NewBytesLoader(jsonContent))
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to validate config section: %s", err)
+	}
+
+	var validationErrors []*ValidationError
+	for _, resultError := range result.Errors() {
+		path := strings.Split(resultError.Context().String("\x00"), "\x00")[1:]
+
+		switch resultError.Type() {
+		case "additional_property_not_allowed":
+			if property, ok := resultError.Details()["property"].(string); ok {
+				path = append(path, property)
+			}
+		case "number_one_of", "number_any_of", "number_all_of":
+			// nested errors describe the violation
+			continue
+		}
+
+		line, column := yamlNodePosition(doc.Content, path)
+		validationErrors = append(validationErrors, &ValidationError{
+			Document: docIndex,
+			Line:     doc.Line + line + 1,
+			Column:   column + 1,
+			Field:    strings.Join(path, "."),
+			Message:  resultError.Description(),
+		})
+	}
+
+	sort.SliceStable(validationErrors, func(i, j int) bool {
+		if validationErrors[i].Line == validationErrors[j].Line {
+			return validationErrors[i].Column < validationErrors[j].Column
+		}
+
+		return validationErrors[i].Line < validationErrors[j].Line
+	})
+
+	return validationErrors, schemaDefinition == metaSchemaDefinition, nil
+}
+
+func newYamlValidationError(docIndex int, doc *doc, err error) *ValidationError {
+	validationError := &ValidationError{
+		Document: docIndex,
+		Line:     doc.Line + 1,
+		Message:  err.Error(),
+	}
+
+	reg := regexp.MustCompile("line ([0-9]+)")
+	if res := reg.FindStringSubmatch(err.Error()); len(res) == 2 {
+		if line, err := strconv.Atoi(res[1]); err == nil {
+			validationError.Line = doc.Line + line
+		}
+	}
+
+	return validationError
+}
+
+// yamlNodePosition returns zero-based line and column of the node addressed by the path within block-style YAML content.
+// For mapping keys the key position is returned, for sequence items — the item content position.
+// The position of the deepest resolved node is returned when the path cannot be resolved completely (e.g. flow-style collections).
+func yamlNodePosition(content []byte, path []string) (int, int) {
+	lines := strings.Split(string(content), "\n")
+
+	line, column, ok := firstYamlNodePosition(lines, 0)
+	if !ok {
+		return 0, 0
+	}
+
+	for ind, segment := range path {
+		var keyLine, keyColumn, valueLine, valueColumn int
+		var found bool
+		if index, err := strconv.Atoi(segment); err == nil {
+			valueLine, valueColumn, found = yamlSequenceItemPosition(lines, line, column, index)
+			keyLine, keyColumn = valueLine, valueColumn
+		} else {
+			keyLine, keyColumn, valueLine, valueColumn, found = yamlMappingKeyPosition(lines, line, column, segment)
+		}
+
+		if !found {
+			break
+		}
+
+		if ind == len(path)-1 {
+			return keyLine, keyColumn
+		}
+
+		line, column = valueLine, valueColumn
+	}
+
+	return line, column
+}
+
+func yamlMappingKeyPosition(lines []string, line, column int, key string) (int, int, int, int, bool) {
+	for ind := line; ind < len(lines); ind++ {
+		text, ok := yamlNodeLineText(lines, line, column, ind)
+		if !ok {
+			break
+		} else if text == "" {
+			continue
+		}
+
+		name, rest, isKey := splitYamlKey(text)
+		if !isKey || name != key {
+			continue
+		}
+
+		if value := strings.TrimLeft(rest, " "); value != "" && !strings.HasPrefix(value, "#") {
+			return ind, column, ind, column + len(text) - len(value), true
+		}
+
+		valueLine, valueColumn, ok := firstYamlNodePosition(lines, ind+1)
+		if !ok || valueColumn < column || (valueColumn == column && !isYamlSequenceItem(lines[valueLine][valueColumn:])) {
+			return ind, column, ind, column, true
+		}
+
+		return ind, column, valueLine, valueColumn, true
+	}
+
+	return 0, 0, 0, 0, false
+}
+
+func yamlSequenceItemPosition(lines []string, line, column, index int) (int, int, bool) {
+	var itemIndex int
+	for ind := line; ind < len(lines); ind++ {
+		text, ok := yamlNodeLineText(lines, line, column, ind)
+		if !ok {
+			break
+		} else if text == "" {
+			continue
+		}
+
+		if !isYamlSequenceItem(text) {
+			break
+		}
+
+		if itemIndex == index {
+			if value := strings.TrimLeft(text[1:], " "); value != "" && !strings.HasPrefix(value, "#") {
+				return ind, column + len(text) - len(value), true
+			}
+
+			valueLine, valueColumn, ok := firstYamlNodePosition(lines, ind+1)
+			if ok && valueColumn > column {
+				return valueLine, valueColumn, true
+			}
+
+			return ind, column, true
+		}
+
+		itemIndex++
+	}
+
+	return 0, 0, false
+}
+
+// yamlNodeLineText returns the part of the line that belongs to the node, which starts at the nodeLine and nodeColumn.
+// Empty text is returned for the lines that should be skipped and false when the node ends.
+func yamlNodeLineText(lines []string, nodeLine, nodeColumn, ind int) (string, bool) {
+	l := lines[ind]
+
+	if ind == nodeLine {
+		if nodeColumn > len(l) {
+			return "", false
+		}
+
+		return l[nodeColumn:], true
+	}
+
+	if isBlankYamlLine(l) {
+		return "", true
+	}
+
+	indent := yamlLineIndent(l)
+	if indent < nodeColumn {
+		return "", false
+	} else if indent > nodeColumn {
+		return "", true
+	}
+
+	return l[indent:], true
+}
+
+func splitYamlKey(text string) (string, string, bool) {
+	if isYamlSequenceItem(text) {
+		return "", "", false
+	}
+
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+		quote := text[:1]
+		end := strings.Index(text[1:], quote)
+		if end == -1 {
+			return "", "", false
+		}
+
+		rest := text[end+2:]
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", false
+		}
+
+		return text[1 : end+1], rest[1:], true
+	}
+
+	for ind := 0; ind < len(text); ind++ {
+		if text[ind] != ':' {
+			continue
+		}
+
+		if ind+1 == len(text) || text[ind+1] == ' ' {
+			return strings.TrimSpace(text[:ind]), text[ind+1:], true
+		}
+	}
+
+	return "", "", false
+}
+
+func firstYamlNodePosition(lines []string, from int) (int, int, bool) {
+	for ind := from; ind < len(lines); ind++ {
+		if !isBlankYamlLine(lines[ind]) {
+			return ind, yamlLineIndent(lines[ind]), true
+		}
+	}
+
+	return 0, 0, false
+}
+
+func isYamlSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func isBlankYamlLine(l string) bool {
+	trimmed := strings.TrimSpace(l)
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
+
+func yamlLineIndent(l string) int {
+	return len(l) - len(strings.TrimLeft(l, " "))
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+const yamlNodePositionContent = `image: app
+from: alpine
+git:
+- add: /
+  to: /app
+  excludePaths:
+  - vendor
+  - node_modules
+- url: https://github.com/company/name.git
+  add: /src
+mount:
+  - from: tmp_dir
+    to: /tmp
+docker:
+  ENV:
+    "QUOTED": value
+`
+
+type yamlNodePositionEntry struct {
+	path           []string
+	expectedLine   int
+	expectedColumn int
+}
+
+var _ = DescribeTable("yaml node position", func(e yamlNodePositionEntry) {
+	line, column := yamlNodePosition([]byte(yamlNodePositionContent), e.path)
+	Ω(line).Should(Equal(e.expectedLine))
+	Ω(column).Should(Equal(e.expectedColumn))
+},
+	Entry("root", yamlNodePositionEntry{nil, 0, 0}),
+	Entry("top level key", yamlNodePositionEntry{[]string{"from"}, 1, 0}),
+	Entry("first key of sequence item", yamlNodePositionEntry{[]string{"git", "0", "add"}, 3, 2}),
+	Entry("key of sequence item", yamlNodePositionEntry{[]string{"git", "0", "to"}, 4, 2}),
+	Entry("nested sequence item", yamlNodePositionEntry{[]string{"git", "0", "excludePaths", "1"}, 7, 4}),
+	Entry("key of second sequence item", yamlNodePositionEntry{[]string{"git", "1", "add"}, 9, 2}),
+	Entry("indented sequence", yamlNodePositionEntry{[]string{"mount", "0", "to"}, 12, 4}),
+	Entry("quoted key", yamlNodePositionEntry{[]string{"docker", "ENV", "QUOTED"}, 15, 4}),
+	Entry("unknown key", yamlNodePositionEntry{[]string{"git", "0", "unknown"}, 3, 2}),
+	Entry("out of range sequence item", yamlNodePositionEntry{[]string{"git", "5"}, 3, 0}),
+)
+
+var _ = Describe("config section validation", func() {
+	It("reports schema violations with document, line and column", func() {
+		content := `image: app
+from: alpine
+git:
+- add: /
+  unknown: true
+mount:
+- from: unknown_dir
+  to: /tmp
+`
+
+		validationErrors, isMeta, err := validateDoc(2, &doc{Content: []byte(content), Line: 4})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(isMeta).Should(BeFalse())
+		Ω(validationErrors).Should(HaveLen(2))
+
+		Ω(validationErrors[0].Document).Should(Equal(2))
+		Ω(validationErrors[0].Line).Should(Equal(9))
+		Ω(validationErrors[0].Column).Should(Equal(3))
+		Ω(validationErrors[0].Field).Should(Equal("git.0.unknown"))
+
+		Ω(validationErrors[1].Line).Should(Equal(11))
+		Ω(validationErrors[1].Column).Should(Equal(3))
+		Ω(validationErrors[1].Field).Should(Equal("mount.0.from"))
+	})
+
+	It("accepts valid meta config section", func() {
+		validationErrors, isMeta, err := validateDoc(1, &doc{Content: []byte("configVersion: 1\nproject: name\n")})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(isMeta).Should(BeTrue())
+		Ω(validationErrors).Should(BeEmpty())
+	})
+})
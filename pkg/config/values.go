@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/helm/pkg/strvals"
+
+	"github.com/flant/werf/pkg/util"
+)
+
+const DefaultWerfConfigValuesPath = ".werf/values.yaml"
+
+type WerfConfigOptions struct {
+	LogRenderedFilePath bool
+
+	// ValuesPaths are YAML files with values for werf.yaml templates, applied after the default .werf/values.yaml
+	ValuesPaths []string
+	// SetValues are key=value pairs (the same format as helm --set), applied after all values files
+	SetValues []string
+}
+
+type configValues struct {
+	Values map[string]interface{}
+
+	usedPaths  []string
+	setKeys    []string
+	projectDir string
+}
+
+func readConfigValues(projectDir string, opts WerfConfigOptions) (*configValues, error) {
+	values := &configValues{Values: map[string]interface{}{}, projectDir: projectDir}
+
+	defaultValuesPath := filepath.Join(projectDir, DefaultWerfConfigValuesPath)
+	if exist, err := util.FileExists(defaultValuesPath); err != nil {
+		return nil, err
+	} else if exist {
+		if err := values.mergeFile(defaultValuesPath); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, valuesPath := range opts.ValuesPaths {
+		if !filepath.IsAbs(valuesPath) {
+			valuesPath = filepath.Join(projectDir, valuesPath)
+		}
+
+		if err := values.mergeFile(valuesPath); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, value := range opts.SetValues {
+		if err := strvals.ParseInto(value, values.Values); err != nil {
+			return nil, fmt.Errorf("failed parsing --config-set data: %s", err)
+		}
+
+		setValues, err := strvals.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing --config-set data: %s", err)
+		}
+
+		values.setKeys = append(values.setKeys, valuesKeys(setValues, "")...)
+	}
+
+	return values, nil
+}
+
+func (v *configValues) mergeFile(valuesPath string) error {
+	data, err := ioutil.ReadFile(valuesPath)
+	if err != nil {
+		return fmt.Errorf("unable to read werf config values file %s: %s", valuesPath, err)
+	}
+
+	fileValues := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &fileValues); err != nil {
+		return fmt.Errorf("failed to parse %s: %s", valuesPath, err)
+	}
+
+	v.Values = mergeValues(v.Values, fileValues)
+	v.usedPaths = append(v.usedPaths, valuesPath)
+
+	return nil
+}
+
+// logLines describes values sources without values themselves, which may be sensitive
+func (v *configValues) logLines() []string {
+	var lines []string
+	for _, p := range v.usedPaths {
+		if rel, err := filepath.Rel(v.projectDir, p); err == nil && !strings.HasPrefix(rel, "..") {
+			p = rel
+		}
+
+		lines = append(lines, fmt.Sprintf("Using werf config values file: %s", p))
+	}
+
+	if len(v.setKeys) != 0 {
+		lines = append(lines, fmt.Sprintf("Using werf config values set: %s", strings.Join(v.setKeys, ", ")))
+	}
+
+	return lines
+}
+
+func valuesKeys(values map[string]interface{}, prefix string) []string {
+	var keys []string
+	for k, v := range values {
+		if nestedValues, ok := v.(map[string]interface{}); ok {
+			keys = append(keys, valuesKeys(nestedValues, prefix+k+".")...)
+		} else {
+			keys = append(keys, prefix+k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Merges source and destination map, preferring values from the source map
+func mergeValues(dest map[string]interface{}, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		if _, exists := dest[k]; !exists {
+			dest[k] = v
+			continue
+		}
+
+		nextMap, ok := v.(map[string]interface{})
+		if !ok {
+			dest[k] = v
+			continue
+		}
+
+		destMap, isMap := dest[k].(map[string]interface{})
+		if !isMap {
+			dest[k] = v
+			continue
+		}
+
+		dest[k] = mergeValues(destMap, nextMap)
+	}
+
+	return dest
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("werf config values", func() {
+	var projectDir string
+
+	BeforeEach(func() {
+		var err error
+		projectDir, err = ioutil.TempDir("", "werf-config-values-")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(os.MkdirAll(filepath.Join(projectDir, ".werf"), os.ModePerm)).Should(Succeed())
+		Ω(ioutil.WriteFile(filepath.Join(projectDir, DefaultWerfConfigValuesPath), []byte("image:\n  from: alpine\n  tag: dev\nmode: dev\n"), 0644)).Should(Succeed())
+		Ω(ioutil.WriteFile(filepath.Join(projectDir, "production.yaml"), []byte("image:\n  tag: production\n"), 0644)).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		Ω(os.RemoveAll(projectDir)).Should(Succeed())
+	})
+
+	It("merges default values, values files and set values in order", func() {
+		values, err := readConfigValues(projectDir, WerfConfigOptions{
+			ValuesPaths: []string{"production.yaml"},
+			SetValues:   []string{"mode=production,image.from=ubuntu"},
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(values.Values).Should(Equal(map[string]interface{}{
+			"image": map[string]interface{}{"from": "ubuntu", "tag": "production"},
+			"mode":  "production",
+		}))
+		Ω(values.logLines()).Should(Equal([]string{
+			"Using werf config values file: .werf/values.yaml",
+			"Using werf config values file: production.yaml",
+			"Using werf config values set: image.from, mode",
+		}))
+	})
+})
@@ -0,0 +1,303 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/flant/kubedog/pkg/kube"
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/config"
+	"github.com/flant/werf/pkg/deploy/helm"
+	"github.com/flant/werf/pkg/deploy/status_stream"
+	"github.com/flant/werf/pkg/deploy/werf_chart"
+	"github.com/flant/werf/pkg/tag_strategy"
+	"github.com/flant/werf/pkg/util/secretvalues"
+)
+
+type DeployCluster struct {
+	Name      string
+	Release   string
+	Namespace string
+	// Values are added to the values of the chart when the release is deployed into the cluster
+	Values []string
+	// Init switches helm and kubedog to the cluster
+	Init func() error
+}
+
+type ClustersDeployOptions struct {
+	DeployOptions
+	// StopOnFirstFailure stops deploy on the first failed cluster and rolls the already deployed clusters and the failed one back
+	StopOnFirstFailure bool
+}
+
+// ClusterRevision is the latest successfully deployed release revision in the cluster before the deploy
+type ClusterRevision struct {
+	Cluster       *DeployCluster
+	ReleaseExists bool
+	// Revision is zero if the release exists but has not been deployed successfully
+	Revision int32
+}
+
+// ClustersWerfChart is the chart prepared once for all clusters: the secret values are decoded and the service values are made for the namespace of each cluster
+type ClustersWerfChart struct {
+	WerfChart *werf_chart.WerfChart `json:"werfChart"`
+	// ServiceValues are the service values by the cluster name
+	ServiceValues map[string]map[string]interface{} `json:"serviceValues"`
+}
+
+// DeployClusters deploys the release into the clusters one by one, the chart with the values and the decoded secrets is prepared only once
+func DeployClusters(projectDir string, imagesRepoManager ImagesRepoManager, tag string, tagStrategy tag_strategy.TagStrategy, werfConfig *config.WerfConfig, helmReleaseStorageNamespace, helmReleaseStorageType string, clusters []*DeployCluster, opts ClustersDeployOptions) error {
+	clustersWerfChart, err := PrepareClustersWerfChart(projectDir, imagesRepoManager, tag, tagStrategy, werfConfig, helmReleaseStorageNamespace, helmReleaseStorageType, clusters, opts)
+	if err != nil {
+		return err
+	}
+
+	return DeployClustersWithWerfChart(clustersWerfChart, clusters, opts)
+}
+
+// PrepareClustersWerfChart makes the chart for DeployClustersWithWerfChart
+func PrepareClustersWerfChart(projectDir string, imagesRepoManager ImagesRepoManager, tag string, tagStrategy tag_strategy.TagStrategy, werfConfig *config.WerfConfig, helmReleaseStorageNamespace, helmReleaseStorageType string, clusters []*DeployCluster, opts ClustersDeployOptions) (*ClustersWerfChart, error) {
+	var logBlockErr error
+	clustersWerfChart := &ClustersWerfChart{ServiceValues: map[string]map[string]interface{}{}}
+
+	chartOptions := deployWerfChartOptions{
+		SecretValues:         opts.SecretValues,
+		Env:                  opts.Env,
+		UserExtraAnnotations: opts.UserExtraAnnotations,
+		UserExtraLabels:      opts.UserExtraLabels,
+		IgnoreSecretKey:      opts.IgnoreSecretKey,
+		ImagesTags:           opts.ImagesTags,
+	}
+
+	logboek.LogBlock("Deploy options", logboek.LogBlockOptions{}, func() {
+		for _, cluster := range clusters {
+			logboek.LogF("Using cluster %s: helm release %s, Kubernetes namespace %s\n", cluster.Name, cluster.Release, cluster.Namespace)
+		}
+		logboek.LogF("Using helm release storage namespace: %s\n", helmReleaseStorageNamespace)
+		logboek.LogF("Using helm release storage type: %s\n", helmReleaseStorageType)
+		if opts.PostRenderer != "" {
+			logboek.LogF("Using post-renderer: %s\n", opts.PostRenderer)
+		}
+
+		clustersWerfChart.WerfChart, logBlockErr = prepareDeployWerfChartWithServiceValues(projectDir, werfConfig, nil, chartOptions)
+		if logBlockErr != nil {
+			return
+		}
+
+		// the service values depend on the namespace, thus they are made for each cluster
+		for _, cluster := range clusters {
+			serviceValues, err := getDeployServiceValues(imagesRepoManager, cluster.Namespace, tag, tagStrategy, werfConfig, chartOptions)
+			if err != nil {
+				logBlockErr = fmt.Errorf("cluster %s: %s", cluster.Name, err)
+				return
+			}
+
+			clustersWerfChart.ServiceValues[cluster.Name] = serviceValues
+		}
+	})
+	logboek.LogOptionalLn()
+
+	if logBlockErr != nil {
+		return nil, logBlockErr
+	}
+
+	return clustersWerfChart, nil
+}
+
+// WriteClustersWerfChart saves the chart to be deployed by another werf process, the file contains the decoded secrets and is readable only by the owner
+func WriteClustersWerfChart(path string, clustersWerfChart *ClustersWerfChart) error {
+	data, err := json.Marshal(clustersWerfChart)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+func ReadClustersWerfChart(path string) (*ClustersWerfChart, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var clustersWerfChart *ClustersWerfChart
+	if err := json.Unmarshal(data, &clustersWerfChart); err != nil {
+		return nil, fmt.Errorf("bad clusters chart %s: %s", path, err)
+	}
+
+	return clustersWerfChart, nil
+}
+
+// DeployClustersWithWerfChart deploys the release into the clusters one by one like DeployClusters does with the already prepared chart
+func DeployClustersWithWerfChart(clustersWerfChart *ClustersWerfChart, clusters []*DeployCluster, opts ClustersDeployOptions) error {
+	werfChart := clustersWerfChart.WerfChart
+
+	helm.SetReleaseLogSecretValuesToMask(werfChart.SecretValuesToMask)
+	status_stream.SetSecretValuesToMask(werfChart.SecretValuesToMask)
+
+	helm.WerfTemplateEngine.InitWerfEngineExtraTemplatesFunctions(werfChart.DecodedSecretFilesData)
+	patchLoadChartfile(werfChart.Name)
+
+	return deployClustersOneByOne(clusters, opts.StopOnFirstFailure, opts.Atomic, func(cluster *DeployCluster) (ClusterRevision, error) {
+		var revision ClusterRevision
+		err := logboek.LogProcess(fmt.Sprintf("Deploying to cluster %s", cluster.Name), logboek.LogProcessOptions{}, func() error {
+			serviceValues, ok := clustersWerfChart.ServiceValues[cluster.Name]
+			if !ok {
+				return fmt.Errorf("service values of cluster %s are not prepared", cluster.Name)
+			}
+
+			var err error
+			if revision, err = initCluster(cluster); err != nil {
+				return err
+			}
+
+			if err := werfChart.SetServiceValues(serviceValues); err != nil {
+				return err
+			}
+
+			return status_stream.WithPhase(status_stream.DeployPhase, func() error {
+				return deployWerfChart(werfChart, cluster.Release, cluster.Namespace, helm.ChartValuesOptions{
+					Set:       opts.Set,
+					SetString: opts.SetString,
+					Values:    append(append([]string{}, opts.Values...), cluster.Values...),
+				}, opts.DeployOptions)
+			})
+		})
+		logboek.LogOptionalLn()
+
+		return revision, err
+	}, func(clusterRevisions []ClusterRevision) error {
+		if err := RollbackClusters(clusterRevisions, opts.Timeout); err != nil {
+			return fmt.Errorf("%s", secretvalues.MaskSecretValuesInString(werfChart.SecretValuesToMask, err.Error()))
+		}
+
+		return nil
+	})
+}
+
+// deployClustersOneByOne deploys the clusters in order. On the first failure with stopOnFirstFailure the rest clusters are not deployed,
+// the deployed clusters and the failed one are rolled back. The revision of the failed cluster is empty if the cluster was not initialized
+func deployClustersOneByOne(clusters []*DeployCluster, stopOnFirstFailure, atomic bool, deployCluster func(cluster *DeployCluster) (ClusterRevision, error), rollback func(clusterRevisions []ClusterRevision) error) error {
+	var deployedClusters []ClusterRevision
+	var failedClusters []string
+	for _, cluster := range clusters {
+		revision, err := deployCluster(cluster)
+		if err == nil {
+			deployedClusters = append(deployedClusters, revision)
+			continue
+		}
+
+		failedClusters = append(failedClusters, fmt.Sprintf("cluster %s: %s", cluster.Name, err))
+
+		if stopOnFirstFailure {
+			// the failed release is rolled back by deploy itself in the atomic mode
+			if revision.Cluster != nil && !atomic {
+				deployedClusters = append(deployedClusters, revision)
+			}
+
+			if rollbackErr := rollback(deployedClusters); rollbackErr != nil {
+				return fmt.Errorf("deploy to cluster %s failed: %s\n%s", cluster.Name, err, rollbackErr)
+			}
+
+			return fmt.Errorf("deploy to cluster %s failed: %s", cluster.Name, err)
+		}
+	}
+
+	if len(failedClusters) != 0 {
+		return fmt.Errorf("deploy failed to %d of %d clusters:\n%s", len(failedClusters), len(clusters), strings.Join(failedClusters, "\n"))
+	}
+
+	return nil
+}
+
+// GetClustersRevisions initializes each cluster and gets the latest successfully deployed revision of the cluster release
+func GetClustersRevisions(clusters []*DeployCluster) ([]ClusterRevision, error) {
+	var res []ClusterRevision
+	for _, cluster := range clusters {
+		revision, err := initCluster(cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, revision)
+	}
+
+	return res, nil
+}
+
+// RollbackClusters rolls the releases back to the recorded revisions in the reverse order, the releases which did not exist are purged
+func RollbackClusters(clusterRevisions []ClusterRevision, timeout time.Duration) error {
+	var errors []string
+	for ind := len(clusterRevisions) - 1; ind >= 0; ind-- {
+		cluster := clusterRevisions[ind].Cluster
+		revision := clusterRevisions[ind].Revision
+
+		var logProcessMsg string
+		switch {
+		case !clusterRevisions[ind].ReleaseExists:
+			logProcessMsg = fmt.Sprintf("Purging release %s in cluster %s", cluster.Release, cluster.Name)
+		case revision == 0:
+			errors = append(errors, fmt.Sprintf("release %s in cluster %s has not been rolled back: successfully deployed release revision was not found", cluster.Release, cluster.Name))
+			continue
+		default:
+			logProcessMsg = fmt.Sprintf("Rolling back release %s in cluster %s to revision %d", cluster.Release, cluster.Name, revision)
+		}
+
+		err := logboek.LogProcess(logProcessMsg, logboek.LogProcessOptions{}, func() error {
+			if err := cluster.Init(); err != nil {
+				return err
+			}
+			status_stream.SetCluster(cluster.Name)
+			status_stream.SetRelease(cluster.Release, cluster.Namespace)
+
+			if !clusterRevisions[ind].ReleaseExists {
+				return helm.PurgeHelmRelease(cluster.Release, cluster.Namespace, false, true)
+			}
+
+			return helm.RollbackHelmRelease(cluster.Release, cluster.Namespace, revision, helm.ChartOptions{Timeout: timeout})
+		})
+		logboek.LogOptionalLn()
+
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("rollback of cluster %s failed: %s", cluster.Name, err))
+		}
+	}
+
+	if len(errors) != 0 {
+		return fmt.Errorf("%s", strings.Join(errors, "\n"))
+	}
+
+	return nil
+}
+
+func initCluster(cluster *DeployCluster) (ClusterRevision, error) {
+	res := ClusterRevision{Cluster: cluster, ReleaseExists: true}
+
+	if err := cluster.Init(); err != nil {
+		return ClusterRevision{}, fmt.Errorf("cannot init cluster %s: %s", cluster.Name, err)
+	}
+
+	status_stream.SetCluster(cluster.Name)
+	status_stream.SetRelease(cluster.Release, cluster.Namespace)
+
+	if kube.Context != "" {
+		logboek.LogF("Using kube context: %s\n", kube.Context)
+	}
+
+	revision, err := helm.LatestSuccessfullyDeployedReleaseRevision(cluster.Release)
+	switch err {
+	case nil:
+		res.Revision = revision
+	case helm.ErrReleaseNotFound:
+		res.ReleaseExists = false
+	case helm.ErrNoSuccessfullyDeployedReleaseRevisionFound:
+	default:
+		return ClusterRevision{}, err
+	}
+
+	return res, nil
+}
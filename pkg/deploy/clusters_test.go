@@ -0,0 +1,169 @@
+package deploy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flant/werf/pkg/deploy/werf_chart"
+)
+
+func TestDeployClustersOneByOne(t *testing.T) {
+	tests := []struct {
+		name               string
+		failedClusters     []string
+		uninitialized      []string
+		stopOnFirstFailure bool
+		atomic             bool
+		rollbackErr        error
+
+		deployed    []string
+		rolledBack  []string
+		expectedErr string
+	}{
+		{
+			name:     "allSucceeded",
+			deployed: []string{"eu", "us", "asia"},
+		},
+		{
+			name:           "allMustSucceedDeploysTheRestClusters",
+			failedClusters: []string{"us"},
+			deployed:       []string{"eu", "us", "asia"},
+			expectedErr:    "deploy failed to 1 of 3 clusters:\ncluster us: failed",
+		},
+		{
+			name:               "stopOnFirstFailureRollsBackDeployedAndFailedClusters",
+			failedClusters:     []string{"us"},
+			stopOnFirstFailure: true,
+			deployed:           []string{"eu", "us"},
+			rolledBack:         []string{"eu", "us"},
+			expectedErr:        "deploy to cluster us failed: failed",
+		},
+		{
+			name:               "failedReleaseIsRolledBackByAtomicDeploy",
+			failedClusters:     []string{"us"},
+			stopOnFirstFailure: true,
+			atomic:             true,
+			deployed:           []string{"eu", "us"},
+			rolledBack:         []string{"eu"},
+			expectedErr:        "deploy to cluster us failed: failed",
+		},
+		{
+			name:               "uninitializedClusterIsNotRolledBack",
+			failedClusters:     []string{"us"},
+			uninitialized:      []string{"us"},
+			stopOnFirstFailure: true,
+			deployed:           []string{"eu", "us"},
+			rolledBack:         []string{"eu"},
+			expectedErr:        "deploy to cluster us failed: failed",
+		},
+		{
+			name:               "rollbackError",
+			failedClusters:     []string{"eu"},
+			stopOnFirstFailure: true,
+			rollbackErr:        errors.New("rollback of cluster eu failed: timeout"),
+			deployed:           []string{"eu"},
+			rolledBack:         []string{"eu"},
+			expectedErr:        "deploy to cluster eu failed: failed\nrollback of cluster eu failed: timeout",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clusters := []*DeployCluster{{Name: "eu"}, {Name: "us"}, {Name: "asia"}}
+
+			var deployed, rolledBack []string
+			var rollbackCalls int
+			err := deployClustersOneByOne(clusters, test.stopOnFirstFailure, test.atomic, func(cluster *DeployCluster) (ClusterRevision, error) {
+				deployed = append(deployed, cluster.Name)
+
+				revision := ClusterRevision{Cluster: cluster, ReleaseExists: true, Revision: 1}
+				for _, name := range test.uninitialized {
+					if name == cluster.Name {
+						revision = ClusterRevision{}
+					}
+				}
+
+				for _, name := range test.failedClusters {
+					if name == cluster.Name {
+						return revision, errors.New("failed")
+					}
+				}
+
+				return revision, nil
+			}, func(clusterRevisions []ClusterRevision) error {
+				rollbackCalls++
+				for _, revision := range clusterRevisions {
+					rolledBack = append(rolledBack, revision.Cluster.Name)
+				}
+
+				return test.rollbackErr
+			})
+
+			if test.expectedErr == "" && err != nil {
+				t.Fatal(err)
+			} else if test.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), test.expectedErr)) {
+				t.Errorf("\n[EXPECTED ERROR]: %s\n[GOT]: %v", test.expectedErr, err)
+			}
+
+			if !reflect.DeepEqual(test.deployed, deployed) {
+				t.Errorf("\n[EXPECTED DEPLOYED]: %v\n[GOT]: %v", test.deployed, deployed)
+			}
+
+			if !reflect.DeepEqual(test.rolledBack, rolledBack) {
+				t.Errorf("\n[EXPECTED ROLLED BACK]: %v\n[GOT]: %v", test.rolledBack, rolledBack)
+			}
+
+			if expectedCalls := map[bool]int{true: 1, false: 0}[test.stopOnFirstFailure && len(test.failedClusters) != 0]; rollbackCalls != expectedCalls {
+				t.Errorf("expected %d rollback calls, got %d", expectedCalls, rollbackCalls)
+			}
+		})
+	}
+}
+
+func TestClustersWerfChart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "werf-clusters-chart-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clustersWerfChart := &ClustersWerfChart{
+		WerfChart: &werf_chart.WerfChart{
+			Name:                   "myproject",
+			ChartDir:               "/project/.helm",
+			SecretValues:           []map[string]interface{}{{"db": map[string]interface{}{"password": "s3cr3t"}}},
+			ExtraAnnotations:       map[string]string{"project.werf.io/name": "myproject"},
+			DecodedSecretFilesData: map[string]string{"tls.key": "key"},
+			SecretValuesToMask:     []string{"s3cr3t", "key"},
+		},
+		ServiceValues: map[string]map[string]interface{}{
+			"eu": {"global": map[string]interface{}{"namespace": "myproject-eu", "werf": map[string]interface{}{"is_nameless_image": false}}},
+			"us": {"global": map[string]interface{}{"namespace": "myproject-us", "werf": map[string]interface{}{"is_nameless_image": false}}},
+		},
+	}
+
+	path := filepath.Join(dir, "clusters-werf-chart.json")
+	if err := WriteClustersWerfChart(path, clustersWerfChart); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("the file with decoded secrets must be readable only by the owner, got mode %s", info.Mode())
+	}
+
+	res, err := ReadClustersWerfChart(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(clustersWerfChart, res) {
+		t.Errorf("\n[EXPECTED]: %#v\n[GOT]: %#v", clustersWerfChart, res)
+	}
+}
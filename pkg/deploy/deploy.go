@@ -17,6 +17,7 @@ import (
 
 	"github.com/flant/werf/pkg/config"
 	"github.com/flant/werf/pkg/deploy/helm"
+	"github.com/flant/werf/pkg/deploy/status_stream"
 	"github.com/flant/werf/pkg/deploy/werf_chart"
 	"github.com/flant/werf/pkg/tag_strategy"
 )
@@ -32,6 +33,14 @@ type DeployOptions struct {
 	UserExtraLabels      map[string]string
 	IgnoreSecretKey      bool
 	ThreeWayMergeMode    helm.ThreeWayMergeModeType
+	// ImagesTags overrides tag for the particular images (stages-signature tagging strategy)
+	ImagesTags map[string]string
+	// Diff prints the changes of the release resources before deploy
+	Diff bool
+	// Atomic rolls the release back to the latest successfully deployed revision (or purges the new release) when deploy fails
+	Atomic bool
+	// PostRenderer is the executable which modifies the rendered manifests before they are stored in the release and applied
+	PostRenderer string
 }
 
 type ImagesRepoManager interface {
@@ -41,6 +50,13 @@ type ImagesRepoManager interface {
 }
 
 func Deploy(projectDir string, imagesRepoManager ImagesRepoManager, release, namespace, tag string, tagStrategy tag_strategy.TagStrategy, werfConfig *config.WerfConfig, helmReleaseStorageNamespace, helmReleaseStorageType string, opts DeployOptions) error {
+	status_stream.SetRelease(release, namespace)
+	return status_stream.WithPhase(status_stream.DeployPhase, func() error {
+		return runDeploy(projectDir, imagesRepoManager, release, namespace, tag, tagStrategy, werfConfig, helmReleaseStorageNamespace, helmReleaseStorageType, opts)
+	})
+}
+
+func runDeploy(projectDir string, imagesRepoManager ImagesRepoManager, release, namespace, tag string, tagStrategy tag_strategy.TagStrategy, werfConfig *config.WerfConfig, helmReleaseStorageNamespace, helmReleaseStorageType string, opts DeployOptions) error {
 	var logBlockErr error
 	var werfChart *werf_chart.WerfChart
 
@@ -52,38 +68,18 @@ func Deploy(projectDir string, imagesRepoManager ImagesRepoManager, release, nam
 		logboek.LogF("Using helm release storage type: %s\n", helmReleaseStorageType)
 		logboek.LogF("Using helm release name: %s\n", release)
 		logboek.LogF("Using Kubernetes namespace: %s\n", namespace)
-
-		images := GetImagesInfoGetters(werfConfig.StapelImages, werfConfig.ImagesFromDockerfile, imagesRepoManager, tag, false)
-
-		m, err := GetSafeSecretManager(projectDir, opts.SecretValues, opts.IgnoreSecretKey)
-		if err != nil {
-			logBlockErr = err
-			return
-		}
-
-		serviceValues, err := GetServiceValues(werfConfig.Meta.Project, imagesRepoManager, namespace, tag, tagStrategy, images, ServiceValuesOptions{Env: opts.Env})
-		if err != nil {
-			logBlockErr = fmt.Errorf("error creating service values: %s", err)
-			return
-		}
-
-		serviceValuesRaw, _ := yaml.Marshal(serviceValues)
-		logboek.LogLn()
-		logboek.LogLn("Using service values:")
-		logboek.LogLn(logboek.FitText(string(serviceValuesRaw), logboek.FitTextOptions{ExtraIndentWidth: 2}))
-
-		projectChartDir := filepath.Join(projectDir, werf_chart.ProjectHelmChartDirName)
-		werfChart, err = PrepareWerfChart(werfConfig.Meta.Project, projectChartDir, opts.Env, m, opts.SecretValues, serviceValues)
-		if err != nil {
-			logBlockErr = err
-			return
+		if opts.PostRenderer != "" {
+			logboek.LogF("Using post-renderer: %s\n", opts.PostRenderer)
 		}
-		helm.SetReleaseLogSecretValuesToMask(werfChart.SecretValuesToMask)
 
-		werfChart.MergeExtraAnnotations(opts.UserExtraAnnotations)
-		werfChart.MergeExtraLabels(opts.UserExtraLabels)
-		werfChart.LogExtraAnnotations()
-		werfChart.LogExtraLabels()
+		werfChart, logBlockErr = prepareDeployWerfChart(projectDir, imagesRepoManager, namespace, tag, tagStrategy, werfConfig, deployWerfChartOptions{
+			SecretValues:         opts.SecretValues,
+			Env:                  opts.Env,
+			UserExtraAnnotations: opts.UserExtraAnnotations,
+			UserExtraLabels:      opts.UserExtraLabels,
+			IgnoreSecretKey:      opts.IgnoreSecretKey,
+			ImagesTags:           opts.ImagesTags,
+		})
 	})
 	logboek.LogOptionalLn()
 
@@ -91,18 +87,38 @@ func Deploy(projectDir string, imagesRepoManager ImagesRepoManager, release, nam
 		return logBlockErr
 	}
 
+	status_stream.SetSecretValuesToMask(werfChart.SecretValuesToMask)
+
 	helm.WerfTemplateEngine.InitWerfEngineExtraTemplatesFunctions(werfChart.DecodedSecretFilesData)
 	patchLoadChartfile(werfChart.Name)
 
-	err := helm.WerfTemplateEngineWithExtraAnnotationsAndLabels(werfChart.ExtraAnnotations, werfChart.ExtraLabels, func() error {
+	return deployWerfChart(werfChart, release, namespace, helm.ChartValuesOptions{
+		Set:       opts.Set,
+		SetString: opts.SetString,
+		Values:    opts.Values,
+	}, opts)
+}
+
+// deployWerfChart deploys the prepared chart with the values into the current cluster, the returned error is masked
+func deployWerfChart(werfChart *werf_chart.WerfChart, release, namespace string, valuesOptions helm.ChartValuesOptions, opts DeployOptions) error {
+	err := withWerfTemplateEngine(werfChart, opts.PostRenderer, func() error {
+		if opts.Diff {
+			var diffErr error
+			logboek.LogBlock("Release diff", logboek.LogBlockOptions{}, func() {
+				_, diffErr = werfChart.Diff(logboek.GetOutStream(), release, namespace, valuesOptions)
+			})
+			logboek.LogOptionalLn()
+
+			if diffErr != nil {
+				return diffErr
+			}
+		}
+
 		return werfChart.Deploy(release, namespace, helm.ChartOptions{
-			Timeout: opts.Timeout,
-			ChartValuesOptions: helm.ChartValuesOptions{
-				Set:       opts.Set,
-				SetString: opts.SetString,
-				Values:    opts.Values,
-			},
-			ThreeWayMergeMode: opts.ThreeWayMergeMode,
+			Timeout:            opts.Timeout,
+			ChartValuesOptions: valuesOptions,
+			ThreeWayMergeMode:  opts.ThreeWayMergeMode,
+			Atomic:             opts.Atomic,
 		})
 	})
 
@@ -113,6 +129,71 @@ func Deploy(projectDir string, imagesRepoManager ImagesRepoManager, release, nam
 	return nil
 }
 
+// withWerfTemplateEngine sets up the chart extra annotations and labels and the post-renderer for the templates rendered by f
+func withWerfTemplateEngine(werfChart *werf_chart.WerfChart, postRenderer string, f func() error) error {
+	return helm.WerfTemplateEngineWithPostRenderer(postRenderer, func() error {
+		return helm.WerfTemplateEngineWithExtraAnnotationsAndLabels(werfChart.ExtraAnnotations, werfChart.ExtraLabels, f)
+	})
+}
+
+type deployWerfChartOptions struct {
+	SecretValues         []string
+	Env                  string
+	UserExtraAnnotations map[string]string
+	UserExtraLabels      map[string]string
+	IgnoreSecretKey      bool
+	ImagesTags           map[string]string
+}
+
+// prepareDeployWerfChart makes the chart with the service values, secret values, extra annotations and labels, which are used by deploy and diff
+func prepareDeployWerfChart(projectDir string, imagesRepoManager ImagesRepoManager, namespace, tag string, tagStrategy tag_strategy.TagStrategy, werfConfig *config.WerfConfig, opts deployWerfChartOptions) (*werf_chart.WerfChart, error) {
+	serviceValues, err := getDeployServiceValues(imagesRepoManager, namespace, tag, tagStrategy, werfConfig, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return prepareDeployWerfChartWithServiceValues(projectDir, werfConfig, serviceValues, opts)
+}
+
+// getDeployServiceValues makes the service values for the release namespace
+func getDeployServiceValues(imagesRepoManager ImagesRepoManager, namespace, tag string, tagStrategy tag_strategy.TagStrategy, werfConfig *config.WerfConfig, opts deployWerfChartOptions) (map[string]interface{}, error) {
+	images := GetImagesInfoGetters(werfConfig.StapelImages, werfConfig.ImagesFromDockerfile, imagesRepoManager, tag, opts.ImagesTags, false)
+
+	serviceValues, err := GetServiceValues(werfConfig.Meta.Project, imagesRepoManager, namespace, tag, tagStrategy, images, ServiceValuesOptions{Env: opts.Env})
+	if err != nil {
+		return nil, fmt.Errorf("error creating service values: %s", err)
+	}
+
+	serviceValuesRaw, _ := yaml.Marshal(serviceValues)
+	logboek.LogLn()
+	logboek.LogLn("Using service values:")
+	logboek.LogLn(logboek.FitText(string(serviceValuesRaw), logboek.FitTextOptions{ExtraIndentWidth: 2}))
+
+	return serviceValues, nil
+}
+
+// prepareDeployWerfChartWithServiceValues makes the chart like prepareDeployWerfChart does, the service values can be nil and set later with WerfChart.SetServiceValues
+func prepareDeployWerfChartWithServiceValues(projectDir string, werfConfig *config.WerfConfig, serviceValues map[string]interface{}, opts deployWerfChartOptions) (*werf_chart.WerfChart, error) {
+	m, err := GetSafeSecretManager(projectDir, opts.SecretValues, opts.IgnoreSecretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	projectChartDir := filepath.Join(projectDir, werf_chart.ProjectHelmChartDirName)
+	werfChart, err := PrepareWerfChart(werfConfig.Meta.Project, projectChartDir, opts.Env, m, opts.SecretValues, serviceValues)
+	if err != nil {
+		return nil, err
+	}
+	helm.SetReleaseLogSecretValuesToMask(werfChart.SecretValuesToMask)
+
+	werfChart.MergeExtraAnnotations(opts.UserExtraAnnotations)
+	werfChart.MergeExtraLabels(opts.UserExtraLabels)
+	werfChart.LogExtraAnnotations()
+	werfChart.LogExtraLabels()
+
+	return werfChart, nil
+}
+
 func patchLoadChartfile(chartName string) {
 	boundedFunc := helm.LoadChartfileFunc
 	helm.LoadChartfileFunc = func(chartPath string) (*chart.Chart, error) {
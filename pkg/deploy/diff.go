@@ -0,0 +1,81 @@
+package deploy
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/flant/kubedog/pkg/kube"
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/config"
+	"github.com/flant/werf/pkg/deploy/helm"
+	"github.com/flant/werf/pkg/deploy/werf_chart"
+	"github.com/flant/werf/pkg/tag_strategy"
+	"github.com/flant/werf/pkg/util/secretvalues"
+)
+
+type DiffOptions struct {
+	Values               []string
+	SecretValues         []string
+	Set                  []string
+	SetString            []string
+	Env                  string
+	UserExtraAnnotations map[string]string
+	UserExtraLabels      map[string]string
+	IgnoreSecretKey      bool
+	// ImagesTags overrides tag for the particular images (stages-signature tagging strategy)
+	ImagesTags   map[string]string
+	PostRenderer string
+}
+
+// Diff prints the changes of the release resources, which deploy with the same options would make, returns true if there are changes
+func Diff(out io.Writer, projectDir string, imagesRepoManager ImagesRepoManager, release, namespace, tag string, tagStrategy tag_strategy.TagStrategy, werfConfig *config.WerfConfig, opts DiffOptions) (bool, error) {
+	var logBlockErr error
+	var werfChart *werf_chart.WerfChart
+
+	logboek.LogBlock("Diff options", logboek.LogBlockOptions{}, func() {
+		if kube.Context != "" {
+			logboek.LogF("Using kube context: %s\n", kube.Context)
+		}
+		logboek.LogF("Using helm release name: %s\n", release)
+		logboek.LogF("Using Kubernetes namespace: %s\n", namespace)
+		if opts.PostRenderer != "" {
+			logboek.LogF("Using post-renderer: %s\n", opts.PostRenderer)
+		}
+
+		werfChart, logBlockErr = prepareDeployWerfChart(projectDir, imagesRepoManager, namespace, tag, tagStrategy, werfConfig, deployWerfChartOptions{
+			SecretValues:         opts.SecretValues,
+			Env:                  opts.Env,
+			UserExtraAnnotations: opts.UserExtraAnnotations,
+			UserExtraLabels:      opts.UserExtraLabels,
+			IgnoreSecretKey:      opts.IgnoreSecretKey,
+			ImagesTags:           opts.ImagesTags,
+		})
+	})
+	logboek.LogOptionalLn()
+
+	if logBlockErr != nil {
+		return false, logBlockErr
+	}
+
+	helm.WerfTemplateEngine.InitWerfEngineExtraTemplatesFunctions(werfChart.DecodedSecretFilesData)
+	patchLoadChartfile(werfChart.Name)
+
+	var changed bool
+	err := withWerfTemplateEngine(werfChart, opts.PostRenderer, func() error {
+		var err error
+		changed, err = werfChart.Diff(out, release, namespace, helm.ChartValuesOptions{
+			Set:       opts.Set,
+			SetString: opts.SetString,
+			Values:    opts.Values,
+		})
+
+		return err
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("%s", secretvalues.MaskSecretValuesInString(werfChart.SecretValuesToMask, err.Error()))
+	}
+
+	return changed, nil
+}
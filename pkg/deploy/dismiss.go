@@ -3,6 +3,7 @@ package deploy
 import (
 	"github.com/flant/logboek"
 	"github.com/flant/werf/pkg/deploy/helm"
+	"github.com/flant/werf/pkg/deploy/status_stream"
 )
 
 type DismissOptions struct {
@@ -16,9 +17,13 @@ func RunDismiss(releaseName, namespace, _ string, opts DismissOptions) error {
 		logboek.LogF("Namespace: %s\n", namespace)
 	}
 
+	status_stream.SetRelease(releaseName, namespace)
+
 	logboek.LogLn()
 	logProcessOptions := logboek.LogProcessOptions{ColorizeMsgFunc: logboek.ColorizeHighlight}
 	return logboek.LogProcess("Running dismiss", logProcessOptions, func() error {
-		return helm.PurgeHelmRelease(releaseName, namespace, opts.WithNamespace, opts.WithHooks)
+		return status_stream.WithPhase(status_stream.DismissPhase, func() error {
+			return helm.PurgeHelmRelease(releaseName, namespace, opts.WithNamespace, opts.WithHooks)
+		})
 	})
 }
@@ -0,0 +1,509 @@
+package helm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/ghodss/yaml"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/helm/pkg/releaseutil"
+
+	"github.com/flant/kubedog/pkg/kube"
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/util"
+	"github.com/flant/werf/pkg/util/secretvalues"
+)
+
+const (
+	diffContextLines = 3
+
+	resourcePolicyAnnoName = "helm.sh/resource-policy"
+)
+
+type DiffOptions struct {
+	SecretValuesToMask []string
+}
+
+type diffResourceKey struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (k diffResourceKey) String() string {
+	if k.Namespace == "" {
+		return fmt.Sprintf("%s/%s", k.Kind, k.Name)
+	}
+
+	return fmt.Sprintf("%s/%s (namespace %s)", k.Kind, k.Name, k.Namespace)
+}
+
+type diffResource struct {
+	key       diffResourceKey
+	groupKind schema.GroupKind
+	rendered  map[string]interface{}
+	released  map[string]interface{}
+}
+
+// Diff renders the chart and prints the unified diff of each release resource, which deploy would create, delete or modify.
+// The current state of the resource is the live object restricted to the fields of the last release and rendered manifests,
+// thus the fields set by Kubernetes are not reported, while manual changes of the fields managed by the chart are.
+// Hooks are compared with the last release manifest.
+// Values of the Secret data and secret values are masked. Returns true if there are changes
+func Diff(out io.Writer, chartPath, releaseName, namespace string, values []string, secretValues []map[string]interface{}, set, setString []string, opts DiffOptions) (bool, error) {
+	rawRenderedTemplates, err := getRawTemplatesFromChart(chartPath, releaseName, namespace, values, secretValues, set, setString)
+	if err != nil {
+		return false, err
+	}
+
+	renderedResources, err := parseDiffResources(rawRenderedTemplates, namespace)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse chart templates: %s", err)
+	}
+
+	var releasedResources []diffResource
+	resp, err := releaseContent(releaseName, releaseContentOptions{})
+	if err != nil && !isReleaseNotFoundError(err) {
+		return false, fmt.Errorf("get release failed: %s", err)
+	} else if err == nil {
+		rawReleasedTemplates, err := getRawTemplatesFromRevision(releaseName, resp.Release.Version)
+		if err != nil {
+			return false, err
+		}
+
+		releasedResources, err = parseDiffResources(rawReleasedTemplates, namespace)
+		if err != nil {
+			return false, fmt.Errorf("unable to parse release templates: %s", err)
+		}
+	}
+
+	resources := renderedResources
+	for _, releasedResource := range releasedResources {
+		found := false
+		for ind := range resources {
+			if resources[ind].key == releasedResource.key {
+				resources[ind].released = releasedResource.rendered
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			resources = append(resources, diffResource{key: releasedResource.key, groupKind: releasedResource.groupKind, released: releasedResource.rendered})
+		}
+	}
+
+	apiResources, err := diffAPIResources()
+	if err != nil {
+		return false, err
+	}
+
+	var created, modified, deleted int
+	for _, resource := range resources {
+		if isKeptDiffResource(resource) {
+			continue
+		}
+
+		var live map[string]interface{}
+		if isHookResource(resource.rendered) {
+			// hooks are recreated by each deploy, thus they are compared with the last release manifest
+			live = resource.released
+		} else {
+			var err error
+			if live, err = liveDiffResource(resource, apiResources); err != nil {
+				return false, err
+			}
+		}
+
+		var current, desired interface{}
+		var action string
+		switch {
+		case resource.rendered == nil && live == nil:
+			continue
+		case resource.rendered == nil:
+			current = pruneByManifest(live, resource.released)
+			action = "deleted"
+		case live == nil:
+			desired = resource.rendered
+			action = "created"
+		default:
+			current = pruneByManifest(live, mergeManifests(resource.released, resource.rendered))
+			desired = resource.rendered
+			action = "modified"
+		}
+
+		if resource.key.Kind == "Secret" {
+			current, desired = maskSecretData(current, desired)
+		}
+
+		currentLines, err := diffManifestLines(current)
+		if err != nil {
+			return false, err
+		}
+
+		desiredLines, err := diffManifestLines(desired)
+		if err != nil {
+			return false, err
+		}
+
+		hunks := util.UnifiedDiff(currentLines, desiredLines, diffContextLines)
+		if len(hunks) == 0 {
+			continue
+		}
+
+		switch action {
+		case "created":
+			created++
+		case "deleted":
+			deleted++
+		default:
+			modified++
+		}
+
+		displayKey := resource.key
+		if apiResource, ok := apiResources[resource.groupKind]; ok && !apiResource.namespaced {
+			displayKey.Namespace = ""
+		}
+
+		fmt.Fprintln(out, logboek.ColorizeHighlight(fmt.Sprintf("%s will be %s", displayKey, action)))
+		for _, line := range hunks {
+			line = secretvalues.MaskSecretValuesInString(opts.SecretValuesToMask, line)
+
+			switch line[0] {
+			case '@':
+				line = color.New(color.FgCyan).Sprint(line)
+			case '-':
+				line = color.New(color.FgRed).Sprint(line)
+			case '+':
+				line = color.New(color.FgGreen).Sprint(line)
+			}
+
+			fmt.Fprintln(out, line)
+		}
+		fmt.Fprintln(out)
+	}
+
+	if created+modified+deleted == 0 {
+		fmt.Fprintf(out, "Release %s has no changes\n", releaseName)
+		return false, nil
+	}
+
+	fmt.Fprintf(out, "Release %s: %d to create, %d to modify, %d to delete\n", releaseName, created, modified, deleted)
+
+	return true, nil
+}
+
+func parseDiffResources(rawTemplates, namespace string) ([]diffResource, error) {
+	manifests := releaseutil.SplitManifests(rawTemplates)
+
+	var resources []diffResource
+	for ind := 0; ind < len(manifests); ind++ {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(manifests[fmt.Sprintf("manifest-%d", ind)]), &obj); err != nil {
+			return nil, err
+		}
+
+		obj, _ = dropNullValues(obj).(map[string]interface{})
+
+		kind, _ := obj["kind"].(string)
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		if kind == "" || name == "" {
+			continue
+		}
+
+		if kind == "Secret" {
+			mergeSecretStringData(obj)
+		}
+
+		resourceNamespace, _ := metadata["namespace"].(string)
+		if resourceNamespace == "" {
+			resourceNamespace = namespace
+		}
+
+		apiVersion, _ := obj["apiVersion"].(string)
+		gv, err := schema.ParseGroupVersion(apiVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, diffResource{
+			key:       diffResourceKey{Kind: kind, Namespace: resourceNamespace, Name: name},
+			groupKind: gv.WithKind(kind).GroupKind(),
+			rendered:  obj,
+		})
+	}
+
+	return resources, nil
+}
+
+// mergeSecretStringData moves the Secret stringData entries into data encoded as the API server does,
+// thus the manifest is compared with the live object, which does not have stringData
+func mergeSecretStringData(obj map[string]interface{}) {
+	stringData, ok := obj["stringData"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	delete(obj, "stringData")
+
+	data, _ := obj["data"].(map[string]interface{})
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	for key, value := range stringData {
+		data[key] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%v", value)))
+	}
+
+	obj["data"] = data
+}
+
+// isKeptDiffResource returns true for the resource removed from the chart, which deploy does not delete: the hook or the resource with keep resource policy
+func isKeptDiffResource(resource diffResource) bool {
+	return resource.rendered == nil && (isHookResource(resource.released) || resourceAnnotation(resource.released, resourcePolicyAnnoName) == "keep")
+}
+
+func isHookResource(obj map[string]interface{}) bool {
+	return resourceAnnotation(obj, HelmHookAnnoName) != ""
+}
+
+func resourceAnnotation(obj map[string]interface{}, name string) string {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	value, _ := annotations[name].(string)
+	return value
+}
+
+type diffAPIResource struct {
+	groupVersionResource schema.GroupVersionResource
+	namespaced           bool
+}
+
+// diffAPIResources returns the preferred resources of the cluster, the groups that failed discovery are skipped
+func diffAPIResources() (map[schema.GroupKind]diffAPIResource, error) {
+	lists, err := kube.Kubernetes.Discovery().ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, fmt.Errorf("unable to discover cluster resources: %s", err)
+	}
+
+	apiResources := map[schema.GroupKind]diffAPIResource{}
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+
+		for _, resource := range list.APIResources {
+			if strings.Contains(resource.Name, "/") {
+				continue
+			}
+
+			apiResources[gv.WithKind(resource.Kind).GroupKind()] = diffAPIResource{
+				groupVersionResource: gv.WithResource(resource.Name),
+				namespaced:           resource.Namespaced,
+			}
+		}
+	}
+
+	return apiResources, nil
+}
+
+// liveDiffResource returns nil if the object does not exist or its kind is not served by the cluster yet (e.g. the CRD is a part of the release)
+func liveDiffResource(resource diffResource, apiResources map[schema.GroupKind]diffAPIResource) (map[string]interface{}, error) {
+	apiResource, ok := apiResources[resource.groupKind]
+	if !ok {
+		return nil, nil
+	}
+
+	key := resource.key
+
+	res := kube.DynamicClient.Resource(apiResource.groupVersionResource)
+
+	var obj map[string]interface{}
+	if apiResource.namespaced {
+		u, err := res.Namespace(key.Namespace).Get(key.Name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+
+			return nil, fmt.Errorf("unable to get %s: %s", key, err)
+		}
+
+		obj = u.Object
+	} else {
+		u, err := res.Get(key.Name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+
+			return nil, fmt.Errorf("unable to get %s: %s", key, err)
+		}
+
+		obj = u.Object
+	}
+
+	return obj, nil
+}
+
+// pruneByManifest leaves the fields of the live object, which are set in the manifest
+func pruneByManifest(live, manifest interface{}) interface{} {
+	switch m := manifest.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+
+		result := map[string]interface{}{}
+		for key, value := range m {
+			if liveValue, ok := l[key]; ok {
+				result[key] = pruneByManifest(liveValue, value)
+			}
+		}
+
+		return result
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			return live
+		}
+
+		result := make([]interface{}, len(l))
+		for ind := range l {
+			if ind < len(m) {
+				result[ind] = pruneByManifest(l[ind], m[ind])
+			} else {
+				result[ind] = l[ind]
+			}
+		}
+
+		return result
+	default:
+		return live
+	}
+}
+
+// mergeManifests returns the manifest with the fields of both manifests, the values of b are preferred
+func mergeManifests(a, b interface{}) interface{} {
+	switch bValue := b.(type) {
+	case map[string]interface{}:
+		aValue, ok := a.(map[string]interface{})
+		if !ok {
+			return b
+		}
+
+		result := map[string]interface{}{}
+		for key, value := range aValue {
+			result[key] = value
+		}
+
+		for key, value := range bValue {
+			result[key] = mergeManifests(aValue[key], value)
+		}
+
+		return result
+	case []interface{}:
+		aValue, ok := a.([]interface{})
+		if !ok {
+			return b
+		}
+
+		result := make([]interface{}, 0, len(aValue)+len(bValue))
+		for ind := 0; ind < len(aValue) || ind < len(bValue); ind++ {
+			switch {
+			case ind >= len(bValue):
+				result = append(result, aValue[ind])
+			case ind >= len(aValue):
+				result = append(result, bValue[ind])
+			default:
+				result = append(result, mergeManifests(aValue[ind], bValue[ind]))
+			}
+		}
+
+		return result
+	case nil:
+		return a
+	default:
+		return b
+	}
+}
+
+func dropNullValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := map[string]interface{}{}
+		for key, value := range v {
+			if value != nil {
+				result[key] = dropNullValues(value)
+			}
+		}
+
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for ind, value := range v {
+			result[ind] = dropNullValues(value)
+		}
+
+		return result
+	default:
+		return value
+	}
+}
+
+// maskSecretData hides the Secret data values, the changed values are marked in the desired object.
+// The stringData of the manifests is merged into data while parsing
+func maskSecretData(current, desired interface{}) (interface{}, interface{}) {
+	currentObj, _ := current.(map[string]interface{})
+	desiredObj, _ := desired.(map[string]interface{})
+
+	currentData, _ := currentObj["data"].(map[string]interface{})
+	desiredData, _ := desiredObj["data"].(map[string]interface{})
+
+	maskedCurrentData := map[string]interface{}{}
+	for key := range currentData {
+		maskedCurrentData[key] = "***"
+	}
+
+	maskedDesiredData := map[string]interface{}{}
+	for key, value := range desiredData {
+		if currentValue, ok := currentData[key]; ok && fmt.Sprintf("%v", currentValue) != fmt.Sprintf("%v", value) {
+			maskedDesiredData[key] = "*** (changed)"
+		} else {
+			maskedDesiredData[key] = "***"
+		}
+	}
+
+	if currentData != nil {
+		currentObj["data"] = maskedCurrentData
+	}
+
+	if desiredData != nil {
+		desiredObj["data"] = maskedDesiredData
+	}
+
+	return current, desired
+}
+
+func diffManifestLines(obj interface{}) ([]string, error) {
+	if obj == nil {
+		return nil, nil
+	}
+
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
@@ -0,0 +1,243 @@
+package helm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+func parseTestManifest(t *testing.T, manifest string) interface{} {
+	if manifest == "" {
+		return nil
+	}
+
+	var obj interface{}
+	if err := yaml.Unmarshal([]byte(manifest), &obj); err != nil {
+		t.Fatal(err)
+	}
+
+	return obj
+}
+
+func TestPruneByManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		live     string
+		manifest string
+		result   string
+	}{
+		{
+			name:     "fieldsSetByKubernetesAreDropped",
+			live:     "metadata:\n  name: app\n  uid: 1a2b\n  resourceVersion: \"42\"\nspec:\n  replicas: 2\nstatus:\n  readyReplicas: 2",
+			manifest: "metadata:\n  name: app\nspec:\n  replicas: 1",
+			result:   "metadata:\n  name: app\nspec:\n  replicas: 2",
+		},
+		{
+			name:     "fieldsMissingInLiveAreNotAdded",
+			live:     "spec:\n  replicas: 1",
+			manifest: "spec:\n  replicas: 1\n  paused: true",
+			result:   "spec:\n  replicas: 1",
+		},
+		{
+			name:     "listItemsArePrunedByIndex",
+			live:     "containers:\n- name: app\n  image: app:v2\n  terminationMessagePath: /dev/termination-log\n- name: sidecar\n  image: sidecar",
+			manifest: "containers:\n- name: app\n  image: app:v1",
+			result:   "containers:\n- name: app\n  image: app:v2\n- name: sidecar\n  image: sidecar",
+		},
+		{
+			name:     "changedTypeIsKept",
+			live:     "data: value",
+			manifest: "data:\n  key: value",
+			result:   "data: value",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := pruneByManifest(parseTestManifest(t, test.live), parseTestManifest(t, test.manifest))
+			if expected := parseTestManifest(t, test.result); !reflect.DeepEqual(expected, result) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, result)
+			}
+		})
+	}
+}
+
+func TestMergeManifests(t *testing.T) {
+	tests := []struct {
+		name   string
+		a      string
+		b      string
+		result string
+	}{
+		{
+			name:   "fieldsOfBothManifests",
+			a:      "metadata:\n  name: app\n  labels:\n    old: \"true\"",
+			b:      "metadata:\n  name: app\n  annotations:\n    new: \"true\"",
+			result: "metadata:\n  name: app\n  labels:\n    old: \"true\"\n  annotations:\n    new: \"true\"",
+		},
+		{
+			name:   "valuesOfSecondManifestArePreferred",
+			a:      "spec:\n  replicas: 1\n  paused: true",
+			b:      "spec:\n  replicas: 3",
+			result: "spec:\n  replicas: 3\n  paused: true",
+		},
+		{
+			name:   "listsAreMergedByIndex",
+			a:      "ports:\n- port: 80\n  name: http\n- port: 443",
+			b:      "ports:\n- port: 8080",
+			result: "ports:\n- port: 8080\n  name: http\n- port: 443",
+		},
+		{
+			name:   "emptyFirstManifest",
+			b:      "spec:\n  replicas: 3",
+			result: "spec:\n  replicas: 3",
+		},
+		{
+			name:   "emptySecondManifest",
+			a:      "spec:\n  replicas: 3",
+			result: "spec:\n  replicas: 3",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := mergeManifests(parseTestManifest(t, test.a), parseTestManifest(t, test.b))
+			if expected := parseTestManifest(t, test.result); !reflect.DeepEqual(expected, result) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, result)
+			}
+		})
+	}
+}
+
+func TestMaskSecretData(t *testing.T) {
+	tests := []struct {
+		name            string
+		current         string
+		desired         string
+		expectedCurrent string
+		expectedDesired string
+	}{
+		{
+			name:            "changedValueIsMarked",
+			current:         "data:\n  password: c2VjcmV0\n  user: YWRtaW4=",
+			desired:         "data:\n  password: bmV3LXNlY3JldA==\n  user: YWRtaW4=",
+			expectedCurrent: "data:\n  password: \"***\"\n  user: \"***\"",
+			expectedDesired: "data:\n  password: \"*** (changed)\"\n  user: \"***\"",
+		},
+		{
+			name:            "createdSecret",
+			desired:         "data:\n  password: c2VjcmV0",
+			expectedDesired: "data:\n  password: \"***\"",
+		},
+		{
+			name:            "deletedSecret",
+			current:         "data:\n  password: c2VjcmV0",
+			expectedCurrent: "data:\n  password: \"***\"",
+		},
+		{
+			name:            "addedAndRemovedKeys",
+			current:         "data:\n  old: c2VjcmV0",
+			desired:         "data:\n  new: c2VjcmV0",
+			expectedCurrent: "data:\n  old: \"***\"",
+			expectedDesired: "data:\n  new: \"***\"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current, desired := maskSecretData(parseTestManifest(t, test.current), parseTestManifest(t, test.desired))
+
+			if expected := parseTestManifest(t, test.expectedCurrent); !reflect.DeepEqual(expected, current) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, current)
+			}
+
+			if expected := parseTestManifest(t, test.expectedDesired); !reflect.DeepEqual(expected, desired) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, desired)
+			}
+
+			for _, obj := range []interface{}{current, desired} {
+				lines, err := diffManifestLines(obj)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, value := range []string{"c2VjcmV0", "bmV3LXNlY3JldA==", "YWRtaW4="} {
+					if output := strings.Join(lines, "\n"); strings.Contains(output, value) {
+						t.Errorf("secret value %s is printed:\n%s", value, output)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseDiffResources(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		keys     []string
+		kept     []bool
+		data     map[string]interface{}
+	}{
+		{
+			name: "resourcesWithDefaultNamespace",
+			manifest: joinManifests([]string{
+				"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app",
+				"apiVersion: v1\nkind: Service\nmetadata:\n  name: app\n  namespace: other",
+				"# empty document",
+			}),
+			keys: []string{"Deployment/app (namespace ns)", "Service/app (namespace other)"},
+			kept: []bool{false, false},
+		},
+		{
+			name: "deletedHookAndResourceWithKeepPolicyAreKept",
+			manifest: joinManifests([]string{
+				"apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n  annotations:\n    helm.sh/hook: pre-upgrade",
+				"apiVersion: v1\nkind: PersistentVolumeClaim\nmetadata:\n  name: data\n  annotations:\n    helm.sh/resource-policy: keep",
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config",
+			}),
+			keys: []string{"Job/migrate (namespace ns)", "PersistentVolumeClaim/data (namespace ns)", "ConfigMap/config (namespace ns)"},
+			kept: []bool{true, true, false},
+		},
+		{
+			name:     "secretStringDataIsMergedIntoData",
+			manifest: joinManifests([]string{"apiVersion: v1\nkind: Secret\nmetadata:\n  name: app\ndata:\n  user: b2xk\n  token: dG9rZW4=\nstringData:\n  user: admin\n  password: secret"}),
+			keys:     []string{"Secret/app (namespace ns)"},
+			kept:     []bool{false},
+			data:     map[string]interface{}{"user": "YWRtaW4=", "password": "c2VjcmV0", "token": "dG9rZW4="},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resources, err := parseDiffResources(test.manifest, "ns")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var keys []string
+			var kept []bool
+			for _, resource := range resources {
+				keys = append(keys, resource.key.String())
+				// the resource is removed from the chart
+				kept = append(kept, isKeptDiffResource(diffResource{key: resource.key, released: resource.rendered}))
+			}
+
+			if !reflect.DeepEqual(test.keys, keys) || !reflect.DeepEqual(test.kept, kept) {
+				t.Errorf("\n[EXPECTED]: %v %v\n[GOT]: %v %v", test.keys, test.kept, keys, kept)
+			}
+
+			if test.data != nil {
+				if _, ok := resources[0].rendered["stringData"]; ok {
+					t.Errorf("stringData is not merged")
+				}
+
+				if data := resources[0].rendered["data"]; !reflect.DeepEqual(test.data, data) {
+					t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", test.data, data)
+				}
+			}
+		})
+	}
+}
@@ -82,6 +82,15 @@ func templatesRules(linter *support.Linter, chartPath, namespace string, values
 			linter.RunLinterRule(support.WarningSev, "templates/", err)
 		}
 
+		if _, exist := template.Metadata.Annotations[WeightAnnoName]; exist {
+			if _, isHook := template.Metadata.Annotations[HelmHookAnnoName]; isHook {
+				err := fmt.Errorf("%s/%s annotation %s is ignored for helm hooks, use helm.sh/hook-weight annotation instead", kind, metadataName, WeightAnnoName)
+				linter.RunLinterRule(support.WarningSev, "templates/", err)
+			} else if _, err := resourceWeight(template); err != nil {
+				linter.RunLinterRule(support.ErrorSev, "templates/", err)
+			}
+		}
+
 	templateAnnotationsLoop:
 		for annoName := range template.Metadata.Annotations {
 			if strings.HasPrefix(annoName, "werf.io/") {
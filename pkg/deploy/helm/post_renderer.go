@@ -0,0 +1,70 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+// PostRenderedTemplateFileName is the chart file which contains all manifests returned by the post-renderer
+const PostRenderedTemplateFileName = "post-rendered.yaml"
+
+// postRender pipes the rendered manifests through the post-renderer executable.
+// The post-renderer returns all manifests at once, so the manifests are not associated with the chart templates anymore
+// and are stored in the single PostRenderedTemplateFileName file. Partials and NOTES.txt are not passed to the post-renderer.
+// The empty output is an error unless there are no manifests to post-render
+func (e *WerfEngine) postRender(chrt *chart.Chart, templates map[string]string) (map[string]string, error) {
+	var fileNames []string
+	for fileName, fileContent := range templates {
+		if strings.TrimSpace(fileContent) == "" || strings.HasPrefix(path.Base(fileName), "_") || strings.HasSuffix(fileName, "/NOTES.txt") {
+			continue
+		}
+
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	var manifests []string
+	for _, fileName := range fileNames {
+		manifests = append(manifests, templates[fileName])
+		delete(templates, fileName)
+	}
+
+	postRenderedManifests, err := runPostRenderer(e.PostRenderer, joinManifests(manifests))
+	if err != nil {
+		return nil, err
+	}
+
+	// the empty output would delete all release resources, which is most likely the post-renderer failure
+	if len(manifests) != 0 && strings.TrimSpace(postRenderedManifests) == "" {
+		return nil, fmt.Errorf("post-renderer %s returned empty output", e.PostRenderer)
+	}
+
+	templates[path.Join(chrt.Metadata.Name, "templates", PostRenderedTemplateFileName)] = postRenderedManifests
+
+	return templates, nil
+}
+
+func runPostRenderer(postRenderer, manifests string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(postRenderer)
+	cmd.Stdin = bytes.NewBufferString(manifests)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() != 0 {
+			return "", fmt.Errorf("post-renderer %s failed: %s\n%s", postRenderer, err, strings.TrimRight(stderr.String(), "\n"))
+		}
+
+		return "", fmt.Errorf("post-renderer %s failed: %s", postRenderer, err)
+	}
+
+	return stdout.String(), nil
+}
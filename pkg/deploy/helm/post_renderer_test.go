@@ -0,0 +1,123 @@
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+func writePostRendererScript(t *testing.T, dir, name, script string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestPostRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "werf-post-renderer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inputPath := filepath.Join(dir, "input.yaml")
+
+	templates := func() map[string]string {
+		return map[string]string{
+			"mychart/templates/deployment.yaml": "kind: Deployment\nmetadata:\n  name: app",
+			"mychart/templates/service.yaml":    "kind: Service\nmetadata:\n  name: app",
+			"mychart/templates/_helpers.tpl":    "helpers",
+			"mychart/templates/NOTES.txt":       "notes",
+			"mychart/templates/empty.yaml":      "\n",
+		}
+	}
+
+	tests := []struct {
+		name        string
+		script      string
+		templates   map[string]string
+		input       string
+		result      map[string]string
+		expectedErr []string
+	}{
+		{
+			name:      "outputReplacesTemplates",
+			script:    "cat > " + inputPath + "\necho 'kind: ConfigMap'",
+			templates: templates(),
+			input:     "---\nkind: Deployment\nmetadata:\n  name: app\n---\nkind: Service\nmetadata:\n  name: app\n",
+			result: map[string]string{
+				"mychart/templates/_helpers.tpl":       "helpers",
+				"mychart/templates/NOTES.txt":          "notes",
+				"mychart/templates/empty.yaml":         "\n",
+				"mychart/templates/post-rendered.yaml": "kind: ConfigMap\n",
+			},
+		},
+		{
+			name:        "nonZeroExitWithStderr",
+			script:      "cat > /dev/null\necho 'bad manifest' >&2\nexit 3",
+			templates:   templates(),
+			expectedErr: []string{"failed: exit status 3", "bad manifest"},
+		},
+		{
+			name:        "emptyOutput",
+			script:      "cat > /dev/null",
+			templates:   templates(),
+			expectedErr: []string{"returned empty output"},
+		},
+		{
+			name:      "emptyOutputWithoutManifests",
+			script:    "cat > " + inputPath,
+			templates: map[string]string{"mychart/templates/NOTES.txt": "notes"},
+			input:     "",
+			result: map[string]string{
+				"mychart/templates/NOTES.txt":          "notes",
+				"mychart/templates/post-rendered.yaml": "",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_ = os.Remove(inputPath)
+
+			e := &WerfEngine{PostRenderer: writePostRendererScript(t, dir, test.name, test.script)}
+			result, err := e.postRender(&chart.Chart{Metadata: &chart.Metadata{Name: "mychart"}}, test.templates)
+
+			if len(test.expectedErr) != 0 {
+				if err == nil {
+					t.Fatalf("expected error, got result %v", result)
+				}
+
+				for _, expectedErr := range test.expectedErr {
+					if !strings.Contains(err.Error(), expectedErr) {
+						t.Errorf("\n[EXPECTED ERROR]: %s\n[GOT]: %s", expectedErr, err)
+					}
+				}
+
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			input, err := ioutil.ReadFile(inputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(input) != test.input {
+				t.Errorf("\n[EXPECTED INPUT]: %q\n[GOT]: %q", test.input, string(input))
+			}
+
+			if !reflect.DeepEqual(test.result, result) {
+				t.Errorf("\n[EXPECTED]: %q\n[GOT]: %q", test.result, result)
+			}
+		})
+	}
+}
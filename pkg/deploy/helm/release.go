@@ -16,6 +16,7 @@ import (
 	"github.com/flant/kubedog/pkg/kube"
 	"github.com/flant/logboek"
 	"github.com/flant/shluz"
+	"github.com/flant/werf/pkg/deploy/status_stream"
 	"github.com/flant/werf/pkg/util"
 	"github.com/flant/werf/pkg/werf"
 )
@@ -38,6 +39,8 @@ const (
 
 	RecreateAnnoName = "werf.io/recreate"
 
+	WeightAnnoName = "werf.io/weight"
+
 	HelmHookAnnoName = "helm.sh/hook"
 )
 
@@ -53,6 +56,7 @@ var (
 		ShowLogsUntilAnnoName,
 		ShowEventsAnnoName,
 		RecreateAnnoName,
+		WeightAnnoName,
 		helm_kube.SetReplicasOnlyOnCreationAnnotation,
 		helm_kube.SetResourcesOnlyOnCreationAnnotation,
 	}
@@ -170,6 +174,8 @@ type ChartOptions struct {
 	DryRun            bool
 	Debug             bool
 	ThreeWayMergeMode ThreeWayMergeModeType
+	// Atomic rolls the release back to the latest successfully deployed revision (or purges the release after the failed install) when deploy fails
+	Atomic bool
 
 	ChartValuesOptions
 }
@@ -284,7 +290,9 @@ func doDeployHelmChart(chartPath, releaseName, namespace string, opts ChartOptio
 
 		if releaseShouldBeDeleted {
 			if err := logboek.LogProcess("Deleting release", logboek.LogProcessOptions{}, func() error {
-				return releaseDelete(releaseName, releaseDeleteOptions{Purge: true})
+				return status_stream.WithPhase(status_stream.PurgePhase, func() error {
+					return releaseDelete(releaseName, releaseDeleteOptions{Purge: true})
+				})
 			}); err != nil {
 				return fmt.Errorf("release delete failed: %s", err)
 			}
@@ -319,7 +327,7 @@ func doDeployHelmChart(chartPath, releaseName, namespace string, opts ChartOptio
 					},
 				}
 				if err := logboek.LogProcess("Getting the latest successfully deployed release revision", logProcessOptions, func() error {
-					latestSuccessfullyDeployedRevision, latestSuccessfullyDeployedReleaseRevisionErr = latestSuccessfullyDeployedReleaseRevision(releaseName)
+					latestSuccessfullyDeployedRevision, latestSuccessfullyDeployedReleaseRevisionErr = LatestSuccessfullyDeployedReleaseRevision(releaseName)
 					if latestSuccessfullyDeployedReleaseRevisionErr != nil && latestSuccessfullyDeployedReleaseRevisionErr != ErrNoSuccessfullyDeployedReleaseRevisionFound {
 						return latestSuccessfullyDeployedReleaseRevisionErr
 					}
@@ -335,48 +343,7 @@ func doDeployHelmChart(chartPath, releaseName, namespace string, opts ChartOptio
 					isRollbackAttempt = true
 				}
 
-				var templatesFromRevision ChartTemplates
-				logProcessMsg := fmt.Sprintf("Getting templates from release revision %d", latestSuccessfullyDeployedRevision)
-				if err := logboek.LogProcessInline(logProcessMsg, logboek.LogProcessInlineOptions{}, func() error {
-					templatesFromRevision, latestSuccessfullyDeployedReleaseRevisionErr = GetTemplatesFromReleaseRevision(releaseName, latestSuccessfullyDeployedRevision)
-					return latestSuccessfullyDeployedReleaseRevisionErr
-				}); err != nil {
-					return fmt.Errorf("get templates from release revision failed: %s", err)
-				}
-
-				rollbackFunc := func() error {
-					releaseRollbackOpts := ReleaseRollbackOptions{
-						releaseRollbackOptions: releaseRollbackOptions{
-							Timeout:       int64(opts.Timeout / time.Second),
-							CleanupOnFail: true,
-							DryRun:        opts.DryRun,
-						},
-					}
-
-					var err error
-					for i := 0; i < 5; i++ {
-						logboek.LogF("Running helm rollback (%d try)...\n", i+1)
-
-						err = ReleaseRollback(
-							releaseName,
-							latestSuccessfullyDeployedRevision,
-							opts.ThreeWayMergeMode,
-							releaseRollbackOpts,
-						)
-
-						if err == nil {
-							return nil
-						}
-					}
-
-					if err != nil {
-						return fmt.Errorf("release rollback to revision %d failed: %s", latestSuccessfullyDeployedRevision, err)
-					}
-
-					panic("unexpected")
-				}
-
-				return runDeployProcess(releaseName, namespace, opts, templatesFromRevision, rollbackFunc)
+				return rollbackToRevision(releaseName, namespace, latestSuccessfullyDeployedRevision, false, opts)
 			}); err != nil {
 				return err
 			}
@@ -472,8 +439,9 @@ func doDeployHelmChart(chartPath, releaseName, namespace string, opts ChartOptio
 		}
 	}
 
+	var deployFailed bool
 	logProcessOptions := logboek.LogProcessOptions{ColorizeMsgFunc: logboek.ColorizeHighlight}
-	return logboek.LogProcess("Running deploy", logProcessOptions, func() error {
+	deployErr := logboek.LogProcess("Running deploy", logProcessOptions, func() error {
 		var templatesFromChart ChartTemplates
 
 		if err := logboek.LogProcessInline("Getting chart templates", logboek.LogProcessInlineOptions{}, func() error {
@@ -483,13 +451,151 @@ func doDeployHelmChart(chartPath, releaseName, namespace string, opts ChartOptio
 			return err
 		}
 
-		return runDeployProcess(releaseName, namespace, opts, templatesFromChart, deployFunc)
+		deployPhase := status_stream.InstallPhase
+		if isReleaseExists {
+			deployPhase = status_stream.UpgradePhase
+		}
+
+		return runDeployProcess(releaseName, namespace, opts, templatesFromChart, func() error {
+			err := status_stream.WithPhase(deployPhase, deployFunc)
+			deployFailed = err != nil
+			return err
+		})
+	})
+
+	if deployErr != nil && deployFailed && opts.Atomic && !opts.DryRun {
+		return atomicRollback(releaseName, namespace, isReleaseExists, opts, deployErr)
+	}
+
+	return deployErr
+}
+
+// release calls of the atomic rollback, replaced in tests
+var (
+	purgeReleaseFunc = func(releaseName string) error {
+		return releaseDelete(releaseName, releaseDeleteOptions{Purge: true})
+	}
+	latestSuccessfullyDeployedReleaseRevisionFunc = LatestSuccessfullyDeployedReleaseRevision
+	rollbackToRevisionFunc                        = rollbackToRevision
+	releaseRollbackFunc                           = ReleaseRollback
+)
+
+// atomicRollback restores the release after the failed deploy: the release is rolled back to the latest successfully deployed revision or purged after the failed install.
+// The returned error reports both the deploy failure and the rollback outcome
+func atomicRollback(releaseName, namespace string, isReleaseExists bool, opts ChartOptions, deployErr error) error {
+	logProcessOptions := logboek.LogProcessOptions{ColorizeMsgFunc: logboek.ColorizeHighlight}
+
+	if !isReleaseExists {
+		if err := logboek.LogProcess("Purging release after failed install (atomic)", logProcessOptions, func() error {
+			return status_stream.WithPhase(status_stream.PurgePhase, func() error {
+				if err := purgeReleaseFunc(releaseName); err != nil {
+					return err
+				}
+
+				return deleteAutoPurgeTriggerFilePath(releaseName)
+			})
+		}); err != nil {
+			return fmt.Errorf("%s\natomic purge of release %s failed: %s", deployErr, releaseName, err)
+		}
+
+		return fmt.Errorf("%s\nrelease %s has been purged (atomic)", deployErr, releaseName)
+	}
+
+	revision, err := latestSuccessfullyDeployedReleaseRevisionFunc(releaseName)
+	if err == ErrNoSuccessfullyDeployedReleaseRevisionFound {
+		return fmt.Errorf("%s\nrelease %s has not been rolled back (atomic): successfully deployed release revision was not found", deployErr, releaseName)
+	} else if err != nil {
+		return fmt.Errorf("%s\natomic rollback of release %s failed: get latest successfully deployed release revision failed: %s", deployErr, releaseName, err)
+	}
+
+	logProcessMsg := fmt.Sprintf("Rolling back release to revision %d after failed upgrade (atomic)", revision)
+	if err := logboek.LogProcess(logProcessMsg, logProcessOptions, func() error {
+		return rollbackToRevisionFunc(releaseName, namespace, revision, true, opts)
+	}); err != nil {
+		return fmt.Errorf("%s\natomic rollback of release %s to revision %d failed: %s", deployErr, releaseName, revision, err)
+	}
+
+	return fmt.Errorf("%s\nrelease %s has been rolled back to revision %d (atomic)", deployErr, releaseName, revision)
+}
+
+// RollbackHelmRelease rolls the release back to the revision and tracks the release resources until readiness
+func RollbackHelmRelease(releaseName, namespace string, revision int32, opts ChartOptions) error {
+	return withLockedHelmRelease(releaseName, func() error {
+		return rollbackToRevision(releaseName, namespace, revision, true, opts)
+	})
+}
+
+// rollbackToRevision rolls the release back to the revision, release resources are tracked until readiness if wait is set
+func rollbackToRevision(releaseName, namespace string, revision int32, wait bool, opts ChartOptions) error {
+	var templatesFromRevision ChartTemplates
+	logProcessMsg := fmt.Sprintf("Getting templates from release revision %d", revision)
+	if err := logboek.LogProcessInline(logProcessMsg, logboek.LogProcessInlineOptions{}, func() error {
+		var err error
+		templatesFromRevision, err = GetTemplatesFromReleaseRevision(releaseName, revision)
+		return err
+	}); err != nil {
+		return fmt.Errorf("get templates from release revision failed: %s", err)
+	}
+
+	rollbackFunc := func() error {
+		return releaseRollbackWithRetries(releaseName, revision, wait, opts)
+	}
+
+	return status_stream.WithPhase(status_stream.RollbackPhase, func() error {
+		return runDeployProcess(releaseName, namespace, opts, templatesFromRevision, rollbackFunc)
 	})
 }
 
-func latestSuccessfullyDeployedReleaseRevision(releaseName string) (int32, error) {
+// releaseRollbackWithRetries retries the rollback call without wait
+func releaseRollbackWithRetries(releaseName string, revision int32, wait bool, opts ChartOptions) error {
+	releaseRollbackOpts := ReleaseRollbackOptions{
+		releaseRollbackOptions: releaseRollbackOptions{
+			Timeout:       int64(opts.Timeout / time.Second),
+			CleanupOnFail: true,
+			Wait:          wait,
+			DryRun:        opts.DryRun,
+		},
+	}
+
+	// the rollback with wait fails when the resources tracking fails as well as when the rollback call itself fails,
+	// retrying it would repeat the tracking of the failed resources, thus the tracked rollback is not retried
+	maxAttempts := 5
+	if wait {
+		maxAttempts = 1
+	}
+
+	var err error
+	for i := 0; i < maxAttempts; i++ {
+		if maxAttempts == 1 {
+			logboek.LogF("Running helm rollback...\n")
+		} else {
+			logboek.LogF("Running helm rollback (%d try)...\n", i+1)
+		}
+
+		err = releaseRollbackFunc(
+			releaseName,
+			revision,
+			opts.ThreeWayMergeMode,
+			releaseRollbackOpts,
+		)
+
+		if err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("release rollback to revision %d failed: %s", revision, err)
+}
+
+// LatestSuccessfullyDeployedReleaseRevision returns ErrReleaseNotFound if the release does not exist
+// and ErrNoSuccessfullyDeployedReleaseRevisionFound if the release has not been deployed successfully
+func LatestSuccessfullyDeployedReleaseRevision(releaseName string) (int32, error) {
 	resp, err := releaseHistory(releaseName, releaseHistoryOptions{})
 	if err != nil {
+		if isReleaseNotFoundError(err) {
+			return 0, ErrReleaseNotFound
+		}
+
 		return 0, fmt.Errorf("unable to get release history: %s", err)
 	}
 
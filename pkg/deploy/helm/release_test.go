@@ -0,0 +1,205 @@
+package helm
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/flant/werf/pkg/util"
+	"github.com/flant/werf/pkg/werf"
+)
+
+func TestAtomicRollback(t *testing.T) {
+	homeDir, err := ioutil.TempDir("", "werf-atomic-rollback-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(homeDir)
+
+	if err := werf.Init("", homeDir); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		purgeReleaseFunc = func(releaseName string) error {
+			return releaseDelete(releaseName, releaseDeleteOptions{Purge: true})
+		}
+		latestSuccessfullyDeployedReleaseRevisionFunc = LatestSuccessfullyDeployedReleaseRevision
+		rollbackToRevisionFunc = rollbackToRevision
+	}()
+
+	deployErr := errors.New("deploy failed: timed out")
+
+	tests := []struct {
+		name            string
+		isReleaseExists bool
+		purgeErr        error
+		revision        int32
+		revisionErr     error
+		rollbackErr     error
+
+		purged      bool
+		rolledBack  bool
+		expectedErr string
+	}{
+		{
+			name:        "purgeAfterFailedInstall",
+			purged:      true,
+			expectedErr: "deploy failed: timed out\nrelease myrelease has been purged (atomic)",
+		},
+		{
+			name:        "purgeFailed",
+			purgeErr:    errors.New("tiller is not available"),
+			purged:      true,
+			expectedErr: "deploy failed: timed out\natomic purge of release myrelease failed: tiller is not available",
+		},
+		{
+			name:            "noSuccessfullyDeployedRevision",
+			isReleaseExists: true,
+			revisionErr:     ErrNoSuccessfullyDeployedReleaseRevisionFound,
+			expectedErr:     "deploy failed: timed out\nrelease myrelease has not been rolled back (atomic): successfully deployed release revision was not found",
+		},
+		{
+			name:            "historyLookupFailed",
+			isReleaseExists: true,
+			revisionErr:     errors.New("unable to get release history: connection refused"),
+			expectedErr:     "deploy failed: timed out\natomic rollback of release myrelease failed: get latest successfully deployed release revision failed: unable to get release history: connection refused",
+		},
+		{
+			name:            "rollbackFailed",
+			isReleaseExists: true,
+			revision:        3,
+			rollbackErr:     errors.New("release rollback to revision 3 failed: timed out"),
+			rolledBack:      true,
+			expectedErr:     "deploy failed: timed out\natomic rollback of release myrelease to revision 3 failed: release rollback to revision 3 failed: timed out",
+		},
+		{
+			name:            "rolledBack",
+			isReleaseExists: true,
+			revision:        3,
+			rolledBack:      true,
+			expectedErr:     "deploy failed: timed out\nrelease myrelease has been rolled back to revision 3 (atomic)",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !test.isReleaseExists {
+				if err := createAutoPurgeTriggerFilePath("myrelease"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var purged, rolledBack bool
+			purgeReleaseFunc = func(releaseName string) error {
+				purged = true
+				return test.purgeErr
+			}
+
+			latestSuccessfullyDeployedReleaseRevisionFunc = func(releaseName string) (int32, error) {
+				return test.revision, test.revisionErr
+			}
+
+			rollbackToRevisionFunc = func(releaseName, namespace string, revision int32, wait bool, opts ChartOptions) error {
+				rolledBack = true
+
+				if revision != test.revision || !wait {
+					t.Errorf("unexpected rollback to revision %d with wait %v", revision, wait)
+				}
+
+				return test.rollbackErr
+			}
+
+			err := atomicRollback("myrelease", "myns", test.isReleaseExists, ChartOptions{}, deployErr)
+			if err == nil || err.Error() != test.expectedErr {
+				t.Errorf("\n[EXPECTED]: %s\n[GOT]: %v", test.expectedErr, err)
+			}
+
+			if purged != test.purged || rolledBack != test.rolledBack {
+				t.Errorf("\n[EXPECTED]: purged %v, rolled back %v\n[GOT]: purged %v, rolled back %v", test.purged, test.rolledBack, purged, rolledBack)
+			}
+
+			if !test.isReleaseExists {
+				exists, err := util.FileExists(autoPurgeTriggerFilePath("myrelease"))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if expected := test.purgeErr != nil; exists != expected {
+					t.Errorf("expected auto purge trigger file exists %v, got %v", expected, exists)
+				}
+
+				if err := deleteAutoPurgeTriggerFilePath("myrelease"); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestReleaseRollbackWithRetries(t *testing.T) {
+	defer func() { releaseRollbackFunc = ReleaseRollback }()
+
+	tests := []struct {
+		name             string
+		wait             bool
+		failedAttempts   int
+		expectedAttempts int
+		expectedErr      string
+	}{
+		{
+			name:             "succeeded",
+			expectedAttempts: 1,
+		},
+		{
+			name:             "succeededAfterRetries",
+			failedAttempts:   2,
+			expectedAttempts: 3,
+		},
+		{
+			name:             "failedAfterRetries",
+			failedAttempts:   10,
+			expectedAttempts: 5,
+			expectedErr:      "release rollback to revision 3 failed: tiller is not available",
+		},
+		{
+			name:             "trackedRollbackIsNotRetried",
+			wait:             true,
+			failedAttempts:   10,
+			expectedAttempts: 1,
+			expectedErr:      "release rollback to revision 3 failed: tiller is not available",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int
+			releaseRollbackFunc = func(releaseName string, revision int32, _ ThreeWayMergeModeType, opts ReleaseRollbackOptions) error {
+				attempts++
+
+				if opts.Wait != test.wait {
+					t.Errorf("unexpected rollback wait %v", opts.Wait)
+				}
+
+				if attempts <= test.failedAttempts {
+					return errors.New("tiller is not available")
+				}
+
+				return nil
+			}
+
+			err := releaseRollbackWithRetries("myrelease", 3, test.wait, ChartOptions{})
+			if test.expectedErr == "" && err != nil {
+				t.Fatal(err)
+			} else if test.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), test.expectedErr)) {
+				t.Errorf("\n[EXPECTED ERROR]: %s\n[GOT]: %v", test.expectedErr, err)
+			}
+
+			if attempts != test.expectedAttempts {
+				t.Errorf("expected %d attempts, got %d", test.expectedAttempts, attempts)
+			}
+		})
+	}
+}
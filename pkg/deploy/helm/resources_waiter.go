@@ -24,6 +24,8 @@ import (
 	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/kubernetes/scheme"
 	helmKube "k8s.io/helm/pkg/kube"
+
+	"github.com/flant/werf/pkg/deploy/status_stream"
 )
 
 type ResourcesWaiter struct {
@@ -148,14 +150,21 @@ func (waiter *ResourcesWaiter) WaitForResources(timeout time.Duration, created h
 		}
 	}
 
+	trackerOptions := tracker.Options{
+		Timeout:      timeout,
+		LogsFromTime: waiter.LogsFromTime,
+	}
+
 	logboek.LogOptionalLn()
-	return logboek.LogProcess("Waiting for release resources to become ready", logboek.LogProcessOptions{}, func() error {
-		return multitrack.Multitrack(kube.Kubernetes, specs, multitrack.MultitrackOptions{
-			StatusProgressPeriod: waiter.StatusProgressPeriod,
-			Options: tracker.Options{
-				Timeout:      timeout,
-				LogsFromTime: waiter.LogsFromTime,
-			},
+	return status_stream.WithPhase(status_stream.TrackingPhase, func() error {
+		stopObserving := status_stream.ObserveMultitrack(kube.Kubernetes, specs, trackerOptions)
+		defer stopObserving()
+
+		return logboek.LogProcess("Waiting for release resources to become ready", logboek.LogProcessOptions{}, func() error {
+			return multitrack.Multitrack(kube.Kubernetes, specs, multitrack.MultitrackOptions{
+				StatusProgressPeriod: waiter.StatusProgressPeriod,
+				Options:              trackerOptions,
+			})
 		})
 	})
 }
@@ -327,13 +336,20 @@ func (waiter *ResourcesWaiter) WatchUntilReady(namespace string, reader io.Reade
 				specs.Jobs = append(specs.Jobs, *spec)
 			}
 
-			return logboek.LogProcess(fmt.Sprintf("Waiting for helm hook job/%s termination", name), logboek.LogProcessOptions{}, func() error {
-				return multitrack.Multitrack(kube.Kubernetes, specs, multitrack.MultitrackOptions{
-					StatusProgressPeriod: waiter.HooksStatusProgressPeriod,
-					Options: tracker.Options{
-						Timeout:      timeout,
-						LogsFromTime: waiter.LogsFromTime,
-					},
+			trackerOptions := tracker.Options{
+				Timeout:      timeout,
+				LogsFromTime: waiter.LogsFromTime,
+			}
+
+			return status_stream.WithResourcePhase(status_stream.HookPhase, "job", name, func() error {
+				stopObserving := status_stream.ObserveMultitrack(kube.Kubernetes, specs, trackerOptions)
+				defer stopObserving()
+
+				return logboek.LogProcess(fmt.Sprintf("Waiting for helm hook job/%s termination", name), logboek.LogProcessOptions{}, func() error {
+					return multitrack.Multitrack(kube.Kubernetes, specs, multitrack.MultitrackOptions{
+						StatusProgressPeriod: waiter.HooksStatusProgressPeriod,
+						Options:              trackerOptions,
+					})
 				})
 			})
 
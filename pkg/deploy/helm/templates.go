@@ -175,6 +175,8 @@ type WerfEngine struct {
 
 	ExtraAnnotations map[string]string
 	ExtraLabels      map[string]string
+	// PostRenderer is the executable which receives the rendered manifests on stdin and returns the modified manifests on stdout
+	PostRenderer string
 }
 
 func (e *WerfEngine) Render(chrt *chart.Chart, values chartutil.Values) (map[string]string, error) {
@@ -242,6 +244,10 @@ func (e *WerfEngine) Render(chrt *chart.Chart, values chartutil.Values) (map[str
 		templates[fileName] = strings.Join(resultManifests, "\n---\n")
 	}
 
+	if e.PostRenderer != "" {
+		return e.postRender(chrt, templates)
+	}
+
 	return templates, nil
 }
 
@@ -476,3 +482,11 @@ func WerfTemplateEngineWithExtraAnnotationsAndLabels(extraAnnotations, extraLabe
 
 	return err
 }
+
+func WerfTemplateEngineWithPostRenderer(postRenderer string, f func() error) error {
+	WerfTemplateEngine.PostRenderer = postRenderer
+	err := f()
+	WerfTemplateEngine.PostRenderer = ""
+
+	return err
+}
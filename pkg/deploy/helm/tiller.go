@@ -68,6 +68,7 @@ var (
 	}
 
 	ErrNoSuccessfullyDeployedReleaseRevisionFound = errors.New("no DEPLOYED release revision found")
+	ErrReleaseNotFound                            = errors.New("release not found")
 
 	currentDate                                 = time.Now()
 	threeWayMergeOnlyNewReleasesEnabledDeadline = time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC)
@@ -134,7 +135,7 @@ func Init(options InitOptions) error {
 	}
 	kubeClient.SetResourcesWaiter(resourcesWaiter)
 
-	tillerSettings.KubeClient = kubeClient
+	tillerSettings.KubeClient = &weightedKubeClient{Client: kubeClient}
 	tillerSettings.EngineYard[WerfTemplateEngineName] = WerfTemplateEngine
 
 	clientset, err := kubeClient.KubernetesClientSet()
@@ -0,0 +1,279 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flant/logboek"
+
+	helmKube "k8s.io/helm/pkg/kube"
+	"k8s.io/helm/pkg/releaseutil"
+)
+
+// weightedKubeClient applies regular (non-hook) release resources group by group in the ascending order of werf.io/weight annotation.
+// Each group is tracked by the resources waiter and the next group is applied only when the previous one is ready.
+// Release manifests without weights are applied by the original client as is
+type weightedKubeClient struct {
+	*helmKube.Client
+}
+
+type weightedResource struct {
+	key      string
+	weight   int
+	manifest string
+}
+
+type weightedResourcesGroup struct {
+	weight    int
+	resources []weightedResource
+}
+
+func (group weightedResourcesGroup) manifest() string {
+	var docs []string
+	for _, resource := range group.resources {
+		docs = append(docs, resource.manifest)
+	}
+
+	return joinManifests(docs)
+}
+
+func (c *weightedKubeClient) CreateWithOptions(namespace string, reader io.Reader, opts helmKube.CreateOptions) error {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	resources, err := parseWeightedResources(string(data), namespace)
+	if err != nil {
+		return err
+	}
+
+	groups := groupResourcesByWeight(resources)
+	if len(groups) < 2 {
+		return c.Client.CreateWithOptions(namespace, bytes.NewReader(data), opts)
+	}
+
+	var warnings []string
+	defer func() { helmKube.LastClientWarnings = warnings }()
+
+	deadline := newGroupsDeadline(opts.Timeout)
+	for _, group := range groups {
+		if err := applyWeightedResourcesGroup(group, func() error {
+			timeout, err := deadline.remainingTimeout()
+			if err != nil {
+				return err
+			}
+
+			groupOpts := opts
+			groupOpts.Timeout = timeout
+
+			err = c.Client.CreateWithOptions(namespace, bytes.NewBufferString(group.manifest()), groupOpts)
+			warnings = append(warnings, helmKube.LastClientWarnings...)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateWithOptions updates each group against the original resources of the group.
+// The resources that are not in the target manifest anymore are deleted with the last group
+func (c *weightedKubeClient) UpdateWithOptions(namespace string, originalReader, targetReader io.Reader, opts helmKube.UpdateOptions) error {
+	originalData, err := ioutil.ReadAll(originalReader)
+	if err != nil {
+		return err
+	}
+
+	targetData, err := ioutil.ReadAll(targetReader)
+	if err != nil {
+		return err
+	}
+
+	targetResources, err := parseWeightedResources(string(targetData), namespace)
+	if err != nil {
+		return err
+	}
+
+	groups := groupResourcesByWeight(targetResources)
+	if len(groups) < 2 {
+		return c.Client.UpdateWithOptions(namespace, bytes.NewReader(originalData), bytes.NewReader(targetData), opts)
+	}
+
+	originalResources, err := parseWeightedResources(string(originalData), namespace)
+	if err != nil {
+		return err
+	}
+
+	originalManifestsByGroup := groupOriginalManifests(originalResources, groups)
+
+	var warnings []string
+	defer func() { helmKube.LastClientWarnings = warnings }()
+
+	deadline := newGroupsDeadline(opts.Timeout)
+	for ind, group := range groups {
+		originalManifest := joinManifests(originalManifestsByGroup[ind])
+		if err := applyWeightedResourcesGroup(group, func() error {
+			timeout, err := deadline.remainingTimeout()
+			if err != nil {
+				return err
+			}
+
+			groupOpts := opts
+			groupOpts.Timeout = timeout
+
+			err = c.Client.UpdateWithOptions(namespace, bytes.NewBufferString(originalManifest), bytes.NewBufferString(group.manifest()), groupOpts)
+			warnings = append(warnings, helmKube.LastClientWarnings...)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// groupOriginalManifests puts the original resource into the group of the same target resource,
+// the resources that are not in the target manifest anymore are put into the last group to be deleted
+func groupOriginalManifests(originalResources []weightedResource, groups []weightedResourcesGroup) [][]string {
+	targetGroupIndexByKey := map[string]int{}
+	for ind, group := range groups {
+		for _, resource := range group.resources {
+			targetGroupIndexByKey[resource.key] = ind
+		}
+	}
+
+	originalManifestsByGroup := make([][]string, len(groups))
+	for _, resource := range originalResources {
+		ind, exist := targetGroupIndexByKey[resource.key]
+		if !exist {
+			ind = len(groups) - 1
+		}
+
+		originalManifestsByGroup[ind] = append(originalManifestsByGroup[ind], resource.manifest)
+	}
+
+	return originalManifestsByGroup
+}
+
+// groupsDeadline shares the timeout of the release between all groups, zero timeout means no timeout
+type groupsDeadline struct {
+	deadline time.Time
+}
+
+func newGroupsDeadline(timeout int64) groupsDeadline {
+	if timeout <= 0 {
+		return groupsDeadline{}
+	}
+
+	return groupsDeadline{deadline: time.Now().Add(time.Duration(timeout) * time.Second)}
+}
+
+// remainingTimeout returns the timeout in seconds for the next group
+func (d groupsDeadline) remainingTimeout() (int64, error) {
+	if d.deadline.IsZero() {
+		return 0, nil
+	}
+
+	remaining := time.Until(d.deadline)
+	if remaining <= 0 {
+		return 0, fmt.Errorf("timed out waiting for the release resources")
+	}
+
+	return int64(math.Ceil(remaining.Seconds())), nil
+}
+
+func applyWeightedResourcesGroup(group weightedResourcesGroup, f func() error) error {
+	logboek.LogOptionalLn()
+	logProcessMsg := fmt.Sprintf("Applying release resources with weight %d", group.weight)
+	return logboek.LogProcess(logProcessMsg, logboek.LogProcessOptions{}, f)
+}
+
+func groupResourcesByWeight(resources []weightedResource) []weightedResourcesGroup {
+	var groups []weightedResourcesGroup
+
+	sortedResources := make([]weightedResource, len(resources))
+	copy(sortedResources, resources)
+	sort.SliceStable(sortedResources, func(i, j int) bool {
+		return sortedResources[i].weight < sortedResources[j].weight
+	})
+
+	for _, resource := range sortedResources {
+		if len(groups) == 0 || groups[len(groups)-1].weight != resource.weight {
+			groups = append(groups, weightedResourcesGroup{weight: resource.weight})
+		}
+
+		groups[len(groups)-1].resources = append(groups[len(groups)-1].resources, resource)
+	}
+
+	return groups
+}
+
+// parseWeightedResources splits the manifest keeping the documents order, the documents without resources are skipped
+func parseWeightedResources(manifest, namespace string) ([]weightedResource, error) {
+	var resources []weightedResource
+
+	docs := releaseutil.SplitManifests(manifest)
+	for ind := 0; ind < len(docs); ind++ {
+		doc := docs[fmt.Sprintf("manifest-%d", ind)]
+
+		t, err := parseTemplate(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.IsEmpty() {
+			continue
+		}
+
+		weight, err := resourceWeight(t)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, weightedResource{
+			key:      weightedResourceKey(t, namespace),
+			weight:   weight,
+			manifest: doc,
+		})
+	}
+
+	return resources, nil
+}
+
+func resourceWeight(t Template) (int, error) {
+	value, exist := t.Metadata.Annotations[WeightAnnoName]
+	if !exist {
+		return 0, nil
+	}
+
+	weight, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s/%s annotation %s with invalid value %s: integer expected", t.Kind, t.Metadata.Name, WeightAnnoName, value)
+	}
+
+	return weight, nil
+}
+
+// weightedResourceKey identifies the resource the same way helm does, the apiVersion is not the part of the key,
+// so the resource with the changed apiVersion is updated in its group and is not deleted with the last group
+func weightedResourceKey(t Template, namespace string) string {
+	return strings.Join([]string{t.Kind, t.Namespace(namespace), t.Metadata.Name}, "/")
+}
+
+func joinManifests(docs []string) string {
+	var result string
+	for _, doc := range docs {
+		result += fmt.Sprintf("---\n%s\n", doc)
+	}
+
+	return result
+}
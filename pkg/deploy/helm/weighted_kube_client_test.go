@@ -0,0 +1,215 @@
+package helm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWeightedResources(t *testing.T) {
+	tests := []struct {
+		name        string
+		manifest    string
+		keys        []string
+		weights     []int
+		expectedErr string
+	}{
+		{
+			name: "withoutWeights",
+			manifest: joinManifests([]string{
+				"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app",
+				"apiVersion: v1\nkind: Service\nmetadata:\n  name: app\n  namespace: other",
+			}),
+			keys:    []string{"Deployment/ns/app", "Service/other/app"},
+			weights: []int{0, 0},
+		},
+		{
+			name: "withWeights",
+			manifest: joinManifests([]string{
+				"apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n  annotations:\n    werf.io/weight: \"-10\"",
+				"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n  annotations:\n    werf.io/weight: \"5\"",
+			}),
+			keys:    []string{"Job/ns/migrate", "Deployment/ns/app"},
+			weights: []int{-10, 5},
+		},
+		{
+			name: "emptyDocumentsAreSkipped",
+			manifest: joinManifests([]string{
+				"# comment only",
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config",
+			}),
+			keys:    []string{"ConfigMap/ns/config"},
+			weights: []int{0},
+		},
+		{
+			name:        "invalidWeight",
+			manifest:    joinManifests([]string{"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n  annotations:\n    werf.io/weight: high"}),
+			expectedErr: "annotation werf.io/weight with invalid value high",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resources, err := parseWeightedResources(test.manifest, "ns")
+			if test.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+					t.Fatalf("\n[EXPECTED ERROR]: %s\n[GOT]: %v", test.expectedErr, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			var keys []string
+			var weights []int
+			for _, resource := range resources {
+				keys = append(keys, resource.key)
+				weights = append(weights, resource.weight)
+			}
+
+			if !reflect.DeepEqual(test.keys, keys) || !reflect.DeepEqual(test.weights, weights) {
+				t.Errorf("\n[EXPECTED]: %v %v\n[GOT]: %v %v", test.keys, test.weights, keys, weights)
+			}
+		})
+	}
+}
+
+func TestGroupResourcesByWeight(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources []weightedResource
+		result    [][]string
+	}{
+		{
+			name:   "empty",
+			result: nil,
+		},
+		{
+			name:      "singleGroup",
+			resources: []weightedResource{{key: "a"}, {key: "b"}},
+			result:    [][]string{{"a", "b"}},
+		},
+		{
+			name: "ascendingWeightsKeepingManifestOrder",
+			resources: []weightedResource{
+				{key: "a", weight: 10},
+				{key: "b", weight: -5},
+				{key: "c"},
+				{key: "d", weight: 10},
+				{key: "e", weight: -5},
+			},
+			result: [][]string{{"b", "e"}, {"c"}, {"a", "d"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result [][]string
+			for _, group := range groupResourcesByWeight(test.resources) {
+				var keys []string
+				for _, resource := range group.resources {
+					keys = append(keys, resource.key)
+				}
+				result = append(result, keys)
+			}
+
+			if !reflect.DeepEqual(test.result, result) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", test.result, result)
+			}
+		})
+	}
+}
+
+func TestGroupOriginalManifests(t *testing.T) {
+	tests := []struct {
+		name     string
+		original []string
+		target   []string
+		result   [][]string
+	}{
+		{
+			name: "originalResourceGoesToTheGroupOfTargetResource",
+			original: []string{
+				"apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate",
+				"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app",
+			},
+			target: []string{
+				"apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n  annotations:\n    werf.io/weight: \"-1\"",
+				"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app",
+			},
+			result: [][]string{{"Job/migrate"}, {"Deployment/app"}},
+		},
+		{
+			name: "removedResourceGoesToTheLastGroup",
+			original: []string{
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: removed",
+				"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app",
+			},
+			target: []string{
+				"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n  annotations:\n    werf.io/weight: \"-1\"",
+				"apiVersion: v1\nkind: Service\nmetadata:\n  name: app",
+			},
+			result: [][]string{{"Deployment/app"}, {"ConfigMap/removed"}},
+		},
+		{
+			name: "resourceWithChangedApiVersionIsNotDeleted",
+			original: []string{
+				"apiVersion: extensions/v1beta1\nkind: Deployment\nmetadata:\n  name: app",
+				"apiVersion: v1\nkind: Service\nmetadata:\n  name: app",
+			},
+			target: []string{
+				"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n  annotations:\n    werf.io/weight: \"-1\"",
+				"apiVersion: v1\nkind: Service\nmetadata:\n  name: app",
+			},
+			result: [][]string{{"Deployment/app"}, {"Service/app"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			originalResources, err := parseWeightedResources(joinManifests(test.original), "ns")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			targetResources, err := parseWeightedResources(joinManifests(test.target), "ns")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var result [][]string
+			for _, manifests := range groupOriginalManifests(originalResources, groupResourcesByWeight(targetResources)) {
+				var names []string
+				for _, manifest := range manifests {
+					tmpl, err := parseTemplate(manifest)
+					if err != nil {
+						t.Fatal(err)
+					}
+					names = append(names, tmpl.Kind+"/"+tmpl.Metadata.Name)
+				}
+				result = append(result, names)
+			}
+
+			if !reflect.DeepEqual(test.result, result) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", test.result, result)
+			}
+		})
+	}
+}
+
+func TestGroupsDeadline(t *testing.T) {
+	timeout, err := newGroupsDeadline(0).remainingTimeout()
+	if err != nil || timeout != 0 {
+		t.Errorf("no timeout expected, got %d %v", timeout, err)
+	}
+
+	timeout, err = newGroupsDeadline(60).remainingTimeout()
+	if err != nil || timeout <= 0 || timeout > 60 {
+		t.Errorf("remaining timeout in (0, 60] expected, got %d %v", timeout, err)
+	}
+
+	if _, err := (groupsDeadline{deadline: time.Now().Add(-time.Second)}).remainingTimeout(); err == nil {
+		t.Errorf("timeout error expected")
+	}
+}
@@ -19,6 +19,10 @@ func (d *ImageInfoGetterStub) GetName() string {
 	return d.Name
 }
 
+func (d *ImageInfoGetterStub) GetTag() string {
+	return d.Tag
+}
+
 func (d *ImageInfoGetterStub) GetImageName() string {
 	return d.ImagesRepoManager.ImageRepoWithTag(d.Name, d.Tag)
 }
@@ -42,6 +46,10 @@ func (d *ImageInfo) GetName() string {
 	return d.Name
 }
 
+func (d *ImageInfo) GetTag() string {
+	return d.Tag
+}
+
 func (d *ImageInfo) GetImageName() string {
 	return d.ImagesRepoManager.ImageRepoWithTag(d.Name, d.Tag)
 }
@@ -22,6 +22,7 @@ type LintOptions struct {
 	SetString       []string
 	Env             string
 	IgnoreSecretKey bool
+	PostRenderer    string
 }
 
 func RunLint(projectDir string, werfConfig *config.WerfConfig, opts LintOptions) error {
@@ -43,7 +44,7 @@ func RunLint(projectDir string, werfConfig *config.WerfConfig, opts LintOptions)
 	tagStrategy := tag_strategy.GitBranch
 	namespace := "NAMESPACE"
 
-	images := GetImagesInfoGetters(werfConfig.StapelImages, werfConfig.ImagesFromDockerfile, imagesRepoManager, tag, true)
+	images := GetImagesInfoGetters(werfConfig.StapelImages, werfConfig.ImagesFromDockerfile, imagesRepoManager, tag, nil, true)
 
 	serviceValues, err := GetServiceValues(werfConfig.Meta.Project, imagesRepoManager, namespace, tag, tagStrategy, images, ServiceValuesOptions{Env: opts.Env})
 	if err != nil {
@@ -60,16 +61,18 @@ func RunLint(projectDir string, werfConfig *config.WerfConfig, opts LintOptions)
 	helm.WerfTemplateEngine.InitWerfEngineExtraTemplatesFunctions(werfChart.DecodedSecretFilesData)
 	patchLoadChartfile(werfChart.Name)
 
-	if err := helm.Lint(
-		os.Stdout,
-		werfChart.ChartDir,
-		namespace,
-		append(werfChart.Values, opts.Values...),
-		werfChart.SecretValues,
-		append(werfChart.Set, opts.Set...),
-		append(werfChart.SetString, opts.SetString...),
-		helm.LintOptions{Strict: true},
-	); err != nil {
+	if err := helm.WerfTemplateEngineWithPostRenderer(opts.PostRenderer, func() error {
+		return helm.Lint(
+			os.Stdout,
+			werfChart.ChartDir,
+			namespace,
+			append(werfChart.Values, opts.Values...),
+			werfChart.AllSecretValues(),
+			append(werfChart.Set, opts.Set...),
+			append(werfChart.SetString, opts.SetString...),
+			helm.LintOptions{Strict: true},
+		)
+	}); err != nil {
 		return fmt.Errorf("%s", secretvalues.MaskSecretValuesInString(werfChart.SecretValuesToMask, err.Error()))
 	}
 
@@ -17,6 +17,7 @@ type RenderOptions struct {
 	ReleaseName          string
 	Tag                  string
 	TagStrategy          tag_strategy.TagStrategy
+	ImagesTags           map[string]string
 	Namespace            string
 	WithoutImagesRepo    bool
 	ImagesRepoManager    ImagesRepoManager
@@ -28,6 +29,7 @@ type RenderOptions struct {
 	UserExtraAnnotations map[string]string
 	UserExtraLabels      map[string]string
 	IgnoreSecretKey      bool
+	PostRenderer         string
 }
 
 func RunRender(out io.Writer, projectDir string, werfConfig *config.WerfConfig, opts RenderOptions) error {
@@ -40,7 +42,7 @@ func RunRender(out io.Writer, projectDir string, werfConfig *config.WerfConfig,
 		return err
 	}
 
-	images := GetImagesInfoGetters(werfConfig.StapelImages, werfConfig.ImagesFromDockerfile, opts.ImagesRepoManager, opts.Tag, opts.WithoutImagesRepo)
+	images := GetImagesInfoGetters(werfConfig.StapelImages, werfConfig.ImagesFromDockerfile, opts.ImagesRepoManager, opts.Tag, opts.ImagesTags, opts.WithoutImagesRepo)
 
 	serviceValues, err := GetServiceValues(werfConfig.Meta.Project, opts.ImagesRepoManager, opts.Namespace, opts.Tag, opts.TagStrategy, images, ServiceValuesOptions{Env: opts.Env})
 	if err != nil {
@@ -65,14 +67,14 @@ func RunRender(out io.Writer, projectDir string, werfConfig *config.WerfConfig,
 	helm.WerfTemplateEngine.InitWerfEngineExtraTemplatesFunctions(werfChart.DecodedSecretFilesData)
 	patchLoadChartfile(werfChart.Name)
 
-	return helm.WerfTemplateEngineWithExtraAnnotationsAndLabels(werfChart.ExtraAnnotations, werfChart.ExtraLabels, func() error {
+	return withWerfTemplateEngine(werfChart, opts.PostRenderer, func() error {
 		return helm.Render(
 			out,
 			werfChart.ChartDir,
 			opts.ReleaseName,
 			opts.Namespace,
 			append(werfChart.Values, opts.Values...),
-			werfChart.SecretValues,
+			werfChart.AllSecretValues(),
 			append(werfChart.Set, opts.Set...),
 			append(werfChart.SetString, opts.SetString...),
 			renderOptions)
@@ -17,21 +17,31 @@ const (
 type ImageInfoGetter interface {
 	IsNameless() bool
 	GetName() string
+	GetTag() string
 	GetImageName() string
 	GetImageId() (string, error)
 	GetImageDigest() (string, error)
 }
 
-func GetImagesInfoGetters(configImages []*config.StapelImage, configImagesFromDockerfile []*config.ImageFromDockerfile, imagesRepoManager ImagesRepoManager, tag string, withoutRegistry bool) []ImageInfoGetter {
+// GetImagesInfoGetters uses imagesTags to override tag for the particular images (e.g. with stages-signature tagging strategy each image has own tag)
+func GetImagesInfoGetters(configImages []*config.StapelImage, configImagesFromDockerfile []*config.ImageFromDockerfile, imagesRepoManager ImagesRepoManager, tag string, imagesTags map[string]string, withoutRegistry bool) []ImageInfoGetter {
 	var images []ImageInfoGetter
 
+	imageTag := func(imageName string) string {
+		if t, ok := imagesTags[imageName]; ok {
+			return t
+		}
+
+		return tag
+	}
+
 	for _, image := range configImages {
-		d := &ImageInfo{Name: image.Name, WithoutRegistry: withoutRegistry, ImagesRepoManager: imagesRepoManager, Tag: tag}
+		d := &ImageInfo{Name: image.Name, WithoutRegistry: withoutRegistry, ImagesRepoManager: imagesRepoManager, Tag: imageTag(image.Name)}
 		images = append(images, d)
 	}
 
 	for _, image := range configImagesFromDockerfile {
-		d := &ImageInfo{Name: image.Name, WithoutRegistry: withoutRegistry, ImagesRepoManager: imagesRepoManager, Tag: tag}
+		d := &ImageInfo{Name: image.Name, WithoutRegistry: withoutRegistry, ImagesRepoManager: imagesRepoManager, Tag: imageTag(image.Name)}
 		images = append(images, d)
 	}
 
@@ -46,12 +56,14 @@ func GetServiceValues(projectName string, imagesRepoManager ImagesRepoManager, n
 	res := make(map[string]interface{})
 
 	ciInfo := map[string]interface{}{
-		"is_tag":    false,
-		"is_branch": false,
-		"is_custom": false,
-		"branch":    TemplateEmptyValue,
-		"tag":       TemplateEmptyValue,
-		"ref":       TemplateEmptyValue,
+		"is_tag":              false,
+		"is_branch":           false,
+		"is_custom":           false,
+		"is_semver":           false,
+		"is_stages_signature": false,
+		"branch":              TemplateEmptyValue,
+		"tag":                 TemplateEmptyValue,
+		"ref":                 TemplateEmptyValue,
 	}
 
 	werfInfo := map[string]interface{}{
@@ -76,6 +88,16 @@ func GetServiceValues(projectName string, imagesRepoManager ImagesRepoManager, n
 		ciInfo["ref"] = tag
 		ciInfo["is_tag"] = true
 
+	case tag_strategy.GitSemver:
+		ciInfo["tag"] = tag
+		ciInfo["ref"] = tag
+		ciInfo["is_tag"] = true
+		ciInfo["is_semver"] = true
+
+	case tag_strategy.StagesSignature:
+		ciInfo["is_stages_signature"] = true
+		werfInfo["docker_tag"] = TemplateEmptyValue
+
 	case tag_strategy.GitBranch:
 		ciInfo["branch"] = tag
 		ciInfo["ref"] = tag
@@ -101,6 +123,10 @@ func GetServiceValues(projectName string, imagesRepoManager ImagesRepoManager, n
 
 		imageData["docker_image"] = image.GetImageName()
 
+		if tagStrategy == tag_strategy.StagesSignature {
+			imageData["stages_signature"] = image.GetTag()
+		}
+
 		if tagStrategy == tag_strategy.GitBranch || tagStrategy == tag_strategy.Custom {
 			setKey := func(key, value string) {
 				if value == "" {
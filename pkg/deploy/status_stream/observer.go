@@ -0,0 +1,250 @@
+package status_stream
+
+import (
+	"context"
+	"sync"
+
+	"github.com/flant/kubedog/pkg/tracker"
+	"github.com/flant/kubedog/pkg/tracker/controller"
+	"github.com/flant/kubedog/pkg/tracker/daemonset"
+	"github.com/flant/kubedog/pkg/tracker/deployment"
+	"github.com/flant/kubedog/pkg/tracker/job"
+	"github.com/flant/kubedog/pkg/tracker/pod"
+	"github.com/flant/kubedog/pkg/tracker/replicaset"
+	"github.com/flant/kubedog/pkg/tracker/statefulset"
+	"github.com/flant/kubedog/pkg/trackers/rollout/multitrack"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ObserveMultitrack starts the observers of the resources tracked by multitrack, which report the resources states to the stream.
+// Observers do not affect the result of the tracking and run until the returned stop function is called
+func ObserveMultitrack(kube kubernetes.Interface, specs multitrack.MultitrackSpecs, opts tracker.Options) func() {
+	if !Enabled() {
+		return func() {}
+	}
+
+	parentContext := opts.ParentContext
+	if parentContext == nil {
+		parentContext = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parentContext)
+
+	opts.ParentContext = ctx
+	opts.Timeout = 0
+
+	var wg sync.WaitGroup
+	observe := func(kind string, spec multitrack.MultitrackSpec, track func(o *resourceObserver) error) {
+		o := newResourceObserver(kind, spec)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = track(o)
+		}()
+	}
+
+	for _, spec := range specs.Deployments {
+		observe("deploy", spec, func(o *resourceObserver) error {
+			feed := deployment.NewFeed()
+			o.setupControllerFeed(feed)
+			feed.OnStatus(func(status deployment.DeploymentStatus) error {
+				o.setReady(status.IsReady)
+				o.setPodsStatuses(status.Pods)
+				return nil
+			})
+
+			return feed.Track(spec.ResourceName, spec.Namespace, kube, opts)
+		})
+	}
+
+	for _, spec := range specs.StatefulSets {
+		observe("sts", spec, func(o *resourceObserver) error {
+			feed := statefulset.NewFeed()
+			o.setupControllerFeed(feed)
+			feed.OnStatus(func(status statefulset.StatefulSetStatus) error {
+				o.setReady(status.IsReady)
+				o.setPodsStatuses(status.Pods)
+				return nil
+			})
+
+			return feed.Track(spec.ResourceName, spec.Namespace, kube, opts)
+		})
+	}
+
+	for _, spec := range specs.DaemonSets {
+		observe("ds", spec, func(o *resourceObserver) error {
+			feed := daemonset.NewFeed()
+			o.setupControllerFeed(feed)
+			feed.OnStatus(func(status daemonset.DaemonSetStatus) error {
+				o.setReady(status.IsReady)
+				o.setPodsStatuses(status.Pods)
+				return nil
+			})
+
+			return feed.Track(spec.ResourceName, spec.Namespace, kube, opts)
+		})
+	}
+
+	for _, spec := range specs.Jobs {
+		observe("job", spec, func(o *resourceObserver) error {
+			feed := job.NewFeed()
+			feed.OnAdded(func() error {
+				o.setReady(false)
+				return nil
+			})
+			feed.OnSucceeded(func() error {
+				o.setReady(true)
+				return nil
+			})
+			feed.OnFailed(func(reason string) error {
+				o.failed(reason)
+				return nil
+			})
+			feed.OnEventMsg(func(msg string) error {
+				o.eventMsg(msg)
+				return nil
+			})
+			feed.OnPodError(func(podError pod.PodError) error {
+				o.containerError(podError.PodName, podError.ContainerName, podError.Message)
+				return nil
+			})
+			feed.OnStatus(func(status job.JobStatus) error {
+				o.setPodsStatuses(status.Pods)
+				return nil
+			})
+
+			return feed.Track(spec.ResourceName, spec.Namespace, kube, opts)
+		})
+	}
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+type containerStatus struct {
+	state    string
+	reason   string
+	restarts int32
+	ready    bool
+}
+
+type resourceObserver struct {
+	kind                string
+	name                string
+	namespace           string
+	showServiceMessages bool
+
+	ready      *bool
+	containers map[string]containerStatus
+}
+
+func newResourceObserver(kind string, spec multitrack.MultitrackSpec) *resourceObserver {
+	return &resourceObserver{
+		kind:                kind,
+		name:                spec.ResourceName,
+		namespace:           spec.Namespace,
+		showServiceMessages: spec.ShowServiceMessages,
+		containers:          map[string]containerStatus{},
+	}
+}
+
+func (o *resourceObserver) setupControllerFeed(feed controller.ControllerFeed) {
+	feed.OnAdded(func(isReady bool) error {
+		o.setReady(isReady)
+		return nil
+	})
+	feed.OnReady(func() error {
+		o.setReady(true)
+		return nil
+	})
+	feed.OnFailed(func(reason string) error {
+		o.failed(reason)
+		return nil
+	})
+	feed.OnEventMsg(func(msg string) error {
+		o.eventMsg(msg)
+		return nil
+	})
+	feed.OnPodError(func(podError replicaset.ReplicaSetPodError) error {
+		o.containerError(podError.PodName, podError.ContainerName, podError.Message)
+		return nil
+	})
+}
+
+func (o *resourceObserver) event(eventType EventType) Event {
+	return Event{Type: eventType, Kind: o.kind, Name: o.name, Namespace: o.namespace}
+}
+
+func (o *resourceObserver) setReady(ready bool) {
+	if o.ready != nil && *o.ready == ready {
+		return
+	}
+
+	o.ready = &ready
+
+	event := o.event(ResourceReadinessEvent)
+	event.Ready = &ready
+	Emit(event)
+}
+
+func (o *resourceObserver) failed(reason string) {
+	event := o.event(ResourceFailureEvent)
+	event.Reason = reason
+	Emit(event)
+}
+
+func (o *resourceObserver) eventMsg(msg string) {
+	if !o.showServiceMessages {
+		return
+	}
+
+	event := o.event(ResourceKubeEvent)
+	event.Message = msg
+	Emit(event)
+}
+
+func (o *resourceObserver) containerError(podName, containerName, msg string) {
+	event := o.event(ContainerErrorEvent)
+	event.Pod = podName
+	event.Container = containerName
+	event.Message = msg
+	Emit(event)
+}
+
+func (o *resourceObserver) setPodsStatuses(pods map[string]pod.PodStatus) {
+	for podName, podStatus := range pods {
+		var containerStatuses []corev1.ContainerStatus
+		containerStatuses = append(containerStatuses, podStatus.InitContainerStatuses...)
+		containerStatuses = append(containerStatuses, podStatus.ContainerStatuses...)
+
+		for _, cs := range containerStatuses {
+			status := containerStatus{restarts: cs.RestartCount, ready: cs.Ready}
+			switch {
+			case cs.State.Waiting != nil:
+				status.state, status.reason = "waiting", cs.State.Waiting.Reason
+			case cs.State.Running != nil:
+				status.state = "running"
+			case cs.State.Terminated != nil:
+				status.state, status.reason = "terminated", cs.State.Terminated.Reason
+			}
+
+			key := podName + "/" + cs.Name
+			if o.containers[key] == status {
+				continue
+			}
+			o.containers[key] = status
+
+			event := o.event(ContainerStateEvent)
+			event.Pod = podName
+			event.Container = cs.Name
+			event.State = status.state
+			event.Reason = status.reason
+			event.Restarts = &status.restarts
+			event.Ready = &status.ready
+			Emit(event)
+		}
+	}
+}
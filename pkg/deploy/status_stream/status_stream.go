@@ -0,0 +1,177 @@
+package status_stream
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/flant/werf/pkg/util/secretvalues"
+)
+
+type EventType string
+
+const (
+	// ReleasePhaseEvent reports the start and the result of the release phase
+	ReleasePhaseEvent EventType = "release-phase"
+	// ResourceReadinessEvent reports the readiness change of the tracked resource
+	ResourceReadinessEvent EventType = "resource-readiness"
+	// ResourceFailureEvent reports the failure of the tracked resource with the reason
+	ResourceFailureEvent EventType = "resource-failure"
+	// ResourceKubeEvent reports the kubernetes event of the resource with werf.io/show-service-messages annotation
+	ResourceKubeEvent EventType = "resource-event"
+	// ContainerStateEvent reports the state, readiness or restarts count change of the pod container
+	ContainerStateEvent EventType = "container-state"
+	// ContainerErrorEvent reports the error of the pod container
+	ContainerErrorEvent EventType = "container-error"
+)
+
+const (
+	DeployPhase   = "deploy"
+	DismissPhase  = "dismiss"
+	InstallPhase  = "install"
+	UpgradePhase  = "upgrade"
+	RollbackPhase = "rollback"
+	PurgePhase    = "purge"
+	HookPhase     = "hook"
+	TrackingPhase = "tracking"
+)
+
+const (
+	PhaseStarted   = "started"
+	PhaseSucceeded = "succeeded"
+	PhaseFailed    = "failed"
+)
+
+// Event is a single line of the json stream, field names are the part of the stream format and must not be changed
+type Event struct {
+	Time      string    `json:"time"`
+	Type      EventType `json:"type"`
+	Cluster   string    `json:"cluster,omitempty"`
+	Release   string    `json:"release,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+
+	Phase  string `json:"phase,omitempty"`
+	Status string `json:"status,omitempty"`
+
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Ready     *bool  `json:"ready,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	State     string `json:"state,omitempty"`
+	Restarts  *int32 `json:"restarts,omitempty"`
+
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+var (
+	out              io.Writer
+	outMux           sync.Mutex
+	clusterName      string
+	releaseName      string
+	releaseNamespace string
+
+	secretValuesToMask []string
+
+	// writeErr is the first error of writing the events, the stream is not written after the error
+	writeErr error
+
+	timeNow = time.Now
+)
+
+// Init enables the stream, events are written to w as newline-delimited json
+func Init(w io.Writer) {
+	outMux.Lock()
+	defer outMux.Unlock()
+
+	out = w
+	writeErr = nil
+}
+
+// WriteError returns the first error of writing the events
+func WriteError() error {
+	outMux.Lock()
+	defer outMux.Unlock()
+
+	return writeErr
+}
+
+func Enabled() bool {
+	outMux.Lock()
+	defer outMux.Unlock()
+
+	return out != nil
+}
+
+// SetSecretValuesToMask sets the secret values which are masked in the reasons and the messages of the following events
+func SetSecretValuesToMask(values []string) {
+	outMux.Lock()
+	defer outMux.Unlock()
+
+	secretValuesToMask = values
+}
+
+// SetCluster sets the cluster name which is added to all following events, the name is set only when the release is deployed to several clusters
+func SetCluster(name string) {
+	outMux.Lock()
+	defer outMux.Unlock()
+
+	clusterName = name
+}
+
+// SetRelease sets the release and the namespace which are added to all following events
+func SetRelease(release, namespace string) {
+	outMux.Lock()
+	defer outMux.Unlock()
+
+	releaseName = release
+	releaseNamespace = namespace
+}
+
+func Emit(event Event) {
+	outMux.Lock()
+	defer outMux.Unlock()
+
+	if out == nil || writeErr != nil {
+		return
+	}
+
+	event.Time = timeNow().UTC().Format(time.RFC3339Nano)
+	event.Cluster = clusterName
+	event.Release = releaseName
+	if event.Namespace == "" {
+		event.Namespace = releaseNamespace
+	}
+
+	event.Reason = secretvalues.MaskSecretValuesInString(secretValuesToMask, event.Reason)
+	event.Message = secretvalues.MaskSecretValuesInString(secretValuesToMask, event.Message)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	if _, err := out.Write(append(data, '\n')); err != nil {
+		writeErr = err
+	}
+}
+
+func WithPhase(phase string, f func() error) error {
+	return WithResourcePhase(phase, "", "", f)
+}
+
+// WithResourcePhase reports the start of the phase, runs f and reports the result of the phase with the error message
+func WithResourcePhase(phase, kind, name string, f func() error) error {
+	Emit(Event{Type: ReleasePhaseEvent, Phase: phase, Status: PhaseStarted, Kind: kind, Name: name})
+
+	err := f()
+	if err != nil {
+		Emit(Event{Type: ReleasePhaseEvent, Phase: phase, Status: PhaseFailed, Kind: kind, Name: name, Message: err.Error()})
+	} else {
+		Emit(Event{Type: ReleasePhaseEvent, Phase: phase, Status: PhaseSucceeded, Kind: kind, Name: name})
+	}
+
+	return err
+}
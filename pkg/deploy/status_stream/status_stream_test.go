@@ -0,0 +1,167 @@
+package status_stream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failingWriter struct {
+	writes int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("disk full")
+}
+
+func initTestStream() *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	Init(buf)
+	SetCluster("")
+	SetRelease("myrelease", "myns")
+	SetSecretValuesToMask(nil)
+
+	timeNow = func() time.Time { return time.Date(2020, 2, 20, 10, 0, 0, 0, time.FixedZone("MSK", 3*60*60)) }
+
+	return buf
+}
+
+func resetTestStream() {
+	Init(nil)
+	SetCluster("")
+	SetRelease("", "")
+	SetSecretValuesToMask(nil)
+	timeNow = time.Now
+}
+
+func TestEmit(t *testing.T) {
+	ready := true
+	restarts := int32(2)
+
+	tests := []struct {
+		name    string
+		cluster string
+		event   Event
+		golden  string
+	}{
+		{
+			name:   "resourceReadiness",
+			event:  Event{Type: ResourceReadinessEvent, Kind: "Deployment", Name: "app", Ready: &ready},
+			golden: `{"time":"2020-02-20T07:00:00Z","type":"resource-readiness","release":"myrelease","namespace":"myns","kind":"Deployment","name":"app","ready":true}`,
+		},
+		{
+			name:    "containerStateWithCluster",
+			cluster: "eu",
+			event:   Event{Type: ContainerStateEvent, Kind: "Deployment", Name: "app", Pod: "app-5d8f", Container: "main", State: "Running", Restarts: &restarts},
+			golden:  `{"time":"2020-02-20T07:00:00Z","type":"container-state","cluster":"eu","release":"myrelease","namespace":"myns","kind":"Deployment","name":"app","pod":"app-5d8f","container":"main","state":"Running","restarts":2}`,
+		},
+		{
+			name:   "resourceNamespaceIsKept",
+			event:  Event{Type: ResourceKubeEvent, Namespace: "other", Kind: "Job", Name: "migrate", Reason: "Started", Message: "Started container"},
+			golden: `{"time":"2020-02-20T07:00:00Z","type":"resource-event","release":"myrelease","namespace":"other","kind":"Job","name":"migrate","reason":"Started","message":"Started container"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := initTestStream()
+			defer resetTestStream()
+			SetCluster(test.cluster)
+
+			Emit(test.event)
+
+			if output := buf.String(); output != test.golden+"\n" {
+				t.Errorf("\n[EXPECTED]: %s\n[GOT]: %s", test.golden, output)
+			}
+		})
+	}
+}
+
+func TestWithPhase(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		golden []string
+	}{
+		{
+			name: "succeeded",
+			golden: []string{
+				`{"time":"2020-02-20T07:00:00Z","type":"release-phase","release":"myrelease","namespace":"myns","phase":"deploy","status":"started"}`,
+				`{"time":"2020-02-20T07:00:00Z","type":"release-phase","release":"myrelease","namespace":"myns","phase":"deploy","status":"succeeded"}`,
+			},
+		},
+		{
+			name: "failed",
+			err:  errors.New("timed out"),
+			golden: []string{
+				`{"time":"2020-02-20T07:00:00Z","type":"release-phase","release":"myrelease","namespace":"myns","phase":"deploy","status":"started"}`,
+				`{"time":"2020-02-20T07:00:00Z","type":"release-phase","release":"myrelease","namespace":"myns","phase":"deploy","status":"failed","message":"timed out"}`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := initTestStream()
+			defer resetTestStream()
+
+			err := WithPhase(DeployPhase, func() error { return test.err })
+			if err != test.err {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", test.err, err)
+			}
+
+			if expected := strings.Join(test.golden, "\n") + "\n"; buf.String() != expected {
+				t.Errorf("\n[EXPECTED]: %s\n[GOT]: %s", expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestEmitMasksSecretValues(t *testing.T) {
+	buf := initTestStream()
+	defer resetTestStream()
+	SetSecretValuesToMask([]string{"s3cr3t"})
+
+	_ = WithResourcePhase(HookPhase, "Job", "migrate", func() error {
+		Emit(Event{Type: ResourceFailureEvent, Kind: "Job", Name: "migrate", Reason: "password s3cr3t rejected", Message: "login with s3cr3t failed"})
+		return fmt.Errorf("job failed: s3cr3t")
+	})
+
+	golden := strings.Join([]string{
+		`{"time":"2020-02-20T07:00:00Z","type":"release-phase","release":"myrelease","namespace":"myns","phase":"hook","status":"started","kind":"Job","name":"migrate"}`,
+		`{"time":"2020-02-20T07:00:00Z","type":"resource-failure","release":"myrelease","namespace":"myns","kind":"Job","name":"migrate","reason":"password *** rejected","message":"login with *** failed"}`,
+		`{"time":"2020-02-20T07:00:00Z","type":"release-phase","release":"myrelease","namespace":"myns","phase":"hook","status":"failed","kind":"Job","name":"migrate","message":"job failed: ***"}`,
+	}, "\n") + "\n"
+
+	if buf.String() != golden {
+		t.Errorf("\n[EXPECTED]: %s\n[GOT]: %s", golden, buf.String())
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	initTestStream()
+	defer resetTestStream()
+
+	w := &failingWriter{}
+	Init(w)
+
+	Emit(Event{Type: ReleasePhaseEvent, Phase: DeployPhase, Status: PhaseStarted})
+	Emit(Event{Type: ReleasePhaseEvent, Phase: DeployPhase, Status: PhaseSucceeded})
+
+	if err := WriteError(); err == nil || err.Error() != "disk full" {
+		t.Errorf("write error expected, got %v", err)
+	}
+
+	if w.writes != 1 {
+		t.Errorf("events must not be written after the error, got %d writes", w.writes)
+	}
+
+	Init(&bytes.Buffer{})
+	if err := WriteError(); err != nil {
+		t.Errorf("write error must be reset, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package werf_chart
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -29,6 +30,7 @@ type WerfChart struct {
 	Name             string
 	ChartDir         string
 	SecretValues     []map[string]interface{}
+	ServiceValues    map[string]interface{}
 	Values           []string
 	Set              []string
 	SetString        []string
@@ -44,11 +46,22 @@ func (chart *WerfChart) SetGlobalAnnotation(name, value string) error {
 	return nil
 }
 
+// SetServiceValues replaces the service values, thus the chart can be deployed with the service values of another namespace
 func (chart *WerfChart) SetServiceValues(values map[string]interface{}) error {
-	chart.SecretValues = append(chart.SecretValues, values)
+	chart.ServiceValues = values
 	return nil
 }
 
+// AllSecretValues returns the secret values followed by the service values, which are passed to helm along with the other secret values
+func (chart *WerfChart) AllSecretValues() []map[string]interface{} {
+	res := append([]map[string]interface{}{}, chart.SecretValues...)
+	if chart.ServiceValues != nil {
+		res = append(res, chart.ServiceValues)
+	}
+
+	return res
+}
+
 func (chart *WerfChart) SetSecretValuesFile(path string, m secret.Manager) error {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -100,7 +113,7 @@ func valueToStrvals(valuePath string, value interface{}) []string {
 }
 
 func (chart *WerfChart) Deploy(releaseName string, namespace string, opts helm.ChartOptions) error {
-	opts.SecretValues = append(chart.SecretValues, opts.SecretValues...)
+	opts.SecretValues = append(chart.AllSecretValues(), opts.SecretValues...)
 	opts.Set = append(chart.Set, opts.Set...)
 	opts.SetString = append(chart.SetString, opts.SetString...)
 	opts.Values = append(chart.Values, opts.Values...)
@@ -108,6 +121,21 @@ func (chart *WerfChart) Deploy(releaseName string, namespace string, opts helm.C
 	return helm.DeployHelmChart(chart.ChartDir, releaseName, namespace, opts)
 }
 
+// Diff prints the changes, which deploy of the chart with the same options would make, returns true if there are changes
+func (chart *WerfChart) Diff(out io.Writer, releaseName string, namespace string, opts helm.ChartValuesOptions) (bool, error) {
+	return helm.Diff(
+		out,
+		chart.ChartDir,
+		releaseName,
+		namespace,
+		append(chart.Values, opts.Values...),
+		append(chart.AllSecretValues(), opts.SecretValues...),
+		append(chart.Set, opts.Set...),
+		append(chart.SetString, opts.SetString...),
+		helm.DiffOptions{SecretValuesToMask: chart.SecretValuesToMask},
+	)
+}
+
 func (chart *WerfChart) MergeExtraAnnotations(extraAnnotations map[string]string) {
 	for annoName, annoValue := range extraAnnotations {
 		chart.ExtraAnnotations[annoName] = annoValue
@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"io"
 	"strings"
 	"time"
 
@@ -41,6 +42,11 @@ func ImageInspect(ref string) (*types.ImageInspect, error) {
 	return &inspect, nil
 }
 
+func ImageSave(ref string) (io.ReadCloser, error) {
+	ctx := context.Background()
+	return apiClient.ImageSave(ctx, []string{ref})
+}
+
 const cliPullMaxAttempts = 5
 
 func CliPullWithRetries(args ...string) error {
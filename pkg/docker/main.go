@@ -90,3 +90,13 @@ func setDockerApiClient() error {
 func Debug() bool {
 	return os.Getenv("WERF_DEBUG_DOCKER") == "1"
 }
+
+func Info() (*types.Info, error) {
+	ctx := context.Background()
+	info, err := apiClient.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
@@ -0,0 +1,358 @@
+package docker_registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/flant/go-containerregistry/pkg/v1"
+	"github.com/flant/go-containerregistry/pkg/v1/empty"
+	"github.com/flant/go-containerregistry/pkg/v1/mutate"
+	"github.com/flant/go-containerregistry/pkg/v1/types"
+
+	imagePkg "github.com/flant/werf/pkg/image"
+)
+
+const (
+	// ImagesMetadataTag is the tag of the image repository that stores metadata records of all published tags of the repository
+	ImagesMetadataTag = "werf-images-metadata"
+
+	imagesMetadataLabel   = "werf-images-metadata"
+	imagesMetadataVersion = 1
+)
+
+// ImageMetadata is the compact record about the published tag, which allows to skip the image config inspection during cleanup
+type ImageMetadata struct {
+	ImageName     string     `json:"imageName"`
+	TagStrategy   string     `json:"tagStrategy"`
+	ImageTag      string     `json:"imageTag"`
+	GitTag        string     `json:"gitTag,omitempty"`
+	GitCommit     string     `json:"gitCommit,omitempty"`
+	GitCommitTime *time.Time `json:"gitCommitTime,omitempty"`
+	Created       time.Time  `json:"created"`
+	WerfVersion   string     `json:"werfVersion"`
+	// Protected is the protected label the image has been published with, the protection marker tag overrides it
+	Protected bool `json:"protected,omitempty"`
+	// ReferencingGitCommits are commits that have skipped publishing of the existing stages-signature tag as up-to-date
+	ReferencingGitCommits []string `json:"referencingGitCommits,omitempty"`
+}
+
+// NewImageMetadata returns the record of the tag published without the record (e.g. by the older werf)
+func NewImageMetadata(configFile v1.ConfigFile) ImageMetadata {
+	labels := configFile.Config.Labels
+
+	return ImageMetadata{
+		ImageName:   labels[imagePkg.WerfImageNameLabel],
+		TagStrategy: labels[imagePkg.WerfTagStrategyLabel],
+		ImageTag:    labels[imagePkg.WerfImageTagLabel],
+		GitTag:      labels[imagePkg.WerfGitTagLabel],
+		GitCommit:   labels[imagePkg.WerfGitCommitLabel],
+		Created:     configFile.Created.Time,
+		WerfVersion: labels[imagePkg.WerfVersionLabel],
+		Protected:   labels[imagePkg.WerfProtectedLabel] == "true",
+	}
+}
+
+// GitCommits returns the commit the tag has been published from and referencing commits
+func (m ImageMetadata) GitCommits() []string {
+	var commits []string
+	if m.GitCommit != "" {
+		commits = append(commits, m.GitCommit)
+	}
+
+	for _, commit := range m.ReferencingGitCommits {
+		if commit != m.GitCommit {
+			commits = append(commits, commit)
+		}
+	}
+
+	return commits
+}
+
+// AddReferencingGitCommit adds the commit that has skipped publishing of the tag as up-to-date
+func (m *ImageMetadata) AddReferencingGitCommit(commit string) {
+	for _, c := range m.GitCommits() {
+		if c == commit {
+			return
+		}
+	}
+
+	m.ReferencingGitCommits = append(m.ReferencingGitCommits, commit)
+}
+
+// Labels returns werf labels of the published image, which are stored in the record
+func (m ImageMetadata) Labels() map[string]string {
+	labels := map[string]string{
+		imagePkg.WerfImageLabel:       "true",
+		imagePkg.WerfImageNameLabel:   m.ImageName,
+		imagePkg.WerfTagStrategyLabel: m.TagStrategy,
+		imagePkg.WerfImageTagLabel:    m.ImageTag,
+		imagePkg.WerfVersionLabel:     m.WerfVersion,
+	}
+
+	if m.GitTag != "" {
+		labels[imagePkg.WerfGitTagLabel] = m.GitTag
+	}
+
+	if m.GitCommit != "" {
+		labels[imagePkg.WerfGitCommitLabel] = m.GitCommit
+	}
+
+	if m.Protected {
+		labels[imagePkg.WerfProtectedLabel] = "true"
+	}
+
+	return labels
+}
+
+// ImagesMetadataLockName is the lock of the read-modify-write of the repository metadata records
+func ImagesMetadataLockName(repository string) string {
+	return fmt.Sprintf("images-metadata.%s", repository)
+}
+
+type imagesMetadata struct {
+	Version int                      `json:"version"`
+	Records map[string]ImageMetadata `json:"records"`
+}
+
+// ImagesMetadata returns metadata records of the repository by tags, the result is empty if the repository does not have metadata or it was written by the incompatible werf version
+func ImagesMetadata(repository string) (map[string]ImageMetadata, error) {
+	records := map[string]ImageMetadata{}
+
+	reference := strings.Join([]string{repository, ImagesMetadataTag}, ":")
+	i, _, err := image(reference)
+	if err != nil {
+		if strings.Contains(err.Error(), "MANIFEST_UNKNOWN") || strings.Contains(err.Error(), "NAME_UNKNOWN") {
+			return records, nil
+		}
+
+		return nil, err
+	}
+
+	configFile, err := i.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := configFile.Config.Labels[imagesMetadataLabel]
+	if !ok {
+		return records, nil
+	}
+
+	var metadata imagesMetadata
+	if err := json.Unmarshal([]byte(value), &metadata); err != nil {
+		return nil, fmt.Errorf("bad images metadata %s: %s", reference, err)
+	}
+
+	if metadata.Version != imagesMetadataVersion {
+		return records, nil
+	}
+
+	for tag, record := range metadata.Records {
+		records[tag] = record
+	}
+
+	return records, nil
+}
+
+// WriteImagesMetadata replaces metadata records of the repository.
+// Records are stored in the config of the image without layers, thus reading all records takes two requests
+func WriteImagesMetadata(repository string, records map[string]ImageMetadata) error {
+	data, err := json.Marshal(imagesMetadata{Version: imagesMetadataVersion, Records: records})
+	if err != nil {
+		return err
+	}
+
+	configFile := &v1.ConfigFile{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       v1.RootFS{Type: "layers"},
+		Config: v1.Config{
+			Labels: map[string]string{
+				imagePkg.WerfLabel:  "true",
+				imagesMetadataLabel: string(data),
+			},
+		},
+	}
+
+	img, err := mutate.ConfigFile(empty.Image, configFile)
+	if err != nil {
+		return err
+	}
+
+	reference := strings.Join([]string{repository, ImagesMetadataTag}, ":")
+	if _, err := PushImage(img, reference, PushOptions{MaxAttempts: DefaultPushMaxAttempts, RetryDelay: DefaultPushRetryDelay}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WerfImages returns werf images of the repository like ImagesByWerfImageLabel does.
+// Tags with metadata records are not inspected: their images are fetched only when used and RepoImage.Metadata is set,
+// the rest tags (e.g. published by the older werf) are inspected. Protection marker tags are not returned,
+// RepoImage.HasProtectionMarker is set for the tag with the marker instead
+func WerfImages(repository string) ([]RepoImage, error) {
+	tags, err := Tags(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := ImagesMetadata(repository)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read images metadata of %s: %s", repository, err)
+	}
+
+	markerTags := map[string]bool{}
+	for _, tag := range tags {
+		if IsProtectionMarkerTag(tag) {
+			markerTags[tag] = true
+		}
+	}
+
+	var repoImages []RepoImage
+	for _, tag := range tags {
+		if tag == ImagesMetadataTag || IsProtectionMarkerTag(tag) {
+			continue
+		}
+
+		var repoImage *RepoImage
+		if record, ok := records[tag]; ok {
+			record := record
+			newRepoImage := NewRepoImage(repository, tag)
+			newRepoImage.Metadata = &record
+			repoImage = &newRepoImage
+		} else {
+			repoImage, err = imageByWerfImageLabel(repository, tag, "true")
+			if err != nil {
+				return nil, err
+			}
+
+			if repoImage == nil {
+				continue
+			}
+		}
+
+		repoImage.HasProtectionMarker = markerTags[ProtectionMarkerTag(tag)]
+		repoImages = append(repoImages, *repoImage)
+	}
+
+	return repoImages, nil
+}
+
+// NewRepoImage returns the repo image, which manifest is fetched on the first use
+func NewRepoImage(repository, tag string) RepoImage {
+	return RepoImage{
+		Repository: repository,
+		Tag:        tag,
+		Image:      &lazyImage{reference: strings.Join([]string{repository, tag}, ":")},
+	}
+}
+
+type lazyImage struct {
+	reference string
+
+	once sync.Once
+	img  v1.Image
+	err  error
+}
+
+func (i *lazyImage) get() (v1.Image, error) {
+	i.once.Do(func() {
+		i.img, _, i.err = image(i.reference)
+	})
+
+	return i.img, i.err
+}
+
+func (i *lazyImage) Layers() ([]v1.Layer, error) {
+	img, err := i.get()
+	if err != nil {
+		return nil, err
+	}
+
+	return img.Layers()
+}
+
+func (i *lazyImage) MediaType() (types.MediaType, error) {
+	img, err := i.get()
+	if err != nil {
+		return "", err
+	}
+
+	return img.MediaType()
+}
+
+func (i *lazyImage) ConfigName() (v1.Hash, error) {
+	img, err := i.get()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	return img.ConfigName()
+}
+
+func (i *lazyImage) ConfigFile() (*v1.ConfigFile, error) {
+	img, err := i.get()
+	if err != nil {
+		return nil, err
+	}
+
+	return img.ConfigFile()
+}
+
+func (i *lazyImage) RawConfigFile() ([]byte, error) {
+	img, err := i.get()
+	if err != nil {
+		return nil, err
+	}
+
+	return img.RawConfigFile()
+}
+
+func (i *lazyImage) Digest() (v1.Hash, error) {
+	img, err := i.get()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	return img.Digest()
+}
+
+func (i *lazyImage) Manifest() (*v1.Manifest, error) {
+	img, err := i.get()
+	if err != nil {
+		return nil, err
+	}
+
+	return img.Manifest()
+}
+
+func (i *lazyImage) RawManifest() ([]byte, error) {
+	img, err := i.get()
+	if err != nil {
+		return nil, err
+	}
+
+	return img.RawManifest()
+}
+
+func (i *lazyImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	img, err := i.get()
+	if err != nil {
+		return nil, err
+	}
+
+	return img.LayerByDigest(h)
+}
+
+func (i *lazyImage) LayerByDiffID(h v1.Hash) (v1.Layer, error) {
+	img, err := i.get()
+	if err != nil {
+		return nil, err
+	}
+
+	return img.LayerByDiffID(h)
+}
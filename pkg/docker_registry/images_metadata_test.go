@@ -0,0 +1,131 @@
+package docker_registry
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flant/go-containerregistry/pkg/registry"
+	v1 "github.com/flant/go-containerregistry/pkg/v1"
+
+	imagePkg "github.com/flant/werf/pkg/image"
+)
+
+func TestImagesMetadata(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	repository := fmt.Sprintf("%s/project/app", strings.TrimPrefix(server.URL, "http://"))
+
+	records, err := ImagesMetadata(repository)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(records) != 0 {
+		t.Errorf("expected no records for the repository without metadata, got %v", records)
+	}
+
+	commitTime := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	expectedRecords := map[string]ImageMetadata{
+		"master": {
+			ImageName:     "app",
+			TagStrategy:   "git-branch",
+			ImageTag:      "master",
+			GitCommit:     "6d5d170b6e3d9b4f2f2e1a1d6e0a0b9b7a8c9d0e",
+			GitCommitTime: &commitTime,
+			Created:       time.Date(2019, 7, 1, 10, 5, 0, 0, time.UTC),
+			WerfVersion:   "v1.0.0",
+		},
+		"v1.2.0": {
+			ImageName:   "app",
+			TagStrategy: "git-semver",
+			ImageTag:    "v1.2.0",
+			GitTag:      "v1.2.0",
+			Created:     time.Date(2019, 7, 2, 10, 5, 0, 0, time.UTC),
+			WerfVersion: "v1.0.0",
+		},
+	}
+
+	if err := WriteImagesMetadata(repository, expectedRecords); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	records, err = ImagesMetadata(repository)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(records, expectedRecords) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expectedRecords, records)
+	}
+
+	repoImage := NewRepoImage(repository, ImagesMetadataTag)
+	configFile, err := repoImage.ConfigFile()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if configFile.Config.Labels[imagePkg.WerfImageLabel] != "" {
+		t.Errorf("metadata image must not be treated as werf image")
+	}
+}
+
+func TestImageMetadataLabels(t *testing.T) {
+	record := ImageMetadata{
+		ImageName:   "app",
+		TagStrategy: "stages-signature",
+		ImageTag:    "b2a9e0c1",
+		GitCommit:   "6d5d170b6e3d9b4f2f2e1a1d6e0a0b9b7a8c9d0e",
+		WerfVersion: "v1.0.0",
+	}
+
+	expected := map[string]string{
+		imagePkg.WerfImageLabel:       "true",
+		imagePkg.WerfImageNameLabel:   "app",
+		imagePkg.WerfTagStrategyLabel: "stages-signature",
+		imagePkg.WerfImageTagLabel:    "b2a9e0c1",
+		imagePkg.WerfGitCommitLabel:   "6d5d170b6e3d9b4f2f2e1a1d6e0a0b9b7a8c9d0e",
+		imagePkg.WerfVersionLabel:     "v1.0.0",
+	}
+
+	if labels := record.Labels(); !reflect.DeepEqual(labels, expected) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, labels)
+	}
+}
+
+func TestNewImageMetadata(t *testing.T) {
+	created := time.Date(2020, 2, 20, 10, 0, 0, 0, time.UTC)
+	record := ImageMetadata{
+		ImageName:   "app",
+		TagStrategy: "stages-signature",
+		ImageTag:    "b2a9e0c1",
+		GitCommit:   "6d5d170b6e3d9b4f2f2e1a1d6e0a0b9b7a8c9d0e",
+		Created:     created,
+		WerfVersion: "v1.0.0",
+		Protected:   true,
+	}
+
+	configFile := v1.ConfigFile{Created: v1.Time{Time: created}, Config: v1.Config{Labels: record.Labels()}}
+	if res := NewImageMetadata(configFile); !reflect.DeepEqual(res, record) {
+		t.Errorf("\n[EXPECTED]: %+v\n[GOT]: %+v", record, res)
+	}
+}
+
+func TestImageMetadataAddReferencingGitCommit(t *testing.T) {
+	record := ImageMetadata{GitCommit: "c1"}
+	for _, commit := range []string{"c1", "c2", "c2", "c3"} {
+		record.AddReferencingGitCommit(commit)
+	}
+
+	if expected := []string{"c2", "c3"}; !reflect.DeepEqual(record.ReferencingGitCommits, expected) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, record.ReferencingGitCommits)
+	}
+
+	if expected := []string{"c1", "c2", "c3"}; !reflect.DeepEqual(record.GitCommits(), expected) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, record.GitCommits())
+	}
+}
@@ -0,0 +1,115 @@
+package docker_registry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "github.com/flant/go-containerregistry/pkg/v1"
+	"github.com/flant/go-containerregistry/pkg/v1/empty"
+	"github.com/flant/go-containerregistry/pkg/v1/mutate"
+
+	imagePkg "github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/util"
+)
+
+const (
+	// ProtectionMarkerTagPrefix is the prefix of the tags, which store the protection of the published tags.
+	// Each protected tag has its own marker tag, thus concurrent protect commands do not overwrite each other
+	ProtectionMarkerTagPrefix = "werf-protection."
+
+	protectionMarkerTagLabel = "werf-protection-tag"
+	maxTagLength             = 128
+)
+
+// ProtectionMarkerTag returns the marker tag of the tag, the tag is hashed if the marker tag exceeds the tag length limit
+func ProtectionMarkerTag(tag string) string {
+	markerTag := ProtectionMarkerTagPrefix + tag
+	if len(markerTag) > maxTagLength {
+		markerTag = ProtectionMarkerTagPrefix + util.MurmurHash(tag)
+	}
+
+	return markerTag
+}
+
+func IsProtectionMarkerTag(tag string) bool {
+	return strings.HasPrefix(tag, ProtectionMarkerTagPrefix)
+}
+
+// WriteProtectionMarker marks the published tag protected or unprotected, the marker overrides the protected label the image has been published with.
+// The marker is the image without layers, the config of which contains the tag, thus each marker has its own digest and is removed separately
+func WriteProtectionMarker(repository, tag string, protected bool) error {
+	reference := strings.Join([]string{repository, tag}, ":")
+	configFile, err := ImageConfigFile(reference)
+	if err != nil {
+		return err
+	}
+
+	if configFile.Config.Labels[imagePkg.WerfImageLabel] != "true" {
+		return fmt.Errorf("%s is not an image published by werf", reference)
+	}
+
+	markerConfigFile := &v1.ConfigFile{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       v1.RootFS{Type: "layers"},
+		Config: v1.Config{
+			Labels: map[string]string{
+				imagePkg.WerfLabel:          "true",
+				protectionMarkerTagLabel:    tag,
+				imagePkg.WerfProtectedLabel: strconv.FormatBool(protected),
+			},
+		},
+	}
+
+	img, err := mutate.ConfigFile(empty.Image, markerConfigFile)
+	if err != nil {
+		return err
+	}
+
+	markerReference := strings.Join([]string{repository, ProtectionMarkerTag(tag)}, ":")
+	if _, err := PushImage(img, markerReference, PushOptions{MaxAttempts: DefaultPushMaxAttempts, RetryDelay: DefaultPushRetryDelay}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ProtectionMarker returns the protection of the tag stored in the marker tag, the second value is false if the tag does not have the marker
+func ProtectionMarker(repository, tag string) (bool, bool, error) {
+	reference := strings.Join([]string{repository, ProtectionMarkerTag(tag)}, ":")
+	configFile, err := ImageConfigFile(reference)
+	if err != nil {
+		if strings.Contains(err.Error(), "MANIFEST_UNKNOWN") || strings.Contains(err.Error(), "NAME_UNKNOWN") {
+			return false, false, nil
+		}
+
+		return false, false, err
+	}
+
+	labels := configFile.Config.Labels
+	if labels[protectionMarkerTagLabel] != tag {
+		return false, false, fmt.Errorf("bad protection marker %s: expected marker of tag %s, got %q", reference, tag, labels[protectionMarkerTagLabel])
+	}
+
+	return labels[imagePkg.WerfProtectedLabel] == "true", true, nil
+}
+
+// OrphanedProtectionMarkerTags returns the marker tags of the removed tags
+func OrphanedProtectionMarkerTags(tags []string) []string {
+	markerTags := map[string]bool{}
+	for _, tag := range tags {
+		if !IsProtectionMarkerTag(tag) {
+			markerTags[ProtectionMarkerTag(tag)] = true
+		}
+	}
+
+	var res []string
+	for _, tag := range tags {
+		if IsProtectionMarkerTag(tag) && !markerTags[tag] {
+			res = append(res, tag)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,118 @@
+package docker_registry
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flant/go-containerregistry/pkg/registry"
+	v1 "github.com/flant/go-containerregistry/pkg/v1"
+	"github.com/flant/go-containerregistry/pkg/v1/mutate"
+	"github.com/flant/go-containerregistry/pkg/v1/random"
+
+	imagePkg "github.com/flant/werf/pkg/image"
+)
+
+func TestProtectionMarker(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	repository := fmt.Sprintf("%s/project/app", strings.TrimPrefix(server.URL, "http://"))
+
+	pushLabeledImage := func(tag string, labels map[string]string) {
+		img, err := random.Image(256, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		img, err = mutate.Config(img, v1.Config{Labels: labels})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if _, err := PushImage(img, strings.Join([]string{repository, tag}, ":"), PushOptions{MaxAttempts: 1}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	werfImageLabels := map[string]string{
+		imagePkg.WerfImageLabel:       "true",
+		imagePkg.WerfImageNameLabel:   "app",
+		imagePkg.WerfTagStrategyLabel: "git-branch",
+		imagePkg.WerfVersionLabel:     "v1.0.0",
+	}
+	pushLabeledImage("master", werfImageLabels)
+	pushLabeledImage("feature-a", werfImageLabels)
+	pushLabeledImage("alien", map[string]string{})
+
+	if err := WriteProtectionMarker(repository, "alien", true); err == nil {
+		t.Errorf("expected error for the image not published by werf")
+	}
+
+	if _, exists, err := ProtectionMarker(repository, "master"); err != nil || exists {
+		t.Fatalf("expected no marker, got %v %v", exists, err)
+	}
+
+	for _, protected := range []bool{true, false} {
+		if err := WriteProtectionMarker(repository, "master", protected); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if err := WriteProtectionMarker(repository, "feature-a", true); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		markerProtected, exists, err := ProtectionMarker(repository, "master")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if !exists || markerProtected != protected {
+			t.Errorf("expected marker with protection %v, got %v (exists %v)", protected, markerProtected, exists)
+		}
+	}
+}
+
+func TestProtectionMarkerTag(t *testing.T) {
+	if markerTag := ProtectionMarkerTag("v1.2.0"); markerTag != "werf-protection.v1.2.0" {
+		t.Errorf("unexpected marker tag %s", markerTag)
+	}
+
+	longTag := strings.Repeat("a", maxTagLength)
+	markerTag := ProtectionMarkerTag(longTag)
+	if len(markerTag) > maxTagLength || !IsProtectionMarkerTag(markerTag) || markerTag == ProtectionMarkerTag(longTag+"b") {
+		t.Errorf("bad marker tag %s of the long tag", markerTag)
+	}
+}
+
+func TestOrphanedProtectionMarkerTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		expected []string
+	}{
+		{
+			name: "noMarkers",
+			tags: []string{"master", ImagesMetadataTag},
+		},
+		{
+			name: "markersOfExistingTags",
+			tags: []string{"master", ProtectionMarkerTag("master"), strings.Repeat("a", maxTagLength), ProtectionMarkerTag(strings.Repeat("a", maxTagLength))},
+		},
+		{
+			name:     "markersOfRemovedTags",
+			tags:     []string{"master", ProtectionMarkerTag("master"), ProtectionMarkerTag("feature-a"), ProtectionMarkerTag(strings.Repeat("a", maxTagLength))},
+			expected: []string{ProtectionMarkerTag("feature-a"), ProtectionMarkerTag(strings.Repeat("a", maxTagLength))},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if res := OrphanedProtectionMarkerTags(test.tags); !reflect.DeepEqual(res, test.expected) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", test.expected, res)
+			}
+		})
+	}
+}
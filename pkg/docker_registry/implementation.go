@@ -0,0 +1,280 @@
+package docker_registry
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/flant/go-containerregistry/pkg/authn"
+	"github.com/flant/go-containerregistry/pkg/name"
+	"github.com/flant/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	DefaultImplementationName   = "default"
+	GCRImplementationName       = "gcr"
+	GitLabImplementationName    = "gitlab"
+	DockerHubImplementationName = "dockerhub"
+	HarborImplementationName    = "harbor"
+	QuayImplementationName      = "quay"
+)
+
+var (
+	ImplementationNames = []string{DefaultImplementationName, GCRImplementationName, GitLabImplementationName, DockerHubImplementationName, HarborImplementationName, QuayImplementationName}
+
+	implementationUrlPatterns = map[string][]string{
+		GitLabImplementationName:    {"^registry\\.gitlab\\.com", "gitlab"},
+		DockerHubImplementationName: {"^index\\.docker\\.io", "^registry-1\\.docker\\.io", "^docker\\.io"},
+		HarborImplementationName:    {"harbor"},
+		QuayImplementationName:      {"^quay\\.io", "quay"},
+	}
+)
+
+// RegistryImplementation removes tags in the way the registry supports:
+// the default docker registry API removes the manifest by the digest (with all tags of the image), vendor APIs remove the tag
+type RegistryImplementation interface {
+	String() string
+	// DeleteReference returns the reference (repo@digest or repo:tag) to remove the tag of the image by
+	DeleteReference(repoImage RepoImage) (string, error)
+	Delete(reference string) error
+}
+
+// Implementation returns the implementation specified by Options.Implementation or detected by the registry host of the reference
+func Implementation(reference string) (RegistryImplementation, error) {
+	implementationName := RepoImplementation
+	if implementationName == "" {
+		var err error
+		implementationName, err = DetectImplementation(reference)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewImplementation(implementationName)
+}
+
+func NewImplementation(implementationName string) (RegistryImplementation, error) {
+	switch implementationName {
+	case DefaultImplementationName:
+		return defaultImplementation{}, nil
+	case GCRImplementationName:
+		return gcrImplementation{}, nil
+	case GitLabImplementationName:
+		return gitlabImplementation{}, nil
+	case DockerHubImplementationName:
+		return dockerHubImplementation{apiUrl: DockerHubApiUrl, tokens: sharedDockerHubTokens}, nil
+	case HarborImplementationName:
+		return harborImplementation{}, nil
+	case QuayImplementationName:
+		return quayImplementation{token: QuayToken}, nil
+	default:
+		return nil, fmt.Errorf("unknown repo implementation '%s', expected one of: %s", implementationName, strings.Join(ImplementationNames, ", "))
+	}
+}
+
+// DetectImplementation returns the implementation name by the registry host of the reference, the default implementation is used for unknown hosts
+func DetectImplementation(reference string) (string, error) {
+	if isGCR, err := IsGCR(reference); err != nil {
+		return "", err
+	} else if isGCR {
+		return GCRImplementationName, nil
+	}
+
+	u, err := url.Parse(fmt.Sprintf("scheme://%s", reference))
+	if err != nil {
+		return "", err
+	}
+
+	// the reference without the registry host points to Docker Hub
+	host := u.Host
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return DockerHubImplementationName, nil
+	}
+
+	for _, implementationName := range ImplementationNames {
+		for _, pattern := range implementationUrlPatterns[implementationName] {
+			matched, err := regexp.MatchString(pattern, host)
+			if err != nil {
+				return "", err
+			}
+
+			if matched {
+				return implementationName, nil
+			}
+		}
+	}
+
+	return DefaultImplementationName, nil
+}
+
+type defaultImplementation struct{}
+
+func (i defaultImplementation) String() string { return DefaultImplementationName }
+
+func (i defaultImplementation) DeleteReference(repoImage RepoImage) (string, error) {
+	return digestDeleteReference(repoImage)
+}
+
+// Delete uses the GitLab API if the registry does not allow to delete the manifest by the docker registry API (self-hosted GitLab)
+func (i defaultImplementation) Delete(reference string) error {
+	r, err := name.ParseReference(reference, parseReferenceOptions()...)
+	if err != nil {
+		return fmt.Errorf("parsing reference %q: %v", reference, err)
+	}
+
+	if deleteErr := remote.Delete(r, remote.WithAuthFromKeychain(authn.DefaultKeychain), remote.WithTransport(getHttpTransport())); deleteErr != nil {
+		if strings.Contains(deleteErr.Error(), "UNAUTHORIZED") {
+			auth, authErr := authn.DefaultKeychain.Resolve(r.Context().Registry)
+			if authErr != nil {
+				return fmt.Errorf("getting creds for %q: %v", r, authErr)
+			}
+
+			if gitlabRegistryDeleteErr := GitlabRegistryDelete(r, auth, getHttpTransport()); gitlabRegistryDeleteErr != nil {
+				if strings.Contains(gitlabRegistryDeleteErr.Error(), "UNAUTHORIZED") {
+					return fmt.Errorf("deleting image %q: %v", r, deleteErr)
+				}
+				return fmt.Errorf("deleting image %q: %v", r, gitlabRegistryDeleteErr)
+			}
+		} else {
+			return fmt.Errorf("deleting image %q: %v", r, deleteErr)
+		}
+	}
+
+	return nil
+}
+
+// gcrImplementation removes the tag by the docker registry API: GCR does not allow to delete the manifest, which is referenced by tags
+type gcrImplementation struct{}
+
+func (i gcrImplementation) String() string { return GCRImplementationName }
+
+func (i gcrImplementation) DeleteReference(repoImage RepoImage) (string, error) {
+	return tagDeleteReference(repoImage), nil
+}
+
+func (i gcrImplementation) Delete(reference string) error {
+	r, err := name.ParseReference(reference, parseReferenceOptions()...)
+	if err != nil {
+		return fmt.Errorf("parsing reference %q: %v", reference, err)
+	}
+
+	if err := remote.Delete(r, remote.WithAuthFromKeychain(authn.DefaultKeychain), remote.WithTransport(getHttpTransport())); err != nil {
+		return fmt.Errorf("deleting image %q: %v", r, err)
+	}
+
+	return nil
+}
+
+type gitlabImplementation struct{}
+
+func (i gitlabImplementation) String() string { return GitLabImplementationName }
+
+func (i gitlabImplementation) DeleteReference(repoImage RepoImage) (string, error) {
+	return digestDeleteReference(repoImage)
+}
+
+func (i gitlabImplementation) Delete(reference string) error {
+	r, err := name.ParseReference(reference, parseReferenceOptions()...)
+	if err != nil {
+		return fmt.Errorf("parsing reference %q: %v", reference, err)
+	}
+
+	auth, err := authn.DefaultKeychain.Resolve(r.Context().Registry)
+	if err != nil {
+		return fmt.Errorf("getting creds for %q: %v", r, err)
+	}
+
+	if err := GitlabRegistryDelete(r, auth, getHttpTransport()); err != nil {
+		return fmt.Errorf("deleting image %q: %v", r, err)
+	}
+
+	return nil
+}
+
+func digestDeleteReference(repoImage RepoImage) (string, error) {
+	digest, err := repoImage.Digest()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{repoImage.Repository, digest.String()}, "@"), nil
+}
+
+func tagDeleteReference(repoImage RepoImage) string {
+	return strings.Join([]string{repoImage.Repository, repoImage.Tag}, ":")
+}
+
+// parseTagReference returns the parsed reference, vendor APIs remove tags only
+func parseTagReference(reference string) (name.Tag, error) {
+	tag, err := name.NewTag(reference, parseReferenceOptions()...)
+	if err != nil {
+		return name.Tag{}, fmt.Errorf("parsing tag reference %q: %v", reference, err)
+	}
+
+	return tag, nil
+}
+
+// basicCredentials returns the username and the password of the registry from the docker config
+func basicCredentials(registry name.Registry) (string, string, error) {
+	auth, err := authn.DefaultKeychain.Resolve(registry)
+	if err != nil {
+		return "", "", fmt.Errorf("getting creds for %q: %v", registry, err)
+	}
+
+	authorization, err := auth.Authorization()
+	if err != nil {
+		return "", "", fmt.Errorf("getting creds for %q: %v", registry, err)
+	}
+
+	if !strings.HasPrefix(authorization, "Basic ") {
+		return "", "", fmt.Errorf("username and password for %q are not found in the docker config", registry)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "Basic "))
+	if err != nil {
+		return "", "", fmt.Errorf("bad creds for %q: %v", registry, err)
+	}
+
+	parts := strings.SplitN(string(data), ":", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("bad creds for %q", registry)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+func doApiRequest(req *http.Request, expectedStatusCodes ...int) ([]byte, error) {
+	resp, err := (&http.Client{Transport: getHttpTransport()}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, statusCode := range expectedStatusCodes {
+		if resp.StatusCode == statusCode {
+			return body, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected status code during %s %s: %v; %v", req.Method, req.URL.String(), resp.Status, string(body))
+}
+
+var temporaryStatusCodeRegexp = regexp.MustCompile(`(status code |: )(429|5\d\d)\b`)
+
+// IsTemporaryError checks the registry request failed on the network level or the registry responded with 429 Too Many Requests or 5xx status code
+func IsTemporaryError(err error) bool {
+	if isTemporaryPushError(err) {
+		return true
+	}
+
+	return strings.Contains(err.Error(), "TOOMANYREQUESTS") || temporaryStatusCodeRegexp.MatchString(err.Error())
+}
@@ -0,0 +1,142 @@
+package docker_registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DockerHubApiUrl is the Docker Hub API, which is used to delete tags (the docker registry API of Docker Hub does not support deletion)
+var DockerHubApiUrl = "https://hub.docker.com"
+
+type dockerHubImplementation struct {
+	apiUrl string
+	tokens *dockerHubTokens
+}
+
+// dockerHubTokens caches the JWT of the Docker Hub API by the API url and the credentials,
+// the implementation is created for each deleted image, thus the tokens are shared by all instances
+type dockerHubTokens struct {
+	mutex  sync.Mutex
+	tokens map[string]string
+}
+
+var sharedDockerHubTokens = newDockerHubTokens()
+
+func newDockerHubTokens() *dockerHubTokens {
+	return &dockerHubTokens{tokens: map[string]string{}}
+}
+
+// get returns the cached token or logs in, concurrent callers wait for the single login
+func (t *dockerHubTokens) get(key string, login func() (string, error)) (string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if token, ok := t.tokens[key]; ok {
+		return token, nil
+	}
+
+	token, err := login()
+	if err != nil {
+		return "", err
+	}
+	t.tokens[key] = token
+
+	return token, nil
+}
+
+func (t *dockerHubTokens) reset(key, token string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.tokens[key] == token {
+		delete(t.tokens, key)
+	}
+}
+
+func (i dockerHubImplementation) String() string { return DockerHubImplementationName }
+
+func (i dockerHubImplementation) DeleteReference(repoImage RepoImage) (string, error) {
+	return tagDeleteReference(repoImage), nil
+}
+
+func (i dockerHubImplementation) Delete(reference string) error {
+	tag, err := parseTagReference(reference)
+	if err != nil {
+		return err
+	}
+
+	username, password, err := basicCredentials(tag.Context().Registry)
+	if err != nil {
+		return err
+	}
+
+	// official images are stored in the library namespace
+	repository := tag.Context().RepositoryStr()
+	if !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+
+	tokenKey := strings.Join([]string{i.apiUrl, username, password}, "\x00")
+	for attempt := 1; ; attempt++ {
+		token, err := i.tokens.get(tokenKey, func() (string, error) {
+			return i.login(username, password)
+		})
+		if err != nil {
+			return fmt.Errorf("Docker Hub login failed: %s", err)
+		}
+
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/v2/repositories/%s/tags/%s/", i.apiUrl, repository, tag.TagStr()), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "JWT "+token)
+
+		_, err = doApiRequest(req, http.StatusOK, http.StatusAccepted, http.StatusNoContent)
+		if err == nil {
+			return nil
+		}
+
+		// the cached token might have expired
+		if attempt == 1 && strings.Contains(err.Error(), fmt.Sprintf("%d %s", http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))) {
+			i.tokens.reset(tokenKey, token)
+			continue
+		}
+
+		return fmt.Errorf("deleting image %q: %v", reference, err)
+	}
+}
+
+func (i dockerHubImplementation) login(username, password string) (string, error) {
+	data, err := json.Marshal(map[string]string{"username": username, "password": password})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v2/users/login/", i.apiUrl), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	body, err := doApiRequest(req, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", err
+	}
+
+	if resp.Token == "" {
+		return "", fmt.Errorf("empty token")
+	}
+
+	return resp.Token, nil
+}
@@ -0,0 +1,46 @@
+package docker_registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// harborImplementation deletes tags by the Harbor API (/api/repositories/REPO/tags/TAG): deletion of the manifest by the docker registry API is not allowed in Harbor
+type harborImplementation struct{}
+
+func (i harborImplementation) String() string { return HarborImplementationName }
+
+func (i harborImplementation) DeleteReference(repoImage RepoImage) (string, error) {
+	return tagDeleteReference(repoImage), nil
+}
+
+func (i harborImplementation) Delete(reference string) error {
+	tag, err := parseTagReference(reference)
+	if err != nil {
+		return err
+	}
+
+	username, password, err := basicCredentials(tag.Context().Registry)
+	if err != nil {
+		return err
+	}
+
+	u := url.URL{
+		Scheme: tag.Context().Registry.Scheme(),
+		Host:   tag.Context().RegistryStr(),
+		Path:   fmt.Sprintf("/api/repositories/%s/tags/%s", tag.Context().RepositoryStr(), tag.TagStr()),
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(username, password)
+
+	if _, err := doApiRequest(req, http.StatusOK); err != nil {
+		return fmt.Errorf("deleting image %q: %v", reference, err)
+	}
+
+	return nil
+}
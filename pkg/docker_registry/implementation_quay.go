@@ -0,0 +1,50 @@
+package docker_registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// QuayToken is the OAuth access token of the Quay application, the Quay API does not accept the docker credentials
+var QuayToken string
+
+// quayImplementation deletes tags by the Quay API (/api/v1/repository/REPO/tag/TAG)
+type quayImplementation struct {
+	token string
+}
+
+func (i quayImplementation) String() string { return QuayImplementationName }
+
+func (i quayImplementation) DeleteReference(repoImage RepoImage) (string, error) {
+	return tagDeleteReference(repoImage), nil
+}
+
+func (i quayImplementation) Delete(reference string) error {
+	if i.token == "" {
+		return fmt.Errorf("deleting image %q: Quay API token is required ($WERF_QUAY_TOKEN)", reference)
+	}
+
+	tag, err := parseTagReference(reference)
+	if err != nil {
+		return err
+	}
+
+	u := url.URL{
+		Scheme: tag.Context().Registry.Scheme(),
+		Host:   tag.Context().RegistryStr(),
+		Path:   fmt.Sprintf("/api/v1/repository/%s/tag/%s", tag.Context().RepositoryStr(), tag.TagStr()),
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+i.token)
+
+	if _, err := doApiRequest(req, http.StatusOK, http.StatusNoContent); err != nil {
+		return fmt.Errorf("deleting image %q: %v", reference, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,342 @@
+package docker_registry
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/flant/go-containerregistry/pkg/registry"
+	"github.com/flant/go-containerregistry/pkg/v1/random"
+)
+
+// fakeRegistryApi records DELETE requests and passes the rest requests to the handler
+type fakeRegistryApi struct {
+	handler http.Handler
+
+	mutex    sync.Mutex
+	requests []string
+}
+
+func (a *fakeRegistryApi) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodDelete || strings.HasPrefix(req.URL.Path, "/v2/users/login") {
+		a.mutex.Lock()
+		a.requests = append(a.requests, fmt.Sprintf("%s %s %s", req.Method, req.URL.Path, req.Header.Get("Authorization")))
+		a.mutex.Unlock()
+	}
+
+	a.handler.ServeHTTP(resp, req)
+}
+
+func (a *fakeRegistryApi) Requests() []string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return append([]string{}, a.requests...)
+}
+
+// withDockerConfig sets the docker config with credentials of the registries for the test
+func withDockerConfig(t *testing.T, auths map[string]string) func() {
+	dir, err := ioutil.TempDir("", "werf-docker-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := map[string]map[string]map[string]string{"auths": {}}
+	for registryName, credentials := range auths {
+		config["auths"][registryName] = map[string]string{"auth": base64.StdEncoding.EncodeToString([]byte(credentials))}
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldDockerConfig, hasOldDockerConfig := os.LookupEnv("DOCKER_CONFIG")
+	os.Setenv("DOCKER_CONFIG", dir)
+
+	return func() {
+		if hasOldDockerConfig {
+			os.Setenv("DOCKER_CONFIG", oldDockerConfig)
+		} else {
+			os.Unsetenv("DOCKER_CONFIG")
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func statusHandler(statusCode int) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(statusCode)
+	})
+}
+
+// registryWithDeleteHandler serves the in-memory registry, which does not support deletion, and accepts DELETE requests
+func registryWithDeleteHandler() http.Handler {
+	registryHandler := registry.New()
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodDelete {
+			resp.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		registryHandler.ServeHTTP(resp, req)
+	})
+}
+
+func TestDefaultAndGCRImplementations(t *testing.T) {
+	api := &fakeRegistryApi{handler: registryWithDeleteHandler()}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	repository := fmt.Sprintf("%s/project/app", strings.TrimPrefix(server.URL, "http://"))
+
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := PushImage(img, repository+":v1", PushOptions{MaxAttempts: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repoImage := NewRepoImage(repository, "v1")
+
+	tests := []struct {
+		implementation    RegistryImplementation
+		expectedReference string
+		expectedRequest   string
+	}{
+		{defaultImplementation{}, repository + "@" + digest.String(), "DELETE /v2/project/app/manifests/" + digest.String() + " "},
+		{gitlabImplementation{}, repository + "@" + digest.String(), "DELETE /v2/project/app/manifests/" + digest.String() + " "},
+		{gcrImplementation{}, repository + ":v1", "DELETE /v2/project/app/manifests/v1 "},
+	}
+
+	for _, test := range tests {
+		reference, err := test.implementation.DeleteReference(repoImage)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.implementation, err)
+		}
+
+		if reference != test.expectedReference {
+			t.Errorf("%s: expected reference %s, got %s", test.implementation, test.expectedReference, reference)
+		}
+
+		if err := test.implementation.Delete(reference); err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.implementation, err)
+		}
+
+		requests := api.Requests()
+		if len(requests) == 0 || requests[len(requests)-1] != test.expectedRequest {
+			t.Errorf("%s: expected request %q, got %q", test.implementation, test.expectedRequest, requests)
+		}
+	}
+}
+
+func TestDockerHubImplementation(t *testing.T) {
+	var logins int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/users/login/", func(resp http.ResponseWriter, req *http.Request) {
+		var credentials map[string]string
+		if err := json.NewDecoder(req.Body).Decode(&credentials); err != nil || credentials["username"] != "user" || credentials["password"] != "pass" {
+			resp.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		logins++
+		resp.Write([]byte(fmt.Sprintf(`{"token": "jwt-token-%d"}`, logins)))
+	})
+	mux.HandleFunc("/v2/repositories/", func(resp http.ResponseWriter, req *http.Request) {
+		// the first token expires before the last deletion
+		if strings.Contains(req.URL.Path, "/expired/") && req.Header.Get("Authorization") == "JWT jwt-token-1" {
+			resp.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		resp.WriteHeader(http.StatusNoContent)
+	})
+
+	api := &fakeRegistryApi{handler: mux}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	defer withDockerConfig(t, map[string]string{"https://index.docker.io/v1/": "user:pass"})()
+
+	tokens := newDockerHubTokens()
+	implementation := dockerHubImplementation{apiUrl: server.URL, tokens: tokens}
+
+	reference, err := implementation.DeleteReference(NewRepoImage("user/app", "v1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := implementation.Delete(reference); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the token is shared by the implementations created for each deleted image
+	if err := (dockerHubImplementation{apiUrl: server.URL, tokens: tokens}).Delete("nginx:custom"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := implementation.Delete("user/app:expired"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expectedRequests := []string{
+		"POST /v2/users/login/ ",
+		"DELETE /v2/repositories/user/app/tags/v1/ JWT jwt-token-1",
+		"DELETE /v2/repositories/library/nginx/tags/custom/ JWT jwt-token-1",
+		"DELETE /v2/repositories/user/app/tags/expired/ JWT jwt-token-1",
+		"POST /v2/users/login/ ",
+		"DELETE /v2/repositories/user/app/tags/expired/ JWT jwt-token-2",
+	}
+
+	if requests := api.Requests(); strings.Join(requests, "\n") != strings.Join(expectedRequests, "\n") {
+		t.Errorf("\n[EXPECTED]: %q\n[GOT]: %q", expectedRequests, requests)
+	}
+}
+
+func TestHarborImplementation(t *testing.T) {
+	api := &fakeRegistryApi{handler: statusHandler(http.StatusOK)}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	registryName := strings.TrimPrefix(server.URL, "http://")
+	defer withDockerConfig(t, map[string]string{registryName: "admin:Harbor12345"})()
+
+	implementation := harborImplementation{}
+	reference, err := implementation.DeleteReference(NewRepoImage(registryName+"/library/app", "v1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := implementation.Delete(reference); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expectedRequests := []string{"DELETE /api/repositories/library/app/tags/v1 Basic " + base64.StdEncoding.EncodeToString([]byte("admin:Harbor12345"))}
+	if requests := api.Requests(); strings.Join(requests, "\n") != strings.Join(expectedRequests, "\n") {
+		t.Errorf("\n[EXPECTED]: %q\n[GOT]: %q", expectedRequests, requests)
+	}
+}
+
+func TestQuayImplementation(t *testing.T) {
+	api := &fakeRegistryApi{handler: statusHandler(http.StatusNoContent)}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	registryName := strings.TrimPrefix(server.URL, "http://")
+
+	if err := (quayImplementation{}).Delete(registryName + "/org/app:v1"); err == nil || !strings.Contains(err.Error(), "Quay API token is required") {
+		t.Errorf("expected token error, got %v", err)
+	}
+
+	implementation := quayImplementation{token: "oauth-token"}
+	reference, err := implementation.DeleteReference(NewRepoImage(registryName+"/org/app", "v1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := implementation.Delete(reference); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expectedRequests := []string{"DELETE /api/v1/repository/org/app/tag/v1 Bearer oauth-token"}
+	if requests := api.Requests(); strings.Join(requests, "\n") != strings.Join(expectedRequests, "\n") {
+		t.Errorf("\n[EXPECTED]: %q\n[GOT]: %q", expectedRequests, requests)
+	}
+}
+
+func TestImplementationErrors(t *testing.T) {
+	api := &fakeRegistryApi{handler: statusHandler(http.StatusForbidden)}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	registryName := strings.TrimPrefix(server.URL, "http://")
+	defer withDockerConfig(t, map[string]string{registryName: "user:pass"})()
+
+	err := harborImplementation{}.Delete(registryName + "/library/app:v1")
+	if err == nil || !strings.Contains(err.Error(), "403 Forbidden") {
+		t.Errorf("expected forbidden error, got %v", err)
+	}
+}
+
+func TestDetectImplementation(t *testing.T) {
+	tests := []struct {
+		reference, expected string
+	}{
+		{"registry.example.com/project/app", DefaultImplementationName},
+		{"localhost:5000/app", DefaultImplementationName},
+		{"gcr.io/project/app", GCRImplementationName},
+		{"eu.gcr.io/project/app", GCRImplementationName},
+		{"registry.gitlab.com/group/project", GitLabImplementationName},
+		{"gitlab.example.com:5050/group/project", GitLabImplementationName},
+		{"user/app", DockerHubImplementationName},
+		{"index.docker.io/user/app", DockerHubImplementationName},
+		{"docker.io/user/app", DockerHubImplementationName},
+		{"harbor.example.com/library/app", HarborImplementationName},
+		{"quay.io/org/app", QuayImplementationName},
+	}
+
+	for _, test := range tests {
+		implementationName, err := DetectImplementation(test.reference)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.reference, err)
+		}
+
+		if implementationName != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.reference, test.expected, implementationName)
+		}
+	}
+
+	if _, err := NewImplementation("artifactory"); err == nil {
+		t.Errorf("expected error for unknown implementation")
+	}
+}
+
+func TestIsTemporaryError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{fmt.Errorf(`deleting image "registry.example.com/app:tag": unsupported status code 503; body: `), true},
+		{fmt.Errorf(`deleting image "registry.example.com/app:tag": unsupported status code 429; body: `), true},
+		{fmt.Errorf(`deleting image "registry.example.com/app:tag": TOOMANYREQUESTS: slow down`), true},
+		{fmt.Errorf(`deleting image "harbor.example.com/app:tag": unexpected status code during DELETE https://harbor.example.com/api/repositories/app/tags/tag: 502 Bad Gateway; `), true},
+		{fmt.Errorf(`deleting image "registry.example.com/app:tag": read tcp: connection reset by peer`), true},
+		{fmt.Errorf(`deleting image "registry.example.com/app:tag": MANIFEST_UNKNOWN: manifest unknown`), false},
+		{fmt.Errorf(`deleting image "harbor.example.com/app:tag": unexpected status code during DELETE https://harbor.example.com/api/repositories/app/tags/tag: 404 Not Found; `), false},
+		{&url.Error{Op: "Get", URL: "https://registry.example.com/v2/", Err: &net.DNSError{Err: "i/o timeout", Name: "registry.example.com", IsTimeout: true}}, true},
+		{&url.Error{Op: "Patch", URL: "https://registry.example.com/v2/app/blobs/uploads/1", Err: errors.New("read tcp: connection reset by peer")}, true},
+		{&url.Error{Op: "Get", URL: "https://registry.example.com/v2/", Err: &net.DNSError{Err: "no such host", Name: "registry.example.com", IsNotFound: true}}, false},
+		{&url.Error{Op: "Get", URL: "https://registry.example.com/v2/", Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, false},
+		{&url.Error{Op: "Get", URL: "https://registry.example.com/v2/", Err: x509.UnknownAuthorityError{}}, false},
+	}
+
+	for _, test := range tests {
+		if IsTemporaryError(test.err) != test.expected {
+			t.Errorf("%s: expected temporary %v", test.err, test.expected)
+		}
+	}
+}
@@ -22,6 +22,7 @@ import (
 var (
 	InsecureRegistry      = false
 	SkipTlsVerifyRegistry = false
+	RepoImplementation    = ""
 	GCRUrlPatterns        = []string{"^container\\.cloud\\.google\\.com", "^gcr\\.io", "^.*\\.gcr\\.io"}
 )
 
@@ -29,16 +30,32 @@ type RepoImage struct {
 	Repository string
 	Tag        string
 	v1.Image
+
+	// Metadata is the record published along with the image, the image is not fetched until it is used
+	Metadata *ImageMetadata
+	// HasProtectionMarker is set if the repository has or might have the protection marker tag of the tag, the marker is read by cleanup
+	HasProtectionMarker bool
 }
 
 type Options struct {
 	InsecureRegistry      bool
 	SkipTlsVerifyRegistry bool
+	// RepoImplementation is the registry implementation to delete tags with, it is detected by the registry host if empty
+	RepoImplementation string
+	QuayToken          string
 }
 
 func Init(opts Options) error {
+	if opts.RepoImplementation != "" {
+		if _, err := NewImplementation(opts.RepoImplementation); err != nil {
+			return err
+		}
+	}
+
 	InsecureRegistry = opts.InsecureRegistry
 	SkipTlsVerifyRegistry = opts.SkipTlsVerifyRegistry
+	RepoImplementation = opts.RepoImplementation
+	QuayToken = opts.QuayToken
 	return nil
 }
 
@@ -71,41 +88,52 @@ func ImagesByWerfImageLabel(reference, labelValue string) ([]RepoImage, error) {
 	}
 
 	for _, tag := range tags {
-		tagReference := strings.Join([]string{reference, tag}, ":")
-		v1Image, _, err := image(tagReference)
+		repoImage, err := imageByWerfImageLabel(reference, tag, labelValue)
 		if err != nil {
-			if strings.Contains(err.Error(), "MANIFEST_UNKNOWN") {
-				logboek.LogErrorF("WARNING: Broken tag %s was skipped: %s\n", tagReference, err)
-				continue
-			}
-
-			if strings.Contains(err.Error(), "BLOB_UNKNOWN") {
-				logboek.LogErrorF("WARNING: Broken tag %s was skipped: %s\n", tagReference, err)
-				continue
-			}
 			return nil, err
 		}
 
-		configFile, err := v1Image.ConfigFile()
-		if err != nil {
-			return nil, err
+		if repoImage != nil {
+			repoImages = append(repoImages, *repoImage)
+		}
+	}
+
+	return repoImages, nil
+}
+
+// imageByWerfImageLabel inspects the image config and returns nil if the image does not have werf-image label with the value or the tag is broken
+func imageByWerfImageLabel(reference, tag, labelValue string) (*RepoImage, error) {
+	tagReference := strings.Join([]string{reference, tag}, ":")
+	v1Image, _, err := image(tagReference)
+	if err != nil {
+		if strings.Contains(err.Error(), "MANIFEST_UNKNOWN") {
+			logboek.LogErrorF("WARNING: Broken tag %s was skipped: %s\n", tagReference, err)
+			return nil, nil
 		}
 
-		for k, v := range configFile.Config.Labels {
-			if k == imagePkg.WerfImageLabel && v == labelValue {
-				repoImage := RepoImage{
-					Repository: reference,
-					Tag:        tag,
-					Image:      v1Image,
-				}
-
-				repoImages = append(repoImages, repoImage)
-				break
-			}
+		if strings.Contains(err.Error(), "BLOB_UNKNOWN") {
+			logboek.LogErrorF("WARNING: Broken tag %s was skipped: %s\n", tagReference, err)
+			return nil, nil
 		}
+		return nil, err
 	}
 
-	return repoImages, nil
+	configFile, err := v1Image.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range configFile.Config.Labels {
+		if k == imagePkg.WerfImageLabel && v == labelValue {
+			return &RepoImage{
+				Repository: reference,
+				Tag:        tag,
+				Image:      v1Image,
+			}, nil
+		}
+	}
+
+	return nil, nil
 }
 
 func Tags(reference string) ([]string, error) {
@@ -171,31 +199,14 @@ func ImageConfigFile(reference string) (v1.ConfigFile, error) {
 	return *configFile, nil
 }
 
+// ImageDelete removes the reference by the implementation of the registry
 func ImageDelete(reference string) error {
-	r, err := name.ParseReference(reference, parseReferenceOptions()...)
+	implementation, err := Implementation(reference)
 	if err != nil {
-		return fmt.Errorf("parsing reference %q: %v", reference, err)
-	}
-
-	if deleteErr := remote.Delete(r, remote.WithAuthFromKeychain(authn.DefaultKeychain), remote.WithTransport(getHttpTransport())); deleteErr != nil {
-		if strings.Contains(deleteErr.Error(), "UNAUTHORIZED") {
-			auth, authErr := authn.DefaultKeychain.Resolve(r.Context().Registry)
-			if authErr != nil {
-				return fmt.Errorf("getting creds for %q: %v", r, authErr)
-			}
-
-			if gitlabRegistryDeleteErr := GitlabRegistryDelete(r, auth, getHttpTransport()); gitlabRegistryDeleteErr != nil {
-				if strings.Contains(gitlabRegistryDeleteErr.Error(), "UNAUTHORIZED") {
-					return fmt.Errorf("deleting image %q: %v", r, deleteErr)
-				}
-				return fmt.Errorf("deleting image %q: %v", r, gitlabRegistryDeleteErr)
-			}
-		} else {
-			return fmt.Errorf("deleting image %q: %v", r, deleteErr)
-		}
+		return err
 	}
 
-	return nil
+	return implementation.Delete(reference)
 }
 
 // TODO https://gitlab.com/gitlab-org/gitlab-ce/issues/48968
@@ -0,0 +1,285 @@
+package docker_registry
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-units"
+
+	"github.com/flant/go-containerregistry/pkg/authn"
+	"github.com/flant/go-containerregistry/pkg/name"
+	v1 "github.com/flant/go-containerregistry/pkg/v1"
+	"github.com/flant/go-containerregistry/pkg/v1/remote"
+	"github.com/flant/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/flant/go-containerregistry/pkg/v1/tarball"
+	"github.com/flant/logboek"
+)
+
+const (
+	DefaultPushParallelLayers = 5
+	DefaultPushMaxAttempts    = 5
+	DefaultPushRetryDelay     = 5 * time.Second
+)
+
+type PushOptions struct {
+	// ParallelLayers limits the number of concurrently uploaded layers, 0 means no limit
+	ParallelLayers int
+	// MountFrom is the repository in the same registry to mount already uploaded blobs from
+	MountFrom string
+	// MaxAttempts is the number of push attempts on temporary errors
+	MaxAttempts int
+	RetryDelay  time.Duration
+}
+
+// PushImageArchive pushes the image from the docker save archive (e.g. saved from the local docker daemon) and returns the manifest digest
+func PushImageArchive(archivePath, reference string, opts PushOptions) (string, error) {
+	img, err := tarball.ImageFromPath(archivePath, nil)
+	if err != nil {
+		return "", fmt.Errorf("reading image archive %s: %s", archivePath, err)
+	}
+
+	return PushImage(img, reference, opts)
+}
+
+// PushImage pushes the image layers, config and manifest with the registry API and returns the manifest digest
+func PushImage(img v1.Image, reference string, opts PushOptions) (string, error) {
+	ref, err := name.ParseReference(reference, parseReferenceOptions()...)
+	if err != nil {
+		return "", fmt.Errorf("parsing reference %q: %v", reference, err)
+	}
+
+	pushImg := &pushImage{Image: img, sem: newSemaphore(opts.ParallelLayers), streamedLayers: map[string]*pushLayerReader{}}
+
+	if opts.MountFrom != "" {
+		// mounting uses only the repository of the reference
+		mountRef, err := name.NewTag(fmt.Sprintf("%s:latest", opts.MountFrom), parseReferenceOptions()...)
+		if err != nil {
+			return "", fmt.Errorf("parsing mount repository %q: %v", opts.MountFrom, err)
+		}
+
+		if mountRef.Context().RegistryStr() == ref.Context().RegistryStr() && mountRef.Context().RepositoryStr() != ref.Context().RepositoryStr() {
+			pushImg.mountRef = mountRef
+		}
+	}
+
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = remote.Write(ref, pushImg, remote.WithAuthFromKeychain(authn.DefaultKeychain), remote.WithTransport(&pushTransport{RoundTripper: getHttpTransport(), image: pushImg}))
+		if err == nil {
+			break
+		}
+
+		if attempt >= maxAttempts || !isTemporaryPushError(err) {
+			return "", fmt.Errorf("pushing image %q: %v", ref, err)
+		}
+
+		logboek.LogErrorF("Push failed: %s\n", err)
+		logboek.LogInfoF("Retrying in %s (%d/%d) ...\n", opts.RetryDelay, attempt, maxAttempts-1)
+		time.Sleep(opts.RetryDelay)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return "", err
+	}
+
+	return digest.String(), nil
+}
+
+func isTemporaryPushError(err error) bool {
+	switch e := err.(type) {
+	case *transport.Error:
+		return e.Temporary()
+	case net.Error:
+		if e.Timeout() || e.Temporary() {
+			return true
+		}
+	}
+
+	specificErrors := []string{
+		"Client.Timeout exceeded while awaiting headers",
+		"TLS handshake timeout",
+		"i/o timeout",
+		"connection reset by peer",
+		"unexpected EOF",
+		"unsupported status code 5",
+	}
+
+	for _, specificError := range specificErrors {
+		if strings.Contains(err.Error(), specificError) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pushImage limits concurrent layers uploads, reports uploaded layers and makes layers mountable from the other repository
+type pushImage struct {
+	v1.Image
+
+	mountRef name.Reference
+	sem      chan struct{}
+
+	// streamedLayers are layers with the streamed blob waiting for the commit request by the layer digest
+	streamedLayers map[string]*pushLayerReader
+	mutex          sync.Mutex
+}
+
+func (i *pushImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []v1.Layer
+	for _, l := range layers {
+		var layer v1.Layer = &pushLayer{Layer: l, image: i}
+		if i.mountRef != nil {
+			layer = &remote.MountableLayer{Layer: layer, Reference: i.mountRef}
+		}
+
+		res = append(res, layer)
+	}
+
+	return res, nil
+}
+
+func (i *pushImage) acquire() {
+	if i.sem != nil {
+		i.sem <- struct{}{}
+	}
+}
+
+func (i *pushImage) release() {
+	if i.sem != nil {
+		<-i.sem
+	}
+}
+
+func (i *pushImage) setStreamedLayer(r *pushLayerReader) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.streamedLayers[r.digest] = r
+}
+
+func (i *pushImage) popStreamedLayer(digest string) *pushLayerReader {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	r := i.streamedLayers[digest]
+	delete(i.streamedLayers, digest)
+
+	return r
+}
+
+type pushLayer struct {
+	v1.Layer
+
+	image *pushImage
+}
+
+func (l *pushLayer) Compressed() (io.ReadCloser, error) {
+	digest, err := l.Layer.Digest()
+	if err != nil {
+		return nil, err
+	}
+
+	l.image.acquire()
+
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		l.image.release()
+		return nil, err
+	}
+
+	return &pushLayerReader{ReadCloser: rc, layer: l, digest: digest.String()}, nil
+}
+
+// pushLayerReader holds the upload slot of the layer until the blob upload is finished
+type pushLayerReader struct {
+	io.ReadCloser
+
+	layer    *pushLayer
+	digest   string
+	size     int64
+	finished sync.Once
+}
+
+func (r *pushLayerReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *pushLayerReader) finish(uploaded bool) {
+	r.finished.Do(func() {
+		defer r.layer.image.release()
+
+		if uploaded {
+			r.layer.image.mutex.Lock()
+			logboek.LogInfoF("Layer %s uploaded (%s)\n", r.digest, units.HumanSize(float64(r.size)))
+			r.layer.image.mutex.Unlock()
+		}
+	})
+}
+
+// pushTransport finishes the layer upload when the registry responds to the blob commit request:
+// the request body is closed as soon as it is sent, so the body reader cannot tell that the upload is over
+type pushTransport struct {
+	http.RoundTripper
+
+	image *pushImage
+}
+
+func (t *pushTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodPatch:
+		r, ok := req.Body.(*pushLayerReader)
+		if !ok {
+			break
+		}
+
+		resp, err := t.RoundTripper.RoundTrip(req)
+		if err != nil || resp.StatusCode >= http.StatusMultipleChoices || resp.Header.Get("Location") == "" {
+			// the blob will not be committed
+			r.finish(false)
+		} else {
+			t.image.setStreamedLayer(r)
+		}
+
+		return resp, err
+	case http.MethodPut:
+		digest := req.URL.Query().Get("digest")
+		if digest == "" {
+			break
+		}
+
+		resp, err := t.RoundTripper.RoundTrip(req)
+		if r := t.image.popStreamedLayer(digest); r != nil {
+			r.finish(err == nil && resp.StatusCode == http.StatusCreated)
+		}
+
+		return resp, err
+	}
+
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func newSemaphore(size int) chan struct{} {
+	if size <= 0 {
+		return nil
+	}
+
+	return make(chan struct{}, size)
+}
@@ -0,0 +1,142 @@
+package docker_registry
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flant/go-containerregistry/pkg/registry"
+	v1 "github.com/flant/go-containerregistry/pkg/v1"
+	"github.com/flant/go-containerregistry/pkg/v1/random"
+)
+
+// uploadsCounter counts concurrent layer blob uploads passed to the registry handler:
+// the upload lasts from the blob streaming request until the commit request is handled
+type uploadsCounter struct {
+	handler http.Handler
+
+	// configDigest is the config blob, which upload is not limited
+	configDigest string
+	// commitDelay keeps the uploads open, so the slot freed before the commit would be counted
+	commitDelay time.Duration
+
+	mutex     sync.Mutex
+	uploads   map[string]bool
+	max       int
+	failFirst int
+}
+
+func (c *uploadsCounter) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if strings.Contains(req.URL.Path, "/blobs/uploads/") {
+		switch {
+		case req.Method == http.MethodPatch:
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				resp.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			c.mutex.Lock()
+			if c.failFirst > 0 {
+				c.failFirst--
+				c.mutex.Unlock()
+				resp.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			if digest, _, err := v1.SHA256(bytes.NewReader(body)); err == nil && digest.String() != c.configDigest {
+				if c.uploads == nil {
+					c.uploads = map[string]bool{}
+				}
+
+				c.uploads[req.URL.Path] = true
+				if len(c.uploads) > c.max {
+					c.max = len(c.uploads)
+				}
+			}
+			c.mutex.Unlock()
+		case req.Method == http.MethodPut && req.URL.Query().Get("digest") != "":
+			time.Sleep(c.commitDelay)
+
+			defer func() {
+				c.mutex.Lock()
+				delete(c.uploads, req.URL.Path)
+				c.mutex.Unlock()
+			}()
+		}
+	}
+
+	c.handler.ServeHTTP(resp, req)
+}
+
+func TestPushImage(t *testing.T) {
+	img, err := random.Image(1024, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configDigest, err := img.ConfigName()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter := &uploadsCounter{handler: registry.New(), configDigest: configDigest.String(), commitDelay: 50 * time.Millisecond}
+	server := httptest.NewServer(counter)
+	defer server.Close()
+
+	reference := fmt.Sprintf("%s/project/app:v1", strings.TrimPrefix(server.URL, "http://"))
+	digest, err := PushImage(img, reference, PushOptions{ParallelLayers: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expectedDigest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if digest != expectedDigest.String() {
+		t.Errorf("\n[EXPECTED]: %s\n[GOT]: %s", expectedDigest, digest)
+	}
+
+	repoDigest, err := ImageDigest(reference)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if repoDigest != digest {
+		t.Errorf("\n[EXPECTED]: %s\n[GOT]: %s", digest, repoDigest)
+	}
+
+	if counter.max > 2 {
+		t.Errorf("expected at most 2 parallel layer uploads, got %d", counter.max)
+	}
+}
+
+func TestPushImageRetries(t *testing.T) {
+	counter := &uploadsCounter{handler: registry.New(), failFirst: 4}
+	server := httptest.NewServer(counter)
+	defer server.Close()
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reference := fmt.Sprintf("%s/project/app:v1", strings.TrimPrefix(server.URL, "http://"))
+
+	if _, err := PushImage(img, reference, PushOptions{MaxAttempts: 1}); err == nil {
+		t.Fatalf("expected error without retries")
+	}
+
+	if _, err := PushImage(img, reference, PushOptions{MaxAttempts: 3}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
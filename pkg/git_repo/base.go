@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/bmatcuk/doublestar"
 	"github.com/flant/logboek"
@@ -340,6 +341,25 @@ func (repo *Base) isCommitExists(repoPath, gitDir string, commit string) (bool,
 	return true, nil
 }
 
+func (repo *Base) commitTime(repoPath, commit string) (time.Time, error) {
+	repository, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot open repo `%s`: %s", repoPath, err)
+	}
+
+	commitHash, err := newHash(commit)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad commit hash `%s`: %s", commit, err)
+	}
+
+	commitObj, err := repository.CommitObject(commitHash)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad commit `%s`: %s", commit, err)
+	}
+
+	return commitObj.Committer.When, nil
+}
+
 func (repo *Base) tagsList(repoPath string) ([]string, error) {
 	repository, err := git.PlainOpen(repoPath)
 	if err != nil {
@@ -404,6 +424,51 @@ func (repo *Base) remoteBranchesList(repoPath string) ([]string, error) {
 	return res, nil
 }
 
+// referencesCommits returns commits that remote branches and tags point to
+func (repo *Base) referencesCommits(repoPath string) ([]string, error) {
+	repository, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open repo `%s`: %s", repoPath, err)
+	}
+
+	references, err := repository.References()
+	if err != nil {
+		return nil, err
+	}
+
+	remoteBranchPrefix := "refs/remotes/origin/"
+
+	res := make([]string, 0)
+	err = references.ForEach(func(r *plumbing.Reference) error {
+		if r.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		refName := r.Name().String()
+		switch {
+		case strings.HasPrefix(refName, remoteBranchPrefix):
+			res = append(res, r.Hash().String())
+		case r.Name().IsTag():
+			obj, err := repository.TagObject(r.Hash())
+			switch err {
+			case nil:
+				res = append(res, obj.Target.String())
+			case plumbing.ErrObjectNotFound:
+				res = append(res, r.Hash().String())
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (repo *Base) checksum(repoPath, gitDir, workTreeCacheDir string, opts ChecksumOptions) (Checksum, error) {
 	repository, err := git.PlainOpen(repoPath)
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/flant/werf/pkg/util"
 
@@ -63,6 +64,10 @@ func (repo *Local) IsCommitExists(commit string) (bool, error) {
 	return repo.isCommitExists(repo.Path, repo.GitDir, commit)
 }
 
+func (repo *Local) CommitTime(commit string) (time.Time, error) {
+	return repo.commitTime(repo.Path, commit)
+}
+
 func (repo *Local) TagsList() ([]string, error) {
 	return repo.tagsList(repo.Path)
 }
@@ -71,6 +76,10 @@ func (repo *Local) RemoteBranchesList() ([]string, error) {
 	return repo.remoteBranchesList(repo.Path)
 }
 
+func (repo *Local) ReferencesCommits() ([]string, error) {
+	return repo.referencesCommits(repo.Path)
+}
+
 func (repo *Local) getRepoWorkTreeCacheDir() string {
 	absPath, err := filepath.Abs(repo.Path)
 	if err != nil {
@@ -314,3 +314,7 @@ func (repo *Remote) TagsList() ([]string, error) {
 func (repo *Remote) RemoteBranchesList() ([]string, error) {
 	return repo.remoteBranchesList(repo.GetClonePath())
 }
+
+func (repo *Remote) ReferencesCommits() ([]string, error) {
+	return repo.referencesCommits(repo.GetClonePath())
+}
@@ -16,6 +16,9 @@ const (
 	WerfImportLabelPrefix = "werf-import-"
 
 	WerfTagStrategyLabel = "werf-tag-strategy"
+	WerfGitTagLabel      = "werf-git-tag"
+	WerfGitCommitLabel   = "werf-git-commit"
+	WerfProtectedLabel   = "werf.io/protected"
 
 	BuildCacheVersion = "1"
 
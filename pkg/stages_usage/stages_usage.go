@@ -0,0 +1,145 @@
+// Package stages_usage stores the time each local stage was last used by the conveyor (built or used as cache).
+// The index is used by the stages cleanup to evict the least recently used stages
+package stages_usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/werf"
+)
+
+const indexVersion = "1"
+
+type index struct {
+	Stages map[string]time.Time `json:"stages"`
+}
+
+// Touch records the current time as the last usage time of the stages
+func Touch(projectName string, signatures ...string) error {
+	if len(signatures) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	return update(projectName, func(idx *index) {
+		for _, signature := range signatures {
+			idx.Stages[signature] = now
+		}
+	})
+}
+
+// LastUsed returns last usage times by stages signatures, stages that have never been recorded are absent
+func LastUsed(projectName string) (map[string]time.Time, error) {
+	var res map[string]time.Time
+	if err := shluz.WithLock(lockName(projectName), shluz.LockOptions{Timeout: time.Second * 600}, func() error {
+		idx, err := read(projectName)
+		if err != nil {
+			return err
+		}
+
+		res = idx.Stages
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Prune forgets the stages, which are not in the list of the existing stages
+func Prune(projectName string, existingSignatures []string) error {
+	existing := map[string]bool{}
+	for _, signature := range existingSignatures {
+		existing[signature] = true
+	}
+
+	return update(projectName, func(idx *index) {
+		for signature := range idx.Stages {
+			if !existing[signature] {
+				delete(idx.Stages, signature)
+			}
+		}
+	})
+}
+
+func update(projectName string, f func(idx *index)) error {
+	return shluz.WithLock(lockName(projectName), shluz.LockOptions{Timeout: time.Second * 600}, func() error {
+		idx, err := read(projectName)
+		if err != nil {
+			return err
+		}
+
+		f(idx)
+
+		return write(projectName, idx)
+	})
+}
+
+func read(projectName string) (*index, error) {
+	idx := &index{Stages: map[string]time.Time{}}
+
+	data, err := ioutil.ReadFile(indexPath(projectName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return idx, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("bad stages usage index %s: %s", indexPath(projectName), err)
+	}
+
+	if idx.Stages == nil {
+		idx.Stages = map[string]time.Time{}
+	}
+
+	return idx, nil
+}
+
+// write replaces the index file atomically, thus readers without the lock never see the partially written index
+func write(projectName string, idx *index) error {
+	path := indexPath(projectName)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), path)
+}
+
+func indexPath(projectName string) string {
+	return filepath.Join(werf.GetServiceDir(), "stages_usage", indexVersion, fmt.Sprintf("%s.json", projectName))
+}
+
+func lockName(projectName string) string {
+	return fmt.Sprintf("stages-usage.%s", projectName)
+}
@@ -0,0 +1,72 @@
+package stages_usage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/werf"
+)
+
+func TestStagesUsage(t *testing.T) {
+	homeDir, err := ioutil.TempDir("", "werf-stages-usage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(homeDir)
+
+	if err := werf.Init("", homeDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := shluz.Init(filepath.Join(werf.GetServiceDir(), "locks")); err != nil {
+		t.Fatal(err)
+	}
+
+	lastUsed, err := LastUsed("project")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(lastUsed) != 0 {
+		t.Errorf("expected empty index, got %v", lastUsed)
+	}
+
+	before := time.Now().Add(-time.Second)
+	if err := Touch("project", "sig-1", "sig-2", "sig-3"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := Touch("other-project", "sig-4"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := Prune("project", []string{"sig-1", "sig-3", "sig-5"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	lastUsed, err = LastUsed("project")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var signatures []string
+	for signature, usedAt := range lastUsed {
+		signatures = append(signatures, signature)
+
+		if usedAt.Before(before) {
+			t.Errorf("%s: unexpected last usage time %s", signature, usedAt)
+		}
+	}
+	sort.Strings(signatures)
+
+	if expected := []string{"sig-1", "sig-3"}; !reflect.DeepEqual(signatures, expected) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, signatures)
+	}
+}
@@ -0,0 +1,89 @@
+package tag_strategy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+const SemverLatestTag = "latest"
+
+var (
+	semverFullVersionRegex  = regexp.MustCompile(`^v?[0-9]+\.[0-9]+\.[0-9]+([-+].*)?$`)
+	semverFloatingTagRegex  = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+	semverMetadataSeparator = "_"
+)
+
+// ParseSemverGitTag parses git tag (e.g. v1.4.2) with the full semantic version
+func ParseSemverGitTag(gitTag string) (*semver.Version, error) {
+	if !semverFullVersionRegex.MatchString(gitTag) {
+		return nil, fmt.Errorf("git tag '%s' is not a semantic version MAJOR.MINOR.PATCH (optionally prefixed with v)", gitTag)
+	}
+
+	return semver.NewVersion(gitTag)
+}
+
+// SemverVersionTag returns docker tag for the full version: without v prefix, build metadata separator + is replaced with _
+func SemverVersionTag(version *semver.Version) string {
+	return strings.Replace(version.String(), "+", semverMetadataSeparator, -1)
+}
+
+// IsSemverFloatingTag reports whether the tag is moved by git-semver tagging strategy (MAJOR, MAJOR.MINOR or latest)
+func IsSemverFloatingTag(tag string) bool {
+	return tag == SemverLatestTag || semverFloatingTagRegex.MatchString(tag)
+}
+
+// SemverTags returns tags for git-semver tagging strategy: the full version (1.4.2) and floating tags MAJOR.MINOR (1.4), MAJOR (1) and latest.
+// Floating tag is returned only when the version is the highest in the line among already published full versions.
+// Prerelease version is published only with the full version tag.
+func SemverTags(gitTag string, existingTags []string) ([]string, error) {
+	version, err := ParseSemverGitTag(gitTag)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{SemverVersionTag(version)}
+	if version.Prerelease() != "" {
+		return tags, nil
+	}
+
+	isHighestMinor, isHighestMajor, isHighest := true, true, true
+	for _, existingTag := range existingTags {
+		// the build metadata separator of the published tag is reverted before matching, e.g. 1.4.3_build.1 is 1.4.3+build.1
+		existingVersionTag := strings.Replace(existingTag, semverMetadataSeparator, "+", -1)
+		if IsSemverFloatingTag(existingTag) || !semverFullVersionRegex.MatchString(existingVersionTag) {
+			continue
+		}
+
+		existingVersion, err := semver.NewVersion(existingVersionTag)
+		if err != nil || existingVersion.Prerelease() != "" || !existingVersion.GreaterThan(version) {
+			continue
+		}
+
+		isHighest = false
+
+		if existingVersion.Major() == version.Major() {
+			isHighestMajor = false
+
+			if existingVersion.Minor() == version.Minor() {
+				isHighestMinor = false
+			}
+		}
+	}
+
+	if isHighestMinor {
+		tags = append(tags, fmt.Sprintf("%d.%d", version.Major(), version.Minor()))
+	}
+
+	if isHighestMajor {
+		tags = append(tags, fmt.Sprintf("%d", version.Major()))
+	}
+
+	if isHighest {
+		tags = append(tags, SemverLatestTag)
+	}
+
+	return tags, nil
+}
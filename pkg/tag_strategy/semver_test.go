@@ -0,0 +1,83 @@
+package tag_strategy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSemverTags(t *testing.T) {
+	tests := []struct {
+		name         string
+		gitTag       string
+		existingTags []string
+		result       []string
+	}{
+		{
+			name:   "firstVersion",
+			gitTag: "v1.4.2",
+			result: []string{"1.4.2", "1.4", "1", "latest"},
+		},
+		{
+			name:         "highestVersion",
+			gitTag:       "v1.4.2",
+			existingTags: []string{"1.4.1", "1.4", "1", "latest", "0.9.0"},
+			result:       []string{"1.4.2", "1.4", "1", "latest"},
+		},
+		{
+			name:         "patchOfOldMinor",
+			gitTag:       "v1.3.5",
+			existingTags: []string{"1.3.4", "1.4.2", "1.4", "1.3", "1", "latest"},
+			result:       []string{"1.3.5", "1.3"},
+		},
+		{
+			name:         "patchOfOldMajor",
+			gitTag:       "1.5.1",
+			existingTags: []string{"1.5.0", "2.0.0"},
+			result:       []string{"1.5.1", "1.5", "1"},
+		},
+		{
+			name:         "prereleaseIsIgnoredInComparison",
+			gitTag:       "v1.4.2",
+			existingTags: []string{"2.0.0-rc.1", "branch-master"},
+			result:       []string{"1.4.2", "1.4", "1", "latest"},
+		},
+		{
+			name:         "prerelease",
+			gitTag:       "v2.0.0-rc.1",
+			existingTags: []string{"1.4.2"},
+			result:       []string{"2.0.0-rc.1"},
+		},
+		{
+			name:         "existingVersionWithMetadata",
+			gitTag:       "v1.4.2",
+			existingTags: []string{"1.4.3_build.1", "1.4", "1", "latest"},
+			result:       []string{"1.4.2"},
+		},
+		{
+			name:   "metadata",
+			gitTag: "v1.0.0+build.5",
+			result: []string{"1.0.0_build.5", "1.0", "1", "latest"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := SemverTags(test.gitTag, test.existingTags)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(result, test.result) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", test.result, result)
+			}
+		})
+	}
+}
+
+func TestSemverTagsBadGitTag(t *testing.T) {
+	for _, gitTag := range []string{"release", "v1.4", "1"} {
+		if _, err := SemverTags(gitTag, nil); err == nil {
+			t.Errorf("expected error for git tag %s", gitTag)
+		}
+	}
+}
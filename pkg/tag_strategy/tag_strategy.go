@@ -7,4 +7,7 @@ const (
 	GitTag    TagStrategy = "git-tag"
 	GitBranch TagStrategy = "git-branch"
 	GitCommit TagStrategy = "git-commit"
+	GitSemver TagStrategy = "git-semver"
+
+	StagesSignature TagStrategy = "stages-signature"
 )
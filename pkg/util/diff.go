@@ -0,0 +1,133 @@
+package util
+
+import "fmt"
+
+type diffLine struct {
+	op   byte
+	line string
+	// aPos and bPos are the indexes of the line in a and b, or the indexes the line would be inserted at
+	aPos, bPos int
+}
+
+// UnifiedDiff returns hunks of the unified diff from a to b with contextLines unchanged lines around changes.
+// Each hunk starts with the "@@ -aStart,aCount +bStart,bCount @@" header followed by the lines prefixed with " ", "-" or "+".
+// No hunks are returned if a and b are equal
+func UnifiedDiff(a, b []string, contextLines int) []string {
+	lines := diffLines(a, b)
+
+	var changes []int
+	for ind, l := range lines {
+		if l.op != ' ' {
+			changes = append(changes, ind)
+		}
+	}
+
+	var result []string
+	for ind := 0; ind < len(changes); {
+		start := changes[ind] - contextLines
+		if start < 0 {
+			start = 0
+		}
+
+		end := changes[ind] + contextLines
+		for ind++; ind < len(changes) && changes[ind]-contextLines <= end+1; ind++ {
+			end = changes[ind] + contextLines
+		}
+
+		if end >= len(lines) {
+			end = len(lines) - 1
+		}
+
+		result = append(result, diffHunk(lines[start:end+1])...)
+	}
+
+	return result
+}
+
+func diffHunk(lines []diffLine) []string {
+	var aCount, bCount int
+	var hunkLines []string
+	for _, l := range lines {
+		if l.op != '+' {
+			aCount++
+		}
+
+		if l.op != '-' {
+			bCount++
+		}
+
+		hunkLines = append(hunkLines, string(l.op)+l.line)
+	}
+
+	aStart, bStart := lines[0].aPos+1, lines[0].bPos+1
+	if aCount == 0 {
+		aStart--
+	}
+
+	if bCount == 0 {
+		bStart--
+	}
+
+	header := fmt.Sprintf("@@ -%d,%d +%d,%d @@", aStart, aCount, bStart, bCount)
+
+	return append([]string{header}, hunkLines...)
+}
+
+// diffLines makes the edit script by the longest common subsequence of the lines, the common prefix and suffix are not included in the table
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	aMiddle, bMiddle := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	lcs := make([][]int, len(aMiddle)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bMiddle)+1)
+	}
+
+	for i := len(aMiddle) - 1; i >= 0; i-- {
+		for j := len(bMiddle) - 1; j >= 0; j-- {
+			if aMiddle[i] == bMiddle[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, diffLine{op: ' ', line: a[i], aPos: i, bPos: i})
+	}
+
+	i, j := 0, 0
+	for i < len(aMiddle) || j < len(bMiddle) {
+		switch {
+		case i < len(aMiddle) && j < len(bMiddle) && aMiddle[i] == bMiddle[j]:
+			lines = append(lines, diffLine{op: ' ', line: aMiddle[i], aPos: prefix + i, bPos: prefix + j})
+			i++
+			j++
+		case j == len(bMiddle) || (i < len(aMiddle) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{op: '-', line: aMiddle[i], aPos: prefix + i, bPos: prefix + j})
+			i++
+		default:
+			lines = append(lines, diffLine{op: '+', line: bMiddle[j], aPos: prefix + i, bPos: prefix + j})
+			j++
+		}
+	}
+
+	for k := 0; k < suffix; k++ {
+		lines = append(lines, diffLine{op: ' ', line: a[len(a)-suffix+k], aPos: len(a) - suffix + k, bPos: len(b) - suffix + k})
+	}
+
+	return lines
+}
@@ -0,0 +1,43 @@
+package util_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/werf/pkg/util"
+)
+
+func diffTestLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, "\n")
+}
+
+var _ = DescribeTable("unified diff",
+	func(a, b string, contextLines int, expected []string) {
+		Ω(util.UnifiedDiff(diffTestLines(a), diffTestLines(b), contextLines)).Should(Equal(expected))
+	},
+	Entry("equal", "a\nb\nc", "a\nb\nc", 3, []string(nil)),
+	Entry("created", "", "a\nb", 3, []string{"@@ -0,0 +1,2 @@", "+a", "+b"}),
+	Entry("deleted", "a\nb", "", 3, []string{"@@ -1,2 +0,0 @@", "-a", "-b"}),
+	Entry("modified with context",
+		"a\nb\nc\nd\ne\nf\ng", "a\nb\nc\nD\ne\nf\ng", 1,
+		[]string{"@@ -3,3 +3,3 @@", " c", "-d", "+D", " e"},
+	),
+	Entry("separate hunks",
+		"a\nb\nc\nd\ne\nf\ng\nh", "A\nb\nc\nd\ne\nf\ng\nH", 1,
+		[]string{"@@ -1,2 +1,2 @@", "-a", "+A", " b", "@@ -7,2 +7,2 @@", " g", "-h", "+H"},
+	),
+	Entry("merged hunks",
+		"a\nb\nc\nd", "A\nb\nc\nD", 1,
+		[]string{"@@ -1,4 +1,4 @@", "-a", "+A", " b", " c", "-d", "+D"},
+	),
+	Entry("inserted line",
+		"a\nb\nc", "a\nb\nx\nc", 1,
+		[]string{"@@ -2,2 +2,3 @@", " b", "+x", " c"},
+	),
+)
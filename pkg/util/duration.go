@@ -0,0 +1,33 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDuration parses go duration (e.g. 12h or 90m) or the number of days (e.g. 30d)
+func ParseDuration(value string) (time.Duration, error) {
+	var duration time.Duration
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.ParseUint(strings.TrimSuffix(value, "d"), 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("expected number of days (e.g. 30d) or go duration (e.g. 72h)")
+		}
+
+		duration = time.Duration(days) * 24 * time.Hour
+	} else {
+		var err error
+		duration, err = time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("expected number of days (e.g. 30d) or go duration (e.g. 72h)")
+		}
+	}
+
+	if duration < 0 {
+		return 0, fmt.Errorf("duration should be non-negative")
+	}
+
+	return duration, nil
+}
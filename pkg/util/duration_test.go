@@ -0,0 +1,31 @@
+package util_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/werf/pkg/util"
+)
+
+var _ = DescribeTable("parse duration",
+	func(value string, expected time.Duration) {
+		duration, err := util.ParseDuration(value)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(duration).Should(Equal(expected))
+	},
+	Entry("days", "14d", 14*24*time.Hour),
+	Entry("go duration", "1h30m", 90*time.Minute),
+	Entry("zero", "0d", time.Duration(0)),
+)
+
+var _ = DescribeTable("parse bad duration",
+	func(value string) {
+		_, err := util.ParseDuration(value)
+		Ω(err).Should(HaveOccurred())
+	},
+	Entry("word", "month"),
+	Entry("negative days", "-1d"),
+	Entry("negative go duration", "-1h"),
+)
@@ -0,0 +1,19 @@
+package util
+
+// FilesystemUsage of the filesystem containing the path
+type FilesystemUsage struct {
+	TotalBytes     uint64
+	AvailableBytes uint64
+}
+
+func (u *FilesystemUsage) UsedBytes() uint64 {
+	return u.TotalBytes - u.AvailableBytes
+}
+
+func (u *FilesystemUsage) UsedPercentage() float64 {
+	if u.TotalBytes == 0 {
+		return 0
+	}
+
+	return float64(u.UsedBytes()) / float64(u.TotalBytes) * 100
+}
@@ -0,0 +1,19 @@
+// +build linux darwin
+
+package util
+
+import (
+	"syscall"
+)
+
+func GetFilesystemUsage(path string) (*FilesystemUsage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return nil, err
+	}
+
+	return &FilesystemUsage{
+		TotalBytes:     uint64(stat.Blocks) * uint64(stat.Bsize),
+		AvailableBytes: uint64(stat.Bavail) * uint64(stat.Bsize),
+	}, nil
+}
@@ -0,0 +1,11 @@
+// +build windows
+
+package util
+
+import (
+	"fmt"
+)
+
+func GetFilesystemUsage(path string) (*FilesystemUsage, error) {
+	return nil, fmt.Errorf("filesystem usage is not supported on windows")
+}
@@ -0,0 +1,21 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParsePercentage parses the percentage with or without the percent sign (e.g. 70% or 70)
+func ParsePercentage(value string) (float64, error) {
+	percentage, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("expected percentage (e.g. 70%%)")
+	}
+
+	if percentage < 0 || percentage > 100 {
+		return 0, fmt.Errorf("percentage should be in range from 0 to 100")
+	}
+
+	return percentage, nil
+}
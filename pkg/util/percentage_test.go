@@ -0,0 +1,29 @@
+package util_test
+
+import (
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/werf/pkg/util"
+)
+
+var _ = DescribeTable("parse percentage",
+	func(value string, expected float64) {
+		percentage, err := util.ParsePercentage(value)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(percentage).Should(Equal(expected))
+	},
+	Entry("with percent sign", "70%", float64(70)),
+	Entry("without percent sign", "60", float64(60)),
+	Entry("fraction", "12.5%", 12.5),
+)
+
+var _ = DescribeTable("parse bad percentage",
+	func(value string) {
+		_, err := util.ParsePercentage(value)
+		Ω(err).Should(HaveOccurred())
+	},
+	Entry("word", "half"),
+	Entry("negative", "-1%"),
+	Entry("more than hundred", "101%"),
+)